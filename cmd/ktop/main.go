@@ -10,8 +10,14 @@ import (
 	"time"
 
 	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/cost"
+	"github.com/nlaak/ktop/internal/demo"
+	"github.com/nlaak/ktop/internal/doctor"
 	"github.com/nlaak/ktop/internal/k8s"
 	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+	"github.com/nlaak/ktop/internal/plan"
+	"github.com/nlaak/ktop/internal/rightsize"
 	"github.com/nlaak/ktop/internal/ui"
 )
 
@@ -24,11 +30,27 @@ func safePct(used, capacity int64) float64 {
 
 func main() {
 	// Parse configuration
+	config.KeyboardHelp = ui.KeyboardHelp
 	cfg := config.NewConfig()
 	if err := cfg.ParseFlags(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if err := ui.ValidateConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Check the pod shape of ktop plan before connecting
+	var shape plan.Shape
+	if cfg.Command == "plan" {
+		var err error
+		shape, err = plan.ParseShape(cfg.PlanCPU, cfg.PlanMemory, cfg.PlanReplicas, cfg.NodeSelector, cfg.PlanTolerations)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// Handle version flag
 	if cfg.ShowVersion {
@@ -52,38 +74,50 @@ func main() {
 		cancel()
 	}()
 
-	// Initialize Kubernetes client
-	fmt.Println("Connecting to Kubernetes cluster...")
-	client, err := k8s.NewClient(cfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to cluster: %v\n", err)
-		fmt.Fprintf(os.Stderr, "\nMake sure:\n")
-		fmt.Fprintf(os.Stderr, "  - Your kubeconfig is valid (default: ~/.kube/config)\n")
-		fmt.Fprintf(os.Stderr, "  - The cluster is accessible\n")
-		fmt.Fprintf(os.Stderr, "  - You have permission to access cluster resources\n")
-		os.Exit(1)
+	// Fleet mode: one collector per context, connected lazily by the TUI
+	if cfg.FleetMode() {
+		runFleet(cfg)
+		return
 	}
 
-	// Check if metrics API is available
-	checkCtx, checkCancel := context.WithTimeout(ctx, 5*time.Second)
-	defer checkCancel()
-	
-	if err := client.CheckMetricsAPIAvailable(checkCtx); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Metrics API not available: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Please ensure metrics-server is installed in your cluster.\n")
-		fmt.Fprintf(os.Stderr, "\nTo install metrics-server:\n")
-		fmt.Fprintf(os.Stderr, "  kubectl apply -f https://github.com/kubernetes-sigs/metrics-server/releases/latest/download/components.yaml\n")
-		fmt.Fprintf(os.Stderr, "\nFor MicroK8s:\n")
-		fmt.Fprintf(os.Stderr, "  microk8s enable metrics-server\n")
-		fmt.Fprintf(os.Stderr, "\nContinuing anyway (some features may not work)...\n")
-		time.Sleep(2 * time.Second)
+	var client *k8s.Client
+	var report *doctor.Report
+	if cfg.Demo {
+		// A simulated cluster always serves metrics-server usage
+		fmt.Fprintln(os.Stderr, "Starting demo cluster...")
+		cfg.MetricsSource = metrics.SourceMetricsServer
+		client = demo.New(demo.Options{Seed: time.Now().UnixNano()}).Client()
+	} else {
+		client, report = connect(ctx, cfg)
 	}
 
 	// Create metrics collector
 	collector := metrics.NewCollector(client, cfg)
+	if report != nil && report.Reachable {
+		collector.SetCapabilities(report.Capabilities)
+	}
+
+	if cfg.Command == "plan" {
+		runPlan(ctx, cfg, collector, shape)
+		return
+	}
+	if cfg.Command == "rightsize" {
+		runRightsize(ctx, cfg, collector)
+		return
+	}
 
 	// Handle --show flag: output JSON to stdout and exit
 	if cfg.ShowResource != "" {
+		kind := metrics.FilterKindPods
+		if cfg.ShowResource == "nodes" {
+			kind = metrics.FilterKindNodes
+		}
+		filter, err := metrics.ParseFilter(cfg.Filter, kind)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --filter: %v\n", err)
+			os.Exit(1)
+		}
+
 		collectCtx, collectCancel := context.WithTimeout(ctx, cfg.Timeout)
 		defer collectCancel()
 
@@ -132,9 +166,11 @@ func main() {
 				ReadyNodes:   clusterMetrics.ReadyNodes,
 			}
 		case "pods":
-			output = clusterMetrics.Pods
+			output = filter.Pods(clusterMetrics.Pods)
 		case "nodes":
-			output = clusterMetrics.Nodes
+			output = filter.Nodes(clusterMetrics.Nodes)
+		case "cost":
+			output = cost.Compute(clusterMetrics, &cfg.Pricing, cfg.Pricing.Basis)
 		}
 
 		enc := json.NewEncoder(os.Stdout)
@@ -152,9 +188,175 @@ func main() {
 	fmt.Println("Starting ktop...")
 
 	// Create and run the TUI application
-	app := ui.NewApp(collector, cfg)
+	app, err := ui.NewApp(collector, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	if err := app.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Application error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// runPlan simulates placing a pod shape on the cluster and prints the
+// report, exiting with status 1 when not every replica fits
+func runPlan(ctx context.Context, cfg *config.Config, collector *metrics.Collector, shape plan.Shape) {
+	collectCtx, collectCancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer collectCancel()
+	clusterMetrics, err := collector.Collect(collectCtx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to collect metrics: %v\n", err)
+		os.Exit(1)
+	}
+	if clusterMetrics.NodesForbidden {
+		fmt.Fprintf(os.Stderr, "Error: ktop plan needs permission to list nodes\n")
+		os.Exit(1)
+	}
+	if len(clusterMetrics.Namespaces) > 0 {
+		// Without cluster-wide access the collector fell back to the
+		// context's namespace, and the requests of other pods are unknown
+		fmt.Fprintf(os.Stderr, "Error: ktop plan needs permission to list pods in all namespaces\n")
+		os.Exit(1)
+	}
+
+	fmt.Println()
+	result := plan.Simulate(clusterMetrics.Nodes, shape)
+	result.Write(os.Stdout)
+	if result.Unplaced() > 0 {
+		os.Exit(1)
+	}
+}
+
+// runRightsize samples usage for the configured duration, or until
+// interrupted, and prints the right-sizing recommendations
+func runRightsize(ctx context.Context, cfg *config.Config, collector *metrics.Collector) {
+	fmt.Fprintf(os.Stderr, "Sampling usage for %s; press Ctrl+C to report early...\n", cfg.SampleDuration)
+	deadline := time.Now().Add(cfg.SampleDuration)
+	ticker := time.NewTicker(cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	var last *models.ClusterMetrics
+	for {
+		collectCtx, collectCancel := context.WithTimeout(ctx, cfg.Timeout)
+		clusterMetrics, err := collector.Collect(collectCtx)
+		collectCancel()
+		if err == nil {
+			last = clusterMetrics
+		} else if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if ctx.Err() != nil || !time.Now().Before(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	if last == nil {
+		fmt.Fprintf(os.Stderr, "Failed to collect metrics\n")
+		os.Exit(1)
+	}
+	// Include the history loaded from Prometheus, unless interrupted
+	collector.WaitBackfill(ctx)
+
+	report := rightsize.Compute(last.Pods, collector.History(), cfg.RightSizing)
+	var err error
+	switch cfg.Output {
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	case "csv":
+		err = report.WriteCSV(os.Stdout)
+	case "yaml":
+		err = report.WritePatch(os.Stdout)
+	default:
+		report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write recommendations: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runFleet runs the TUI across several kubeconfig contexts. A context whose
+// client cannot be created is still listed, with its error.
+func runFleet(cfg *config.Config) {
+	contexts := cfg.Contexts
+	if cfg.AllContexts {
+		var err error
+		contexts, err = k8s.ListContexts(cfg.KubeconfigPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(contexts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no kubeconfig contexts found\n")
+		os.Exit(1)
+	}
+
+	clusters := make([]ui.Cluster, 0, len(contexts))
+	for _, name := range contexts {
+		c := ui.Cluster{Context: name}
+		client, err := k8s.NewClientForContext(cfg, name)
+		if err != nil {
+			c.Err = err
+		} else {
+			c.Collector = metrics.NewCollector(client, cfg)
+		}
+		clusters = append(clusters, c)
+	}
+
+	fmt.Printf("Monitoring %d clusters\n", len(clusters))
+	fmt.Println("Starting ktop...")
+
+	app, err := ui.NewFleetApp(clusters, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := app.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Application error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// connect creates the Kubernetes client and runs the preflight checks,
+// exiting when the client cannot be created or for ktop doctor
+func connect(ctx context.Context, cfg *config.Config) (*k8s.Client, *doctor.Report) {
+	// Initialize Kubernetes client
+	fmt.Fprintln(os.Stderr, "Connecting to Kubernetes cluster...")
+	client, err := k8s.NewClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to cluster: %v\n", err)
+		fmt.Fprintf(os.Stderr, "\nMake sure:\n")
+		fmt.Fprintf(os.Stderr, "  - Your kubeconfig is valid (default: ~/.kube/config)\n")
+		fmt.Fprintf(os.Stderr, "  - The cluster is accessible\n")
+		fmt.Fprintf(os.Stderr, "  - You have permission to access cluster resources\n")
+		os.Exit(1)
+	}
+
+	// Run preflight checks
+	checkCtx, checkCancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer checkCancel()
+	report := doctor.Run(checkCtx, client, cfg.Namespaces)
+
+	if cfg.Command == "doctor" {
+		report.Write(os.Stdout)
+		if report.Failed() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Report problems briefly; optional features disable themselves
+	for _, check := range report.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", check.Name, check.Detail)
+	}
+	if len(report.Warnings()) > 0 {
+		fmt.Fprintf(os.Stderr, "Run 'ktop doctor' for details and remediation hints.\n")
+	}
+
+	return client, report
+}
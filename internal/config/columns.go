@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ColumnConfig selects and sizes one table column
+type ColumnConfig struct {
+	// Name identifies the column, e.g. "cpu", "age" or "label:team"
+	Name string `json:"name"`
+
+	// Header replaces the default column header
+	Header string `json:"header,omitempty"`
+
+	// Width is the maximum column width; 0 uses the column default
+	Width int `json:"width,omitempty"`
+}
+
+// Columns holds the column layout of each table. An empty list means the
+// built-in default layout; columns not listed are hidden.
+type Columns struct {
+	Nodes []ColumnConfig `json:"nodes,omitempty"`
+	Pods  []ColumnConfig `json:"pods,omitempty"`
+}
+
+// State holds settings changed from within the TUI. It is stored next to
+// the config file and takes precedence over it, so interactive changes
+// persist between sessions without rewriting the user's config.
+type State struct {
+	Columns *Columns `json:"columns,omitempty"`
+}
+
+// StatePath returns the location of the state file
+func (c *Config) StatePath() string {
+	if c.ConfigPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.ConfigPath), "state.yaml")
+}
+
+// LoadState applies the state file, if any, on top of the config
+func (c *Config) LoadState() error {
+	c.fileColumns = Columns{
+		Nodes: slices.Clone(c.Columns.Nodes),
+		Pods:  slices.Clone(c.Columns.Pods),
+	}
+	path := c.StatePath()
+	if path == "" {
+		return nil
+	}
+
+	state, err := readState(path)
+	if err != nil {
+		return err
+	}
+	if state.Columns != nil {
+		if len(state.Columns.Nodes) > 0 {
+			c.Columns.Nodes = state.Columns.Nodes
+		}
+		if len(state.Columns.Pods) > 0 {
+			c.Columns.Pods = state.Columns.Pods
+		}
+	}
+	return nil
+}
+
+// readState reads the state file; a missing file is an empty state
+func readState(path string) (*State, error) {
+	var state State
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &state, nil
+		}
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// FileColumns returns the column layout of the config file, which the
+// state file may override
+func (c *Config) FileColumns() Columns {
+	return c.fileColumns
+}
+
+// SaveColumns records the layout of the "nodes" or "pods" table, changed
+// in the TUI, in the state file. A nil layout removes the table from the
+// state, so that the config file applies to it again.
+func (c *Config) SaveColumns(table string, columns []ColumnConfig) error {
+	path := c.StatePath()
+	if path == "" {
+		return fmt.Errorf("no config directory available")
+	}
+	state, err := readState(path)
+	if err != nil {
+		return err
+	}
+	if state.Columns == nil {
+		state.Columns = &Columns{}
+	}
+	if table == "pods" {
+		state.Columns.Pods = columns
+	} else {
+		state.Columns.Nodes = columns
+	}
+	if len(state.Columns.Nodes) == 0 && len(state.Columns.Pods) == 0 {
+		state.Columns = nil
+	}
+
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // Version is set at build time via ldflags
@@ -27,19 +32,72 @@ const (
 
 	// MaxRefreshInterval is the maximum allowed refresh interval
 	MaxRefreshInterval = 60 * time.Second
+
+	// DefaultSampleDuration is how long ktop rightsize samples usage
+	DefaultSampleDuration = 5 * time.Minute
 )
 
+// KeyboardHelp renders the keyboard section of the usage message. The UI
+// sets it so the text is generated from the active key bindings.
+var KeyboardHelp func(c *Config) string
+
 // Config holds all configuration options for ktop
 type Config struct {
+	// Config file location (default: ~/.config/ktop/config.yaml)
+	ConfigPath string
+
 	// Kubernetes configuration
 	KubeconfigPath string
 	Context        string
 
+	// Namespaces scopes all pod calls; empty means cluster-wide, falling
+	// back to the context's namespace when that is forbidden
+	Namespaces []string
+
+	// Selectors restrict the pod and node lists and the usage calls
+	// server-side; empty selects everything
+	Selector      string // pod label selector
+	FieldSelector string // pod field selector, e.g. spec.nodeName=node-a
+	NodeSelector  string // node label selector
+
+	// MetricsSource selects where usage is read from: auto,
+	// metrics-server, kubelet or prometheus
+	MetricsSource string
+	Prometheus    PrometheusConfig
+
+	// Fleet mode: monitor several contexts at once
+	Contexts    []string
+	AllContexts bool
+
+	// Demo runs against a simulated cluster instead of a real one
+	Demo bool
+
 	// Display configuration
 	RefreshInterval time.Duration
 	Timeout         time.Duration
 	TopPods         int
 	AllNamespaces   bool
+	Thresholds      Thresholds
+
+	// Theme selects a built-in or config-file theme by name
+	Theme  string
+	Themes map[string]ThemeConfig
+
+	// Keys remaps UI actions to keys, e.g. "sort-pods": ["o"]
+	Keys map[string][]string
+
+	// Columns selects the columns of the nodes and pods tables
+	Columns Columns
+
+	// fileColumns is the layout of the config file, before the state
+	// file overrides it
+	fileColumns Columns
+
+	// GroupLabels are the node labels the nodes table and the heatmap can
+	// group nodes by, in the order the group key cycles through them;
+	// GroupBy is the one they start with, empty for none
+	GroupLabels []string
+	GroupBy     string
 
 	// Flags
 	ShowVersion bool
@@ -47,17 +105,50 @@ type Config struct {
 
 	// Show resource as JSON to stdout (resources, pods, nodes, or empty for TUI)
 	ShowResource string
+
+	// Filter expression applied to --show pods and --show nodes
+	Filter string
+
+	// Command is the subcommand to run ("doctor" or "plan"), or empty for
+	// the TUI
+	Command string
+
+	// Pod shape placed by ktop plan; NodeSelector restricts its nodes
+	PlanCPU         string
+	PlanMemory      string
+	PlanReplicas    int
+	PlanTolerations []string
+
+	// RightSizing tunes the recommendations; ktop rightsize samples usage
+	// for SampleDuration and prints them in Output format
+	RightSizing    RightSizingConfig
+	SampleDuration time.Duration
+	Output         string
+
+	// Pricing of the cost view and --show cost
+	Pricing PricingConfig
 }
 
 // NewConfig creates a new Config with default values
 func NewConfig() *Config {
 	return &Config{
+		ConfigPath:      defaultConfigFilePath(),
 		KubeconfigPath:  defaultKubeconfigPath(),
 		Context:         "",
 		RefreshInterval: DefaultRefreshInterval,
 		Timeout:         DefaultTimeout,
 		TopPods:         DefaultTopPods,
 		AllNamespaces:   false,
+		Thresholds:      DefaultResourceThresholds(),
+		Theme:           "dark",
+		MetricsSource:   "auto",
+		Prometheus:      DefaultPrometheusConfig(),
+		GroupLabels:     DefaultGroupLabels(),
+		PlanReplicas:    1,
+		RightSizing:     DefaultRightSizingConfig(),
+		SampleDuration:  DefaultSampleDuration,
+		Output:          "table",
+		Pricing:         DefaultPricingConfig(),
 		ShowVersion:     false,
 		ShowHelp:        false,
 	}
@@ -80,10 +171,58 @@ func defaultKubeconfigPath() string {
 
 // ParseFlags parses command-line flags and populates the config
 func (c *Config) ParseFlags() error {
+	// Subcommands come first: ktop doctor [options]
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "doctor" || args[0] == "plan" || args[0] == "rightsize") {
+		c.Command = args[0]
+		args = args[1:]
+	}
+
+	// Load the config file first so flags can override its values
+	if path, ok := configPathFromArgs(args); ok {
+		c.ConfigPath = path
+		if err := c.LoadFile(path, true); err != nil {
+			return err
+		}
+	} else if err := c.LoadFile(c.ConfigPath, false); err != nil {
+		return err
+	}
+	if err := c.LoadState(); err != nil {
+		return err
+	}
+
+	flag.StringVar(&c.ConfigPath, "config", c.ConfigPath,
+		"Path to config file")
 	flag.StringVar(&c.KubeconfigPath, "kubeconfig", c.KubeconfigPath,
 		"Path to kubeconfig file")
 	flag.StringVar(&c.Context, "context", c.Context,
 		"Kubernetes context to use (default: current context)")
+	namespaceFlag := func(s string) error {
+		c.Namespaces = append(c.Namespaces, splitList(s)...)
+		return nil
+	}
+	flag.Func("namespace", "Comma-separated namespaces to watch; may be repeated (default: all, or the context's namespace without cluster-wide access)", namespaceFlag)
+	flag.Func("n", "Shorthand for -namespace", namespaceFlag)
+	flag.StringVar(&c.Selector, "selector", c.Selector,
+		"Label selector of the pods to show, e.g. app=checkout (applied server-side)")
+	flag.StringVar(&c.Selector, "l", c.Selector,
+		"Shorthand for -selector")
+	flag.StringVar(&c.FieldSelector, "field-selector", c.FieldSelector,
+		"Field selector of the pods to show, e.g. status.phase=Running (applied server-side)")
+	flag.StringVar(&c.NodeSelector, "node-selector", c.NodeSelector,
+		"Label selector of the nodes to show, e.g. node-role.kubernetes.io/worker (applied server-side)")
+	flag.StringVar(&c.MetricsSource, "metrics-source", c.MetricsSource,
+		"Where to read usage from: "+strings.Join(MetricsSources, ", ")+" (auto uses Prometheus when a URL is set, else metrics-server with kubelet fallback)")
+	flag.StringVar(&c.Prometheus.URL, "prometheus-url", c.Prometheus.URL,
+		"Prometheus HTTP API URL for the prometheus metrics source")
+	flag.Func("contexts", "Comma-separated kubeconfig contexts to monitor as a fleet", func(s string) error {
+		c.Contexts = splitList(s)
+		return nil
+	})
+	flag.BoolVar(&c.AllContexts, "all-contexts", c.AllContexts,
+		"Monitor every kubeconfig context as a fleet")
+	flag.BoolVar(&c.Demo, "demo", c.Demo,
+		"Run against a simulated cluster; no cluster or kubeconfig needed")
 	flag.DurationVar(&c.RefreshInterval, "refresh-interval", c.RefreshInterval,
 		"Metrics refresh interval (e.g., 2s, 5s)")
 	flag.DurationVar(&c.Timeout, "timeout", c.Timeout,
@@ -92,43 +231,109 @@ func (c *Config) ParseFlags() error {
 		"Number of top pods to display")
 	flag.BoolVar(&c.AllNamespaces, "all-namespaces", c.AllNamespaces,
 		"Include system namespaces (kube-system, etc.)")
+	flag.Var(thresholdFlag{&c.Thresholds.CPU}, "cpu-threshold",
+		"CPU warning,critical percentages")
+	flag.Var(thresholdFlag{&c.Thresholds.Memory}, "memory-threshold",
+		"Memory warning,critical percentages")
+	flag.Var(thresholdFlag{&c.Thresholds.Disk}, "disk-threshold",
+		"Disk warning,critical percentages")
+	flag.Var(thresholdFlag{&c.Thresholds.GPU}, "gpu-threshold",
+		"GPU warning,critical percentages")
+	flag.Var(thresholdFlag{&c.Thresholds.Restarts}, "restart-threshold",
+		"Pod restart warning,critical counts")
+	flag.Var(thresholdFlag{&c.Thresholds.Pods}, "pods-threshold",
+		"Node pod count warning,critical percentages of allocatable pods")
+	flag.Func("group-labels", "Comma-separated node labels the g key groups nodes by (default: node pool, zone and instance type labels)", func(s string) error {
+		c.GroupLabels = splitList(s)
+		return nil
+	})
+	flag.StringVar(&c.GroupBy, "group-by", c.GroupBy,
+		"Node label to group the nodes table and heatmap by on startup, e.g. topology.kubernetes.io/zone")
+	flag.StringVar(&c.Theme, "theme", c.Theme,
+		"Color theme (dark, light, solarized, deuteranopia, monochrome, or one from the config file)")
 	flag.BoolVar(&c.ShowVersion, "version", c.ShowVersion,
 		"Show version information")
 	flag.BoolVar(&c.ShowHelp, "help", c.ShowHelp,
 		"Show help message")
 	flag.StringVar(&c.ShowResource, "show", c.ShowResource,
-		"Show resource data as JSON to stdout (resources, pods, nodes)")
+		"Show resource data as JSON to stdout (resources, pods, nodes, cost)")
+	flag.StringVar(&c.Filter, "filter", c.Filter,
+		"Filter expression for --show pods and --show nodes (e.g. \"ns:shop cpu>500m\")")
+	flag.StringVar(&c.PlanCPU, "cpu", c.PlanCPU,
+		"CPU request of each replica for ktop plan, e.g. 500m or 2")
+	flag.StringVar(&c.PlanMemory, "memory", c.PlanMemory,
+		"Memory request of each replica for ktop plan, e.g. 4Gi")
+	flag.IntVar(&c.PlanReplicas, "replicas", c.PlanReplicas,
+		"Number of replicas for ktop plan")
+	flag.Float64Var(&c.RightSizing.Headroom, "headroom", c.RightSizing.Headroom,
+		"Headroom added to observed usage in right-sizing recommendations, in percent")
+	flag.DurationVar(&c.SampleDuration, "duration", c.SampleDuration,
+		"How long ktop rightsize samples usage before recommending")
+	flag.StringVar(&c.Output, "output", c.Output,
+		"Output format of ktop rightsize: "+strings.Join(OutputFormats, ", "))
+	flag.StringVar(&c.Pricing.Basis, "cost-basis", c.Pricing.Basis,
+		"What pods are charged for in the cost view and --show cost: "+strings.Join(CostBases, ", "))
+	flag.StringVar(&c.Pricing.GroupLabel, "cost-label", c.Pricing.GroupLabel,
+		"Pod label costs are also summed up by, e.g. team")
+	flag.Func("toleration", "Taint the replicas of ktop plan tolerate, as key=value:Effect, key:Effect or key; may be repeated", func(s string) error {
+		c.PlanTolerations = append(c.PlanTolerations, s)
+		return nil
+	})
 
 	// Custom usage message
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "ktop - Kubernetes Cluster Monitor (v%s)\n\n", Version)
-		fmt.Fprintf(os.Stderr, "Usage: ktop [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: ktop [options]\n")
+		fmt.Fprintf(os.Stderr, "       ktop doctor [options]\n")
+		fmt.Fprintf(os.Stderr, "       ktop plan --cpu 2 --memory 4Gi --replicas 10 [options]\n")
+		fmt.Fprintf(os.Stderr, "       ktop rightsize [--duration 5m] [--output table|json|csv|yaml] [options]\n\n")
 		fmt.Fprintf(os.Stderr, "A terminal UI for monitoring Kubernetes cluster resources,\n")
 		fmt.Fprintf(os.Stderr, "similar to htop for Linux processes.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nKeyboard Controls:\n")
-		fmt.Fprintf(os.Stderr, "  q          Quit\n")
-		fmt.Fprintf(os.Stderr, "  r          Force refresh\n")
-		fmt.Fprintf(os.Stderr, "  s          Sort nodes (cycle: name, CPU, memory, status)\n")
-		fmt.Fprintf(os.Stderr, "  p          Sort pods (cycle: namespace, name, CPU, memory)\n")
-		fmt.Fprintf(os.Stderr, "  f          Filter pods by namespace\n")
-		fmt.Fprintf(os.Stderr, "  n          Next namespace filter\n")
-		fmt.Fprintf(os.Stderr, "  t          Toggle view mode (split/nodes/pods)\n")
-		fmt.Fprintf(os.Stderr, "  a          Toggle system namespaces\n")
-		fmt.Fprintf(os.Stderr, "  ?          Show help\n")
-		fmt.Fprintf(os.Stderr, "  ↑/↓        Navigate selection\n")
-		fmt.Fprintf(os.Stderr, "  Tab        Switch between nodes and pods\n")
+		if KeyboardHelp != nil {
+			fmt.Fprintf(os.Stderr, "\nKeyboard Controls:\n")
+			fmt.Fprint(os.Stderr, KeyboardHelp(c))
+		}
 		fmt.Fprintf(os.Stderr, "\nJSON Output:\n")
 		fmt.Fprintf(os.Stderr, "  --show resources  Print all cluster metrics as JSON\n")
 		fmt.Fprintf(os.Stderr, "  --show pods       Print pod metrics as JSON\n")
 		fmt.Fprintf(os.Stderr, "  --show nodes      Print node metrics as JSON\n")
+		fmt.Fprintf(os.Stderr, "  --show cost       Print the hourly cost per node, namespace, workload and --cost-label as JSON\n")
+		fmt.Fprintf(os.Stderr, "  --filter EXPR     Only print the pods or nodes matching a / filter expression\n")
+		fmt.Fprintf(os.Stderr, "\nDiagnostics:\n")
+		fmt.Fprintf(os.Stderr, "  ktop doctor        Check connectivity, RBAC permissions and the metrics API\n")
+		fmt.Fprintf(os.Stderr, "\nCapacity Planning:\n")
+		fmt.Fprintf(os.Stderr, "  ktop plan --cpu 2 --memory 4Gi --replicas 10\n")
+		fmt.Fprintf(os.Stderr, "                     Report how many replicas fit, where, and what blocks the rest;\n")
+		fmt.Fprintf(os.Stderr, "                     --node-selector and --toleration restrict the nodes\n")
+		fmt.Fprintf(os.Stderr, "\nRight-Sizing:\n")
+		fmt.Fprintf(os.Stderr, "  ktop rightsize --output yaml > patch.yaml\n")
+		fmt.Fprintf(os.Stderr, "                     Sample usage, then recommend requests and limits per container;\n")
+		fmt.Fprintf(os.Stderr, "                     yaml prints strategic merge patches for the workloads\n")
+		fmt.Fprintf(os.Stderr, "\nNamespace-Scoped Mode:\n")
+		fmt.Fprintf(os.Stderr, "  -n team-a,team-b   Only list pods in these namespaces (no cluster-wide RBAC needed)\n")
+		fmt.Fprintf(os.Stderr, "  Without node list access the nodes panel is replaced by an explanation.\n")
+		fmt.Fprintf(os.Stderr, "\nSelectors:\n")
+		fmt.Fprintf(os.Stderr, "  -l app=checkout    Only list pods with these labels; --field-selector and\n")
+		fmt.Fprintf(os.Stderr, "                     --node-selector work the same way, all server-side\n")
+		fmt.Fprintf(os.Stderr, "\nFleet Mode:\n")
+		fmt.Fprintf(os.Stderr, "  --contexts a,b,c   Monitor several clusters; Enter opens one, b goes back\n")
+		fmt.Fprintf(os.Stderr, "  --all-contexts     Monitor every context in the kubeconfig\n")
+		fmt.Fprintf(os.Stderr, "\nDemo Mode:\n")
+		fmt.Fprintf(os.Stderr, "  --demo             Explore ktop on a simulated cluster with evolving usage\n")
+		fmt.Fprintf(os.Stderr, "\nConfig File:\n")
+		fmt.Fprintf(os.Stderr, "  Settings are read from %s when present;\n", defaultConfigFilePath())
+		fmt.Fprintf(os.Stderr, "  command-line flags take precedence over the file.\n")
+		fmt.Fprintf(os.Stderr, "  Set NO_COLOR to disable colors.\n")
 		fmt.Fprintf(os.Stderr, "\nRequirements:\n")
-		fmt.Fprintf(os.Stderr, "  - Kubernetes cluster with metrics-server installed\n")
+		fmt.Fprintf(os.Stderr, "  - Kubernetes cluster with metrics-server installed (or nodes/proxy access)\n")
 		fmt.Fprintf(os.Stderr, "  - Valid kubeconfig file\n")
 	}
 
-	flag.Parse()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
 
 	return c.Validate()
 }
@@ -150,12 +355,131 @@ func (c *Config) Validate() error {
 	if c.TopPods > 1000 {
 		return fmt.Errorf("top-pods should not exceed 1000")
 	}
-	if c.ShowResource != "" && c.ShowResource != "resources" && c.ShowResource != "pods" && c.ShowResource != "nodes" {
-		return fmt.Errorf("--show must be one of: resources, pods, nodes")
+	if c.ShowResource != "" && !contains(ShowResources, c.ShowResource) {
+		return fmt.Errorf("--show must be one of: %s", strings.Join(ShowResources, ", "))
+	}
+	if c.Filter != "" && c.ShowResource != "pods" && c.ShowResource != "nodes" {
+		return fmt.Errorf("--filter requires --show pods or --show nodes")
+	}
+	if _, err := labels.Parse(c.Selector); err != nil {
+		return fmt.Errorf("invalid --selector: %w", err)
+	}
+	if _, err := fields.ParseSelector(c.FieldSelector); err != nil {
+		return fmt.Errorf("invalid --field-selector: %w", err)
+	}
+	if _, err := labels.Parse(c.NodeSelector); err != nil {
+		return fmt.Errorf("invalid --node-selector: %w", err)
+	}
+	if !contains(MetricsSources, c.MetricsSource) {
+		return fmt.Errorf("--metrics-source must be one of: %s", strings.Join(MetricsSources, ", "))
+	}
+	if c.MetricsSource == "prometheus" && c.Prometheus.URL == "" {
+		return fmt.Errorf("--metrics-source prometheus requires --prometheus-url or prometheus.url in the config file")
+	}
+	if err := c.Prometheus.Validate(); err != nil {
+		return err
+	}
+	if c.Command == "doctor" && (c.FleetMode() || c.ShowResource != "") {
+		return fmt.Errorf("doctor cannot be combined with --show, --contexts or --all-contexts")
+	}
+	if c.Command == "plan" && (c.FleetMode() || c.ShowResource != "") {
+		return fmt.Errorf("plan cannot be combined with --show, --contexts or --all-contexts")
+	}
+	if c.Command == "plan" && (len(c.Namespaces) > 0 || c.Selector != "" || c.FieldSelector != "") {
+		// Free capacity is allocatable minus the requests of every pod
+		return fmt.Errorf("plan needs all pods; --namespace, --selector and --field-selector are not available")
+	}
+	if c.Command == "rightsize" && (c.FleetMode() || c.ShowResource != "") {
+		return fmt.Errorf("rightsize cannot be combined with --show, --contexts or --all-contexts")
+	}
+	if !contains(OutputFormats, c.Output) {
+		return fmt.Errorf("--output must be one of: %s", strings.Join(OutputFormats, ", "))
+	}
+	if c.SampleDuration < 0 {
+		return fmt.Errorf("--duration must not be negative")
+	}
+	if c.Command != "rightsize" && (c.Output != "table" || c.SampleDuration != DefaultSampleDuration) {
+		return fmt.Errorf("--output and --duration require ktop rightsize")
+	}
+	if c.Command != "plan" && (c.PlanCPU != "" || c.PlanMemory != "" || len(c.PlanTolerations) > 0) {
+		return fmt.Errorf("--cpu, --memory and --toleration require ktop plan")
+	}
+	if c.FleetMode() && c.ShowResource != "" {
+		return fmt.Errorf("--show cannot be combined with --contexts or --all-contexts")
+	}
+	if c.Demo && (c.Command == "doctor" || c.FleetMode()) {
+		return fmt.Errorf("--demo cannot be combined with doctor, --contexts or --all-contexts")
+	}
+	if c.Demo && c.MetricsSource != "auto" && c.MetricsSource != "metrics-server" {
+		return fmt.Errorf("--demo simulates metrics-server; --metrics-source %s is not available", c.MetricsSource)
+	}
+	if c.AllContexts && len(c.Contexts) > 0 {
+		return fmt.Errorf("--contexts and --all-contexts are mutually exclusive")
+	}
+	if errs := validation.IsQualifiedName(c.GroupBy); c.GroupBy != "" && len(errs) > 0 {
+		return fmt.Errorf("invalid --group-by label %q: %s", c.GroupBy, strings.Join(errs, "; "))
+	}
+	if err := c.RightSizing.Validate(); err != nil {
+		return err
+	}
+	if err := c.Pricing.Validate(); err != nil {
+		return err
+	}
+	if err := c.Thresholds.Validate(); err != nil {
+		return err
 	}
 	return nil
 }
 
+// DefaultGroupLabels returns the well-known node pool, zone and instance
+// type labels; the group key offers those that are set on some node
+func DefaultGroupLabels() []string {
+	return []string{
+		"node-pool",
+		"cloud.google.com/gke-nodepool",
+		"eks.amazonaws.com/nodegroup",
+		"kubernetes.azure.com/agentpool",
+		"karpenter.sh/nodepool",
+		"topology.kubernetes.io/zone",
+		"node.kubernetes.io/instance-type",
+	}
+}
+
+// MetricsSources lists the valid --metrics-source values
+var MetricsSources = []string{"auto", "metrics-server", "kubelet", "prometheus"}
+
+// ShowResources lists the valid --show values
+var ShowResources = []string{"resources", "pods", "nodes", "cost"}
+
+// OutputFormats lists the valid --output values
+var OutputFormats = []string{"table", "json", "csv", "yaml"}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FleetMode reports whether several clusters are monitored at once
+func (c *Config) FleetMode() bool {
+	return c.AllContexts || len(c.Contexts) > 0
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // PrintVersion prints version information
 func PrintVersion() {
 	fmt.Printf("ktop %s\n", Version)
@@ -169,14 +493,14 @@ func PrintVersion() {
 
 // ThresholdConfig holds threshold values for color coding
 type ThresholdConfig struct {
-	WarningPercent  float64 // threshold for yellow (default 50%)
-	CriticalPercent float64 // threshold for red (default 80%)
+	Warning  float64 `json:"warning"`  // threshold for yellow (default 50%)
+	Critical float64 `json:"critical"` // threshold for red (default 80%)
 }
 
 // DefaultThresholds returns default threshold configuration
 func DefaultThresholds() ThresholdConfig {
 	return ThresholdConfig{
-		WarningPercent:  50.0,
-		CriticalPercent: 80.0,
+		Warning:  50.0,
+		Critical: 80.0,
 	}
 }
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// File mirrors the layout of the YAML config file. Sections point into a
+// Config so that values missing from the file keep their defaults.
+type File struct {
+	Thresholds *Thresholds             `json:"thresholds,omitempty"`
+	Theme      *string                 `json:"theme,omitempty"`
+	Themes     *map[string]ThemeConfig `json:"themes,omitempty"`
+	Keys       *map[string][]string    `json:"keys,omitempty"`
+	Columns    *Columns                `json:"columns,omitempty"`
+
+	GroupLabels *[]string `json:"groupLabels,omitempty"`
+	GroupBy     *string   `json:"groupBy,omitempty"`
+
+	MetricsSource *string           `json:"metricsSource,omitempty"`
+	Prometheus    *PrometheusConfig `json:"prometheus,omitempty"`
+
+	RightSizing *RightSizingConfig `json:"rightSizing,omitempty"`
+	Pricing     *PricingConfig     `json:"pricing,omitempty"`
+}
+
+// ThemeConfig defines a custom color theme in the config file
+type ThemeConfig struct {
+	// Base is the built-in theme to start from (default: dark)
+	Base string `json:"base,omitempty"`
+
+	// Colors overrides palette entries by name, e.g. healthy: "#00d75f".
+	// Values are #rrggbb hex colors, W3C color names or "default".
+	Colors map[string]string `json:"colors,omitempty"`
+}
+
+// defaultConfigFilePath returns the default config file location
+func defaultConfigFilePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ktop", "config.yaml")
+}
+
+// configPathFromArgs finds -config/--config in args before flags are parsed,
+// so the file can supply defaults that command-line flags then override
+func configPathFromArgs(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if len(name) == len(arg) {
+			continue
+		}
+		if value, ok := strings.CutPrefix(name, "config="); ok {
+			return value, true
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// LoadFile reads the config file at path into c. A missing file is only an
+// error when required is set (i.e. the path was given explicitly).
+func (c *Config) LoadFile(path string, required bool) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	f := File{
+		Thresholds: &c.Thresholds,
+		Theme:      &c.Theme,
+		Themes:     &c.Themes,
+		Keys:       &c.Keys,
+		Columns:    &c.Columns,
+
+		GroupLabels: &c.GroupLabels,
+		GroupBy:     &c.GroupBy,
+
+		MetricsSource: &c.MetricsSource,
+		Prometheus:    &c.Prometheus,
+
+		RightSizing: &c.RightSizing,
+		Pricing:     &c.Pricing,
+	}
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
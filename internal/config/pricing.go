@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// CostBases lists how pods are charged: for what they request or for
+// what they use
+var CostBases = []string{"requests", "usage"}
+
+// Rates are hourly prices of compute resources
+type Rates struct {
+	CPU    float64 `json:"cpu"`    // per vCPU-hour
+	Memory float64 `json:"memory"` // per GiB-hour
+	GPU    float64 `json:"gpu"`    // per GPU-hour
+}
+
+// PricingConfig prices nodes and pods for the cost view
+type PricingConfig struct {
+	// Currency is printed before amounts, e.g. "$" or "€"
+	Currency string `json:"currency"`
+
+	// Default rates of every node
+	Rates
+
+	// InstanceTypes replaces the rates of the nodes with that value of
+	// the node.kubernetes.io/instance-type label
+	InstanceTypes map[string]Rates `json:"instanceTypes,omitempty"`
+
+	// Basis charges pods for their requests or their usage
+	Basis string `json:"basis"`
+
+	// GroupLabel is the pod label costs are also summed up by, e.g. team
+	GroupLabel string `json:"groupLabel,omitempty"`
+}
+
+// DefaultPricingConfig returns on-demand list prices of a typical cloud
+// provider in US dollars
+func DefaultPricingConfig() PricingConfig {
+	return PricingConfig{
+		Currency: "$",
+		Rates:    Rates{CPU: 0.031611, Memory: 0.004237, GPU: 0.95},
+		Basis:    "requests",
+	}
+}
+
+// Validate checks the pricing settings
+func (p *PricingConfig) Validate() error {
+	if !contains(CostBases, p.Basis) {
+		return fmt.Errorf("pricing: basis must be one of: %s", strings.Join(CostBases, ", "))
+	}
+	if err := p.Rates.validate("pricing"); err != nil {
+		return err
+	}
+	for name, rates := range p.InstanceTypes {
+		if err := rates.validate("pricing: instanceTypes." + name); err != nil {
+			return err
+		}
+	}
+	if errs := validation.IsQualifiedName(p.GroupLabel); p.GroupLabel != "" && len(errs) > 0 {
+		return fmt.Errorf("pricing: invalid groupLabel %q: %s", p.GroupLabel, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validate checks that no rate is negative
+func (r *Rates) validate(prefix string) error {
+	if r.CPU < 0 || r.Memory < 0 || r.GPU < 0 {
+		return fmt.Errorf("%s: rates must not be negative", prefix)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PrometheusConfig configures the Prometheus metrics source
+type PrometheusConfig struct {
+	// URL is the base URL of the Prometheus HTTP API,
+	// e.g. http://prometheus.monitoring:9090
+	URL string `json:"url,omitempty"`
+
+	// Headers are added to every request, e.g. Authorization
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// BearerTokenFile is read for an Authorization: Bearer header
+	BearerTokenFile string `json:"bearerTokenFile,omitempty"`
+
+	// Backfill is how much history to load with range queries at startup;
+	// 0 disables backfilling
+	Backfill metav1.Duration `json:"backfill,omitempty"`
+
+	// Labels names the series labels identifying nodes and pods
+	Labels PrometheusLabels `json:"labels,omitempty"`
+
+	// Queries are the PromQL expressions ktop evaluates. Node queries must
+	// return one series per node label value, pod queries one per
+	// namespace/pod pair. An empty query disables that metric.
+	Queries PrometheusQueries `json:"queries,omitempty"`
+}
+
+// PrometheusLabels names the labels that identify nodes and pods
+type PrometheusLabels struct {
+	Node      string `json:"node,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+}
+
+// PrometheusQueries holds the PromQL queries of each metric. CPU is in
+// cores, memory in bytes, network in bytes per second and throttling the
+// fraction of CFS periods that were throttled.
+type PrometheusQueries struct {
+	NodeCPU       string `json:"nodeCPU"`
+	NodeMemory    string `json:"nodeMemory"`
+	NodeNetworkRx string `json:"nodeNetworkRx"`
+	NodeNetworkTx string `json:"nodeNetworkTx"`
+	PodCPU        string `json:"podCPU"`
+	PodMemory     string `json:"podMemory"`
+	PodNetworkRx  string `json:"podNetworkRx"`
+	PodNetworkTx  string `json:"podNetworkTx"`
+	PodThrottling string `json:"podThrottling"`
+}
+
+// DefaultPrometheusConfig returns queries for the cAdvisor metrics scraped
+// from the kubelets, labelled as kube-prometheus does
+func DefaultPrometheusConfig() PrometheusConfig {
+	return PrometheusConfig{
+		Backfill: metav1.Duration{Duration: time.Hour},
+		Labels: PrometheusLabels{
+			Node:      "node",
+			Namespace: "namespace",
+			Pod:       "pod",
+		},
+		Queries: PrometheusQueries{
+			NodeCPU:       `sum by (node) (rate(container_cpu_usage_seconds_total{id="/"}[5m]))`,
+			NodeMemory:    `sum by (node) (container_memory_working_set_bytes{id="/"})`,
+			NodeNetworkRx: `sum by (node) (rate(container_network_receive_bytes_total{id="/"}[5m]))`,
+			NodeNetworkTx: `sum by (node) (rate(container_network_transmit_bytes_total{id="/"}[5m]))`,
+			PodCPU:        `sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{container!="", container!="POD"}[5m]))`,
+			PodMemory:     `sum by (namespace, pod) (container_memory_working_set_bytes{container!="", container!="POD"})`,
+			PodNetworkRx:  `sum by (namespace, pod) (rate(container_network_receive_bytes_total[5m]))`,
+			PodNetworkTx:  `sum by (namespace, pod) (rate(container_network_transmit_bytes_total[5m]))`,
+			PodThrottling: `sum by (namespace, pod) (rate(container_cpu_cfs_throttled_periods_total[5m])) / sum by (namespace, pod) (rate(container_cpu_cfs_periods_total[5m]))`,
+		},
+	}
+}
+
+// Validate checks the Prometheus settings
+func (p *PrometheusConfig) Validate() error {
+	if p.URL != "" {
+		u, err := url.Parse(p.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("prometheus: invalid url %q", p.URL)
+		}
+	}
+	if p.Backfill.Duration < 0 {
+		return fmt.Errorf("prometheus: backfill must not be negative")
+	}
+	if p.Labels.Node == "" || p.Labels.Namespace == "" || p.Labels.Pod == "" {
+		return fmt.Errorf("prometheus: labels node, namespace and pod must not be empty")
+	}
+	return nil
+}
+
+// RequestHeaders returns the headers to send with every request,
+// including the bearer token from BearerTokenFile
+func (p *PrometheusConfig) RequestHeaders() (map[string]string, error) {
+	headers := make(map[string]string, len(p.Headers)+1)
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	if p.BearerTokenFile != "" {
+		token, err := os.ReadFile(p.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus: failed to read bearer token: %w", err)
+		}
+		headers["Authorization"] = "Bearer " + strings.TrimSpace(string(token))
+	}
+	return headers, nil
+}
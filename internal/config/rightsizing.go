@@ -0,0 +1,40 @@
+package config
+
+import "fmt"
+
+// RightSizingConfig tunes the right-sizing recommendations
+type RightSizingConfig struct {
+	// Headroom is added to the observed usage, in percent
+	Headroom float64 `json:"headroom"`
+
+	// Tolerance is how far, in percent, a request may exceed the
+	// recommendation before the container counts as over-provisioned
+	Tolerance float64 `json:"tolerance"`
+
+	// MinSamples is the number of history points a container needs
+	// before it gets a recommendation
+	MinSamples int `json:"minSamples"`
+}
+
+// DefaultRightSizingConfig returns the default recommendation settings
+func DefaultRightSizingConfig() RightSizingConfig {
+	return RightSizingConfig{
+		Headroom:   15,
+		Tolerance:  30,
+		MinSamples: 10,
+	}
+}
+
+// Validate checks the right-sizing settings
+func (r *RightSizingConfig) Validate() error {
+	if r.Headroom < 0 || r.Headroom > 1000 {
+		return fmt.Errorf("rightSizing: headroom must be between 0 and 1000 percent")
+	}
+	if r.Tolerance < 0 {
+		return fmt.Errorf("rightSizing: tolerance must not be negative")
+	}
+	if r.MinSamples < 1 {
+		return fmt.Errorf("rightSizing: minSamples must be at least 1")
+	}
+	return nil
+}
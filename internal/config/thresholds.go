@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Thresholds holds the warning/critical thresholds for every colored resource
+type Thresholds struct {
+	CPU      ThresholdConfig `json:"cpu"`
+	Memory   ThresholdConfig `json:"memory"`
+	Disk     ThresholdConfig `json:"disk"`
+	GPU      ThresholdConfig `json:"gpu"`
+	Restarts ThresholdConfig `json:"restarts"` // restart counts rather than percentages
+	Pods     ThresholdConfig `json:"pods"`     // percent of the node's allocatable pods
+
+	// Overrides replace thresholds for nodes matching a label selector.
+	// They are applied in order, so later matches win.
+	Overrides []ThresholdOverride `json:"overrides,omitempty"`
+}
+
+// ThresholdOverride replaces some thresholds for nodes matching NodeSelector
+type ThresholdOverride struct {
+	NodeSelector string           `json:"nodeSelector"`
+	CPU          *ThresholdConfig `json:"cpu,omitempty"`
+	Memory       *ThresholdConfig `json:"memory,omitempty"`
+	Disk         *ThresholdConfig `json:"disk,omitempty"`
+	GPU          *ThresholdConfig `json:"gpu,omitempty"`
+	Restarts     *ThresholdConfig `json:"restarts,omitempty"`
+	Pods         *ThresholdConfig `json:"pods,omitempty"`
+
+	selector labels.Selector
+}
+
+// DefaultResourceThresholds returns the default thresholds for all resources
+func DefaultResourceThresholds() Thresholds {
+	return Thresholds{
+		CPU:      DefaultThresholds(),
+		Memory:   DefaultThresholds(),
+		Disk:     DefaultThresholds(),
+		GPU:      DefaultThresholds(),
+		Restarts: ThresholdConfig{Warning: 1, Critical: 6},
+		Pods:     ThresholdConfig{Warning: 80, Critical: 95},
+	}
+}
+
+// Validate checks threshold ordering and compiles override selectors
+func (t *Thresholds) Validate() error {
+	checks := []struct {
+		name string
+		tc   ThresholdConfig
+	}{
+		{"cpu", t.CPU},
+		{"memory", t.Memory},
+		{"disk", t.Disk},
+		{"gpu", t.GPU},
+		{"restarts", t.Restarts},
+		{"pods", t.Pods},
+	}
+	for _, c := range checks {
+		if err := c.tc.Validate(); err != nil {
+			return fmt.Errorf("%s threshold: %w", c.name, err)
+		}
+	}
+
+	for i := range t.Overrides {
+		o := &t.Overrides[i]
+		sel, err := labels.Parse(o.NodeSelector)
+		if err != nil {
+			return fmt.Errorf("threshold override %q: %w", o.NodeSelector, err)
+		}
+		o.selector = sel
+
+		for _, tc := range []*ThresholdConfig{o.CPU, o.Memory, o.Disk, o.GPU, o.Restarts, o.Pods} {
+			if tc == nil {
+				continue
+			}
+			if err := tc.Validate(); err != nil {
+				return fmt.Errorf("threshold override %q: %w", o.NodeSelector, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ForLabels returns the thresholds that apply to a node with the given labels
+func (t Thresholds) ForLabels(nodeLabels map[string]string) Thresholds {
+	result := t
+	for _, o := range t.Overrides {
+		if o.selector == nil || !o.selector.Matches(labels.Set(nodeLabels)) {
+			continue
+		}
+		if o.CPU != nil {
+			result.CPU = *o.CPU
+		}
+		if o.Memory != nil {
+			result.Memory = *o.Memory
+		}
+		if o.Disk != nil {
+			result.Disk = *o.Disk
+		}
+		if o.GPU != nil {
+			result.GPU = *o.GPU
+		}
+		if o.Restarts != nil {
+			result.Restarts = *o.Restarts
+		}
+		if o.Pods != nil {
+			result.Pods = *o.Pods
+		}
+	}
+	return result
+}
+
+// Validate checks that the warning threshold does not exceed the critical one
+func (t ThresholdConfig) Validate() error {
+	if t.Warning < 0 || t.Critical < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if t.Warning > t.Critical {
+		return fmt.Errorf("warning (%g) must not exceed critical (%g)", t.Warning, t.Critical)
+	}
+	return nil
+}
+
+// thresholdFlag adapts a ThresholdConfig to flag.Value as "warning,critical"
+type thresholdFlag struct {
+	tc *ThresholdConfig
+}
+
+func (f thresholdFlag) String() string {
+	if f.tc == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g", f.tc.Warning, f.tc.Critical)
+}
+
+func (f thresholdFlag) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("expected warning,critical (e.g. 50,80)")
+	}
+	warn, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid warning threshold: %w", err)
+	}
+	crit, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid critical threshold: %w", err)
+	}
+	f.tc.Warning = warn
+	f.tc.Critical = crit
+	return nil
+}
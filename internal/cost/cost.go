@@ -0,0 +1,303 @@
+// Package cost prices the nodes of a cluster and charges the pods running
+// on them, for what they request or what they use. Costs are summed up per
+// node, namespace, workload and pod label, as an hourly burn rate and as
+// the amount accumulated while ktop runs.
+package cost
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// InstanceTypeLabel is the node label pricing.instanceTypes are matched
+// against; older nodes only have the beta label
+const (
+	InstanceTypeLabel     = "node.kubernetes.io/instance-type"
+	betaInstanceTypeLabel = "beta.kubernetes.io/instance-type"
+)
+
+// HoursPerMonth is the average number of hours in a month, used to
+// project hourly costs
+const HoursPerMonth = 730
+
+// unlabeled names the group of the pods without the group label
+const unlabeled = "(unlabeled)"
+
+const gi = 1024 * 1024 * 1024
+
+// Line is the cost of one node, namespace, workload or label value
+type Line struct {
+	Name    string  `json:"name"`
+	Hourly  float64 `json:"hourly"`  // burn rate per hour
+	Session float64 `json:"session"` // accumulated while ktop runs
+}
+
+// NodeLine is the cost of a node: the whole machine, whether its
+// capacity is charged to pods or idle
+type NodeLine struct {
+	Line
+	InstanceType string  `json:"instanceType,omitempty"`
+	Allocated    float64 `json:"allocatedHourly"` // charged to its pods
+}
+
+// Idle returns the hourly cost of the node not charged to any pod
+func (n *NodeLine) Idle() float64 {
+	return max(0, n.Hourly-n.Allocated)
+}
+
+// Report is the cost of a cluster, its lines sorted by burn rate
+type Report struct {
+	Currency string `json:"currency"`
+	Basis    string `json:"basis"`   // what pods are charged for
+	Session  string `json:"session"` // how long costs were accumulated
+
+	Cluster   Line `json:"cluster"`   // every node
+	Allocated Line `json:"allocated"` // charged to pods
+	Idle      Line `json:"idle"`      // node capacity no pod is charged for
+
+	GroupLabel string     `json:"groupLabel,omitempty"`
+	Nodes      []NodeLine `json:"nodes"`
+	Namespaces []Line     `json:"namespaces"`
+	Workloads  []Line     `json:"workloads"`
+	Groups     []Line     `json:"groups,omitempty"` // by GroupLabel
+}
+
+// RatesOf returns the rates of a node: those of its instance type when
+// priced, the default rates otherwise
+func RatesOf(node *models.Node, p *config.PricingConfig) config.Rates {
+	if node != nil {
+		if rates, ok := p.InstanceTypes[instanceType(node)]; ok {
+			return rates
+		}
+	}
+	return p.Rates
+}
+
+// instanceType returns the instance type label of a node
+func instanceType(node *models.Node) string {
+	if t := node.Labels[InstanceTypeLabel]; t != "" {
+		return t
+	}
+	return node.Labels[betaInstanceTypeLabel]
+}
+
+// price returns the hourly price of CPU (millicores), memory (bytes) and
+// GPUs at rates
+func price(rates config.Rates, cpu, memory, gpus int64) float64 {
+	return float64(cpu)/1000*rates.CPU + float64(memory)/gi*rates.Memory + float64(gpus)*rates.GPU
+}
+
+// Compute prices the nodes of m and charges the running pods by basis,
+// "requests" or "usage", at the rates of the node they run on. GPUs are
+// charged for their requests on either basis, since their usage is not
+// reported per pod.
+func Compute(m *models.ClusterMetrics, p *config.PricingConfig, basis string) *Report {
+	r := &Report{Currency: p.Currency, Basis: basis, Session: "0s", GroupLabel: p.GroupLabel}
+	r.Cluster.Name, r.Allocated.Name, r.Idle.Name = "cluster", "allocated", "idle"
+
+	nodes := make(map[string]*NodeLine, len(m.Nodes))
+	rates := make(map[string]config.Rates, len(m.Nodes))
+	r.Nodes = make([]NodeLine, len(m.Nodes))
+	for i := range m.Nodes {
+		n := &m.Nodes[i]
+		gpus := 0
+		if n.GPU != nil {
+			gpus = n.GPU.Count
+		}
+		rates[n.Name] = RatesOf(n, p)
+		r.Nodes[i] = NodeLine{
+			Line:         Line{Name: n.Name, Hourly: price(rates[n.Name], n.CPU.Capacity, n.Memory.Capacity, int64(gpus))},
+			InstanceType: instanceType(n),
+		}
+		nodes[n.Name] = &r.Nodes[i]
+		r.Cluster.Hourly += r.Nodes[i].Hourly
+	}
+
+	namespaces := make(map[string]float64)
+	workloads := make(map[string]float64)
+	groups := make(map[string]float64)
+	for i := range m.Pods {
+		pod := &m.Pods[i]
+		if pod.Status != models.PodStatusRunning {
+			continue
+		}
+		nodeRates, ok := rates[pod.NodeName]
+		if !ok {
+			nodeRates = p.Rates
+		}
+		cpu, memory := pod.CPURequest, pod.MemoryRequest
+		if basis == "usage" {
+			cpu, memory = pod.CPU, pod.Memory
+		}
+		hourly := price(nodeRates, cpu, memory, pod.GPURequest)
+
+		r.Allocated.Hourly += hourly
+		if n := nodes[pod.NodeName]; n != nil {
+			n.Allocated += hourly
+		}
+		namespaces[pod.Namespace] += hourly
+		workload := pod.Workload
+		if workload == "" {
+			workload = "Pod/" + pod.Name
+		}
+		workloads[pod.Namespace+"/"+workload] += hourly
+		if p.GroupLabel != "" {
+			group := pod.Labels[p.GroupLabel]
+			if group == "" {
+				group = unlabeled
+			}
+			groups[group] += hourly
+		}
+	}
+	for i := range r.Nodes {
+		r.Idle.Hourly += r.Nodes[i].Idle()
+	}
+
+	sort.SliceStable(r.Nodes, func(i, j int) bool {
+		return byCost(&r.Nodes[i].Line, &r.Nodes[j].Line)
+	})
+	r.Namespaces = lines(namespaces)
+	r.Workloads = lines(workloads)
+	if p.GroupLabel != "" {
+		r.Groups = lines(groups)
+	}
+	return r
+}
+
+// byCost orders lines by burn rate, the highest first, then by name
+func byCost(a, b *Line) bool {
+	if a.Hourly != b.Hourly {
+		return a.Hourly > b.Hourly
+	}
+	return a.Name < b.Name
+}
+
+// lines returns hourly costs by name as sorted lines
+func lines(costs map[string]float64) []Line {
+	result := make([]Line, 0, len(costs))
+	for name, hourly := range costs {
+		result = append(result, Line{Name: name, Hourly: hourly})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return byCost(&result[i], &result[j])
+	})
+	return result
+}
+
+// Tracker accumulates the costs of a cluster over a session. Each
+// observation adds the burn rates of the previous one over the time in
+// between, for both bases, so the basis can be switched at any time.
+type Tracker struct {
+	mu      sync.Mutex
+	pricing config.PricingConfig
+
+	start, last time.Time
+	reports     map[string]*Report            // latest report by basis
+	totals      map[string]map[string]float64 // accumulated by basis and line key
+}
+
+// NewTracker creates a tracker pricing by p
+func NewTracker(p config.PricingConfig) *Tracker {
+	t := &Tracker{pricing: p}
+	t.Reset()
+	return t
+}
+
+// Reset starts a new session, e.g. after switching clusters
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start, t.last = time.Time{}, time.Time{}
+	t.reports = make(map[string]*Report)
+	t.totals = make(map[string]map[string]float64)
+}
+
+// Observe records the costs of a collection. Metrics that are not newer
+// than the last observed ones are ignored.
+func (t *Tracker) Observe(m *models.ClusterMetrics) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m == nil || !m.Timestamp.After(t.last) {
+		return
+	}
+
+	if !t.last.IsZero() {
+		hours := m.Timestamp.Sub(t.last).Hours()
+		for basis, r := range t.reports {
+			totals := t.totals[basis]
+			if totals == nil {
+				totals = make(map[string]float64)
+				t.totals[basis] = totals
+			}
+			r.each(func(key string, l *Line) {
+				totals[key] += l.Hourly * hours
+			})
+		}
+	} else {
+		t.start = m.Timestamp
+	}
+	t.last = m.Timestamp
+	for _, basis := range config.CostBases {
+		t.reports[basis] = Compute(m, &t.pricing, basis)
+	}
+}
+
+// Report returns the latest costs by basis with the amounts accumulated
+// so far, or nil before the first observation
+func (t *Tracker) Report(basis string) *Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	latest := t.reports[basis]
+	if latest == nil {
+		return nil
+	}
+
+	r := *latest
+	r.Nodes = append([]NodeLine(nil), latest.Nodes...)
+	r.Namespaces = append([]Line(nil), latest.Namespaces...)
+	r.Workloads = append([]Line(nil), latest.Workloads...)
+	r.Groups = append([]Line(nil), latest.Groups...)
+	r.Session = t.last.Sub(t.start).Round(time.Second).String()
+	totals := t.totals[basis]
+	r.each(func(key string, l *Line) {
+		l.Session = totals[key]
+	})
+	return &r
+}
+
+// each calls fn with every line of the report and a key unique across
+// its sections
+func (r *Report) each(fn func(key string, l *Line)) {
+	fn("cluster", &r.Cluster)
+	fn("allocated", &r.Allocated)
+	fn("idle", &r.Idle)
+	for i := range r.Nodes {
+		fn("node/"+r.Nodes[i].Name, &r.Nodes[i].Line)
+	}
+	for i := range r.Namespaces {
+		fn("namespace/"+r.Namespaces[i].Name, &r.Namespaces[i])
+	}
+	for i := range r.Workloads {
+		fn("workload/"+r.Workloads[i].Name, &r.Workloads[i])
+	}
+	for i := range r.Groups {
+		fn("group/"+r.Groups[i].Name, &r.Groups[i])
+	}
+}
+
+// Format formats an amount of money with a precision that suits its
+// size, e.g. $1234, $12.35 or $0.042
+func Format(currency string, amount float64) string {
+	switch {
+	case amount >= 100:
+		return currency + strconv.FormatFloat(amount, 'f', 0, 64)
+	case amount >= 1:
+		return currency + strconv.FormatFloat(amount, 'f', 2, 64)
+	}
+	return currency + strconv.FormatFloat(amount, 'f', 3, 64)
+}
@@ -0,0 +1,123 @@
+package cost
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+const mi = 1024 * 1024
+
+// testMetrics returns a general node, a GPU node priced by its instance
+// type, and pods of two teams
+func testMetrics() *models.ClusterMetrics {
+	node := func(name, instanceType string, cpu, memory int64, gpus int) models.Node {
+		n := models.Node{Name: name, Labels: map[string]string{InstanceTypeLabel: instanceType}}
+		n.CPU.Capacity, n.Memory.Capacity = cpu, memory
+		if gpus > 0 {
+			n.GPU = &models.GPUInfo{Count: gpus}
+		}
+		return n
+	}
+	pod := func(namespace, name, workload, team, node string, cpuRequest, memoryRequest, cpu, memory int64) models.Pod {
+		return models.Pod{
+			Namespace: namespace, Name: name, Workload: workload, NodeName: node, Status: models.PodStatusRunning,
+			Labels:     map[string]string{"team": team},
+			CPURequest: cpuRequest, MemoryRequest: memoryRequest, CPU: cpu, Memory: memory,
+		}
+	}
+	m := &models.ClusterMetrics{
+		Timestamp: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		Nodes: []models.Node{
+			node("node-a", "m6i.xlarge", 4000, 16*1024*mi, 0),
+			node("gpu-1", "p3.8xlarge", 32000, 256*1024*mi, 4),
+		},
+		Pods: []models.Pod{
+			pod("shop", "web-1", "Deployment/web", "checkout", "node-a", 1000, 2048*mi, 500, 1024*mi),
+			pod("shop", "web-2", "Deployment/web", "checkout", "node-a", 1000, 2048*mi, 250, 512*mi),
+			pod("ml", "trainer-0", "StatefulSet/trainer", "", "gpu-1", 8000, 64*1024*mi, 6000, 32*1024*mi),
+			pod("shop", "pending", "Deployment/web", "checkout", "", 1000, 2048*mi, 0, 0),
+		},
+	}
+	m.Pods[2].GPURequest = 2
+	m.Pods[3].Status = models.PodStatusPending
+	return m
+}
+
+func testPricing() *config.PricingConfig {
+	p := config.DefaultPricingConfig()
+	p.Rates = config.Rates{CPU: 0.04, Memory: 0.005, GPU: 1}
+	p.InstanceTypes = map[string]config.Rates{"p3.8xlarge": {CPU: 0.05, Memory: 0.005, GPU: 3}}
+	p.GroupLabel = "team"
+	return &p
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCompute(t *testing.T) {
+	r := Compute(testMetrics(), testPricing(), "requests")
+
+	// gpu-1: 32 × 0.05 + 256 × 0.005 + 4 × 3 = 14.88; node-a: 4 × 0.04 + 16 × 0.005 = 0.24
+	if len(r.Nodes) != 2 || r.Nodes[0].Name != "gpu-1" || !near(r.Nodes[0].Hourly, 14.88) || !near(r.Nodes[1].Hourly, 0.24) {
+		t.Fatalf("nodes: %+v", r.Nodes)
+	}
+	if !near(r.Cluster.Hourly, 15.12) {
+		t.Errorf("cluster costs %f", r.Cluster.Hourly)
+	}
+	// trainer-0: 8 × 0.05 + 64 × 0.005 + 2 × 3 = 6.72; web: 2 × (0.04 + 2 × 0.005) = 0.1
+	if len(r.Workloads) != 2 || r.Workloads[0].Name != "ml/StatefulSet/trainer" || !near(r.Workloads[0].Hourly, 6.72) ||
+		!near(r.Workloads[1].Hourly, 0.1) {
+		t.Errorf("workloads: %+v", r.Workloads)
+	}
+	if !near(r.Allocated.Hourly, 6.82) || !near(r.Idle.Hourly, 15.12-6.82) || !near(r.Nodes[1].Idle(), 0.14) {
+		t.Errorf("allocated %f, idle %f, node-a idle %f", r.Allocated.Hourly, r.Idle.Hourly, r.Nodes[1].Idle())
+	}
+	if len(r.Groups) != 2 || r.Groups[0].Name != unlabeled || r.Groups[1].Name != "checkout" {
+		t.Errorf("groups: %+v", r.Groups)
+	}
+
+	// Usage charges web for 0.75 cores and 1.5Gi; GPUs stay requested
+	r = Compute(testMetrics(), testPricing(), "usage")
+	if !near(r.Namespaces[1].Hourly, 0.75*0.04+1.5*0.005) || !near(r.Namespaces[0].Hourly, 6*0.05+32*0.005+6) {
+		t.Errorf("namespaces by usage: %+v", r.Namespaces)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(*testPricing())
+	if tracker.Report("requests") != nil {
+		t.Fatal("report before the first observation")
+	}
+
+	m := testMetrics()
+	tracker.Observe(m)
+	// Half an hour later web-2 is gone: the first half hour is charged at
+	// the old rates
+	next := testMetrics()
+	next.Timestamp = m.Timestamp.Add(30 * time.Minute)
+	next.Pods = append(next.Pods[:1], next.Pods[2:]...)
+	tracker.Observe(next)
+	tracker.Observe(next) // not newer, ignored
+
+	r := tracker.Report("requests")
+	if r.Session != "30m0s" || !near(r.Cluster.Session, 15.12/2) {
+		t.Errorf("cluster accumulated %f over %s", r.Cluster.Session, r.Session)
+	}
+	web := r.Workloads[1]
+	if web.Name != "shop/Deployment/web" || !near(web.Hourly, 0.05) || !near(web.Session, 0.05) {
+		t.Errorf("web: %+v", web)
+	}
+	if u := tracker.Report("usage"); !near(u.Allocated.Session, (0.75*0.04+1.5*0.005+6*0.05+32*0.005+6)/2) {
+		t.Errorf("usage accumulated %f", u.Allocated.Session)
+	}
+
+	tracker.Reset()
+	if tracker.Report("requests") != nil {
+		t.Error("report after reset")
+	}
+}
@@ -0,0 +1,136 @@
+// Package demo simulates a Kubernetes cluster backed by client-go fake
+// clientsets. The generated cluster has node pools, GPUs, crashlooping and
+// pending pods, and usage that evolves over time with noise and incidents.
+// It drives ktop's --demo mode and serves as a fixture for tests.
+package demo
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Options configures the generated cluster
+type Options struct {
+	// Seed makes the cluster and its evolution reproducible
+	Seed int64
+
+	// Pools and Workloads default to DefaultPools and DefaultWorkloads
+	Pools     []Pool
+	Workloads []Workload
+
+	// Clock returns the simulated time; time.Now when nil. The cluster
+	// advances to the clock's time whenever it is listed.
+	Clock func() time.Time
+
+	// NoIncidents disables random incidents, for predictable tests
+	NoIncidents bool
+}
+
+// Cluster is a simulated cluster. Listing objects through its clientsets
+// advances the simulation to the current time of the clock.
+type Cluster struct {
+	clock     func() time.Time
+	incidents bool
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	start     time.Time
+	now       time.Time
+	nodes     []*simNode
+	pods      []*simPod
+	active    []*incident
+	nextEvent time.Time
+
+	clientset *fake.Clientset
+	metrics   *metricsfake.Clientset
+}
+
+// New generates a cluster and seeds fake clientsets with it
+func New(opts Options) *Cluster {
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	if len(opts.Pools) == 0 {
+		opts.Pools = DefaultPools()
+	}
+	if len(opts.Workloads) == 0 {
+		opts.Workloads = DefaultWorkloads()
+	}
+
+	now := opts.Clock()
+	c := &Cluster{
+		clock:     opts.Clock,
+		incidents: !opts.NoIncidents,
+		rng:       rand.New(rand.NewSource(opts.Seed)),
+		start:     now,
+		now:       now,
+		clientset: fake.NewSimpleClientset(),
+		metrics:   metricsfake.NewSimpleClientset(),
+	}
+	c.nextEvent = now.Add(c.incidentInterval())
+
+	c.generate(opts.Pools, opts.Workloads)
+	c.simulate(now)
+	c.publish()
+
+	// Advance before every list so each collection sees fresh usage
+	advance := func(k8stesting.Action) (bool, runtime.Object, error) {
+		c.Advance(c.clock())
+		return false, nil, nil
+	}
+	c.clientset.PrependReactor("list", "*", advance)
+	c.metrics.PrependReactor("list", "*", advance)
+	return c
+}
+
+// Clientset returns the fake Kubernetes clientset of the cluster
+func (c *Cluster) Clientset() kubernetes.Interface {
+	return c.clientset
+}
+
+// MetricsClientset returns the fake metrics.k8s.io clientset
+func (c *Cluster) MetricsClientset() metricsv.Interface {
+	return c.metrics
+}
+
+// Client returns a ktop client reading from the simulated cluster
+func (c *Cluster) Client() *k8s.Client {
+	return k8s.NewClientFromClientsets(c.clientset, c.metrics, models.ClusterInfo{
+		Name:    "demo",
+		Context: "demo",
+		Server:  "https://demo.ktop.invalid",
+	})
+}
+
+// Advance moves the simulation forward to now. Earlier times are ignored.
+func (c *Cluster) Advance(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !now.After(c.now) {
+		return
+	}
+	c.simulate(now)
+	c.publish()
+}
+
+// Incidents describes the incidents in progress
+func (c *Cluster) Incidents() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	descriptions := make([]string, 0, len(c.active))
+	for _, inc := range c.active {
+		descriptions = append(descriptions, inc.description)
+	}
+	return descriptions
+}
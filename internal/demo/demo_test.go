@@ -0,0 +1,173 @@
+package demo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testClock is a manually advanced clock
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestCluster(t *testing.T, opts Options) (*Cluster, *testClock) {
+	t.Helper()
+	clock := &testClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	opts.Clock = clock.Now
+	return New(opts), clock
+}
+
+func listPods(t *testing.T, c *Cluster, ns string) []corev1.Pod {
+	t.Helper()
+	pods, err := c.Clientset().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pods.Items
+}
+
+func TestReproducible(t *testing.T) {
+	a, _ := newTestCluster(t, Options{Seed: 42})
+	b, _ := newTestCluster(t, Options{Seed: 42})
+
+	podsA, podsB := listPods(t, a, ""), listPods(t, b, "")
+	if len(podsA) != len(podsB) {
+		t.Fatalf("got %d and %d pods", len(podsA), len(podsB))
+	}
+	names := make(map[string]string)
+	for _, p := range podsA {
+		names[p.Namespace+"/"+p.Name] = p.Spec.NodeName
+	}
+	for _, p := range podsB {
+		if node, ok := names[p.Namespace+"/"+p.Name]; !ok || node != p.Spec.NodeName {
+			t.Errorf("pod %s/%s on %q differs between runs with the same seed", p.Namespace, p.Name, p.Spec.NodeName)
+		}
+	}
+}
+
+func TestDefaultCluster(t *testing.T) {
+	c, _ := newTestCluster(t, Options{Seed: 1})
+	ctx := context.Background()
+
+	nodes, err := c.Clientset().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantNodes, gpus int
+	for _, pool := range DefaultPools() {
+		wantNodes += pool.Nodes
+		gpus += pool.Nodes * pool.GPUs
+	}
+	if len(nodes.Items) != wantNodes {
+		t.Errorf("got %d nodes, want %d", len(nodes.Items), wantNodes)
+	}
+	var gotGPUs int64
+	for _, n := range nodes.Items {
+		q := n.Status.Capacity[gpuResource]
+		gotGPUs += q.Value()
+	}
+	if gotGPUs != int64(gpus) {
+		t.Errorf("got %d GPUs, want %d", gotGPUs, gpus)
+	}
+
+	var pending, crashing, succeeded, running int
+	for _, p := range listPods(t, c, "") {
+		switch p.Status.Phase {
+		case corev1.PodPending:
+			pending++
+			if p.Spec.NodeName != "" {
+				t.Errorf("pending pod %s is bound to %s", p.Name, p.Spec.NodeName)
+			}
+		case corev1.PodSucceeded:
+			succeeded++
+		case corev1.PodRunning:
+			running++
+			if w := p.Status.ContainerStatuses[0].State.Waiting; w != nil && w.Reason == "CrashLoopBackOff" {
+				crashing++
+			}
+		}
+	}
+	if pending == 0 || crashing == 0 || succeeded == 0 {
+		t.Errorf("pending=%d crashlooping=%d succeeded=%d, want each > 0", pending, crashing, succeeded)
+	}
+
+	// Only running pods have metrics, like with metrics-server
+	podMetrics, err := c.MetricsClientset().MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(podMetrics.Items) != running {
+		t.Errorf("got metrics for %d pods, want %d", len(podMetrics.Items), running)
+	}
+	nodeMetrics, err := c.MetricsClientset().MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeMetrics.Items) != wantNodes {
+		t.Errorf("got metrics for %d nodes, want %d", len(nodeMetrics.Items), wantNodes)
+	}
+}
+
+func TestUsageEvolves(t *testing.T) {
+	c, clock := newTestCluster(t, Options{Seed: 7, NoIncidents: true})
+	ctx := context.Background()
+
+	usage := func() map[string]int64 {
+		list, err := c.MetricsClientset().MetricsV1beta1().PodMetricses("shop").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string]int64)
+		for _, pm := range list.Items {
+			result[pm.Name] = pm.Containers[0].Usage.Cpu().MilliValue()
+		}
+		return result
+	}
+	restarts := func() int32 {
+		for _, p := range listPods(t, c, "shop") {
+			if p.Labels["app"] == "payments-worker" {
+				return p.Status.ContainerStatuses[0].RestartCount
+			}
+		}
+		t.Fatal("payments-worker pod not found")
+		return 0
+	}
+
+	before, restartsBefore := usage(), restarts()
+	clock.now = clock.now.Add(10 * time.Minute)
+	after, restartsAfter := usage(), restarts()
+
+	changed := 0
+	for name, cpu := range before {
+		if after[name] != cpu {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Error("usage did not change over time")
+	}
+	if restartsAfter <= restartsBefore {
+		t.Errorf("crashlooping pod restarts went from %d to %d", restartsBefore, restartsAfter)
+	}
+	if got := c.Incidents(); len(got) != 0 {
+		t.Errorf("incidents with NoIncidents: %v", got)
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	c, clock := newTestCluster(t, Options{Seed: 3})
+
+	seen := false
+	for i := 0; i < 360 && !seen; i++ {
+		clock.now = clock.now.Add(10 * time.Second)
+		c.Advance(clock.now)
+		seen = len(c.Incidents()) > 0
+	}
+	if !seen {
+		t.Error("no incident within an hour")
+	}
+}
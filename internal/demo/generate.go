@@ -0,0 +1,518 @@
+package demo
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Node and pod labels set by the generator
+const (
+	LabelPool         = "node-pool"
+	LabelInstanceType = "node.kubernetes.io/instance-type"
+	LabelZone         = "topology.kubernetes.io/zone"
+	LabelTeam         = "team"
+)
+
+// gpuResource is the extended resource of NVIDIA GPUs
+const gpuResource corev1.ResourceName = "nvidia.com/gpu"
+
+// maxPodsPerNode is the kubelet's default pod limit
+const maxPodsPerNode = 110
+
+var zones = []string{"us-east-1a", "us-east-1b", "us-east-1c"}
+
+// sidecars are the names of extra containers, in order
+var sidecars = []string{"istio-proxy", "log-shipper", "config-reloader"}
+
+// teams owns the demo namespaces
+var teams = map[string]string{
+	"kube-system":   "platform",
+	"monitoring":    "platform",
+	"ingress-nginx": "platform",
+	"shop":          "storefront",
+	"data":          "data",
+	"ml":            "ml",
+}
+
+// simNode is a node with its scheduling and usage state
+type simNode struct {
+	obj  *corev1.Node
+	pool Pool
+
+	// Allocatable resources and the requests scheduled onto them
+	cpuAlloc, memAlloc int64
+	cpuReq, memReq     int64
+	gpusFree           int
+	pods               int
+
+	// Usage of the current simulation step
+	cpu, mem int64
+
+	notReady       bool
+	memoryPressure bool
+}
+
+// simPod is a pod with its usage state
+type simPod struct {
+	obj  *corev1.Pod
+	w    *Workload
+	node *simNode
+
+	phase    float64 // offset into the usage cycle
+	memBase  float64 // typical working set, bytes
+	memDrift float64 // slow random walk around 1
+	leaked   float64 // bytes leaked since the last restart
+	leakRate float64 // bytes per second
+
+	restarts    int32
+	nextRestart time.Time
+	oomKilled   bool
+
+	// Usage of the current simulation step, main container first
+	containerCPU []int64
+	containerMem []int64
+}
+
+// generate creates the nodes and schedules the pods of the workloads
+func (c *Cluster) generate(pools []Pool, workloads []Workload) {
+	tracker := c.clientset.Tracker()
+
+	namespaces := make(map[string]bool)
+	for _, w := range workloads {
+		if namespaces[w.Namespace] {
+			continue
+		}
+		namespaces[w.Namespace] = true
+		tracker.Add(&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              w.Namespace,
+				Labels:            map[string]string{LabelTeam: teams[w.Namespace]},
+				CreationTimestamp: metav1.NewTime(c.start.Add(-90 * 24 * time.Hour)),
+			},
+			Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		})
+	}
+
+	for i, pool := range pools {
+		// Pools were created at different times
+		created := c.start.Add(-time.Duration(3+c.rng.Intn(60)) * 24 * time.Hour)
+		for j := 0; j < pool.Nodes; j++ {
+			n := c.newNode(pool, i, j, created)
+			c.nodes = append(c.nodes, n)
+			tracker.Add(n.obj)
+		}
+	}
+
+	for i := range workloads {
+		w := &workloads[i]
+		if w.Containers < 1 {
+			w.Containers = 1
+		}
+		for _, p := range c.newPods(w) {
+			c.pods = append(c.pods, p)
+			tracker.Add(p.obj)
+		}
+	}
+}
+
+// newNode creates the j-th node of a pool
+func (c *Cluster) newNode(pool Pool, poolIndex, j int, created time.Time) *simNode {
+	name := fmt.Sprintf("%s-%s", pool.Name, c.suffix(5))
+	zone := zones[j%len(zones)]
+	ip := fmt.Sprintf("10.0.%d.%d", poolIndex*16+j%len(zones), 10+j)
+
+	labels := map[string]string{
+		"kubernetes.io/hostname":        name,
+		"kubernetes.io/os":              "linux",
+		"kubernetes.io/arch":            "amd64",
+		LabelPool:                       pool.Name,
+		LabelInstanceType:               pool.InstanceType,
+		LabelZone:                       zone,
+		"topology.kubernetes.io/region": "us-east-1",
+	}
+
+	// The kubelet and system daemons reserve part of each node
+	cpuAlloc := pool.CPU*1000 - 100 - pool.CPU*10
+	memAlloc := pool.Memory - pool.Memory/20
+
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:              *resource.NewQuantity(pool.CPU, resource.DecimalSI),
+		corev1.ResourceMemory:           *resource.NewQuantity(pool.Memory, resource.BinarySI),
+		corev1.ResourcePods:             *resource.NewQuantity(maxPodsPerNode, resource.DecimalSI),
+		corev1.ResourceEphemeralStorage: *resource.NewQuantity(100*Gi, resource.BinarySI),
+	}
+	allocatable := corev1.ResourceList{
+		corev1.ResourceCPU:              *resource.NewMilliQuantity(cpuAlloc, resource.DecimalSI),
+		corev1.ResourceMemory:           *resource.NewQuantity(memAlloc, resource.BinarySI),
+		corev1.ResourcePods:             *resource.NewQuantity(maxPodsPerNode, resource.DecimalSI),
+		corev1.ResourceEphemeralStorage: *resource.NewQuantity(90*Gi, resource.BinarySI),
+	}
+	if pool.GPUs > 0 {
+		labels["nvidia.com/gpu.present"] = "true"
+		labels["nvidia.com/gpu.product"] = "Tesla-V100-SXM2-16GB"
+		labels["nvidia.com/gpu.memory"] = fmt.Sprintf("%d", pool.GPUMemory)
+		capacity[gpuResource] = *resource.NewQuantity(int64(pool.GPUs), resource.DecimalSI)
+		allocatable[gpuResource] = *resource.NewQuantity(int64(pool.GPUs), resource.DecimalSI)
+	}
+
+	obj := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: fmt.Sprintf("aws:///%s/i-%s", zone, c.suffix(17)),
+		},
+		Status: corev1.NodeStatus{
+			Capacity:    capacity,
+			Allocatable: allocatable,
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: ip},
+				{Type: corev1.NodeHostName, Address: name},
+			},
+			NodeInfo: corev1.NodeSystemInfo{
+				KubeletVersion:          "v1.30.4",
+				KubeProxyVersion:        "v1.30.4",
+				ContainerRuntimeVersion: "containerd://1.7.20",
+				OSImage:                 "Amazon Linux 2023",
+				OperatingSystem:         "linux",
+				Architecture:            "amd64",
+			},
+		},
+	}
+
+	return &simNode{
+		obj:      obj,
+		pool:     pool,
+		cpuAlloc: cpuAlloc,
+		memAlloc: memAlloc,
+		gpusFree: pool.GPUs,
+	}
+}
+
+// newPods creates and schedules the pods of a workload
+func (c *Cluster) newPods(w *Workload) []*simPod {
+	var pods []*simPod
+	hash := c.suffix(10)
+
+	if w.Kind == "DaemonSet" {
+		for _, n := range c.nodes {
+			p := c.newPod(w, fmt.Sprintf("%s-%s", w.Name, c.suffix(5)), hash)
+			c.bind(p, n)
+			pods = append(pods, p)
+		}
+		return pods
+	}
+
+	for i := 0; i < w.Replicas; i++ {
+		var name string
+		switch w.Kind {
+		case "StatefulSet":
+			name = fmt.Sprintf("%s-%d", w.Name, i)
+		case "Deployment":
+			name = fmt.Sprintf("%s-%s-%s", w.Name, hash, c.suffix(5))
+		default:
+			name = fmt.Sprintf("%s-%s", w.Name, c.suffix(5))
+		}
+		p := c.newPod(w, name, hash)
+
+		if w.Behavior == Unschedulable {
+			c.markUnschedulable(p)
+		} else if n := c.schedule(p); n != nil {
+			c.bind(p, n)
+		} else {
+			c.markUnschedulable(p)
+		}
+		pods = append(pods, p)
+	}
+	return pods
+}
+
+// newPod creates an unscheduled pod of a workload
+func (c *Cluster) newPod(w *Workload, name, hash string) *simPod {
+	labels := map[string]string{
+		"app":     w.Name,
+		LabelTeam: teams[w.Namespace],
+	}
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: w.Kind, Name: w.Name, Controller: boolPtr(true)}
+	switch w.Kind {
+	case "Deployment":
+		labels["pod-template-hash"] = hash
+		owner.Kind = "ReplicaSet"
+		owner.Name = w.Name + "-" + hash
+	case "Job":
+		owner.APIVersion = "batch/v1"
+		labels["job-name"] = w.Name
+	}
+
+	containers := make([]corev1.Container, w.Containers)
+	for i := range containers {
+		if i == 0 {
+			containers[i] = corev1.Container{
+				Name:      w.Name,
+				Image:     fmt.Sprintf("registry.example.com/%s/%s:1.%d.%d", w.Namespace, w.Name, c.rng.Intn(20), c.rng.Intn(10)),
+				Resources: w.resources(),
+			}
+			continue
+		}
+		containers[i] = corev1.Container{
+			Name:  sidecars[(i-1)%len(sidecars)],
+			Image: "registry.example.com/platform/" + sidecars[(i-1)%len(sidecars)] + ":2.1.0",
+			Resources: corev1.ResourceRequirements{
+				Requests: resourceList(10, 32*Mi, 0),
+				Limits:   resourceList(100, 64*Mi, 0),
+			},
+		}
+	}
+
+	age := time.Duration(1+c.rng.Intn(14*24)) * time.Hour
+	obj := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         w.Namespace,
+			Name:              name,
+			Labels:            labels,
+			OwnerReferences:   []metav1.OwnerReference{owner},
+			CreationTimestamp: metav1.NewTime(c.start.Add(-age)),
+		},
+		Spec: corev1.PodSpec{Containers: containers},
+	}
+	obj.Status.QOSClass = qosClass(containers)
+
+	p := &simPod{
+		obj:          obj,
+		w:            w,
+		phase:        c.rng.Float64() * 6.28,
+		memDrift:     1,
+		containerCPU: make([]int64, w.Containers),
+		containerMem: make([]int64, w.Containers),
+	}
+	memRequest := w.MemoryRequest
+	if memRequest == 0 {
+		memRequest = 128 * Mi
+	}
+	p.memBase = float64(memRequest) * (0.4 + 0.5*w.Load) * (0.9 + 0.2*c.rng.Float64())
+	if w.Behavior == Leaky && w.MemoryLimit > 0 {
+		// Reach the limit after 5 to 15 minutes
+		p.leakRate = (float64(w.MemoryLimit) - p.memBase) / float64(300+c.rng.Intn(600))
+		p.leaked = c.rng.Float64() * (float64(w.MemoryLimit) - p.memBase) / 2
+	}
+	return p
+}
+
+// resources returns the requests and limits of the main container
+func (w *Workload) resources() corev1.ResourceRequirements {
+	r := corev1.ResourceRequirements{
+		Requests: resourceList(w.CPURequest, w.MemoryRequest, w.GPUs),
+		Limits:   resourceList(w.CPULimit, w.MemoryLimit, w.GPUs),
+	}
+	if len(r.Limits) == 0 {
+		r.Limits = nil
+	}
+	return r
+}
+
+// resourceList builds a resource list, leaving out zero values
+func resourceList(cpu, memory int64, gpus int) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if cpu > 0 {
+		list[corev1.ResourceCPU] = *resource.NewMilliQuantity(cpu, resource.DecimalSI)
+	}
+	if memory > 0 {
+		list[corev1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+	}
+	if gpus > 0 {
+		list[gpuResource] = *resource.NewQuantity(int64(gpus), resource.DecimalSI)
+	}
+	return list
+}
+
+// qosClass derives the QoS class of a pod like the API server does
+func qosClass(containers []corev1.Container) corev1.PodQOSClass {
+	guaranteed, anyRequests := true, false
+	for _, ctr := range containers {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			req, hasReq := ctr.Resources.Requests[name]
+			lim, hasLim := ctr.Resources.Limits[name]
+			anyRequests = anyRequests || hasReq || hasLim
+			if !hasLim || (hasReq && req.Cmp(lim) != 0) {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case guaranteed:
+		return corev1.PodQOSGuaranteed
+	case anyRequests:
+		return corev1.PodQOSBurstable
+	default:
+		return corev1.PodQOSBestEffort
+	}
+}
+
+// podRequests returns the summed CPU and memory requests of a pod
+func podRequests(pod *corev1.Pod) (cpu, memory int64) {
+	for _, ctr := range pod.Spec.Containers {
+		cpu += ctr.Resources.Requests.Cpu().MilliValue()
+		memory += ctr.Resources.Requests.Memory().Value()
+	}
+	return cpu, memory
+}
+
+// schedule picks the least requested node of the workload's pool that
+// fits the pod, or nil when none does
+func (c *Cluster) schedule(p *simPod) *simNode {
+	cpu, mem := podRequests(p.obj)
+	var best *simNode
+	var bestScore float64
+	for _, n := range c.nodes {
+		if p.w.Pool != "" && n.pool.Name != p.w.Pool {
+			continue
+		}
+		if n.pods >= maxPodsPerNode || n.gpusFree < p.w.GPUs ||
+			n.cpuReq+cpu > n.cpuAlloc || n.memReq+mem > n.memAlloc {
+			continue
+		}
+		score := float64(n.cpuReq+cpu)/float64(n.cpuAlloc) + float64(n.memReq+mem)/float64(n.memAlloc)
+		if best == nil || score < bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+// bind assigns a pod to a node and sets its initial status
+func (c *Cluster) bind(p *simPod, n *simNode) {
+	p.node = n
+	n.pods++
+	if p.w.Behavior != Completed {
+		cpu, mem := podRequests(p.obj)
+		n.cpuReq += cpu
+		n.memReq += mem
+		n.gpusFree -= p.w.GPUs
+	}
+
+	started := metav1.NewTime(p.obj.CreationTimestamp.Add(5 * time.Second))
+	p.obj.Spec.NodeName = n.obj.Name
+	p.obj.Status.HostIP = n.obj.Status.Addresses[0].Address
+	p.obj.Status.PodIP = fmt.Sprintf("10.244.%d.%d", c.nodeIndex(n), 2+n.pods)
+	p.obj.Status.StartTime = &started
+	p.obj.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: p.obj.CreationTimestamp},
+	}
+
+	if p.w.Behavior == Completed {
+		p.obj.Status.Phase = corev1.PodSucceeded
+		finished := metav1.NewTime(started.Add(time.Duration(10+c.rng.Intn(50)) * time.Minute))
+		for _, ctr := range p.obj.Spec.Containers {
+			p.obj.Status.ContainerStatuses = append(p.obj.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name:  ctr.Name,
+				Image: ctr.Image,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason: "Completed", StartedAt: started, FinishedAt: finished,
+				}},
+			})
+		}
+		return
+	}
+
+	p.obj.Status.Phase = corev1.PodRunning
+	if p.w.Behavior == CrashLoop {
+		p.restarts = int32(5 + c.rng.Intn(20))
+		p.nextRestart = c.start.Add(time.Duration(10+c.rng.Intn(60)) * time.Second)
+	}
+	c.updateContainerStatuses(p)
+}
+
+// markUnschedulable leaves a pod Pending with the scheduler's reason
+func (c *Cluster) markUnschedulable(p *simPod) {
+	reason := fmt.Sprintf("0/%d nodes are available: insufficient cpu, memory", len(c.nodes))
+	if p.w.GPUs > 0 {
+		reason = fmt.Sprintf("0/%d nodes are available: %d Insufficient nvidia.com/gpu", len(c.nodes), len(c.nodes))
+	}
+	p.obj.Status.Phase = corev1.PodPending
+	p.obj.Status.Conditions = []corev1.PodCondition{{
+		Type:               corev1.PodScheduled,
+		Status:             corev1.ConditionFalse,
+		Reason:             corev1.PodReasonUnschedulable,
+		Message:            reason,
+		LastTransitionTime: p.obj.CreationTimestamp,
+	}}
+}
+
+// updateContainerStatuses sets the container statuses of a running pod
+// from its restart state
+func (c *Cluster) updateContainerStatuses(p *simPod) {
+	started := *p.obj.Status.StartTime
+	statuses := make([]corev1.ContainerStatus, len(p.obj.Spec.Containers))
+	ready := true
+	for i, ctr := range p.obj.Spec.Containers {
+		status := corev1.ContainerStatus{
+			Name:    ctr.Name,
+			Image:   ctr.Image,
+			Ready:   true,
+			Started: boolPtr(true),
+			State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}},
+		}
+		if i == 0 {
+			status.RestartCount = p.restarts
+			switch {
+			case p.w.Behavior == CrashLoop:
+				status.Ready = false
+				status.Started = boolPtr(false)
+				status.State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason:  "CrashLoopBackOff",
+					Message: fmt.Sprintf("back-off restarting failed container %s", ctr.Name),
+				}}
+				status.LastTerminationState = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 1, Reason: "Error",
+				}}
+			case p.oomKilled:
+				status.LastTerminationState = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 137, Reason: "OOMKilled",
+				}}
+			}
+		}
+		ready = ready && status.Ready
+		statuses[i] = status
+	}
+	p.obj.Status.ContainerStatuses = statuses
+
+	readyStatus := corev1.ConditionTrue
+	if !ready {
+		readyStatus = corev1.ConditionFalse
+	}
+	p.obj.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: p.obj.CreationTimestamp},
+		{Type: corev1.PodReady, Status: readyStatus, LastTransitionTime: started},
+	}
+}
+
+// nodeIndex returns the position of a node, used for pod CIDRs
+func (c *Cluster) nodeIndex(n *simNode) int {
+	for i, node := range c.nodes {
+		if node == n {
+			return i
+		}
+	}
+	return 0
+}
+
+// suffix returns a random lowercase alphanumeric suffix like the ones
+// Kubernetes generates for object names
+func (c *Cluster) suffix(n int) string {
+	const alphabet = "bcdfghjklmnpqrstvwxz2456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[c.rng.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
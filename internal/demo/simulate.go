@@ -0,0 +1,330 @@
+package demo
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+var (
+	nodesResource       = corev1.SchemeGroupVersion.WithResource("nodes")
+	podsResource        = corev1.SchemeGroupVersion.WithResource("pods")
+	nodeMetricsResource = metricsv1beta1.SchemeGroupVersion.WithResource("nodes")
+	podMetricsResource  = metricsv1beta1.SchemeGroupVersion.WithResource("pods")
+)
+
+// incidentKind is a kind of simulated trouble
+type incidentKind int
+
+const (
+	cpuSpike incidentKind = iota
+	memoryPressure
+	nodeNotReady
+)
+
+// incident is simulated trouble that ends by itself
+type incident struct {
+	kind        incidentKind
+	until       time.Time
+	workload    *Workload // cpuSpike
+	node        *simNode  // memoryPressure, nodeNotReady
+	description string
+}
+
+// incidentInterval returns a random time until the next incident
+func (c *Cluster) incidentInterval() time.Duration {
+	return time.Duration(90+c.rng.Intn(150)) * time.Second
+}
+
+// simulate computes the state of every node and pod at now. Called with
+// c.mu held.
+func (c *Cluster) simulate(now time.Time) {
+	dt := now.Sub(c.now).Seconds()
+	c.now = now
+	elapsed := now.Sub(c.start).Seconds()
+
+	c.updateIncidents(now)
+
+	for _, n := range c.nodes {
+		// Kubelet, container runtime and system daemons
+		n.cpu = int64(float64(n.pool.CPU*1000) * (0.03 + 0.01*c.rng.Float64()))
+		n.mem = n.pool.Memory / 25
+	}
+
+	for _, p := range c.pods {
+		if p.node == nil || p.w.Behavior == Completed {
+			continue
+		}
+		c.simulatePod(p, now, elapsed, dt)
+		if !p.node.notReady {
+			for i := range p.containerCPU {
+				p.node.cpu += p.containerCPU[i]
+				p.node.mem += p.containerMem[i]
+			}
+		}
+	}
+
+	for _, n := range c.nodes {
+		n.cpu = min(n.cpu, n.pool.CPU*1000)
+		n.mem = min(n.mem, n.pool.Memory)
+		n.obj.Status.Conditions = nodeConditions(n, now)
+	}
+}
+
+// simulatePod advances the usage and restarts of one pod
+func (c *Cluster) simulatePod(p *simPod, now time.Time, elapsed, dt float64) {
+	w := p.w
+
+	if w.Behavior == CrashLoop {
+		// The container starts, fails and backs off, up to five minutes
+		if !now.Before(p.nextRestart) {
+			p.restarts++
+			backoff := min(10*time.Second<<min(p.restarts, 5), 5*time.Minute)
+			p.nextRestart = now.Add(backoff)
+			c.updateContainerStatuses(p)
+		}
+		p.containerCPU[0] = int64(1 + c.rng.Intn(5))
+		p.containerMem[0] = int64(8+c.rng.Intn(8)) * Mi
+		c.simulateSidecars(p)
+		return
+	}
+
+	// CPU follows a cycle, with noise and incident spikes
+	period, amplitude := 600.0, 0.15
+	if w.Behavior == Bursty {
+		period, amplitude = 180.0, 0.5
+	}
+	load := w.Load * (1 + amplitude*math.Sin(2*math.Pi*elapsed/period+p.phase))
+	load *= 1 + 0.08*c.rng.NormFloat64()
+	load *= c.cpuFactor(p)
+
+	request := w.CPURequest
+	if request == 0 {
+		request = 100
+	}
+	cpu := int64(load * float64(request))
+	if w.CPULimit > 0 {
+		cpu = min(cpu, w.CPULimit)
+	}
+	p.containerCPU[0] = max(cpu, 1)
+
+	// Memory drifts slowly; leaking pods grow until they are OOM killed
+	p.memDrift += 0.01 * c.rng.NormFloat64() * math.Sqrt(dt/10)
+	p.memDrift = math.Max(0.9, math.Min(1.1, p.memDrift))
+	p.leaked += p.leakRate * dt
+	mem := (p.memBase*p.memDrift + p.leaked) * c.memoryFactor(p)
+	if w.MemoryLimit > 0 && mem >= float64(w.MemoryLimit) {
+		p.restarts++
+		p.oomKilled = true
+		p.leaked = 0
+		started := metav1.NewTime(now)
+		p.obj.Status.StartTime = &started
+		c.updateContainerStatuses(p)
+		mem = p.memBase * p.memDrift
+	}
+	p.containerMem[0] = int64(mem)
+
+	c.simulateSidecars(p)
+}
+
+// simulateSidecars sets small, noisy usage for the sidecar containers
+func (c *Cluster) simulateSidecars(p *simPod) {
+	for i := 1; i < len(p.containerCPU); i++ {
+		p.containerCPU[i] = int64(2 + c.rng.Intn(8))
+		p.containerMem[i] = int64(20+c.rng.Intn(12)) * Mi
+	}
+}
+
+// cpuFactor returns the CPU multiplier incidents apply to a pod
+func (c *Cluster) cpuFactor(p *simPod) float64 {
+	factor := 1.0
+	for _, inc := range c.active {
+		if inc.kind == cpuSpike && inc.workload == p.w {
+			factor *= 3
+		}
+	}
+	return factor
+}
+
+// memoryFactor returns the memory multiplier incidents apply to a pod
+func (c *Cluster) memoryFactor(p *simPod) float64 {
+	factor := 1.0
+	for _, inc := range c.active {
+		if inc.kind == memoryPressure && inc.node == p.node {
+			factor *= 1.25
+		}
+	}
+	return factor
+}
+
+// updateIncidents ends expired incidents and starts a new one when due
+func (c *Cluster) updateIncidents(now time.Time) {
+	active := c.active[:0]
+	for _, inc := range c.active {
+		if now.Before(inc.until) {
+			active = append(active, inc)
+			continue
+		}
+		switch inc.kind {
+		case memoryPressure:
+			inc.node.memoryPressure = false
+		case nodeNotReady:
+			inc.node.notReady = false
+		}
+	}
+	c.active = active
+
+	if !c.incidents || now.Before(c.nextEvent) {
+		return
+	}
+	c.nextEvent = now.Add(c.incidentInterval())
+	if inc := c.newIncident(now); inc != nil {
+		c.active = append(c.active, inc)
+	}
+}
+
+// newIncident starts a random incident, or returns nil when the chosen
+// target is already affected
+func (c *Cluster) newIncident(now time.Time) *incident {
+	duration := time.Duration(60+c.rng.Intn(120)) * time.Second
+	inc := &incident{kind: incidentKind(c.rng.Intn(3)), until: now.Add(duration)}
+
+	if inc.kind == cpuSpike {
+		p := c.pods[c.rng.Intn(len(c.pods))]
+		if p.node == nil || p.w.Behavior == Completed || p.w.Behavior == CrashLoop {
+			return nil
+		}
+		for _, other := range c.active {
+			if other.workload == p.w {
+				return nil
+			}
+		}
+		inc.workload = p.w
+		inc.description = fmt.Sprintf("CPU spike in %s/%s", p.w.Namespace, p.w.Name)
+		return inc
+	}
+
+	n := c.nodes[c.rng.Intn(len(c.nodes))]
+	if n.notReady || n.memoryPressure {
+		return nil
+	}
+	inc.node = n
+	if inc.kind == memoryPressure {
+		n.memoryPressure = true
+		inc.description = fmt.Sprintf("memory pressure on %s", n.obj.Name)
+	} else {
+		n.notReady = true
+		inc.description = fmt.Sprintf("node %s not ready", n.obj.Name)
+	}
+	return inc
+}
+
+// nodeConditions returns the conditions of a node in its current state
+func nodeConditions(n *simNode, now time.Time) []corev1.NodeCondition {
+	condition := func(t corev1.NodeConditionType, status corev1.ConditionStatus, reason string) corev1.NodeCondition {
+		return corev1.NodeCondition{
+			Type:              t,
+			Status:            status,
+			Reason:            reason,
+			LastHeartbeatTime: metav1.NewTime(now),
+		}
+	}
+
+	if n.notReady {
+		// The kubelet stopped posting status
+		return []corev1.NodeCondition{
+			condition(corev1.NodeReady, corev1.ConditionUnknown, "NodeStatusUnknown"),
+			condition(corev1.NodeMemoryPressure, corev1.ConditionUnknown, "NodeStatusUnknown"),
+			condition(corev1.NodeDiskPressure, corev1.ConditionUnknown, "NodeStatusUnknown"),
+			condition(corev1.NodePIDPressure, corev1.ConditionUnknown, "NodeStatusUnknown"),
+		}
+	}
+
+	memory := condition(corev1.NodeMemoryPressure, corev1.ConditionFalse, "KubeletHasSufficientMemory")
+	if n.memoryPressure {
+		memory = condition(corev1.NodeMemoryPressure, corev1.ConditionTrue, "KubeletHasInsufficientMemory")
+	}
+	return []corev1.NodeCondition{
+		condition(corev1.NodeReady, corev1.ConditionTrue, "KubeletReady"),
+		memory,
+		condition(corev1.NodeDiskPressure, corev1.ConditionFalse, "KubeletHasNoDiskPressure"),
+		condition(corev1.NodePIDPressure, corev1.ConditionFalse, "KubeletHasSufficientPID"),
+	}
+}
+
+// publish writes nodes, pods and their metrics to the fake clientsets.
+// Nodes that are not ready and pods that are not running have no
+// metrics, as with metrics-server. Called with c.mu held.
+func (c *Cluster) publish() {
+	core := c.clientset.Tracker()
+	metrics := c.metrics.Tracker()
+	window := metav1.Duration{Duration: 15 * time.Second}
+	timestamp := metav1.NewTime(c.now)
+
+	for _, n := range c.nodes {
+		core.Update(nodesResource, n.obj, "")
+
+		if n.notReady {
+			remove(metrics, nodeMetricsResource, "", n.obj.Name)
+			continue
+		}
+		upsert(metrics, nodeMetricsResource, "", &metricsv1beta1.NodeMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: n.obj.Name, Labels: n.obj.Labels},
+			Timestamp:  timestamp,
+			Window:     window,
+			Usage:      usageList(n.cpu, n.mem),
+		})
+	}
+
+	for _, p := range c.pods {
+		core.Update(podsResource, p.obj, p.obj.Namespace)
+
+		if p.node == nil || p.node.notReady || p.obj.Status.Phase != corev1.PodRunning {
+			remove(metrics, podMetricsResource, p.obj.Namespace, p.obj.Name)
+			continue
+		}
+		pm := &metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{Namespace: p.obj.Namespace, Name: p.obj.Name, Labels: p.obj.Labels},
+			Timestamp:  timestamp,
+			Window:     window,
+		}
+		for i, ctr := range p.obj.Spec.Containers {
+			pm.Containers = append(pm.Containers, metricsv1beta1.ContainerMetrics{
+				Name:  ctr.Name,
+				Usage: usageList(p.containerCPU[i], p.containerMem[i]),
+			})
+		}
+		upsert(metrics, podMetricsResource, p.obj.Namespace, pm)
+	}
+}
+
+// usageList builds a CPU and memory usage list
+func usageList(cpu, memory int64) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI),
+	}
+}
+
+// upsert creates or updates an object in a fake tracker. Metrics objects
+// are tracked under the resource the metrics client lists, which differs
+// from the one the tracker would guess from their kind.
+func upsert(tracker k8stesting.ObjectTracker, gvr schema.GroupVersionResource, ns string, obj runtime.Object) {
+	if err := tracker.Update(gvr, obj, ns); apierrors.IsNotFound(err) {
+		tracker.Create(gvr, obj, ns)
+	}
+}
+
+// remove deletes an object from a fake tracker if it exists
+func remove(tracker k8stesting.ObjectTracker, gvr schema.GroupVersionResource, ns, name string) {
+	tracker.Delete(gvr, ns, name)
+}
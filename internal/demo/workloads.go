@@ -0,0 +1,104 @@
+package demo
+
+// Gi and Mi are byte multiples used to size pools and workloads
+const (
+	Mi int64 = 1024 * 1024
+	Gi int64 = 1024 * Mi
+)
+
+// Pool is a group of identical nodes
+type Pool struct {
+	Name         string
+	Nodes        int
+	CPU          int64 // cores per node
+	Memory       int64 // bytes per node
+	GPUs         int   // NVIDIA GPUs per node
+	GPUMemory    int64 // MiB per GPU
+	InstanceType string
+}
+
+// Behavior describes how the pods of a workload evolve
+type Behavior int
+
+const (
+	// Steady pods follow a gentle daily-like cycle with noise
+	Steady Behavior = iota
+	// Bursty pods swing widely, like traffic-driven frontends
+	Bursty
+	// Leaky pods grow in memory until they are OOM killed and restart
+	Leaky
+	// CrashLoop pods keep failing and back off between restarts
+	CrashLoop
+	// Unschedulable pods stay Pending
+	Unschedulable
+	// Completed pods ran to completion, like finished job pods
+	Completed
+)
+
+// Workload is a set of pods created by one controller
+type Workload struct {
+	Namespace  string
+	Name       string
+	Kind       string // Deployment, StatefulSet, DaemonSet or Job
+	Replicas   int    // ignored for DaemonSets, which run on every node
+	Pool       string // node pool to schedule on; empty for any
+	Containers int    // including sidecars; at least 1
+
+	// Resources of the main container; sidecars get small fixed ones.
+	// Limits of 0 are unset.
+	CPURequest    int64 // millicores
+	CPULimit      int64 // millicores
+	MemoryRequest int64 // bytes
+	MemoryLimit   int64 // bytes
+	GPUs          int
+
+	Load     float64 // typical usage as a fraction of the requests
+	Behavior Behavior
+}
+
+// DefaultPools returns the node pools of the default demo cluster
+func DefaultPools() []Pool {
+	return []Pool{
+		{Name: "system", Nodes: 3, CPU: 4, Memory: 16 * Gi, InstanceType: "m6i.xlarge"},
+		{Name: "general", Nodes: 6, CPU: 8, Memory: 32 * Gi, InstanceType: "m6i.2xlarge"},
+		{Name: "highmem", Nodes: 3, CPU: 8, Memory: 64 * Gi, InstanceType: "r6i.2xlarge"},
+		{Name: "gpu", Nodes: 2, CPU: 32, Memory: 244 * Gi, GPUs: 4, GPUMemory: 16384, InstanceType: "p3.8xlarge"},
+	}
+}
+
+// DefaultWorkloads returns the workloads of the default demo cluster: a
+// shop, data stores, ML jobs and the usual system add-ons, including a
+// crashlooping worker, a leaking service and a job waiting for GPUs
+func DefaultWorkloads() []Workload {
+	return []Workload{
+		// System add-ons
+		{Namespace: "kube-system", Name: "coredns", Kind: "Deployment", Replicas: 2, Pool: "system", CPURequest: 100, MemoryRequest: 70 * Mi, MemoryLimit: 170 * Mi, Load: 0.3},
+		{Namespace: "kube-system", Name: "kube-proxy", Kind: "DaemonSet", CPURequest: 100, MemoryRequest: 50 * Mi, Load: 0.2},
+		{Namespace: "kube-system", Name: "metrics-server", Kind: "Deployment", Replicas: 1, Pool: "system", CPURequest: 100, MemoryRequest: 200 * Mi, Load: 0.4},
+		{Namespace: "kube-system", Name: "ebs-csi-node", Kind: "DaemonSet", Containers: 3, CPURequest: 30, MemoryRequest: 120 * Mi, Load: 0.3},
+		{Namespace: "monitoring", Name: "prometheus", Kind: "StatefulSet", Replicas: 2, Pool: "highmem", Containers: 2, CPURequest: 1000, CPULimit: 2000, MemoryRequest: 8 * Gi, MemoryLimit: 12 * Gi, Load: 0.7},
+		{Namespace: "monitoring", Name: "alertmanager", Kind: "StatefulSet", Replicas: 2, Pool: "system", CPURequest: 50, MemoryRequest: 128 * Mi, Load: 0.3},
+		{Namespace: "monitoring", Name: "grafana", Kind: "Deployment", Replicas: 1, Pool: "general", CPURequest: 100, MemoryRequest: 256 * Mi, MemoryLimit: 512 * Mi, Load: 0.5},
+		{Namespace: "monitoring", Name: "node-exporter", Kind: "DaemonSet", CPURequest: 50, MemoryRequest: 64 * Mi, MemoryLimit: 128 * Mi, Load: 0.4},
+		{Namespace: "ingress-nginx", Name: "ingress-nginx-controller", Kind: "Deployment", Replicas: 3, Pool: "general", CPURequest: 500, CPULimit: 2000, MemoryRequest: 512 * Mi, MemoryLimit: Gi, Load: 0.6, Behavior: Bursty},
+
+		// Online shop
+		{Namespace: "shop", Name: "frontend", Kind: "Deployment", Replicas: 6, Pool: "general", Containers: 2, CPURequest: 250, CPULimit: 1000, MemoryRequest: 256 * Mi, MemoryLimit: 512 * Mi, Load: 0.7, Behavior: Bursty},
+		{Namespace: "shop", Name: "cart", Kind: "Deployment", Replicas: 3, Pool: "general", CPURequest: 200, CPULimit: 500, MemoryRequest: 256 * Mi, MemoryLimit: 512 * Mi, Load: 0.5},
+		{Namespace: "shop", Name: "checkout", Kind: "Deployment", Replicas: 3, Pool: "general", CPURequest: 300, MemoryRequest: 384 * Mi, MemoryLimit: 768 * Mi, Load: 0.4},
+		{Namespace: "shop", Name: "payments", Kind: "Deployment", Replicas: 2, Pool: "general", CPURequest: 200, CPULimit: 200, MemoryRequest: 256 * Mi, MemoryLimit: 256 * Mi, Load: 0.3},
+		{Namespace: "shop", Name: "payments-worker", Kind: "Deployment", Replicas: 1, Pool: "general", CPURequest: 100, MemoryRequest: 128 * Mi, MemoryLimit: 256 * Mi, Load: 0.2, Behavior: CrashLoop},
+		{Namespace: "shop", Name: "recommendations", Kind: "Deployment", Replicas: 2, Pool: "general", CPURequest: 1000, CPULimit: 2000, MemoryRequest: 2 * Gi, MemoryLimit: 3 * Gi, Load: 0.8, Behavior: Leaky},
+		{Namespace: "shop", Name: "redis", Kind: "StatefulSet", Replicas: 1, Pool: "highmem", CPURequest: 500, MemoryRequest: 4 * Gi, MemoryLimit: 6 * Gi, Load: 0.3},
+
+		// Data
+		{Namespace: "data", Name: "postgres", Kind: "StatefulSet", Replicas: 2, Pool: "highmem", Containers: 2, CPURequest: 2000, CPULimit: 2000, MemoryRequest: 16 * Gi, MemoryLimit: 16 * Gi, Load: 0.5},
+		{Namespace: "data", Name: "kafka", Kind: "StatefulSet", Replicas: 3, Pool: "highmem", CPURequest: 1000, CPULimit: 4000, MemoryRequest: 8 * Gi, MemoryLimit: 12 * Gi, Load: 0.6, Behavior: Bursty},
+		{Namespace: "data", Name: "etl-nightly", Kind: "Job", Replicas: 4, Pool: "general", CPURequest: 500, MemoryRequest: Gi, Behavior: Completed},
+
+		// Machine learning
+		{Namespace: "ml", Name: "inference", Kind: "Deployment", Replicas: 3, Pool: "gpu", Containers: 2, CPURequest: 4000, CPULimit: 8000, MemoryRequest: 16 * Gi, MemoryLimit: 24 * Gi, GPUs: 1, Load: 0.6, Behavior: Bursty},
+		{Namespace: "ml", Name: "trainer", Kind: "Job", Replicas: 1, Pool: "gpu", CPURequest: 8000, MemoryRequest: 64 * Gi, GPUs: 2, Load: 0.9},
+		{Namespace: "ml", Name: "trainer-xl", Kind: "Job", Replicas: 1, Pool: "gpu", CPURequest: 16000, MemoryRequest: 128 * Gi, GPUs: 4, Load: 0.9, Behavior: Unschedulable},
+	}
+}
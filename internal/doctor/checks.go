@@ -0,0 +1,263 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/nlaak/ktop/internal/k8s"
+)
+
+// Report sections, in the order the checks run
+const (
+	sectionConnectivity = "Connectivity"
+	sectionPermissions  = "Permissions"
+	sectionMetrics      = "Metrics API"
+	sectionOptional     = "Optional Features"
+)
+
+// Latency above which API calls are reported as slow
+const (
+	slowLatency = 500 * time.Millisecond
+	pingCount   = 3
+)
+
+// metricsGroup is the API group served by metrics-server
+const metricsGroup = "metrics.k8s.io"
+
+// metricsVersion is the metrics API version ktop's client uses
+const metricsVersion = "v1beta1"
+
+const installMetricsHint = `Install metrics-server:
+  kubectl apply -f https://github.com/kubernetes-sigs/metrics-server/releases/latest/download/components.yaml
+For MicroK8s: microk8s enable metrics-server`
+
+// checkConnectivity pings the API server and reports its latency. It
+// returns false when the server is unreachable.
+func (r *Report) checkConnectivity(client *k8s.Client) bool {
+	var total, worst time.Duration
+	var version string
+	for i := 0; i < pingCount; i++ {
+		v, latency, err := client.Ping()
+		if err != nil {
+			r.add(Check{
+				Section: sectionConnectivity,
+				Name:    "API server reachable",
+				Status:  Fail,
+				Detail:  err.Error(),
+				Hint:    "Check the server address in your kubeconfig, network/VPN access and credentials (kubectl cluster-info)",
+			})
+			return false
+		}
+		version = v
+		total += latency
+		if latency > worst {
+			worst = latency
+		}
+	}
+
+	r.add(Check{
+		Section: sectionConnectivity,
+		Name:    "API server reachable",
+		Status:  Pass,
+		Detail:  "Kubernetes " + version,
+	})
+
+	avg := total / pingCount
+	latency := Check{
+		Section: sectionConnectivity,
+		Name:    "API latency",
+		Status:  Pass,
+		Detail: fmt.Sprintf("avg %s, max %s over %d requests",
+			avg.Round(time.Millisecond), worst.Round(time.Millisecond), pingCount),
+	}
+	if avg > slowLatency {
+		latency.Status = Warn
+		latency.Hint = "Every refresh makes several API calls; consider a longer -refresh-interval and -timeout"
+	}
+	r.add(latency)
+	return true
+}
+
+// checkAccess records whether an operation is permitted. denied is the
+// status reported when it is not. Permissions that cannot be checked are
+// assumed to be granted so that features are not disabled needlessly.
+func (r *Report) checkAccess(ctx context.Context, client *k8s.Client, section string, access k8s.ResourceAccess, denied Status, hint string) bool {
+	allowed, reason, err := client.CanI(ctx, access)
+	return r.recordAccess(section, access, allowed, reason, err, denied, hint)
+}
+
+// recordAccess records the result of an access review
+func (r *Report) recordAccess(section string, access k8s.ResourceAccess, allowed bool, reason string, err error, denied Status, hint string) bool {
+	check := Check{Section: section, Name: access.String()}
+	switch {
+	case err != nil:
+		check.Status = Warn
+		check.Detail = err.Error()
+		check.Hint = "Could not verify this permission; ktop will try the operation anyway"
+		allowed = true
+	case allowed:
+		check.Status = Pass
+		check.Detail = "allowed"
+	default:
+		check.Status = denied
+		check.Detail = "denied"
+		if reason != "" {
+			check.Detail += ": " + reason
+		}
+		check.Hint = hint
+	}
+	r.add(check)
+	return allowed
+}
+
+// scopeNamespace returns the namespace for checks of namespaced features:
+// the first watched namespace, or all namespaces
+func scopeNamespace(namespaces []string) string {
+	if len(namespaces) > 0 {
+		return namespaces[0]
+	}
+	return metav1.NamespaceAll
+}
+
+// checkPods verifies ktop can list pods in its scope
+func (r *Report) checkPods(ctx context.Context, client *k8s.Client, namespaces []string) {
+	const hint = "ktop needs to list pods; ask an admin for a Role granting get/list on pods, or pass -n with namespaces you can access"
+
+	if len(namespaces) > 0 {
+		for _, ns := range namespaces {
+			r.checkAccess(ctx, client, sectionPermissions,
+				k8s.ResourceAccess{Verb: "list", Resource: "pods", Namespace: ns}, Fail, hint)
+		}
+		return
+	}
+
+	all := k8s.ResourceAccess{Verb: "list", Resource: "pods"}
+	allowed, reason, err := client.CanI(ctx, all)
+	if err != nil || allowed {
+		r.recordAccess(sectionPermissions, all, allowed, reason, err, Fail, hint)
+		return
+	}
+
+	// Without cluster-wide access ktop falls back to the context's namespace
+	ns := r.ClusterInfo.Namespace
+	if ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+	fallback := k8s.ResourceAccess{Verb: "list", Resource: "pods", Namespace: ns}
+	allowed, reason, err = client.CanI(ctx, fallback)
+	if err == nil && allowed {
+		r.add(Check{
+			Section: sectionPermissions,
+			Name:    "list pods",
+			Status:  Warn,
+			Detail:  fmt.Sprintf("denied cluster-wide; ktop will only watch namespace %s", ns),
+			Hint:    "Pass -n to choose the namespaces to watch, or ask for cluster-wide list access on pods",
+		})
+		return
+	}
+	r.recordAccess(sectionPermissions, fallback, allowed, reason, err, Fail, hint)
+}
+
+// checkNodes verifies ktop can list nodes
+func (r *Report) checkNodes(ctx context.Context, client *k8s.Client) {
+	r.Capabilities.ListNodes = r.checkAccess(ctx, client, sectionPermissions,
+		k8s.ResourceAccess{Verb: "list", Resource: "nodes"}, Warn,
+		"Without node access the nodes panel is hidden and cluster capacity is unknown; ask for a ClusterRole granting list on nodes")
+}
+
+// checkMetrics verifies the metrics API is registered, serving and
+// readable
+func (r *Report) checkMetrics(ctx context.Context, client *k8s.Client, namespaces []string) {
+	versions, preferred, ok, err := client.APIGroupVersions(metricsGroup)
+	switch {
+	case err != nil:
+		r.add(Check{Section: sectionMetrics, Name: metricsGroup + " discovery", Status: Warn, Detail: err.Error()})
+	case !ok:
+		r.add(Check{
+			Section: sectionMetrics,
+			Name:    metricsGroup + " discovery",
+			Status:  Fail,
+			Detail:  "not registered; metrics-server is not installed",
+			Hint:    installMetricsHint,
+
+			kubeletFallback: true,
+		})
+		return
+	default:
+		check := Check{
+			Section: sectionMetrics,
+			Name:    metricsGroup + " discovery",
+			Status:  Pass,
+			Detail:  fmt.Sprintf("versions %v (preferred %s)", versions, preferred),
+		}
+		if !contains(versions, metricsVersion) {
+			check.Status = Fail
+			check.Hint = fmt.Sprintf("ktop reads %s/%s; upgrade or reinstall metrics-server", metricsGroup, metricsVersion)
+			r.add(check)
+			return
+		}
+		r.add(check)
+	}
+
+	const hint = "CPU and memory usage will show as 0; ask for get/list on %s.metrics.k8s.io"
+	nodeMetrics := r.checkAccess(ctx, client, sectionMetrics,
+		k8s.ResourceAccess{Verb: "list", Group: metricsGroup, Resource: "nodes"}, Warn,
+		fmt.Sprintf(hint, "nodes"))
+	podMetrics := r.checkAccess(ctx, client, sectionMetrics,
+		k8s.ResourceAccess{Verb: "list", Group: metricsGroup, Resource: "pods", Namespace: scopeNamespace(namespaces)}, Warn,
+		fmt.Sprintf(hint, "pods"))
+
+	// A registered but unhealthy metrics-server fails every request
+	serving := true
+	if nodeMetrics {
+		if err := client.CheckMetricsAPIAvailable(ctx); err != nil {
+			serving = false
+			r.add(Check{
+				Section: sectionMetrics,
+				Name:    "metrics API responding",
+				Status:  Fail,
+				Detail:  err.Error(),
+				Hint: "metrics-server is registered but not serving; check\n" +
+					"  kubectl -n kube-system get pods -l k8s-app=metrics-server\n" +
+					"  kubectl get apiservice v1beta1.metrics.k8s.io",
+
+				kubeletFallback: true,
+			})
+		} else {
+			r.add(Check{Section: sectionMetrics, Name: "metrics API responding", Status: Pass, Detail: "node metrics listed"})
+		}
+	}
+
+	r.Capabilities.NodeMetrics = nodeMetrics && serving
+	r.Capabilities.PodMetrics = podMetrics && serving
+}
+
+// checkOptional verifies the permissions of features ktop can do without
+func (r *Report) checkOptional(ctx context.Context, client *k8s.Client, namespaces []string) {
+	ns := scopeNamespace(namespaces)
+	r.Capabilities.Events = r.checkAccess(ctx, client, sectionOptional,
+		k8s.ResourceAccess{Verb: "list", Resource: "events", Namespace: ns}, Warn,
+		"Pod events will not be shown; ask for list on events")
+	r.Capabilities.Logs = r.checkAccess(ctx, client, sectionOptional,
+		k8s.ResourceAccess{Verb: "get", Resource: "pods", Subresource: "log", Namespace: ns}, Warn,
+		"Pod logs will not be available; ask for get on pods/log")
+	r.Capabilities.Exec = r.checkAccess(ctx, client, sectionOptional,
+		k8s.ResourceAccess{Verb: "create", Resource: "pods", Subresource: "exec", Namespace: ns}, Warn,
+		"Shelling into containers will not be available; ask for create on pods/exec")
+	r.Capabilities.NodeProxy = r.checkAccess(ctx, client, sectionOptional,
+		k8s.ResourceAccess{Verb: "get", Resource: "nodes", Subresource: "proxy"}, Warn,
+		"Kubelet stats (disk usage, metrics without metrics-server) will not be available; ask for get on nodes/proxy")
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Package doctor runs preflight checks against a cluster: API reachability
+// and latency, RBAC permissions for every operation ktop uses, and
+// availability of the metrics API.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+)
+
+// String returns the report label of a status
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Warn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// Check is the result of one preflight check
+type Check struct {
+	Section string
+	Name    string
+	Status  Status
+	Detail  string
+	Hint    string // remediation, shown for warnings and failures
+
+	// kubeletFallback marks metrics-server failures that the kubelet
+	// metrics source can compensate for
+	kubeletFallback bool
+}
+
+// Report holds the results of all checks
+type Report struct {
+	ClusterInfo models.ClusterInfo
+	Checks      []Check
+
+	// Reachable is false when the API server could not be contacted, in
+	// which case no other checks ran and Capabilities is meaningless
+	Reachable    bool
+	Capabilities models.Capabilities
+}
+
+// Run checks the cluster behind client. namespaces is the pod scope ktop
+// will use; empty means cluster-wide.
+func Run(ctx context.Context, client *k8s.Client, namespaces []string) *Report {
+	r := &Report{ClusterInfo: client.ClusterInfo()}
+
+	r.Reachable = r.checkConnectivity(client)
+	if !r.Reachable {
+		return r
+	}
+	r.checkPods(ctx, client, namespaces)
+	r.checkNodes(ctx, client)
+	r.checkMetrics(ctx, client, namespaces)
+	r.checkOptional(ctx, client, namespaces)
+	r.applyKubeletFallback()
+	return r
+}
+
+// applyKubeletFallback downgrades metrics-server failures to warnings when
+// usage can be read from the kubelets instead
+func (r *Report) applyKubeletFallback() {
+	if !r.Capabilities.NodeProxy {
+		return
+	}
+	for i := range r.Checks {
+		if r.Checks[i].kubeletFallback && r.Checks[i].Status == Fail {
+			r.Checks[i].Status = Warn
+			r.Checks[i].Hint += "\nUntil then ktop reads usage from the kubelets (--metrics-source kubelet)"
+		}
+	}
+}
+
+// add records a check result
+func (r *Report) add(c Check) {
+	r.Checks = append(r.Checks, c)
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings returns the checks that did not pass
+func (r *Report) Warnings() []Check {
+	var result []Check
+	for _, c := range r.Checks {
+		if c.Status != Pass {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Write prints the report grouped by section, followed by a summary
+func (r *Report) Write(w io.Writer) {
+	info := r.ClusterInfo
+	fmt.Fprintf(w, "ktop doctor - context %s (cluster %s, %s)\n", info.Context, info.Name, info.Server)
+
+	section := ""
+	counts := map[Status]int{}
+	for _, c := range r.Checks {
+		if c.Section != section {
+			section = c.Section
+			fmt.Fprintf(w, "\n%s\n", section)
+		}
+		counts[c.Status]++
+		fmt.Fprintf(w, "  %s  %-36s %s\n", c.Status, c.Name, c.Detail)
+		if c.Status != Pass && c.Hint != "" {
+			for _, line := range strings.Split(c.Hint, "\n") {
+				fmt.Fprintf(w, "        → %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\nSummary: %d passed, %d warnings, %d failures\n", counts[Pass], counts[Warn], counts[Fail])
+}
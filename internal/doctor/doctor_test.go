@@ -0,0 +1,260 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// testCluster holds the fake clientsets behind a doctor run
+type testCluster struct {
+	core    *fake.Clientset
+	metrics *metricsfake.Clientset
+}
+
+// newTestCluster returns a cluster serving the metrics API that allows
+// every operation except those in denied, given in kubectl auth can-i
+// form, e.g. "list pods"
+func newTestCluster(denied ...string) *testCluster {
+	tc := &testCluster{
+		core:    fake.NewSimpleClientset(),
+		metrics: metricsfake.NewSimpleClientset(),
+	}
+	tc.core.Resources = []*metav1.APIResourceList{
+		{GroupVersion: "v1"},
+		{GroupVersion: metricsGroup + "/" + metricsVersion},
+	}
+	tc.core.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		access := k8s.ResourceAccess{
+			Verb:        attrs.Verb,
+			Group:       attrs.Group,
+			Resource:    attrs.Resource,
+			Subresource: attrs.Subresource,
+			Namespace:   attrs.Namespace,
+		}
+		review.Status.Allowed = true
+		for _, d := range denied {
+			if access.String() == d {
+				review.Status.Allowed = false
+				review.Status.Reason = "RBAC: no matching role"
+			}
+		}
+		return true, review, nil
+	})
+	return tc
+}
+
+func (tc *testCluster) run(namespaces ...string) *Report {
+	info := models.ClusterInfo{Name: "test", Context: "test", Namespace: "team-a"}
+	client := k8s.NewClientFromClientsets(tc.core, tc.metrics, info)
+	return Run(context.Background(), client, namespaces)
+}
+
+// findCheck returns the check named name
+func findCheck(t *testing.T, r *Report, name string) Check {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("check %q not found", name)
+	return Check{}
+}
+
+func TestRunAllowed(t *testing.T) {
+	r := newTestCluster().run()
+
+	if !r.Reachable {
+		t.Fatal("Reachable = false")
+	}
+	if r.Failed() {
+		t.Error("Failed() = true")
+	}
+	if w := r.Warnings(); len(w) != 0 {
+		t.Errorf("Warnings() = %+v, want none", w)
+	}
+	want := models.Capabilities{
+		ListNodes: true, NodeMetrics: true, PodMetrics: true,
+		Events: true, Logs: true, Exec: true, NodeProxy: true,
+	}
+	if r.Capabilities != want {
+		t.Errorf("Capabilities = %+v, want %+v", r.Capabilities, want)
+	}
+}
+
+func TestRunDenied(t *testing.T) {
+	r := newTestCluster("list nodes", "list pods.metrics.k8s.io -n team-a", "create pods/exec -n team-a", "get pods/log -n team-a").run("team-a")
+
+	if r.Failed() {
+		t.Error("Failed() = true, want optional denials as warnings")
+	}
+	want := models.Capabilities{NodeMetrics: true, Events: true, NodeProxy: true}
+	if r.Capabilities != want {
+		t.Errorf("Capabilities = %+v, want %+v", r.Capabilities, want)
+	}
+
+	names := make(map[string]bool)
+	for _, c := range r.Warnings() {
+		if c.Status != Warn {
+			t.Errorf("%s: status = %s, want WARN", c.Name, c.Status)
+		}
+		names[c.Name] = true
+	}
+	for _, name := range []string{"list nodes", "list pods.metrics.k8s.io -n team-a", "get pods/log -n team-a", "create pods/exec -n team-a"} {
+		if !names[name] {
+			t.Errorf("no warning for %q, got %v", name, names)
+		}
+	}
+	if c := findCheck(t, r, "list nodes"); !strings.Contains(c.Detail, "RBAC: no matching role") {
+		t.Errorf("list nodes detail = %q, want the denial reason", c.Detail)
+	}
+}
+
+func TestRunPods(t *testing.T) {
+	t.Run("context namespace fallback", func(t *testing.T) {
+		r := newTestCluster("list pods").run()
+		if r.Failed() {
+			t.Error("Failed() = true")
+		}
+		c := findCheck(t, r, "list pods")
+		if c.Status != Warn || !strings.Contains(c.Detail, "namespace team-a") {
+			t.Errorf("list pods = %s %q, want a warning naming team-a", c.Status, c.Detail)
+		}
+	})
+
+	t.Run("denied everywhere", func(t *testing.T) {
+		r := newTestCluster("list pods", "list pods -n team-a").run()
+		if !r.Failed() {
+			t.Error("Failed() = false")
+		}
+		if c := findCheck(t, r, "list pods -n team-a"); c.Status != Fail {
+			t.Errorf("status = %s, want FAIL", c.Status)
+		}
+	})
+
+	t.Run("watched namespaces", func(t *testing.T) {
+		r := newTestCluster("list pods -n team-b").run("team-a", "team-b")
+		if !r.Failed() {
+			t.Error("Failed() = false")
+		}
+		if c := findCheck(t, r, "list pods -n team-a"); c.Status != Pass {
+			t.Errorf("team-a status = %s, want PASS", c.Status)
+		}
+		if c := findCheck(t, r, "list pods -n team-b"); c.Status != Fail {
+			t.Errorf("team-b status = %s, want FAIL", c.Status)
+		}
+	})
+}
+
+func TestRunMetricsMissing(t *testing.T) {
+	t.Run("without node proxy", func(t *testing.T) {
+		tc := newTestCluster("get nodes/proxy")
+		tc.core.Resources = []*metav1.APIResourceList{{GroupVersion: "v1"}}
+		r := tc.run()
+
+		if !r.Failed() {
+			t.Error("Failed() = false")
+		}
+		c := findCheck(t, r, metricsGroup+" discovery")
+		if c.Status != Fail || !strings.Contains(c.Hint, "metrics-server") {
+			t.Errorf("discovery = %s %q, want FAIL with an install hint", c.Status, c.Hint)
+		}
+		if r.Capabilities.NodeMetrics || r.Capabilities.PodMetrics || r.Capabilities.NodeProxy {
+			t.Errorf("Capabilities = %+v, want no metrics", r.Capabilities)
+		}
+	})
+
+	t.Run("kubelet fallback", func(t *testing.T) {
+		tc := newTestCluster()
+		tc.core.Resources = []*metav1.APIResourceList{{GroupVersion: "v1"}}
+		r := tc.run()
+
+		if r.Failed() {
+			t.Error("Failed() = true, want the kubelets to stand in")
+		}
+		c := findCheck(t, r, metricsGroup+" discovery")
+		if c.Status != Warn || !strings.Contains(c.Hint, "--metrics-source kubelet") {
+			t.Errorf("discovery = %s %q, want WARN mentioning the kubelet source", c.Status, c.Hint)
+		}
+		if !r.Capabilities.NodeProxy || r.Capabilities.NodeMetrics {
+			t.Errorf("Capabilities = %+v", r.Capabilities)
+		}
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		tc := newTestCluster("get nodes/proxy")
+		tc.core.Resources = []*metav1.APIResourceList{{GroupVersion: metricsGroup + "/v1alpha1"}}
+		r := tc.run()
+
+		c := findCheck(t, r, metricsGroup+" discovery")
+		if c.Status != Fail || !strings.Contains(c.Detail, "v1alpha1") {
+			t.Errorf("discovery = %s %q, want FAIL listing v1alpha1", c.Status, c.Detail)
+		}
+	})
+}
+
+func TestRunMetricsNotServing(t *testing.T) {
+	tc := newTestCluster("get nodes/proxy")
+	tc.metrics.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("service unavailable")
+	})
+	r := tc.run()
+
+	if !r.Failed() {
+		t.Error("Failed() = false")
+	}
+	if c := findCheck(t, r, "metrics API responding"); c.Status != Fail {
+		t.Errorf("status = %s, want FAIL", c.Status)
+	}
+	if r.Capabilities.NodeMetrics || r.Capabilities.PodMetrics {
+		t.Errorf("Capabilities = %+v, want no metrics", r.Capabilities)
+	}
+}
+
+func TestRunAccessReviewFails(t *testing.T) {
+	tc := newTestCluster()
+	tc.core.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	r := tc.run()
+
+	if r.Failed() {
+		t.Error("Failed() = true")
+	}
+	// Permissions that cannot be checked are assumed granted
+	if !r.Capabilities.ListNodes || !r.Capabilities.Exec {
+		t.Errorf("Capabilities = %+v, want unverified permissions granted", r.Capabilities)
+	}
+	if c := findCheck(t, r, "list nodes"); c.Status != Warn {
+		t.Errorf("status = %s, want WARN", c.Status)
+	}
+}
+
+func TestRunUnreachable(t *testing.T) {
+	tc := newTestCluster()
+	tc.core.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	r := tc.run()
+
+	if r.Reachable || !r.Failed() {
+		t.Errorf("Reachable = %v, Failed() = %v", r.Reachable, r.Failed())
+	}
+	if len(r.Checks) != 1 {
+		t.Errorf("checks = %d, want only connectivity", len(r.Checks))
+	}
+}
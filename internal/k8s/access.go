@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceAccess describes an API operation to check permissions for
+type ResourceAccess struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	Namespace   string // empty for cluster-scoped or all-namespace checks
+}
+
+// String returns the operation in kubectl auth can-i form, e.g.
+// "list pods.metrics.k8s.io -n team-a"
+func (r ResourceAccess) String() string {
+	s := r.Verb + " " + r.Resource
+	if r.Subresource != "" {
+		s += "/" + r.Subresource
+	}
+	if r.Group != "" {
+		s += "." + r.Group
+	}
+	if r.Namespace != "" {
+		s += " -n " + r.Namespace
+	}
+	return s
+}
+
+// CanI asks the API server whether the current user may perform an
+// operation, using a SelfSubjectAccessReview
+func (c *Client) CanI(ctx context.Context, access ResourceAccess) (bool, string, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   access.Namespace,
+				Verb:        access.Verb,
+				Group:       access.Group,
+				Resource:    access.Resource,
+				Subresource: access.Subresource,
+			},
+		},
+	}
+	result, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("access review failed: %w", err)
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
+
+// APIGroupVersions returns the served versions of an API group and its
+// preferred version, or ok=false when the group is not registered
+func (c *Client) APIGroupVersions(group string) (versions []string, preferred string, ok bool, err error) {
+	groups, err := c.clientset.Discovery().ServerGroups()
+	if err != nil {
+		return nil, "", false, fmt.Errorf("API discovery failed: %w", err)
+	}
+	for _, g := range groups.Groups {
+		if g.Name != group {
+			continue
+		}
+		for _, v := range g.Versions {
+			versions = append(versions, v.Version)
+		}
+		return versions, g.PreferredVersion.Version, true, nil
+	}
+	return nil, "", false, nil
+}
+
+// Ping requests the server version and reports the round-trip time
+func (c *Client) Ping() (version string, latency time.Duration, err error) {
+	start := time.Now()
+	info, err := c.clientset.Discovery().ServerVersion()
+	latency = time.Since(start)
+	if err != nil {
+		return "", latency, fmt.Errorf("API server unreachable: %w", err)
+	}
+	return info.GitVersion, latency, nil
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -20,33 +23,50 @@ import (
 // Client wraps Kubernetes clients and provides cluster operations
 type Client struct {
 	config        *rest.Config
-	clientset     *kubernetes.Clientset
-	metricsClient *metricsv.Clientset
+	clientset     kubernetes.Interface
+	metricsClient metricsv.Interface
 	clusterInfo   models.ClusterInfo
 	rawConfig     *api.Config
 }
 
 // NewClient creates a new Kubernetes client from the given configuration
 func NewClient(cfg *config.Config) (*Client, error) {
-	var restConfig *rest.Config
-	var rawConfig *api.Config
-	var err error
-
 	// Try in-cluster config first
-	restConfig, err = rest.InClusterConfig()
-	if err != nil {
-		// Fall back to kubeconfig file
-		restConfig, rawConfig, err = loadKubeconfig(cfg.KubeconfigPath, cfg.Context)
+	restConfig, err := rest.InClusterConfig()
+	if err == nil {
+		client, err := newClient(cfg, restConfig, nil, cfg.Context)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+			return nil, err
 		}
+		client.clusterInfo.Namespace = inClusterNamespace()
+		return client, nil
+	}
+
+	// Fall back to kubeconfig file
+	return NewClientForContext(cfg, cfg.Context)
+}
+
+// NewClientForContext creates a client for a specific kubeconfig context,
+// ignoring any in-cluster configuration
+func NewClientForContext(cfg *config.Config, contextName string) (*Client, error) {
+	restConfig, rawConfig, err := loadKubeconfig(cfg.KubeconfigPath, contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
+	return newClient(cfg, restConfig, rawConfig, contextName)
+}
 
+// newClient creates the clientsets for a REST config
+func newClient(cfg *config.Config, restConfig *rest.Config, rawConfig *api.Config, contextName string) (*Client, error) {
 	// Set timeout from config
 	restConfig.Timeout = cfg.Timeout
 
-	// Create the main Kubernetes clientset
-	clientset, err := kubernetes.NewForConfig(restConfig)
+	// Create the main Kubernetes clientset. Core types are requested as
+	// protobuf, which is smaller and cheaper to decode than JSON.
+	coreConfig := rest.CopyConfig(restConfig)
+	coreConfig.ContentType = runtime.ContentTypeProtobuf
+	coreConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	clientset, err := kubernetes.NewForConfig(coreConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
@@ -58,7 +78,7 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	}
 
 	// Extract cluster info
-	clusterInfo := extractClusterInfo(restConfig, rawConfig, cfg.Context)
+	clusterInfo := extractClusterInfo(restConfig, rawConfig, contextName)
 
 	return &Client{
 		config:        restConfig,
@@ -69,13 +89,21 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	}, nil
 }
 
+// NewClientFromClientsets wraps existing clientsets, such as the fake
+// clientsets of a simulated cluster. The client has no kubeconfig, and
+// calls that need a real API server, such as the node proxy, fail.
+func NewClientFromClientsets(clientset kubernetes.Interface, metricsClient metricsv.Interface, info models.ClusterInfo) *Client {
+	return &Client{
+		clientset:     clientset,
+		metricsClient: metricsClient,
+		clusterInfo:   info,
+	}
+}
+
 // loadKubeconfig loads kubeconfig from file
 func loadKubeconfig(kubeconfigPath, contextName string) (*rest.Config, *api.Config, error) {
 	// Expand ~ in path
-	if kubeconfigPath[:2] == "~/" {
-		home, _ := os.UserHomeDir()
-		kubeconfigPath = filepath.Join(home, kubeconfigPath[2:])
-	}
+	kubeconfigPath = expandHome(kubeconfigPath)
 
 	// Build config loading rules
 	loadingRules := &clientcmd.ClientConfigLoadingRules{
@@ -139,12 +167,12 @@ func extractClusterInfo(restConfig *rest.Config, rawConfig *api.Config, contextO
 }
 
 // Clientset returns the Kubernetes clientset
-func (c *Client) Clientset() *kubernetes.Clientset {
+func (c *Client) Clientset() kubernetes.Interface {
 	return c.clientset
 }
 
 // MetricsClient returns the metrics clientset
-func (c *Client) MetricsClient() *metricsv.Clientset {
+func (c *Client) MetricsClient() metricsv.Interface {
 	return c.metricsClient
 }
 
@@ -163,15 +191,126 @@ func (c *Client) CheckMetricsAPIAvailable(ctx context.Context) error {
 	return nil
 }
 
+// NodeStatsSummary fetches the kubelet's /stats/summary of a node through
+// the API server's node proxy
+func (c *Client) NodeStatsSummary(ctx context.Context, node string) ([]byte, error) {
+	if c.config == nil {
+		return nil, fmt.Errorf("node proxy not available without an API server")
+	}
+	return c.clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(node).
+		SubResource("proxy").
+		Suffix("stats", "summary").
+		DoRaw(ctx)
+}
+
 // GetContexts returns available contexts from kubeconfig
 func (c *Client) GetContexts() []string {
 	if c.rawConfig == nil {
 		return nil
 	}
-	
-	contexts := make([]string, 0, len(c.rawConfig.Contexts))
-	for name := range c.rawConfig.Contexts {
+	return contextNames(c.rawConfig)
+}
+
+// ContextInfo describes a kubeconfig context
+type ContextInfo struct {
+	Name      string
+	Cluster   string
+	User      string
+	Namespace string
+	Current   bool // the kubeconfig's current-context
+}
+
+// GetContextDetails returns the kubeconfig contexts with their cluster,
+// user and namespace
+func (c *Client) GetContextDetails() []ContextInfo {
+	if c.rawConfig == nil {
+		return nil
+	}
+	return contextDetails(c.rawConfig)
+}
+
+// ListContexts returns the contexts defined in a kubeconfig file
+func ListContexts(kubeconfigPath string) ([]string, error) {
+	rawConfig, err := loadRawConfig(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return contextNames(rawConfig), nil
+}
+
+// ListContextDetails returns the contexts defined in a kubeconfig file
+// with their cluster, user and namespace
+func ListContextDetails(kubeconfigPath string) ([]ContextInfo, error) {
+	rawConfig, err := loadRawConfig(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return contextDetails(rawConfig), nil
+}
+
+// loadRawConfig loads a kubeconfig file without resolving a context
+func loadRawConfig(kubeconfigPath string) (*api.Config, error) {
+	loadingRules := &clientcmd.ClientConfigLoadingRules{
+		ExplicitPath: expandHome(kubeconfigPath),
+	}
+	rawConfig, err := loadingRules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return rawConfig, nil
+}
+
+// contextDetails returns the contexts of a kubeconfig, sorted by name
+func contextDetails(rawConfig *api.Config) []ContextInfo {
+	names := contextNames(rawConfig)
+	details := make([]ContextInfo, 0, len(names))
+	for _, name := range names {
+		ctx := rawConfig.Contexts[name]
+		details = append(details, ContextInfo{
+			Name:      name,
+			Cluster:   ctx.Cluster,
+			User:      ctx.AuthInfo,
+			Namespace: ctx.Namespace,
+			Current:   name == rawConfig.CurrentContext,
+		})
+	}
+	return details
+}
+
+// contextNames returns the sorted context names of a kubeconfig
+func contextNames(rawConfig *api.Config) []string {
+	contexts := make([]string, 0, len(rawConfig.Contexts))
+	for name := range rawConfig.Contexts {
 		contexts = append(contexts, name)
 	}
+	sort.Strings(contexts)
 	return contexts
 }
+
+// serviceAccountNamespace is the file holding the namespace of the pod's
+// service account
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// inClusterNamespace returns the namespace ktop runs in: POD_NAMESPACE,
+// e.g. set from the downward API, or that of its service account
+func inClusterNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	data, err := os.ReadFile(serviceAccountNamespace)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// expandHome expands a leading ~/ in a path
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -20,59 +23,290 @@ import (
 
 // Collector fetches and aggregates Kubernetes metrics
 type Collector struct {
-	client *k8s.Client
-	config *config.Config
+	client  *k8s.Client
+	config  *config.Config
+	source  Source
+	history *History
+
+	// backfill loads past usage into the history after the first
+	// collection, when the source supports it; backfillDone is closed
+	// once it finished, and nil when it never started
+	backfill     sync.Once
+	backfillDone chan struct{}
+
+	// collectMu serializes collections, which share the results below
+	collectMu sync.Mutex
+
+	// Results of the last successful fetch of each source, shown when a
+	// later fetch fails, and when each source last succeeded
+	lastNodes   []corev1.Node
+	lastPods    []corev1.Pod
+	lastUsage   *Usage
+	lastSuccess map[string]time.Time
+
+	// podList is a pod list still running when its collection was
+	// published; the next collection picks it up instead of listing again
+	podList *pendingFetch[[]corev1.Pod]
 
 	// Cached data
 	mu          sync.RWMutex
 	lastMetrics *models.ClusterMetrics
 	namespaces  []string
+
+	// scope is the namespaces pod calls are limited to; empty means
+	// cluster-wide. It is settled once pods were listed, possibly after
+	// falling back to the context's namespace.
+	scope   []string
+	settled bool
+
+	// caps disables calls the preflight checks found unusable; nil tries
+	// everything
+	caps *models.Capabilities
 }
 
-// NewCollector creates a new metrics collector
+// defaultHistoryWindow is how much usage history is kept when no longer
+// Prometheus backfill is configured
+const defaultHistoryWindow = time.Hour
+
+// backfillTimeout bounds the range queries loading past usage
+const backfillTimeout = time.Minute
+
+// podListGrace is how long a collection waits for the pod list once the
+// nodes and usage are in, before it shows the last pod list instead
+const podListGrace = time.Second
+
+// errPodListPending is the status of a pod list that is still running
+var errPodListPending = errors.New("still listing pods")
+
+// NewCollector creates a new metrics collector reading usage from the
+// source selected by cfg.MetricsSource
 func NewCollector(client *k8s.Client, cfg *config.Config) *Collector {
+	source, err := NewSource(cfg, client)
+	if err != nil {
+		// Keep running and show why there is no usage
+		source = &unavailableSource{name: cfg.MetricsSource, err: err}
+	}
+	window := max(defaultHistoryWindow, cfg.Prometheus.Backfill.Duration)
+	if cfg.Command == "rightsize" {
+		// Keep everything ktop rightsize samples
+		window = max(window, cfg.SampleDuration)
+	}
 	return &Collector{
-		client: client,
-		config: cfg,
+		client:  client,
+		config:  cfg,
+		source:  source,
+		history: NewHistory(window),
+		scope:   append([]string(nil), cfg.Namespaces...),
+		settled: len(cfg.Namespaces) > 0,
+
+		lastSuccess: make(map[string]time.Time),
 	}
 }
 
-// Collect fetches all metrics from the cluster
+// SetCapabilities skips the API calls caps marks as unavailable, so that
+// missing permissions or a missing metrics API do not surface as errors
+func (c *Collector) SetCapabilities(caps models.Capabilities) {
+	c.mu.Lock()
+	c.caps = &caps
+	c.mu.Unlock()
+
+	if aware, ok := c.source.(capabilityAware); ok {
+		aware.applyCapabilities(caps)
+	}
+}
+
+// capabilities returns the usable features; all of them when no
+// preflight results were set
+func (c *Collector) capabilities() models.Capabilities {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.caps == nil {
+		return models.Capabilities{
+			ListNodes: true, NodeMetrics: true, PodMetrics: true,
+			Events: true, Logs: true, Exec: true, NodeProxy: true,
+		}
+	}
+	return *c.caps
+}
+
+// Names of the node and pod list sources in ClusterMetrics.Sources; usage
+// is reported under the name of the metrics source
+const (
+	sourceNodeList = "nodes"
+	sourcePodList  = "pods"
+)
+
+// fetchResult is the outcome of one fetch of a collection
+type fetchResult[T any] struct {
+	value   T
+	err     error
+	latency time.Duration
+}
+
+// fetch runs f until deadline and measures it
+func fetch[T any](ctx context.Context, deadline time.Time, f func(context.Context) (T, error)) fetchResult[T] {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	start := time.Now()
+	value, err := f(ctx)
+	return fetchResult[T]{value: value, err: err, latency: time.Since(start)}
+}
+
+// pendingFetch is a fetch running in the background; result is set when
+// done is closed
+type pendingFetch[T any] struct {
+	start  time.Time
+	done   chan struct{}
+	result fetchResult[T]
+}
+
+// startFetch runs f in the background until deadline. The fetch is not
+// cancelled with ctx, so it may outlive the collection that started it.
+func startFetch[T any](ctx context.Context, deadline time.Time, f func(context.Context) (T, error)) *pendingFetch[T] {
+	p := &pendingFetch[T]{start: time.Now(), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.result = fetch(context.WithoutCancel(ctx), deadline, f)
+	}()
+	return p
+}
+
+// settle records the status of a fetch in m and returns the data to show.
+// When the fetch failed without returning anything usable, the data of the
+// last successful fetch is shown instead and the source is stale.
+func settle[T any](c *Collector, m *models.ClusterMetrics, name string, r fetchResult[T], last *T, empty func(T) bool) T {
+	status := models.SourceStatus{Name: name, State: models.SourceOK, Latency: r.latency, Err: r.err}
+	value := r.value
+	if r.err == nil {
+		*last = value
+		c.lastSuccess[name] = m.Timestamp
+	} else {
+		status.State = models.SourceFailed
+		if empty(value) && !c.lastSuccess[name].IsZero() {
+			value = *last
+			status.State = models.SourceStale
+		}
+	}
+	status.LastSuccess = c.lastSuccess[name]
+	m.Sources = append(m.Sources, status)
+	return value
+}
+
+// Collect fetches all metrics from the cluster. The node list, pod list
+// and usage are fetched concurrently, all within the configured timeout.
+// A slow pod list does not hold up the nodes: once they and the usage are
+// in, the collection waits podListGrace at most, then shows the last pod
+// list as stale and picks the running one up next time. A failed source is
+// reported in ClusterMetrics.Sources; an error is returned only when
+// nothing could be fetched.
 func (c *Collector) Collect(ctx context.Context) (*models.ClusterMetrics, error) {
+	c.collectMu.Lock()
+	defer c.collectMu.Unlock()
+
 	metrics := &models.ClusterMetrics{
 		Timestamp:   time.Now(),
 		ClusterInfo: c.client.ClusterInfo(),
 	}
+	caps := c.capabilities()
+	deadline := metrics.Timestamp.Add(c.config.Timeout)
 
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
-	defer cancel()
-
-	// Fetch node data (status, capacity, etc.)
-	nodes, err := c.fetchNodes(ctx)
-	if err != nil {
-		metrics.Error = fmt.Errorf("failed to fetch nodes: %w", err)
-		return metrics, err
+	podList := c.podList
+	if podList == nil {
+		podList = startFetch(ctx, deadline, c.fetchPods)
+	}
+	var (
+		nodesRes  fetchResult[[]corev1.Node]
+		podsRes   fetchResult[[]corev1.Pod]
+		usageRes  fetchResult[*Usage]
+		query     UsageQuery
+		nodesDone = make(chan struct{})
+		wg        sync.WaitGroup
+	)
+	// Namespace-scoped accounts may not list nodes; pods are shown alone
+	nodesForbidden := func() bool {
+		return !caps.ListNodes || apierrors.IsForbidden(nodesRes.err)
 	}
 
-	// Fetch node metrics
-	nodeMetrics, err := c.fetchNodeMetrics(ctx)
-	if err != nil {
-		// Metrics might not be available, continue with what we have
-		metrics.Error = fmt.Errorf("failed to fetch node metrics: %w", err)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(nodesDone)
+		if caps.ListNodes {
+			nodesRes = fetch(ctx, deadline, c.fetchNodes)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Usage is fetched for the listed nodes and, once the first pod
+		// list has settled the namespace scope, for the scope
+		<-nodesDone
+		if !c.scopeSettled() {
+			<-podList.done
+		}
+		for _, n := range nodesRes.value {
+			query.Nodes = append(query.Nodes, n.Name)
+		}
+		query.Namespaces = c.Scope()
+		query.NodeUsage = !nodesForbidden()
+		query.NodeSelector = c.config.NodeSelector
+		query.PodSelector = c.config.Selector
+		usageRes = fetch(ctx, deadline, func(ctx context.Context) (*Usage, error) {
+			return c.source.Usage(ctx, query)
+		})
+	}()
+	wg.Wait()
+
+	// Without an earlier pod list to show, the collection waits for it
+	var grace <-chan time.Time
+	if !c.lastSuccess[sourcePodList].IsZero() {
+		grace = time.After(podListGrace)
+	}
+	select {
+	case <-podList.done:
+		podsRes, c.podList = podList.result, nil
+	case <-grace:
+		podsRes = fetchResult[[]corev1.Pod]{err: errPodListPending, latency: time.Since(podList.start)}
+		c.podList = podList
 	}
 
-	// Merge node info with metrics
-	metrics.Nodes = c.mergeNodeData(nodes, nodeMetrics)
+	var nodes []corev1.Node
+	if nodesForbidden() {
+		metrics.NodesForbidden = true
+	} else {
+		nodes = settle(c, metrics, sourceNodeList, nodesRes, &c.lastNodes, func(v []corev1.Node) bool { return v == nil })
+	}
+	pods := settle(c, metrics, sourcePodList, podsRes, &c.lastPods, func(v []corev1.Pod) bool { return v == nil })
+	usage := settle(c, metrics, c.source.Name(), usageRes, &c.lastUsage, func(v *Usage) bool {
+		return v == nil || (len(v.Nodes) == 0 && len(v.Pods) == 0)
+	})
+	if usage == nil {
+		usage = newUsage()
+	}
 
-	// Fetch pod data and metrics
-	pods, err := c.fetchPodMetrics(ctx)
-	if err != nil {
-		if metrics.Error == nil {
-			metrics.Error = fmt.Errorf("failed to fetch pod metrics: %w", err)
-		}
+	if metrics.Sources[len(metrics.Sources)-1].State != models.SourceStale {
+		c.history.Record(metrics.Timestamp, usage)
+	}
+	if src, ok := c.source.(historySource); ok && c.config.Prometheus.Backfill.Duration > 0 {
+		c.backfill.Do(func() {
+			done := make(chan struct{})
+			c.mu.Lock()
+			c.backfillDone = done
+			c.mu.Unlock()
+			// The backfill outlives this collection, whose context ends
+			// when it returns; backfillTimeout bounds it instead
+			go func() {
+				defer close(done)
+				c.backfillHistory(context.WithoutCancel(ctx), src, query)
+			}()
+		})
 	}
-	metrics.Pods = pods
+	metrics.MetricsSource = c.source.Name()
+	metrics.MetricsUnavailable = usage.PodsSkipped || (!metrics.NodesForbidden && usage.NodesSkipped)
+
+	// Merge pod info first so node pod counts come from this collection
+	metrics.Pods = c.mergePodData(pods, usage)
+	metrics.Nodes = c.mergeNodeData(nodes, usage.Nodes, loadPerNode(metrics.Pods))
+	metrics.Namespaces = c.Scope()
 
 	// Calculate aggregates
 	c.calculateAggregates(metrics)
@@ -82,53 +316,60 @@ func (c *Collector) Collect(ctx context.Context) (*models.ClusterMetrics, error)
 	c.lastMetrics = metrics
 	c.mu.Unlock()
 
-	return metrics, nil
+	return metrics, collectionError(metrics)
 }
 
-// fetchNodes fetches node information from the API
-func (c *Collector) fetchNodes(ctx context.Context) ([]corev1.Node, error) {
-	nodeList, err := c.client.Clientset().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+// collectionError returns the error of the first source when no source
+// succeeded, e.g. because the cluster is unreachable
+func collectionError(m *models.ClusterMetrics) error {
+	for _, s := range m.Sources {
+		if s.State == models.SourceOK {
+			return nil
+		}
 	}
-	return nodeList.Items, nil
-}
-
-// nodeMetricData holds raw node metrics from the metrics API
-type nodeMetricData struct {
-	CPU    int64 // millicores
-	Memory int64 // bytes
-}
-
-// fetchNodeMetrics fetches metrics from the metrics API
-func (c *Collector) fetchNodeMetrics(ctx context.Context) (map[string]nodeMetricData, error) {
-	metricsList, err := c.client.MetricsClient().MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+	if len(m.Sources) == 0 {
+		return nil
 	}
+	return fmt.Errorf("failed to fetch %s: %w", m.Sources[0].Name, m.Sources[0].Err)
+}
 
-	result := make(map[string]nodeMetricData)
-	for _, nm := range metricsList.Items {
-		result[nm.Name] = nodeMetricData{
-			CPU:    nm.Usage.Cpu().MilliValue(),
-			Memory: nm.Usage.Memory().Value(),
+// fetchNodes fetches node information from the API
+func (c *Collector) fetchNodes(ctx context.Context) ([]corev1.Node, error) {
+	opts := metav1.ListOptions{LabelSelector: c.config.NodeSelector}
+	return listAll(ctx, opts, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Node, string, error) {
+		nodeList, err := c.client.Clientset().CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			return nil, "", err
 		}
-	}
-	return result, nil
+		return nodeList.Items, nodeList.Continue, nil
+	}, stripNode)
 }
 
-// mergeNodeData combines node status with metrics
-func (c *Collector) mergeNodeData(nodes []corev1.Node, metrics map[string]nodeMetricData) []models.Node {
+// mergeNodeData combines node status with metrics and the pods scheduled
+// on each node
+func (c *Collector) mergeNodeData(nodes []corev1.Node, metrics map[string]Sample, loads map[string]nodeLoad) []models.Node {
 	result := make([]models.Node, 0, len(nodes))
 
 	for _, n := range nodes {
 		node := models.Node{
-			Name:   n.Name,
-			Labels: n.Labels,
+			Name:      n.Name,
+			Labels:    n.Labels,
+			CreatedAt: n.CreationTimestamp.Time,
+			Version:   n.Status.NodeInfo.KubeletVersion,
+		}
+		for _, addr := range n.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				node.InternalIP = addr.Address
+				break
+			}
 		}
 
 		// Get node status
 		node.Status = c.getNodeStatus(n)
+		node.Unschedulable = n.Spec.Unschedulable
+		for _, t := range n.Spec.Taints {
+			node.Taints = append(node.Taints, models.Taint{Key: t.Key, Value: t.Value, Effect: string(t.Effect)})
+		}
 
 		// Get capacity
 		cpuCap := n.Status.Capacity.Cpu()
@@ -136,6 +377,8 @@ func (c *Collector) mergeNodeData(nodes []corev1.Node, metrics map[string]nodeMe
 
 		node.CPU.Capacity = cpuCap.MilliValue()
 		node.Memory.Capacity = memCap.Value()
+		node.CPUAllocatable = n.Status.Allocatable.Cpu().MilliValue()
+		node.MemoryAllocatable = n.Status.Allocatable.Memory().Value()
 
 		// Get disk capacity if available
 		if ephStorage, ok := n.Status.Capacity[corev1.ResourceEphemeralStorage]; ok {
@@ -146,6 +389,12 @@ func (c *Collector) mergeNodeData(nodes []corev1.Node, metrics map[string]nodeMe
 		if m, ok := metrics[n.Name]; ok {
 			node.CPU.Current = m.CPU
 			node.Memory.Current = m.Memory
+			node.Disk.Current = m.Disk
+			node.NetworkRx = m.NetworkRx
+			node.NetworkTx = m.NetworkTx
+			if node.Disk.Capacity > 0 {
+				node.Disk.Percent = float64(m.Disk) / float64(node.Disk.Capacity) * 100
+			}
 
 			if node.CPU.Capacity > 0 {
 				node.CPU.Percent = float64(m.CPU) / float64(node.CPU.Capacity) * 100
@@ -158,8 +407,13 @@ func (c *Collector) mergeNodeData(nodes []corev1.Node, metrics map[string]nodeMe
 		// Get conditions
 		node.Conditions = c.getNodeConditions(n)
 
-		// Count pods on this node
-		node.PodCount = c.countPodsOnNode(n.Name)
+		// Pods on this node against the kubelet's max-pods, and what
+		// they request
+		load := loads[n.Name]
+		node.PodCount = load.pods
+		node.PodCapacity = int(n.Status.Allocatable.Pods().Value())
+		node.CPURequests = load.cpuRequests
+		node.MemoryRequests = load.memoryRequests
 
 		// Check for GPU
 		node.GPU = c.getGPUInfo(n)
@@ -204,22 +458,29 @@ func (c *Collector) getNodeConditions(node corev1.Node) models.NodeConditions {
 	return conditions
 }
 
-// countPodsOnNode returns the number of pods running on a node
-func (c *Collector) countPodsOnNode(nodeName string) int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.lastMetrics == nil {
-		return 0
-	}
+// nodeLoad is the number of pods scheduled on a node and their requests
+type nodeLoad struct {
+	pods           int
+	cpuRequests    int64 // millicores
+	memoryRequests int64 // bytes
+}
 
-	count := 0
-	for _, pod := range c.lastMetrics.Pods {
-		if pod.NodeName == nodeName {
-			count++
+// loadPerNode sums up the pods scheduled on each node. Completed pods are
+// left out since they no longer count against the node's pod limit or
+// hold their requests.
+func loadPerNode(pods []models.Pod) map[string]nodeLoad {
+	loads := make(map[string]nodeLoad)
+	for _, pod := range pods {
+		if pod.NodeName == "" || pod.Status == models.PodStatusSucceeded || pod.Status == models.PodStatusFailed {
+			continue
 		}
+		load := loads[pod.NodeName]
+		load.pods++
+		load.cpuRequests += pod.CPURequest
+		load.memoryRequests += pod.MemoryRequest
+		loads[pod.NodeName] = load
 	}
-	return count
+	return loads
 }
 
 // getGPUInfo extracts GPU information from node labels and capacity
@@ -253,43 +514,48 @@ func (c *Collector) getGPUInfo(node corev1.Node) *models.GPUInfo {
 	return info
 }
 
-// fetchPodMetrics fetches pod information and metrics
-func (c *Collector) fetchPodMetrics(ctx context.Context) ([]models.Pod, error) {
-	// Fetch pod metrics
-	podMetricsList, err := c.client.MetricsClient().MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a map of metrics by namespace/name
-	metricsMap := make(map[string]struct {
-		CPU    int64
-		Memory int64
-	})
-	for _, pm := range podMetricsList.Items {
-		key := pm.Namespace + "/" + pm.Name
-		var cpu, mem int64
-		for _, container := range pm.Containers {
-			cpu += container.Usage.Cpu().MilliValue()
-			mem += container.Usage.Memory().Value()
+// fetchPods lists the pods in scope. Without cluster-wide access the
+// scope falls back to the context's namespace.
+func (c *Collector) fetchPods(ctx context.Context) ([]corev1.Pod, error) {
+	scope := c.Scope()
+	podItems, err := c.listPods(ctx, scope)
+	if err != nil && len(scope) == 0 && apierrors.IsForbidden(err) {
+		// Without cluster-wide access, fall back to the context's namespace
+		scope = []string{c.defaultNamespace()}
+		podItems, err = c.listPods(ctx, scope)
+		if err == nil {
+			c.mu.Lock()
+			c.scope = scope
+			c.mu.Unlock()
 		}
-		metricsMap[key] = struct {
-			CPU    int64
-			Memory int64
-		}{CPU: cpu, Memory: mem}
 	}
-
-	// Fetch pod info for status and other details
-	podList, err := c.client.Clientset().CoreV1().Pods("").List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
+	c.mu.Lock()
+	c.settled = true
+	c.mu.Unlock()
+	return podItems, nil
+}
 
-	// Update namespace list
+// scopeSettled reports whether the pod scope is known; until then it may
+// still fall back to the context's namespace
+func (c *Collector) scopeSettled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.settled
+}
+
+// mergePodData converts pods and combines them with their usage
+func (c *Collector) mergePodData(podItems []corev1.Pod, usage *Usage) []models.Pod {
+	// Update namespace list; scoped namespaces are listed even when empty
 	nsSet := make(map[string]bool)
-	result := make([]models.Pod, 0, len(podList.Items))
+	for _, ns := range c.Scope() {
+		nsSet[ns] = true
+	}
+	result := make([]models.Pod, 0, len(podItems))
 
-	for _, p := range podList.Items {
+	for _, p := range podItems {
 		nsSet[p.Namespace] = true
 
 		pod := models.Pod{
@@ -298,18 +564,57 @@ func (c *Collector) fetchPodMetrics(ctx context.Context) ([]models.Pod, error) {
 			NodeName:       p.Spec.NodeName,
 			Status:         c.getPodStatus(p),
 			ContainerCount: len(p.Spec.Containers),
+			Labels:         p.Labels,
+			CreatedAt:      p.CreationTimestamp.Time,
+			IP:             p.Status.PodIP,
+			QOSClass:       string(p.Status.QOSClass),
+			Workload:       workloadOf(&p),
+		}
+
+		// Containers with their requests, limits and usage; the pod
+		// sums them up
+		key := p.Namespace + "/" + p.Name
+		containerUsage := usage.Containers[key]
+		pod.Containers = make([]models.Container, len(p.Spec.Containers))
+		for i, container := range p.Spec.Containers {
+			ctr := models.Container{
+				Name:          container.Name,
+				State:         "Waiting",
+				CPU:           containerUsage[container.Name].CPU,
+				Memory:        containerUsage[container.Name].Memory,
+				CPURequest:    container.Resources.Requests.Cpu().MilliValue(),
+				CPULimit:      container.Resources.Limits.Cpu().MilliValue(),
+				MemoryRequest: container.Resources.Requests.Memory().Value(),
+				MemoryLimit:   container.Resources.Limits.Memory().Value(),
+			}
+			pod.CPURequest += ctr.CPURequest
+			pod.CPULimit += ctr.CPULimit
+			pod.MemoryRequest += ctr.MemoryRequest
+			pod.MemoryLimit += ctr.MemoryLimit
+			if gpus, ok := container.Resources.Requests["nvidia.com/gpu"]; ok {
+				pod.GPURequest += gpus.Value()
+			}
+			pod.Containers[i] = ctr
 		}
 
-		// Get restart count
+		// Get restart counts and container states
 		for _, cs := range p.Status.ContainerStatuses {
 			pod.RestartCount += cs.RestartCount
+			for i := range pod.Containers {
+				if pod.Containers[i].Name == cs.Name {
+					pod.Containers[i].RestartCount = cs.RestartCount
+					pod.Containers[i].State = containerState(cs.State)
+				}
+			}
 		}
 
 		// Apply metrics if available
-		key := p.Namespace + "/" + p.Name
-		if m, ok := metricsMap[key]; ok {
+		if m, ok := usage.Pods[key]; ok {
 			pod.CPU = m.CPU
 			pod.Memory = m.Memory
+			pod.NetworkRx = m.NetworkRx
+			pod.NetworkTx = m.NetworkTx
+			pod.CPUThrottled = m.Throttled * 100
 		}
 
 		result = append(result, pod)
@@ -324,7 +629,82 @@ func (c *Collector) fetchPodMetrics(ctx context.Context) ([]models.Pod, error) {
 	sort.Strings(c.namespaces)
 	c.mu.Unlock()
 
-	return result, nil
+	return result
+}
+
+// listPods lists the pods of the given namespaces, or of all namespaces
+// when none are given, that match the configured selectors
+func (c *Collector) listPods(ctx context.Context, namespaces []string) ([]corev1.Pod, error) {
+	var items []corev1.Pod
+	opts := metav1.ListOptions{LabelSelector: c.config.Selector, FieldSelector: c.config.FieldSelector}
+	for _, ns := range scopeOrAll(namespaces) {
+		pods, err := listAll(ctx, opts, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Pod, string, error) {
+			podList, err := c.client.Clientset().CoreV1().Pods(ns).List(ctx, opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return podList.Items, podList.Continue, nil
+		}, stripPod)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pods...)
+	}
+	return items, nil
+}
+
+// scopeOrAll returns the namespaces to query; "" selects all namespaces
+func scopeOrAll(namespaces []string) []string {
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+// defaultNamespace returns the namespace of the kubeconfig context
+func (c *Collector) defaultNamespace() string {
+	if ns := c.client.ClusterInfo().Namespace; ns != "" {
+		return ns
+	}
+	return metav1.NamespaceDefault
+}
+
+// Scope returns the namespaces pod calls are limited to; empty means
+// cluster-wide
+func (c *Collector) Scope() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.scope
+}
+
+// workloadOf returns the controller of a pod as kind/name. Pods of a
+// Deployment are owned by one of its ReplicaSets, named after it with the
+// pod-template-hash appended.
+func workloadOf(p *corev1.Pod) string {
+	owner := metav1.GetControllerOf(p)
+	if owner == nil {
+		return "Pod/" + p.Name
+	}
+	if hash := p.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && strings.HasSuffix(owner.Name, "-"+hash) {
+		return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// containerState describes a container state: Running, or the reason
+// it is waiting or terminated, e.g. CrashLoopBackOff or Completed
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Waiting != nil && state.Waiting.Reason != "":
+		return state.Waiting.Reason
+	case state.Terminated != nil && state.Terminated.Reason != "":
+		return state.Terminated.Reason
+	case state.Terminated != nil:
+		return "Terminated"
+	}
+	return "Waiting"
 }
 
 // getPodStatus determines the pod status
@@ -370,6 +750,47 @@ func (c *Collector) calculateAggregates(metrics *models.ClusterMetrics) {
 	}
 }
 
+// backfillHistory loads the usage of the configured backfill period, up
+// to the history window, from the source
+func (c *Collector) backfillHistory(ctx context.Context, src historySource, q UsageQuery) {
+	ctx, cancel := context.WithTimeout(ctx, backfillTimeout)
+	defer cancel()
+
+	end := time.Now()
+	start := end.Add(-min(c.config.Prometheus.Backfill.Duration, c.history.Window()))
+	past, err := src.UsageRange(ctx, q, start, end, c.history.Resolution())
+	if err != nil {
+		// The history then only starts with ktop; live usage is unaffected
+		return
+	}
+	c.history.Backfill(past)
+}
+
+// WaitBackfill waits until past usage was loaded into the history, or ctx
+// ends. It returns at once when the source does not backfill.
+func (c *Collector) WaitBackfill(ctx context.Context) {
+	c.mu.RLock()
+	done := c.backfillDone
+	c.mu.RUnlock()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// History returns the usage history recorded by the collector
+func (c *Collector) History() *History {
+	return c.history
+}
+
+// Client returns the Kubernetes client the collector reads from
+func (c *Collector) Client() *k8s.Client {
+	return c.client
+}
+
 // GetNamespaces returns the list of available namespaces
 func (c *Collector) GetNamespaces() []string {
 	c.mu.RLock()
@@ -412,6 +833,11 @@ func FormatMemory(bytes int64) string {
 	}
 }
 
+// FormatRate formats a byte rate for display
+func FormatRate(bytesPerSecond int64) string {
+	return FormatMemory(bytesPerSecond) + "/s"
+}
+
 // FormatPercent formats a percentage for display
 func FormatPercent(percent float64) string {
 	return fmt.Sprintf("%.1f%%", percent)
@@ -426,53 +852,60 @@ func ParseResourceQuantity(s string) (int64, error) {
 	return q.Value(), nil
 }
 
-// SortNodes sorts nodes by the specified field
+// SortNodes sorts nodes by the specified field. Nodes that compare equal
+// are ordered by name, so rows keep their place between refreshes.
 func SortNodes(nodes []models.Node, field models.SortField, ascending bool) {
-	sort.Slice(nodes, func(i, j int) bool {
-		var less bool
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := &nodes[i], &nodes[j]
+		var c int
 		switch field {
-		case models.SortNodeName:
-			less = strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
 		case models.SortNodeCPU:
-			less = nodes[i].CPU.Percent < nodes[j].CPU.Percent
+			c = cmp.Compare(a.CPU.Percent, b.CPU.Percent)
 		case models.SortNodeMemory:
-			less = nodes[i].Memory.Percent < nodes[j].Memory.Percent
+			c = cmp.Compare(a.Memory.Percent, b.Memory.Percent)
 		case models.SortNodeStatus:
-			less = nodes[i].Status < nodes[j].Status
+			c = cmp.Compare(a.Status, b.Status)
 		case models.SortNodePods:
-			less = nodes[i].PodCount < nodes[j].PodCount
+			c = cmp.Compare(a.PodCount, b.PodCount)
 		default:
-			less = nodes[i].Name < nodes[j].Name
+			c = cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
 		}
-		if ascending {
-			return less
+		if !ascending {
+			c = -c
 		}
-		return !less
+		if c == 0 {
+			c = cmp.Compare(a.Name, b.Name)
+		}
+		return c < 0
 	})
 }
 
-// SortPods sorts pods by the specified field
+// SortPods sorts pods by the specified field. Pods that compare equal are
+// ordered by namespace and name, so rows keep their place between
+// refreshes.
 func SortPods(pods []models.Pod, field models.SortField, ascending bool) {
-	sort.Slice(pods, func(i, j int) bool {
-		var less bool
+	sort.SliceStable(pods, func(i, j int) bool {
+		a, b := &pods[i], &pods[j]
+		var c int
 		switch field {
 		case models.SortPodNamespace:
-			less = strings.ToLower(pods[i].Namespace) < strings.ToLower(pods[j].Namespace)
-		case models.SortPodName:
-			less = strings.ToLower(pods[i].Name) < strings.ToLower(pods[j].Name)
+			c = cmp.Compare(strings.ToLower(a.Namespace), strings.ToLower(b.Namespace))
 		case models.SortPodCPU:
-			less = pods[i].CPU < pods[j].CPU
+			c = cmp.Compare(a.CPU, b.CPU)
 		case models.SortPodMemory:
-			less = pods[i].Memory < pods[j].Memory
+			c = cmp.Compare(a.Memory, b.Memory)
 		case models.SortPodStatus:
-			less = pods[i].Status < pods[j].Status
+			c = cmp.Compare(a.Status, b.Status)
 		default:
-			less = pods[i].Name < pods[j].Name
+			c = cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		if !ascending {
+			c = -c
 		}
-		if ascending {
-			return less
+		if c == 0 {
+			c = cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
 		}
-		return !less
+		return c < 0
 	})
 }
 
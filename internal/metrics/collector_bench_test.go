@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// benchCluster builds a synthetic cluster of pods spread over nodes of
+// 100 pods each. Pods carry the managed fields, annotations and
+// environment that real ones do, so stripping them is measured too.
+func benchCluster(b *testing.B, pods int) *testCluster {
+	b.Helper()
+	nodes := (pods + 99) / 100
+	objects := make([]runtime.Object, 0, nodes+pods)
+	for i := range nodes {
+		objects = append(objects, testNode(fmt.Sprintf("node-%d", i), 16000, 64*1024*mi, corev1.ConditionTrue))
+	}
+	for i := range pods {
+		p := testPod(fmt.Sprintf("ns-%d", i%50), fmt.Sprintf("pod-%d", i), fmt.Sprintf("node-%d", i%nodes), corev1.PodRunning, 0)
+		p.Annotations = map[string]string{
+			"kubectl.kubernetes.io/last-applied-configuration": `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod"}}`,
+		}
+		p.ManagedFields = []metav1.ManagedFieldsEntry{
+			{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate},
+			{Manager: "kubelet", Operation: metav1.ManagedFieldsOperationUpdate, Subresource: "status"},
+		}
+		for j := range 10 {
+			p.Spec.Containers[0].Env = append(p.Spec.Containers[0].Env,
+				corev1.EnvVar{Name: fmt.Sprintf("VAR_%d", j), Value: "value"})
+		}
+		objects = append(objects, p)
+	}
+
+	tc := newTestCluster(objects...)
+	for i := range nodes {
+		tc.addNodeMetrics(b, fmt.Sprintf("node-%d", i), 8000, 32*1024*mi)
+	}
+	for i := range pods {
+		tc.addPodMetrics(b, fmt.Sprintf("ns-%d", i%50), fmt.Sprintf("pod-%d", i), 50, 64*mi)
+	}
+	return tc
+}
+
+// BenchmarkCollect reports the time and allocations of one collection of
+// a large cluster. Run with
+//
+//	go test ./internal/metrics -run '^$' -bench Collect -benchmem
+func BenchmarkCollect(b *testing.B) {
+	for _, pods := range []int{10_000, 50_000} {
+		b.Run(fmt.Sprintf("pods=%d", pods), func(b *testing.B) {
+			tc := benchCluster(b, pods)
+			c := tc.collector()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				m, err := c.Collect(context.Background())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(m.Pods) != pods {
+					b.Fatalf("collected %d pods, want %d", len(m.Pods), pods)
+				}
+			}
+		})
+	}
+}
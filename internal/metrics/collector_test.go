@@ -0,0 +1,876 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/demo"
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+const mi = 1024 * 1024
+
+// testCluster holds the fake clientsets behind a collector, so tests can
+// add reactors that fail calls
+type testCluster struct {
+	core    *fake.Clientset
+	metrics *metricsfake.Clientset
+	info    models.ClusterInfo
+}
+
+func newTestCluster(objects ...runtime.Object) *testCluster {
+	return &testCluster{
+		core:    fake.NewSimpleClientset(objects...),
+		metrics: metricsfake.NewSimpleClientset(),
+		info:    models.ClusterInfo{Name: "test", Context: "test"},
+	}
+}
+
+// addNodeMetrics records usage for a node. Metrics objects are tracked
+// under the resource the metrics client lists, not the guessed one.
+func (tc *testCluster) addNodeMetrics(t testing.TB, name string, cpu, memory int64) {
+	t.Helper()
+	gvr := metricsv1beta1.SchemeGroupVersion.WithResource("nodes")
+	nm := &metricsv1beta1.NodeMetrics{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Usage:      testResources(cpu, memory),
+	}
+	if err := tc.metrics.Tracker().Create(gvr, nm, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addPodMetrics records usage for a pod with a single container
+func (tc *testCluster) addPodMetrics(t testing.TB, ns, name string, cpu, memory int64) {
+	t.Helper()
+	gvr := metricsv1beta1.SchemeGroupVersion.WithResource("pods")
+	pm := &metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: testResources(cpu, memory)}},
+	}
+	if err := tc.metrics.Tracker().Create(gvr, pm, ns); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fail makes lists of resource fail with err when match returns true
+func fail(clientset interface {
+	PrependReactor(verb, resource string, reaction k8stesting.ReactionFunc)
+}, resource string, match func(k8stesting.Action) bool, err error) {
+	clientset.PrependReactor("list", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if match != nil && !match(action) {
+			return false, nil, nil
+		}
+		return true, nil, err
+	})
+}
+
+// collector returns a collector reading from the fake clientsets through
+// metrics-server
+func (tc *testCluster) collector() *Collector {
+	cfg := config.NewConfig()
+	cfg.MetricsSource = SourceMetricsServer
+	client := k8s.NewClientFromClientsets(tc.core, tc.metrics, tc.info)
+	return NewCollector(client, cfg)
+}
+
+func testResources(cpu, memory int64) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI),
+	}
+}
+
+func testNode(name string, cpu, memory int64, ready corev1.ConditionStatus) *corev1.Node {
+	allocatable := testResources(cpu, memory)
+	allocatable[corev1.ResourcePods] = *resource.NewQuantity(110, resource.DecimalSI)
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Capacity:    testResources(cpu, memory),
+			Allocatable: allocatable,
+			Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			Addresses:   []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+		},
+	}
+}
+
+func testPod(ns, name, node string, phase corev1.PodPhase, restarts ...int32) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Containers: []corev1.Container{
+				{Name: "app", Resources: corev1.ResourceRequirements{
+					Requests: testResources(100, 128*mi),
+					Limits:   testResources(500, 256*mi),
+				}},
+				{Name: "sidecar", Resources: corev1.ResourceRequirements{
+					Requests: testResources(10, 32*mi),
+				}},
+			},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+	for i, r := range restarts {
+		status := corev1.ContainerStatus{Name: p.Spec.Containers[i].Name, RestartCount: r}
+		if phase == corev1.PodRunning {
+			status.State.Running = &corev1.ContainerStateRunning{}
+		}
+		p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, status)
+	}
+	return p
+}
+
+func collect(t *testing.T, c *Collector) *models.ClusterMetrics {
+	t.Helper()
+	m, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	return m
+}
+
+func findNode(t *testing.T, m *models.ClusterMetrics, name string) models.Node {
+	t.Helper()
+	for _, n := range m.Nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	t.Fatalf("node %s not collected", name)
+	return models.Node{}
+}
+
+func findPod(t *testing.T, m *models.ClusterMetrics, ns, name string) models.Pod {
+	t.Helper()
+	for _, p := range m.Pods {
+		if p.Namespace == ns && p.Name == name {
+			return p
+		}
+	}
+	t.Fatalf("pod %s/%s not collected", ns, name)
+	return models.Pod{}
+}
+
+// sourceStatus returns the status of the named source
+func sourceStatus(t *testing.T, m *models.ClusterMetrics, name string) models.SourceStatus {
+	t.Helper()
+	for _, s := range m.Sources {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no status for source %s in %+v", name, m.Sources)
+	return models.SourceStatus{}
+}
+
+func assertHealthy(t *testing.T, m *models.ClusterMetrics) {
+	t.Helper()
+	if degraded := m.Degraded(); len(degraded) > 0 {
+		t.Fatalf("degraded sources: %+v", degraded)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	tc := newTestCluster(
+		testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue),
+		testNode("node-b", 2000, 8*1024*mi, corev1.ConditionFalse),
+		testPod("shop", "web", "node-a", corev1.PodRunning, 1, 2),
+		testPod("kube-system", "dns", "node-b", corev1.PodPending),
+	)
+	tc.addNodeMetrics(t, "node-a", 1000, 4*1024*mi)
+	tc.addPodMetrics(t, "shop", "web", 250, 100*mi)
+
+	c := tc.collector()
+	m := collect(t, c)
+	assertHealthy(t, m)
+	if m.MetricsSource != SourceMetricsServer {
+		t.Errorf("source = %q", m.MetricsSource)
+	}
+	if len(m.Sources) != 3 {
+		t.Errorf("sources = %+v, want nodes, pods and metrics-server", m.Sources)
+	}
+	for _, s := range m.Sources {
+		if s.LastSuccess != m.Timestamp {
+			t.Errorf("%s last success %v, want %v", s.Name, s.LastSuccess, m.Timestamp)
+		}
+	}
+
+	a := findNode(t, m, "node-a")
+	if a.Status != models.NodeStatusReady || a.InternalIP != "10.0.0.1" {
+		t.Errorf("node-a status %v, IP %q", a.Status, a.InternalIP)
+	}
+	if a.CPU.Current != 1000 || a.CPU.Percent != 25 || a.Memory.Percent != 25 {
+		t.Errorf("node-a usage = %+v, %+v", a.CPU, a.Memory)
+	}
+	b := findNode(t, m, "node-b")
+	if b.Status != models.NodeStatusNotReady || b.CPU.Current != 0 || b.CPU.Percent != 0 {
+		t.Errorf("node-b without metrics = %v, %+v", b.Status, b.CPU)
+	}
+	// Pod counts come from this collection, not the previous one
+	if a.PodCount != 1 || b.PodCount != 1 || a.PodCapacity != 110 {
+		t.Errorf("pods = %d/%d on node-a, %d on node-b", a.PodCount, a.PodCapacity, b.PodCount)
+	}
+
+	web := findPod(t, m, "shop", "web")
+	if web.CPU != 250 || web.Memory != 100*mi {
+		t.Errorf("web usage = %d, %d", web.CPU, web.Memory)
+	}
+	if web.CPURequest != 110 || web.CPULimit != 500 || web.MemoryRequest != 160*mi || web.MemoryLimit != 256*mi {
+		t.Errorf("web resources = %dm/%dm, %d/%d", web.CPURequest, web.CPULimit, web.MemoryRequest, web.MemoryLimit)
+	}
+	if web.RestartCount != 3 || web.ContainerCount != 2 || web.Status != models.PodStatusRunning {
+		t.Errorf("web restarts %d, containers %d, status %v", web.RestartCount, web.ContainerCount, web.Status)
+	}
+	if len(web.Containers) != 2 {
+		t.Fatalf("web containers = %+v", web.Containers)
+	}
+	if app := web.Containers[0]; app.Name != "app" || app.CPU != 250 || app.CPURequest != 100 || app.RestartCount != 1 || app.State != "Running" {
+		t.Errorf("web app container = %+v", app)
+	}
+	if sidecar := web.Containers[1]; sidecar.Name != "sidecar" || sidecar.CPU != 0 || sidecar.RestartCount != 2 {
+		t.Errorf("web sidecar container = %+v", sidecar)
+	}
+	if dns := findPod(t, m, "kube-system", "dns"); dns.Status != models.PodStatusPending || dns.CPU != 0 {
+		t.Errorf("dns = %v with %dm", dns.Status, dns.CPU)
+	}
+
+	// Aggregates
+	if m.TotalNodes != 2 || m.ReadyNodes != 1 || m.TotalPods != 2 {
+		t.Errorf("nodes %d, ready %d, pods %d", m.TotalNodes, m.ReadyNodes, m.TotalPods)
+	}
+	if m.TotalCPUCapacity != 6000 || m.TotalCPUUsed != 1000 || m.TotalCPUCores != 6 {
+		t.Errorf("CPU capacity %d, used %d, cores %d", m.TotalCPUCapacity, m.TotalCPUUsed, m.TotalCPUCores)
+	}
+	if m.TotalMemoryCapacity != 24*1024*mi || m.TotalMemoryUsed != 4*1024*mi {
+		t.Errorf("memory capacity %d, used %d", m.TotalMemoryCapacity, m.TotalMemoryUsed)
+	}
+	if got := c.GetNamespaces(); len(got) != 2 || got[0] != "kube-system" || got[1] != "shop" {
+		t.Errorf("namespaces = %v", got)
+	}
+}
+
+func TestCollectSelectors(t *testing.T) {
+	worker, infra := testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue), testNode("node-b", 4000, 16*1024*mi, corev1.ConditionTrue)
+	worker.Labels = map[string]string{"pool": "workers"}
+	checkout, cart := testPod("shop", "checkout", "node-a", corev1.PodRunning), testPod("shop", "cart", "node-a", corev1.PodRunning)
+	checkout.Labels = map[string]string{"app": "checkout"}
+	cart.Labels = map[string]string{"app": "cart"}
+	tc := newTestCluster(worker, infra, checkout, cart)
+	tc.addNodeMetrics(t, "node-a", 1000, mi)
+	// metrics-server copies the pod's labels to its metrics
+	pm := &metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", Labels: checkout.Labels},
+		Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: testResources(100, mi)}},
+	}
+	if err := tc.metrics.Tracker().Create(metricsv1beta1.SchemeGroupVersion.WithResource("pods"), pm, "shop"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := tc.collector()
+	c.config.Selector = "app=checkout"
+	c.config.FieldSelector = "status.phase=Running"
+	c.config.NodeSelector = "pool=workers"
+	m := collect(t, c)
+	assertHealthy(t, m)
+
+	// The fake clientsets apply label selectors like the API server does
+	if len(m.Nodes) != 1 || m.Nodes[0].Name != "node-a" {
+		t.Errorf("nodes = %+v, want node-a only", m.Nodes)
+	}
+	if len(m.Pods) != 1 || m.Pods[0].Name != "checkout" || m.Pods[0].CPU != 100 {
+		t.Errorf("pods = %+v, want checkout with usage only", m.Pods)
+	}
+
+	// Every list call carries the selectors
+	want := map[string]metav1.ListOptions{
+		"nodes": {LabelSelector: "pool=workers"},
+		"pods":  {LabelSelector: "app=checkout", FieldSelector: "status.phase=Running"},
+	}
+	for _, actions := range [][]k8stesting.Action{tc.core.Actions(), tc.metrics.Actions()} {
+		for _, action := range actions {
+			list, ok := action.(k8stesting.ListActionImpl)
+			if !ok {
+				continue
+			}
+			restrictions := list.GetListRestrictions()
+			w := want[list.GetResource().Resource]
+			if restrictions.Labels.String() != w.LabelSelector {
+				t.Errorf("%s list selected labels %q, want %q", list.GetResource(), restrictions.Labels, w.LabelSelector)
+			}
+			// The metrics API only supports label selectors
+			if list.GetResource().Group == "" && restrictions.Fields.String() != w.FieldSelector {
+				t.Errorf("%s list selected fields %q, want %q", list.GetResource(), restrictions.Fields, w.FieldSelector)
+			}
+		}
+	}
+}
+
+func TestCollectMetricsAPIDown(t *testing.T) {
+	tc := newTestCluster(
+		testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue),
+		testPod("shop", "web", "node-a", corev1.PodRunning),
+	)
+	down := apierrors.NewServiceUnavailable("the server is currently unable to handle the request")
+	fail(tc.metrics, "*", nil, down)
+
+	m := collect(t, tc.collector())
+	status := sourceStatus(t, m, SourceMetricsServer)
+	if status.State != models.SourceFailed || !apierrors.IsServiceUnavailable(errors.Unwrap(status.Err)) {
+		t.Errorf("metrics-server status = %+v, want the metrics API failure", status)
+	}
+	if s := sourceStatus(t, m, sourceNodeList); s.State != models.SourceOK {
+		t.Errorf("nodes status = %+v", s)
+	}
+	// Status and capacity are still shown, without usage
+	if len(m.Nodes) != 1 || len(m.Pods) != 1 {
+		t.Fatalf("got %d nodes and %d pods", len(m.Nodes), len(m.Pods))
+	}
+	if n := m.Nodes[0]; n.CPU.Capacity != 4000 || n.CPU.Current != 0 {
+		t.Errorf("node CPU = %+v", n.CPU)
+	}
+	if m.TotalCPUUsed != 0 || m.TotalCPUCapacity != 4000 {
+		t.Errorf("CPU used %d of %d", m.TotalCPUUsed, m.TotalCPUCapacity)
+	}
+}
+
+func TestCollectPodsForbidden(t *testing.T) {
+	clusterWide := func(action k8stesting.Action) bool { return action.GetNamespace() == "" }
+	forbidden := apierrors.NewForbidden(corev1.Resource("pods"), "", errors.New("no cluster-wide access"))
+
+	t.Run("falls back to the context namespace", func(t *testing.T) {
+		tc := newTestCluster(
+			testPod("team-a", "api", "", corev1.PodRunning),
+			testPod("team-b", "api", "", corev1.PodRunning),
+		)
+		tc.info.Namespace = "team-a"
+		fail(tc.core, "pods", clusterWide, forbidden)
+		fail(tc.metrics, "pods", clusterWide, forbidden)
+		tc.addPodMetrics(t, "team-a", "api", 50, 64*mi)
+
+		c := tc.collector()
+		m := collect(t, c)
+		assertHealthy(t, m)
+		if len(m.Pods) != 1 || m.Pods[0].Namespace != "team-a" || m.Pods[0].CPU != 50 {
+			t.Errorf("pods = %+v", m.Pods)
+		}
+		if scope := c.Scope(); len(scope) != 1 || scope[0] != "team-a" {
+			t.Errorf("scope = %v", scope)
+		}
+	})
+
+	t.Run("everywhere", func(t *testing.T) {
+		tc := newTestCluster(testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue))
+		fail(tc.core, "pods", nil, forbidden)
+
+		m := collect(t, tc.collector())
+		if s := sourceStatus(t, m, sourcePodList); s.State != models.SourceFailed || !apierrors.IsForbidden(s.Err) {
+			t.Errorf("pods status = %+v, want forbidden", s)
+		}
+		if len(m.Nodes) != 1 || len(m.Pods) != 0 {
+			t.Errorf("got %d nodes and %d pods", len(m.Nodes), len(m.Pods))
+		}
+	})
+
+	t.Run("nodes forbidden", func(t *testing.T) {
+		tc := newTestCluster(testPod("shop", "web", "node-a", corev1.PodRunning))
+		fail(tc.core, "nodes", nil, apierrors.NewForbidden(corev1.Resource("nodes"), "", errors.New("denied")))
+
+		m := collect(t, tc.collector())
+		assertHealthy(t, m)
+		if !m.NodesForbidden {
+			t.Error("NodesForbidden not set")
+		}
+		for _, s := range m.Sources {
+			if s.Name == sourceNodeList {
+				t.Errorf("forbidden node list reported as a source: %+v", s)
+			}
+		}
+		if len(m.Nodes) != 0 || len(m.Pods) != 1 {
+			t.Errorf("got %d nodes and %d pods", len(m.Nodes), len(m.Pods))
+		}
+	})
+
+	t.Run("nodes unavailable", func(t *testing.T) {
+		tc := newTestCluster(testPod("shop", "web", "node-a", corev1.PodRunning))
+		fail(tc.core, "nodes", nil, errors.New("connection refused"))
+
+		m := collect(t, tc.collector())
+		if s := sourceStatus(t, m, sourceNodeList); s.State != models.SourceFailed || s.Err == nil {
+			t.Errorf("nodes status = %+v, want failed", s)
+		}
+		if m.NodesForbidden || len(m.Pods) != 1 {
+			t.Errorf("NodesForbidden %v, %d pods", m.NodesForbidden, len(m.Pods))
+		}
+	})
+}
+
+func TestCollectStale(t *testing.T) {
+	tc := newTestCluster(
+		testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue),
+		testPod("shop", "web", "node-a", corev1.PodRunning),
+	)
+	tc.addNodeMetrics(t, "node-a", 1000, 4*1024*mi)
+	c := tc.collector()
+	first := collect(t, c)
+	assertHealthy(t, first)
+
+	// Pods and usage fail from now on; their last results are shown
+	timeout := errors.New("context deadline exceeded")
+	fail(tc.core, "pods", nil, timeout)
+	fail(tc.metrics, "*", nil, timeout)
+	second := collect(t, c)
+
+	for _, name := range []string{sourcePodList, SourceMetricsServer} {
+		s := sourceStatus(t, second, name)
+		if s.State != models.SourceStale || s.LastSuccess != first.Timestamp || s.Err == nil {
+			t.Errorf("%s status = %+v, want stale since %v", name, s, first.Timestamp)
+		}
+	}
+	if s := sourceStatus(t, second, sourceNodeList); s.State != models.SourceOK || s.LastSuccess != second.Timestamp {
+		t.Errorf("nodes status = %+v", s)
+	}
+	if len(second.Pods) != 1 || second.Nodes[0].CPU.Current != 1000 {
+		t.Errorf("stale data not shown: %d pods, node CPU %d", len(second.Pods), second.Nodes[0].CPU.Current)
+	}
+}
+
+// slowPods holds up pod lists while hold is set, until it is closed
+type slowPods struct {
+	kubernetes.Interface
+	hold *chan struct{}
+}
+
+func (s slowPods) CoreV1() typedcorev1.CoreV1Interface {
+	return slowPodsCore{s.Interface.CoreV1(), s.hold}
+}
+
+type slowPodsCore struct {
+	typedcorev1.CoreV1Interface
+	hold *chan struct{}
+}
+
+func (s slowPodsCore) Pods(namespace string) typedcorev1.PodInterface {
+	return slowPodList{s.CoreV1Interface.Pods(namespace), *s.hold}
+}
+
+type slowPodList struct {
+	typedcorev1.PodInterface
+	hold chan struct{}
+}
+
+func (s slowPodList) List(ctx context.Context, opts metav1.ListOptions) (*corev1.PodList, error) {
+	if s.hold != nil {
+		select {
+		case <-s.hold:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.PodInterface.List(ctx, opts)
+}
+
+func TestCollectSlowPods(t *testing.T) {
+	tc := newTestCluster(
+		testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue),
+		testPod("shop", "web", "node-a", corev1.PodRunning),
+	)
+	tc.addNodeMetrics(t, "node-a", 1000, 4*1024*mi)
+	var hold chan struct{}
+	cfg := config.NewConfig()
+	cfg.MetricsSource = SourceMetricsServer
+	c := NewCollector(k8s.NewClientFromClientsets(slowPods{tc.core, &hold}, tc.metrics, tc.info), cfg)
+	first := collect(t, c)
+	assertHealthy(t, first)
+
+	// Pod lists hang from now on, while the node usage changes
+	hold = make(chan struct{})
+	gvr := metricsv1beta1.SchemeGroupVersion.WithResource("nodes")
+	if err := tc.metrics.Tracker().Delete(gvr, "", "node-a"); err != nil {
+		t.Fatal(err)
+	}
+	tc.addNodeMetrics(t, "node-a", 2000, 4*1024*mi)
+
+	start := time.Now()
+	second := collect(t, c)
+	if took := time.Since(start); took > podListGrace+time.Second {
+		t.Errorf("collection took %s waiting for pods", took)
+	}
+	if s := sourceStatus(t, second, sourcePodList); s.State != models.SourceStale || !errors.Is(s.Err, errPodListPending) {
+		t.Errorf("pods status = %+v, want stale while listing", s)
+	}
+	if len(second.Pods) != 1 || second.Nodes[0].CPU.Current != 2000 {
+		t.Errorf("got %d pods and node CPU %d, want the last pods and new usage", len(second.Pods), second.Nodes[0].CPU.Current)
+	}
+
+	// The next collection picks up the pod list once it finished
+	pending := c.podList
+	close(hold)
+	select {
+	case <-pending.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pod list did not finish")
+	}
+	third := collect(t, c)
+	if s := sourceStatus(t, third, sourcePodList); s.State != models.SourceOK || s.Latency < podListGrace {
+		t.Errorf("pods status = %+v, want the list started by the last collection", s)
+	}
+}
+
+func TestCollectUnreachable(t *testing.T) {
+	tc := newTestCluster()
+	refused := errors.New("connection refused")
+	fail(tc.core, "*", nil, refused)
+	fail(tc.metrics, "*", nil, refused)
+
+	m, err := tc.collector().Collect(context.Background())
+	if !errors.Is(err, refused) {
+		t.Errorf("err = %v, want %v", err, refused)
+	}
+	if m == nil || len(m.Degraded()) != 3 {
+		t.Errorf("metrics = %+v, want three failed sources", m)
+	}
+}
+
+func TestGPUDetection(t *testing.T) {
+	withGPUs := func(n *corev1.Node, capacity, allocatable string, memory string) *corev1.Node {
+		if capacity != "" {
+			n.Status.Capacity["nvidia.com/gpu"] = resource.MustParse(capacity)
+		}
+		if allocatable != "" {
+			n.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse(allocatable)
+		}
+		if memory != "" {
+			n.Labels = map[string]string{"nvidia.com/gpu.memory": memory}
+		}
+		return n
+	}
+
+	tc := newTestCluster(
+		withGPUs(testNode("gpu-capacity", 32000, 0, corev1.ConditionTrue), "4", "", "16384"),
+		withGPUs(testNode("gpu-allocatable", 32000, 0, corev1.ConditionTrue), "", "2", ""),
+		withGPUs(testNode("gpu-zero", 32000, 0, corev1.ConditionTrue), "0", "", ""),
+		withGPUs(testNode("gpu-bad-label", 32000, 0, corev1.ConditionTrue), "1", "", "lots"),
+		testNode("cpu-only", 4000, 0, corev1.ConditionTrue),
+	)
+	m := collect(t, tc.collector())
+
+	tests := []struct {
+		node   string
+		count  int
+		memory int64
+	}{
+		{"gpu-capacity", 4, 16384 * mi},
+		{"gpu-allocatable", 2, 0},
+		{"gpu-zero", 0, 0},
+		{"gpu-bad-label", 1, 0},
+		{"cpu-only", 0, 0},
+	}
+	for _, tt := range tests {
+		gpu := findNode(t, m, tt.node).GPU
+		if tt.count == 0 {
+			if gpu != nil {
+				t.Errorf("%s: GPU = %+v, want none", tt.node, gpu)
+			}
+			continue
+		}
+		if gpu == nil || gpu.Count != tt.count || gpu.MemoryTotal != tt.memory {
+			t.Errorf("%s: GPU = %+v, want %d with %d bytes", tt.node, gpu, tt.count, tt.memory)
+		}
+	}
+	if m.TotalGPUs != 7 {
+		t.Errorf("TotalGPUs = %d, want 7", m.TotalGPUs)
+	}
+}
+
+func TestMergeNodeData(t *testing.T) {
+	n := *testNode("node-a", 2000, 4*1024*mi, corev1.ConditionTrue)
+	n.Status.Capacity[corev1.ResourceEphemeralStorage] = *resource.NewQuantity(100*1024*mi, resource.BinarySI)
+	n.Status.Conditions = append(n.Status.Conditions,
+		corev1.NodeCondition{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue},
+		corev1.NodeCondition{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse},
+		corev1.NodeCondition{Type: corev1.NodePIDPressure, Status: corev1.ConditionTrue},
+	)
+	n.Spec.Unschedulable = true
+	n.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	unknown := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}
+
+	c := newTestCluster().collector()
+	nodes := c.mergeNodeData([]corev1.Node{n, unknown}, map[string]Sample{
+		"node-a": {CPU: 500, Memory: 3 * 1024 * mi, Disk: 25 * 1024 * mi, NetworkRx: 1000, NetworkTx: 2000},
+	}, loadPerNode([]models.Pod{
+		{Name: "web", NodeName: "node-a", Status: models.PodStatusRunning, CPURequest: 250, MemoryRequest: 256 * mi},
+		{Name: "init", NodeName: "node-a", Status: models.PodStatusPending, CPURequest: 100},
+		{Name: "job", NodeName: "node-a", Status: models.PodStatusSucceeded, CPURequest: 1000},
+		{Name: "crashed", NodeName: "node-a", Status: models.PodStatusFailed},
+		{Name: "unscheduled", Status: models.PodStatusPending},
+	}))
+	if len(nodes) != 2 {
+		t.Fatalf("got %d nodes", len(nodes))
+	}
+
+	a := nodes[0]
+	if a.CPU.Percent != 25 || a.Memory.Percent != 75 || a.Disk.Percent != 25 {
+		t.Errorf("percents = %.1f, %.1f, %.1f", a.CPU.Percent, a.Memory.Percent, a.Disk.Percent)
+	}
+	if a.NetworkRx != 1000 || a.NetworkTx != 2000 {
+		t.Errorf("network = %d/%d", a.NetworkRx, a.NetworkTx)
+	}
+	if a.PodCount != 2 || a.PodCapacity != 110 {
+		t.Errorf("pods = %d/%d, want 2/110 without completed pods", a.PodCount, a.PodCapacity)
+	}
+	if a.CPURequests != 350 || a.MemoryRequests != 256*mi || a.CPUAllocatable != 2000 || a.MemoryAllocatable != 4*1024*mi {
+		t.Errorf("requests %dm/%dm, %d/%d", a.CPURequests, a.CPUAllocatable, a.MemoryRequests, a.MemoryAllocatable)
+	}
+	if !a.Unschedulable || len(a.Taints) != 1 || a.Taints[0].String() != "dedicated=gpu:NoSchedule" {
+		t.Errorf("unschedulable = %v, taints = %v", a.Unschedulable, a.Taints)
+	}
+	want := models.NodeConditions{MemoryPressure: true, PIDPressure: true}
+	if a.Conditions != want {
+		t.Errorf("conditions = %+v, want %+v", a.Conditions, want)
+	}
+
+	// No capacity and no conditions must not divide by zero
+	b := nodes[1]
+	if b.Status != models.NodeStatusUnknown || b.CPU.Percent != 0 || b.Memory.Percent != 0 || b.PodCapacity != 0 {
+		t.Errorf("node-b = %v, %+v, %+v, %d pods", b.Status, b.CPU, b.Memory, b.PodCapacity)
+	}
+}
+
+func TestWorkloadOf(t *testing.T) {
+	controller := true
+	pod := func(name, hash, kind, owner string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+		if hash != "" {
+			p.Labels["pod-template-hash"] = hash
+		}
+		if owner != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}}
+		}
+		return p
+	}
+	tests := []struct {
+		pod  *corev1.Pod
+		want string
+	}{
+		{pod("web-7d9f-x2k", "7d9f", "ReplicaSet", "web-7d9f"), "Deployment/web"},
+		{pod("legacy-abc", "", "ReplicaSet", "legacy"), "ReplicaSet/legacy"},
+		{pod("db-0", "", "StatefulSet", "db"), "StatefulSet/db"},
+		{pod("debug", "", "", ""), "Pod/debug"},
+	}
+	for _, tt := range tests {
+		if got := workloadOf(tt.pod); got != tt.want {
+			t.Errorf("workloadOf(%s) = %q, want %q", tt.pod.Name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterPods(t *testing.T) {
+	pods := []models.Pod{
+		{Namespace: "shop", Name: "web"},
+		{Namespace: "kube-system", Name: "dns"},
+		{Namespace: "data", Name: "db"},
+		{Namespace: "shop", Name: "cart"},
+	}
+	names := func(pods []models.Pod) []string {
+		var result []string
+		for _, p := range pods {
+			result = append(result, p.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		namespace  string
+		showSystem bool
+		want       []string
+	}{
+		{"", true, []string{"web", "dns", "db", "cart"}},
+		{"", false, []string{"web", "db", "cart"}},
+		{"shop", false, []string{"web", "cart"}},
+		{"kube-system", false, nil},
+		{"kube-system", true, []string{"dns"}},
+		{"missing", true, nil},
+	}
+	for _, tt := range tests {
+		got := names(FilterPods(pods, tt.namespace, tt.showSystem))
+		if len(got) != len(tt.want) {
+			t.Errorf("FilterPods(%q, %v) = %v, want %v", tt.namespace, tt.showSystem, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("FilterPods(%q, %v) = %v, want %v", tt.namespace, tt.showSystem, got, tt.want)
+				break
+			}
+		}
+	}
+	if len(pods) != 4 || pods[1].Name != "dns" {
+		t.Errorf("FilterPods modified its input: %v", names(pods))
+	}
+}
+
+func TestSortPods(t *testing.T) {
+	pods := func() []models.Pod {
+		return []models.Pod{
+			{Namespace: "shop", Name: "web-2", CPU: 100, Memory: 300, Status: models.PodStatusRunning},
+			{Namespace: "data", Name: "db", CPU: 300, Memory: 100, Status: models.PodStatusPending},
+			{Namespace: "shop", Name: "web-1", CPU: 100, Memory: 200, Status: models.PodStatusRunning},
+			{Namespace: "data", Name: "web-1", CPU: 100, Memory: 200, Status: models.PodStatusRunning},
+			{Namespace: "Ops", Name: "Agent", CPU: 200, Memory: 100, Status: models.PodStatusFailed},
+		}
+	}
+	keys := func(pods []models.Pod) []string {
+		var result []string
+		for _, p := range pods {
+			result = append(result, p.Namespace+"/"+p.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		field     models.SortField
+		ascending bool
+		want      []string
+	}{
+		// Equal CPU is broken by namespace and name in both directions
+		{models.SortPodCPU, false, []string{"data/db", "Ops/Agent", "data/web-1", "shop/web-1", "shop/web-2"}},
+		{models.SortPodCPU, true, []string{"data/web-1", "shop/web-1", "shop/web-2", "Ops/Agent", "data/db"}},
+		{models.SortPodMemory, false, []string{"shop/web-2", "data/web-1", "shop/web-1", "Ops/Agent", "data/db"}},
+		{models.SortPodName, true, []string{"Ops/Agent", "data/db", "data/web-1", "shop/web-1", "shop/web-2"}},
+		{models.SortPodNamespace, true, []string{"data/db", "data/web-1", "Ops/Agent", "shop/web-1", "shop/web-2"}},
+		{models.SortPodNamespace, false, []string{"shop/web-1", "shop/web-2", "Ops/Agent", "data/db", "data/web-1"}},
+	}
+	for _, tt := range tests {
+		got := pods()
+		SortPods(got, tt.field, tt.ascending)
+		if g, w := keys(got), tt.want; !equalStrings(g, w) {
+			t.Errorf("SortPods(%v, ascending=%v) = %v, want %v", tt.field, tt.ascending, g, w)
+		}
+
+		// Sorting again, as every refresh does, must not move rows
+		again := append([]models.Pod(nil), got...)
+		SortPods(again, tt.field, tt.ascending)
+		if g, w := keys(again), keys(got); !equalStrings(g, w) {
+			t.Errorf("SortPods(%v, ascending=%v) reordered sorted pods: %v", tt.field, tt.ascending, g)
+		}
+	}
+}
+
+func TestSortNodes(t *testing.T) {
+	nodes := []models.Node{
+		{Name: "node-c", PodCount: 10, Status: models.NodeStatusReady},
+		{Name: "node-a", PodCount: 20, Status: models.NodeStatusNotReady},
+		{Name: "node-b", PodCount: 10, Status: models.NodeStatusReady},
+		{Name: "Node-d", PodCount: 5, Status: models.NodeStatusReady},
+	}
+	nodes[0].CPU.Percent, nodes[1].CPU.Percent, nodes[2].CPU.Percent, nodes[3].CPU.Percent = 50, 50, 50, 90
+
+	names := func(nodes []models.Node) []string {
+		var result []string
+		for _, n := range nodes {
+			result = append(result, n.Name)
+		}
+		return result
+	}
+	tests := []struct {
+		field     models.SortField
+		ascending bool
+		want      []string
+	}{
+		{models.SortNodeCPU, false, []string{"Node-d", "node-a", "node-b", "node-c"}},
+		{models.SortNodeCPU, true, []string{"node-a", "node-b", "node-c", "Node-d"}},
+		{models.SortNodePods, false, []string{"node-a", "node-b", "node-c", "Node-d"}},
+		{models.SortNodeName, true, []string{"node-a", "node-b", "node-c", "Node-d"}},
+		{models.SortNodeName, false, []string{"Node-d", "node-c", "node-b", "node-a"}},
+	}
+	for _, tt := range tests {
+		got := append([]models.Node(nil), nodes...)
+		SortNodes(got, tt.field, tt.ascending)
+		if g := names(got); !equalStrings(g, tt.want) {
+			t.Errorf("SortNodes(%v, ascending=%v) = %v, want %v", tt.field, tt.ascending, g, tt.want)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCollectDemoCluster(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cluster := demo.New(demo.Options{Seed: 7, Clock: func() time.Time { return now }, NoIncidents: true})
+	cfg := config.NewConfig()
+	cfg.MetricsSource = SourceMetricsServer
+	c := NewCollector(cluster.Client(), cfg)
+
+	m := collect(t, c)
+	assertHealthy(t, m)
+	var wantNodes, wantGPUs int
+	for _, p := range demo.DefaultPools() {
+		wantNodes += p.Nodes
+		wantGPUs += p.Nodes * p.GPUs
+	}
+	if m.TotalNodes != wantNodes || m.ReadyNodes != wantNodes || m.TotalGPUs != wantGPUs {
+		t.Errorf("nodes %d, ready %d, GPUs %d; want %d nodes and %d GPUs", m.TotalNodes, m.ReadyNodes, m.TotalGPUs, wantNodes, wantGPUs)
+	}
+	if m.TotalCPUUsed <= 0 || m.TotalCPUUsed >= m.TotalCPUCapacity {
+		t.Errorf("CPU used %d of %d", m.TotalCPUUsed, m.TotalCPUCapacity)
+	}
+
+	// Usage of running pods adds up to at most the usage of their nodes
+	var podCPU int64
+	for _, p := range m.Pods {
+		podCPU += p.CPU
+	}
+	if podCPU == 0 || podCPU > m.TotalCPUUsed {
+		t.Errorf("pods use %dm of %dm node CPU", podCPU, m.TotalCPUUsed)
+	}
+}
+
+func TestHistoryWindow(t *testing.T) {
+	tc := newTestCluster()
+	client := k8s.NewClientFromClientsets(tc.core, tc.metrics, tc.info)
+	tests := []struct {
+		command  string
+		duration time.Duration
+		want     time.Duration
+	}{
+		{"", 6 * time.Hour, time.Hour},
+		{"rightsize", 15 * time.Minute, time.Hour},
+		// ktop rightsize keeps everything it samples
+		{"rightsize", 6 * time.Hour, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		cfg := config.NewConfig()
+		cfg.Command, cfg.SampleDuration = tt.command, tt.duration
+		if got := NewCollector(client, cfg).History().Window(); got != tt.want {
+			t.Errorf("%q for %s keeps %s, want %s", tt.command, tt.duration, got, tt.want)
+		}
+	}
+}
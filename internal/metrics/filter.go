@@ -0,0 +1,347 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// FilterKind selects what a filter expression is applied to
+type FilterKind int
+
+const (
+	FilterKindPods FilterKind = iota
+	FilterKindNodes
+)
+
+func (k FilterKind) String() string {
+	if k == FilterKindNodes {
+		return "nodes"
+	}
+	return "pods"
+}
+
+// Filter is a parsed filter expression. Terms separated by spaces (or
+// AND) must all match; NOT or a leading ! negates a term. A term is one of
+//
+//	web            name contains "web" (case-insensitive)
+//	/^web-\d+$/    name matches the regular expression
+//	ns:shop        namespace (pods)
+//	node:node-a    node the pod runs on (pods)
+//	status:Running status, e.g. Pending or NotReady
+//	label:app=web  label value; label:app only requires the label
+//	cpu>500m       CPU usage; also mem>1Gi, restarts>3 (pods),
+//	               pods>100, cpu%>80 and mem%>90 (nodes)
+//
+// Values of ns:, node:, status: and label: may also be /regexps/.
+type Filter struct {
+	expr  string
+	terms []filterTerm
+}
+
+// filterTerm is one condition of a filter; only the matcher for the
+// filter's kind is set
+type filterTerm struct {
+	negate bool
+	pod    func(*models.Pod) bool
+	node   func(*models.Node) bool
+
+	// scoped terms name namespaces or nodes of one cluster
+	scoped bool
+}
+
+// numericFilter matches comparisons such as cpu>500m or mem%<=80
+var numericFilter = regexp.MustCompile(`^(cpu%|mem%|cpu|mem|memory|restarts|pods)(>=|<=|!=|>|<|=)(.*)$`)
+
+// ParseFilter parses a filter expression for pods or nodes. An empty
+// expression returns a nil filter, which matches everything.
+func ParseFilter(expr string, kind FilterKind) (*Filter, error) {
+	f := &Filter{expr: strings.TrimSpace(expr)}
+	negate := false
+	for _, word := range strings.Fields(f.expr) {
+		switch strings.ToUpper(word) {
+		case "AND", "&&":
+			continue
+		case "NOT", "!":
+			negate = !negate
+			continue
+		}
+		for strings.HasPrefix(word, "!") {
+			negate = !negate
+			word = word[1:]
+		}
+		term, err := parseTerm(word, kind)
+		if err != nil {
+			return nil, err
+		}
+		term.negate = negate
+		negate = false
+		f.terms = append(f.terms, term)
+	}
+	if negate {
+		return nil, fmt.Errorf("NOT must be followed by a term")
+	}
+	if len(f.terms) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// String returns the expression the filter was parsed from
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// ClusterScoped reports whether the filter names namespaces or nodes,
+// which only exist in the cluster it was written for
+func (f *Filter) ClusterScoped() bool {
+	if f == nil {
+		return false
+	}
+	for _, t := range f.terms {
+		if t.scoped {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPod reports whether a pod matches every term of the filter
+func (f *Filter) MatchPod(p *models.Pod) bool {
+	if f == nil {
+		return true
+	}
+	for _, t := range f.terms {
+		if t.pod == nil || t.pod(p) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchNode reports whether a node matches every term of the filter
+func (f *Filter) MatchNode(n *models.Node) bool {
+	if f == nil {
+		return true
+	}
+	for _, t := range f.terms {
+		if t.node == nil || t.node(n) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Pods returns the pods matching the filter
+func (f *Filter) Pods(pods []models.Pod) []models.Pod {
+	if f == nil {
+		return pods
+	}
+	result := make([]models.Pod, 0, len(pods))
+	for i := range pods {
+		if f.MatchPod(&pods[i]) {
+			result = append(result, pods[i])
+		}
+	}
+	return result
+}
+
+// Nodes returns the nodes matching the filter
+func (f *Filter) Nodes(nodes []models.Node) []models.Node {
+	if f == nil {
+		return nodes
+	}
+	result := make([]models.Node, 0, len(nodes))
+	for i := range nodes {
+		if f.MatchNode(&nodes[i]) {
+			result = append(result, nodes[i])
+		}
+	}
+	return result
+}
+
+// parseTerm parses a single term of a filter expression
+func parseTerm(word string, kind FilterKind) (filterTerm, error) {
+	if m := numericFilter.FindStringSubmatch(word); m != nil {
+		return parseComparison(m[1], m[2], m[3], kind)
+	}
+
+	field, value, ok := strings.Cut(word, ":")
+	if !ok || isRegexp(word) {
+		match, err := textMatcher(word, true)
+		if err != nil {
+			return filterTerm{}, err
+		}
+		return filterTerm{
+			pod:  func(p *models.Pod) bool { return match(p.Name) },
+			node: func(n *models.Node) bool { return match(n.Name) },
+		}, nil
+	}
+	if value == "" {
+		return filterTerm{}, fmt.Errorf("%s: needs a value", field)
+	}
+
+	switch strings.ToLower(field) {
+	case "ns", "namespace":
+		match, err := textMatcher(value, false)
+		if err != nil {
+			return filterTerm{}, err
+		}
+		term, err := podsOnly(field, kind, func(p *models.Pod) bool { return match(p.Namespace) })
+		term.scoped = true
+		return term, err
+	case "node":
+		match, err := textMatcher(value, false)
+		if err != nil {
+			return filterTerm{}, err
+		}
+		term, err := podsOnly(field, kind, func(p *models.Pod) bool { return match(p.NodeName) })
+		term.scoped = true
+		return term, err
+	case "status":
+		match, err := textMatcher(value, false)
+		if err != nil {
+			return filterTerm{}, err
+		}
+		return filterTerm{
+			pod:  func(p *models.Pod) bool { return match(string(p.Status)) },
+			node: func(n *models.Node) bool { return match(string(n.Status)) },
+		}, nil
+	case "label":
+		return parseLabelTerm(value)
+	}
+	return filterTerm{}, fmt.Errorf("unknown filter %q (use ns:, node:, status: or label:)", field+":")
+}
+
+// parseLabelTerm parses the value of label:key=value or label:key
+func parseLabelTerm(value string) (filterTerm, error) {
+	key, want, hasValue := strings.Cut(value, "=")
+	if key == "" {
+		return filterTerm{}, fmt.Errorf("label: needs a key, e.g. label:app=web")
+	}
+	match := func(string) bool { return true }
+	if hasValue {
+		var err error
+		if match, err = textMatcher(want, false); err != nil {
+			return filterTerm{}, err
+		}
+	}
+	matchLabels := func(labels map[string]string) bool {
+		v, ok := labels[key]
+		return ok && match(v)
+	}
+	return filterTerm{
+		pod:  func(p *models.Pod) bool { return matchLabels(p.Labels) },
+		node: func(n *models.Node) bool { return matchLabels(n.Labels) },
+	}, nil
+}
+
+// parseComparison parses a numeric predicate such as cpu>500m
+func parseComparison(field, op, value string, kind FilterKind) (filterTerm, error) {
+	if value == "" {
+		return filterTerm{}, fmt.Errorf("%s%s needs a value", field, op)
+	}
+	var want float64
+	switch field {
+	case "cpu":
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return filterTerm{}, fmt.Errorf("cpu%s%s: invalid quantity, e.g. 500m or 2", op, value)
+		}
+		want = float64(q.MilliValue())
+	case "mem", "memory":
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return filterTerm{}, fmt.Errorf("%s%s%s: invalid quantity, e.g. 512Mi or 1Gi", field, op, value)
+		}
+		want = float64(q.Value())
+	default:
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return filterTerm{}, fmt.Errorf("%s%s%s: invalid number", field, op, value)
+		}
+		want = v
+	}
+	compare := func(got float64) bool {
+		switch op {
+		case ">":
+			return got > want
+		case ">=":
+			return got >= want
+		case "<":
+			return got < want
+		case "<=":
+			return got <= want
+		case "!=":
+			return got != want
+		}
+		return got == want
+	}
+
+	switch field {
+	case "cpu":
+		return filterTerm{
+			pod:  func(p *models.Pod) bool { return compare(float64(p.CPU)) },
+			node: func(n *models.Node) bool { return compare(float64(n.CPU.Current)) },
+		}, nil
+	case "mem", "memory":
+		return filterTerm{
+			pod:  func(p *models.Pod) bool { return compare(float64(p.Memory)) },
+			node: func(n *models.Node) bool { return compare(float64(n.Memory.Current)) },
+		}, nil
+	case "restarts":
+		return podsOnly(field, kind, func(p *models.Pod) bool { return compare(float64(p.RestartCount)) })
+	case "pods":
+		return nodesOnly(field, kind, func(n *models.Node) bool { return compare(float64(n.PodCount)) })
+	case "cpu%":
+		return nodesOnly(field, kind, func(n *models.Node) bool { return compare(n.CPU.Percent) })
+	default: // mem%
+		return nodesOnly(field, kind, func(n *models.Node) bool { return compare(n.Memory.Percent) })
+	}
+}
+
+// podsOnly returns a term for a field that only pods have
+func podsOnly(field string, kind FilterKind, match func(*models.Pod) bool) (filterTerm, error) {
+	if kind != FilterKindPods {
+		return filterTerm{}, fmt.Errorf("%s applies to pods, not %s", field, kind)
+	}
+	return filterTerm{pod: match}, nil
+}
+
+// nodesOnly returns a term for a field that only nodes have
+func nodesOnly(field string, kind FilterKind, match func(*models.Node) bool) (filterTerm, error) {
+	if kind != FilterKindNodes {
+		return filterTerm{}, fmt.Errorf("%s applies to nodes, not %s", field, kind)
+	}
+	return filterTerm{node: match}, nil
+}
+
+// isRegexp reports whether a value is written as /regexp/
+func isRegexp(s string) bool {
+	return len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/")
+}
+
+// textMatcher matches text against a /regexp/, or else a case-insensitive
+// substring (names) or exact value (other fields)
+func textMatcher(pattern string, substring bool) (func(string) bool, error) {
+	if isRegexp(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %s: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	if substring {
+		pattern = strings.ToLower(pattern)
+		return func(s string) bool { return strings.Contains(strings.ToLower(s), pattern) }, nil
+	}
+	return func(s string) bool { return strings.EqualFold(s, pattern) }, nil
+}
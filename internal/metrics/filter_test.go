@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/nlaak/ktop/internal/models"
+)
+
+func TestFilterExpressionPods(t *testing.T) {
+	pods := []models.Pod{
+		{Namespace: "shop", Name: "web-1", NodeName: "node-a", Status: models.PodStatusRunning, CPU: 250, Memory: 300 * mi, Labels: map[string]string{"app": "web"}},
+		{Namespace: "shop", Name: "web-2", NodeName: "node-b", Status: models.PodStatusRunning, CPU: 900, Memory: 2048 * mi, Labels: map[string]string{"app": "web"}},
+		{Namespace: "shop", Name: "worker", NodeName: "node-a", Status: models.PodStatusRunning, CPU: 5, Memory: 12 * mi, RestartCount: 14},
+		{Namespace: "data", Name: "postgres-0", NodeName: "node-a", Status: models.PodStatusPending, Labels: map[string]string{"app": "postgres", "tier": "db"}},
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"", []string{"web-1", "web-2", "worker", "postgres-0"}},
+		{"WEB", []string{"web-1", "web-2"}},
+		{`/^web-\d$/`, []string{"web-1", "web-2"}},
+		{"ns:data", []string{"postgres-0"}},
+		{"namespace:/^sh/", []string{"web-1", "web-2", "worker"}},
+		{"node:node-b", []string{"web-2"}},
+		{"status:pending", []string{"postgres-0"}},
+		{"label:app=web", []string{"web-1", "web-2"}},
+		{"label:tier", []string{"postgres-0"}},
+		{"label:app=/^post/", []string{"postgres-0"}},
+		{"cpu>500m", []string{"web-2"}},
+		{"cpu>=250m", []string{"web-1", "web-2"}},
+		{"cpu<500m", []string{"web-1", "worker", "postgres-0"}},
+		{"mem>1Gi", []string{"web-2"}},
+		{"memory<=12Mi", []string{"worker", "postgres-0"}},
+		{"restarts>3", []string{"worker"}},
+		{"ns:shop cpu>100m", []string{"web-1", "web-2"}},
+		{"ns:shop AND NOT web", []string{"worker"}},
+		{"!ns:shop", []string{"postgres-0"}},
+		{"NOT !web", []string{"web-1", "web-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr, FilterKindPods)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range f.Pods(pods) {
+				got = append(got, p.Name)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterExpressionNodes(t *testing.T) {
+	nodes := []models.Node{
+		{Name: "node-a", Status: models.NodeStatusReady, PodCount: 105, CPU: models.ResourceUsage{Current: 3400, Percent: 85}, Memory: models.ResourceUsage{Current: 14 * 1024 * mi, Percent: 87.5}},
+		{Name: "node-b", Status: models.NodeStatusReady, PodCount: 20, CPU: models.ResourceUsage{Current: 800, Percent: 20}, Labels: map[string]string{"pool": "spot"}},
+		{Name: "gpu-1", Status: models.NodeStatusNotReady, Labels: map[string]string{"pool": "gpu"}},
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"node", []string{"node-a", "node-b"}},
+		{"status:NotReady", []string{"gpu-1"}},
+		{"cpu%>80", []string{"node-a"}},
+		{"mem%>=50", []string{"node-a"}},
+		{"pods>100", []string{"node-a"}},
+		{"cpu>1", []string{"node-a"}},
+		{"label:pool=spot", []string{"node-b"}},
+		{"NOT label:pool", []string{"node-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr, FilterKindNodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, n := range f.Nodes(nodes) {
+				got = append(got, n.Name)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterClusterScoped(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", false},
+		{"web cpu>500m status:Running label:app=web", false},
+		{"ns:shop", true},
+		{"web NOT node:/^gpu-/", true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr, FilterKindPods)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.ClusterScoped(); got != tt.want {
+			t.Errorf("%q scoped = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind FilterKind
+	}{
+		{"cpu>lots", FilterKindPods},
+		{"cpu>", FilterKindPods},
+		{"mem>1Gx", FilterKindPods},
+		{"restarts>three", FilterKindPods},
+		{"owner:me", FilterKindPods},
+		{"ns:", FilterKindPods},
+		{"label:=web", FilterKindPods},
+		{"/(/", FilterKindPods},
+		{"ns:/(/", FilterKindPods},
+		{"web NOT", FilterKindPods},
+		{"pods>10", FilterKindPods},
+		{"cpu%>80", FilterKindPods},
+		{"ns:shop", FilterKindNodes},
+		{"restarts>1", FilterKindNodes},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFilter(tt.expr, tt.kind); err == nil {
+			t.Errorf("ParseFilter(%q, %v) succeeded", tt.expr, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// historyPoints is the number of points kept per node or pod; the
+// resolution of a History is its window divided by it
+const historyPoints = 240
+
+// Point is the usage of a node or pod at one time
+type Point struct {
+	Time time.Time
+	Sample
+}
+
+// UsageHistory holds past usage, keyed like Usage
+type UsageHistory struct {
+	Nodes map[string][]Point
+	Pods  map[string][]Point
+}
+
+// History keeps the recent usage of nodes, pods and containers. Samples are merged
+// into buckets of a fixed resolution, keeping the peak of each bucket, so
+// memory stays bounded however often ktop refreshes.
+type History struct {
+	window     time.Duration
+	resolution time.Duration
+
+	mu    sync.RWMutex
+	nodes map[string][]Point
+	pods  map[string][]Point
+
+	// containers is keyed by namespace/pod/container and only recorded
+	// live, for sources that report container usage
+	containers map[string][]Point
+}
+
+// NewHistory creates a history covering window
+func NewHistory(window time.Duration) *History {
+	resolution := window / historyPoints
+	if resolution < time.Second {
+		resolution = time.Second
+	}
+	return &History{
+		window:     window,
+		resolution: resolution,
+		nodes:      make(map[string][]Point),
+		pods:       make(map[string][]Point),
+		containers: make(map[string][]Point),
+	}
+}
+
+// Window returns how far back the history reaches
+func (h *History) Window() time.Duration {
+	return h.window
+}
+
+// Resolution returns the bucket size of the history
+func (h *History) Resolution() time.Duration {
+	return h.resolution
+}
+
+// Record adds the usage of one collection at time t and drops points
+// that fell out of the window
+func (h *History) Record(t time.Time, usage *Usage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, s := range usage.Nodes {
+		h.nodes[name] = h.add(h.nodes[name], Point{Time: t, Sample: s})
+	}
+	for key, s := range usage.Pods {
+		h.pods[key] = h.add(h.pods[key], Point{Time: t, Sample: s})
+	}
+	for key, containers := range usage.Containers {
+		for name, s := range containers {
+			h.containers[key+"/"+name] = h.add(h.containers[key+"/"+name], Point{Time: t, Sample: s})
+		}
+	}
+	h.prune(t)
+}
+
+// Backfill merges past usage, e.g. loaded from Prometheus at startup, in
+// front of the recorded points. Points must be in time order.
+func (h *History) Backfill(past *UsageHistory) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, points := range past.Nodes {
+		h.nodes[name] = h.merge(points, h.nodes[name])
+	}
+	for key, points := range past.Pods {
+		h.pods[key] = h.merge(points, h.pods[key])
+	}
+	h.prune(time.Now())
+}
+
+// Node returns the history of a node, oldest first
+func (h *History) Node(name string) []Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]Point(nil), h.nodes[name]...)
+}
+
+// Pod returns the history of a pod, oldest first
+func (h *History) Pod(namespace, name string) []Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]Point(nil), h.pods[namespace+"/"+name]...)
+}
+
+// Container returns the history of a container of a pod, oldest first
+func (h *History) Container(namespace, pod, container string) []Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]Point(nil), h.containers[namespace+"/"+pod+"/"+container]...)
+}
+
+// add appends p to series, merging it into the last point when both fall
+// into the same bucket
+func (h *History) add(series []Point, p Point) []Point {
+	p.Time = p.Time.Truncate(h.resolution)
+	if n := len(series); n > 0 && !series[n-1].Time.Before(p.Time) {
+		last := &series[n-1]
+		last.CPU = max(last.CPU, p.CPU)
+		last.Memory = max(last.Memory, p.Memory)
+		last.Disk = max(last.Disk, p.Disk)
+		last.NetworkRx = max(last.NetworkRx, p.NetworkRx)
+		last.NetworkTx = max(last.NetworkTx, p.NetworkTx)
+		last.Throttled = max(last.Throttled, p.Throttled)
+		return series
+	}
+	return append(series, p)
+}
+
+// merge combines past points with the recorded ones, skipping recorded
+// points older than the last past bucket
+func (h *History) merge(past, recorded []Point) []Point {
+	var merged []Point
+	for _, p := range past {
+		merged = h.add(merged, p)
+	}
+	for _, p := range recorded {
+		if n := len(merged); n > 0 && p.Time.Before(merged[n-1].Time) {
+			continue
+		}
+		merged = h.add(merged, p)
+	}
+	return merged
+}
+
+// prune drops points older than the window before now, and series left
+// without points. Called with h.mu held.
+func (h *History) prune(now time.Time) {
+	cutoff := now.Add(-h.window)
+	for _, series := range []map[string][]Point{h.nodes, h.pods, h.containers} {
+		for key, points := range series {
+			i := 0
+			for i < len(points) && points[i].Time.Before(cutoff) {
+				i++
+			}
+			switch {
+			case i == len(points):
+				delete(series, key)
+			case i > 0:
+				series[key] = append(points[:0:0], points[i:]...)
+			}
+		}
+	}
+}
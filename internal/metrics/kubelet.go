@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// kubeletConcurrency limits the simultaneous /stats/summary requests
+const kubeletConcurrency = 16
+
+// kubeletSource reads usage from each node's kubelet /stats/summary
+// endpoint through the API server proxy, for clusters without
+// metrics-server. CPU usage is computed from the cumulative CPU counters
+// of successive samples.
+type kubeletSource struct {
+	client *k8s.Client
+
+	mu      sync.Mutex
+	allowed bool                 // nodes/proxy permitted; true until preflight says otherwise
+	prev    map[string]cpuSample // last CPU counter per node, pod or container
+}
+
+// cpuSample is a cumulative CPU counter reading
+type cpuSample struct {
+	at    time.Time
+	usage uint64 // core-nanoseconds
+}
+
+// statsSummary is the subset of the kubelet stats/summary API ktop reads
+type statsSummary struct {
+	Node struct {
+		NodeName string       `json:"nodeName"`
+		CPU      *cpuStats    `json:"cpu"`
+		Memory   *memoryStats `json:"memory"`
+		Fs       *fsStats     `json:"fs"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		CPU        *cpuStats    `json:"cpu"`
+		Memory     *memoryStats `json:"memory"`
+		Containers []struct {
+			Name   string       `json:"name"`
+			CPU    *cpuStats    `json:"cpu"`
+			Memory *memoryStats `json:"memory"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+type cpuStats struct {
+	Time                 time.Time `json:"time"`
+	UsageNanoCores       *uint64   `json:"usageNanoCores"`
+	UsageCoreNanoSeconds *uint64   `json:"usageCoreNanoSeconds"`
+}
+
+type memoryStats struct {
+	WorkingSetBytes *uint64 `json:"workingSetBytes"`
+}
+
+type fsStats struct {
+	UsedBytes *uint64 `json:"usedBytes"`
+}
+
+// newKubeletSource creates a kubelet stats source
+func newKubeletSource(client *k8s.Client) *kubeletSource {
+	return &kubeletSource{
+		client:  client,
+		allowed: true,
+		prev:    make(map[string]cpuSample),
+	}
+}
+
+// Name returns the source name
+func (s *kubeletSource) Name() string {
+	return SourceKubelet
+}
+
+// applyCapabilities disables the source when nodes/proxy is forbidden
+func (s *kubeletSource) applyCapabilities(caps models.Capabilities) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowed = caps.NodeProxy
+}
+
+// Usage fetches the stats summary of every node concurrently. Nodes whose
+// kubelet cannot be reached are left out and reported in the error.
+func (s *kubeletSource) Usage(ctx context.Context, q UsageQuery) (*Usage, error) {
+	usage := newUsage()
+
+	s.mu.Lock()
+	allowed := s.allowed
+	s.mu.Unlock()
+	if !allowed || len(q.Nodes) == 0 {
+		// Without node names there is no kubelet to ask
+		usage.NodesSkipped = true
+		usage.PodsSkipped = true
+		return usage, nil
+	}
+	usage.NodesSkipped = !q.NodeUsage
+
+	summaries := make([]*statsSummary, len(q.Nodes))
+	errs := make([]error, len(q.Nodes))
+	sem := make(chan struct{}, kubeletConcurrency)
+	var wg sync.WaitGroup
+	for i, node := range q.Nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summaries[i], errs[i] = s.fetchSummary(ctx, node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	scope := namespaceSet(q.Namespaces)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool)
+	var failed int
+	var firstErr error
+	for i, summary := range summaries {
+		if errs[i] != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("node %s: %w", q.Nodes[i], errs[i])
+			}
+			continue
+		}
+
+		nodeKey := "node/" + q.Nodes[i]
+		seen[nodeKey] = true
+		usage.Nodes[q.Nodes[i]] = Sample{
+			CPU:    s.cpuMillicores(nodeKey, summary.Node.CPU),
+			Memory: workingSet(summary.Node.Memory),
+			Disk:   fsUsed(summary.Node.Fs),
+		}
+
+		for _, pod := range summary.Pods {
+			if len(scope) > 0 && !scope[pod.PodRef.Namespace] {
+				continue
+			}
+			key := pod.PodRef.Namespace + "/" + pod.PodRef.Name
+			seen["pod/"+key] = true
+			usage.Pods[key] = Sample{
+				CPU:    s.cpuMillicores("pod/"+key, pod.CPU),
+				Memory: workingSet(pod.Memory),
+			}
+			containers := make(map[string]Sample, len(pod.Containers))
+			for _, c := range pod.Containers {
+				containerKey := "container/" + key + "/" + c.Name
+				seen[containerKey] = true
+				containers[c.Name] = Sample{
+					CPU:    s.cpuMillicores(containerKey, c.CPU),
+					Memory: workingSet(c.Memory),
+				}
+			}
+			usage.Containers[key] = containers
+		}
+	}
+
+	// Forget counters of nodes, pods and containers that are gone
+	for key := range s.prev {
+		if !seen[key] {
+			delete(s.prev, key)
+		}
+	}
+
+	if failed == len(q.Nodes) {
+		return usage, fmt.Errorf("failed to fetch kubelet stats: %w", firstErr)
+	}
+	if failed > 0 {
+		return usage, fmt.Errorf("failed to fetch kubelet stats of %d/%d nodes: %w", failed, len(q.Nodes), firstErr)
+	}
+	return usage, nil
+}
+
+// fetchSummary fetches and decodes the stats summary of one node
+func (s *kubeletSource) fetchSummary(ctx context.Context, node string) (*statsSummary, error) {
+	data, err := s.client.NodeStatsSummary(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	var summary statsSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("invalid stats summary: %w", err)
+	}
+	return &summary, nil
+}
+
+// cpuMillicores computes the CPU rate since the previous sample of key
+// from the cumulative counter. The first sample, and one after a counter
+// reset, use the kubelet's own instantaneous estimate. Called with s.mu
+// held.
+func (s *kubeletSource) cpuMillicores(key string, stats *cpuStats) int64 {
+	if stats == nil {
+		return 0
+	}
+
+	rate := int64(-1)
+	if stats.UsageCoreNanoSeconds != nil {
+		cur := cpuSample{at: stats.Time, usage: *stats.UsageCoreNanoSeconds}
+		if prev, ok := s.prev[key]; ok && cur.usage >= prev.usage && cur.at.After(prev.at) {
+			elapsed := cur.at.Sub(prev.at).Nanoseconds()
+			// core-ns per ns = cores; * 1000 = millicores
+			rate = int64(float64(cur.usage-prev.usage) / float64(elapsed) * 1000)
+		}
+		if !cur.at.IsZero() {
+			s.prev[key] = cur
+		}
+	}
+
+	if rate < 0 {
+		if stats.UsageNanoCores == nil {
+			return 0
+		}
+		rate = int64(*stats.UsageNanoCores / 1_000_000)
+	}
+	return rate
+}
+
+// workingSet returns the working set bytes of memory stats
+func workingSet(stats *memoryStats) int64 {
+	if stats == nil || stats.WorkingSetBytes == nil {
+		return 0
+	}
+	return int64(*stats.WorkingSetBytes)
+}
+
+// fsUsed returns the used bytes of filesystem stats
+func fsUsed(stats *fsStats) int64 {
+	if stats == nil || stats.UsedBytes == nil {
+		return 0
+	}
+	return int64(*stats.UsedBytes)
+}
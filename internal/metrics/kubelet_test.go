@@ -0,0 +1,380 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+func uint64p(v uint64) *uint64 {
+	return &v
+}
+
+func TestCPUMillicores(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := func(at time.Time, counter, nanoCores *uint64) *cpuStats {
+		return &cpuStats{Time: at, UsageCoreNanoSeconds: counter, UsageNanoCores: nanoCores}
+	}
+
+	tests := []struct {
+		name    string
+		samples []*cpuStats
+		want    int64 // of the last sample
+	}{
+		{"nil stats", []*cpuStats{nil}, 0},
+		{"first sample uses estimate",
+			[]*cpuStats{stats(t0, uint64p(5e9), uint64p(250e6))}, 250},
+		{"first sample without estimate",
+			[]*cpuStats{stats(t0, uint64p(5e9), nil)}, 0},
+		{"rate from counter",
+			[]*cpuStats{
+				stats(t0, uint64p(5e9), uint64p(250e6)),
+				stats(t0.Add(10*time.Second), uint64p(20e9), uint64p(250e6)),
+			}, 1500},
+		{"counter reset uses estimate",
+			[]*cpuStats{
+				stats(t0, uint64p(50e9), nil),
+				stats(t0.Add(10*time.Second), uint64p(1e9), uint64p(300e6)),
+			}, 300},
+		{"same timestamp uses estimate",
+			[]*cpuStats{
+				stats(t0, uint64p(5e9), nil),
+				stats(t0, uint64p(6e9), uint64p(400e6)),
+			}, 400},
+		{"rate after counter reset",
+			[]*cpuStats{
+				stats(t0, uint64p(50e9), nil),
+				stats(t0.Add(10*time.Second), uint64p(1e9), nil),
+				stats(t0.Add(20*time.Second), uint64p(6e9), nil),
+			}, 500},
+		{"zero time is not remembered",
+			[]*cpuStats{
+				stats(time.Time{}, uint64p(5e9), nil),
+				stats(t0, uint64p(6e9), uint64p(100e6)),
+			}, 100},
+		{"estimate only",
+			[]*cpuStats{
+				stats(t0, nil, uint64p(100e6)),
+				stats(t0.Add(10*time.Second), nil, uint64p(200e6)),
+			}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newKubeletSource(nil)
+			var got int64
+			for _, sample := range tt.samples {
+				got = s.cpuMillicores("node/a", sample)
+			}
+			if got != tt.want {
+				t.Errorf("cpuMillicores() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeKubelet serves the stats summaries of nodes behind the API server's
+// node proxy. Nodes without a summary answer with an error.
+type fakeKubelet struct {
+	mu        sync.Mutex
+	summaries map[string]map[string]any
+}
+
+func (f *fakeKubelet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	node, ok := strings.CutPrefix(r.URL.Path, "/api/v1/nodes/")
+	node, ok2 := strings.CutSuffix(node, "/proxy/stats/summary")
+	if !ok || !ok2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	summary := f.summaries[node]
+	f.mu.Unlock()
+	if summary == nil {
+		http.Error(w, "kubelet unreachable", http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+func (f *fakeKubelet) set(node string, summary map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.summaries[node] = summary
+}
+
+// newTestKubeletSource starts a fake API server and a kubelet source
+// reaching it through a kubeconfig
+func newTestKubeletSource(t *testing.T, fake *fakeKubelet) *kubeletSource {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	data := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+users:
+- name: test
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`, srv.URL)
+	if err := os.WriteFile(kubeconfig, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.KubeconfigPath = kubeconfig
+	client, err := k8s.NewClientForContext(cfg, "")
+	if err != nil {
+		t.Fatalf("NewClientForContext() error = %v", err)
+	}
+	return newKubeletSource(client)
+}
+
+// testSummary builds a stats summary in the kubelet's JSON form. Every
+// pod has one container, and all share the node's CPU and memory readings.
+func testSummary(node string, at time.Time, counter, memory uint64, pods ...string) map[string]any {
+	cpu := map[string]any{"time": at, "usageCoreNanoSeconds": counter, "usageNanoCores": 100e6}
+	mem := map[string]any{"workingSetBytes": memory}
+	var podStats []map[string]any
+	for _, key := range pods {
+		ns, name, _ := strings.Cut(key, "/")
+		podStats = append(podStats, map[string]any{
+			"podRef":     map[string]any{"namespace": ns, "name": name},
+			"cpu":        cpu,
+			"memory":     mem,
+			"containers": []map[string]any{{"name": "app", "cpu": cpu, "memory": mem}},
+		})
+	}
+	return map[string]any{
+		"node": map[string]any{
+			"nodeName": node,
+			"cpu":      cpu,
+			"memory":   mem,
+			"fs":       map[string]any{"usedBytes": 1 << 30},
+		},
+		"pods": podStats,
+	}
+}
+
+func TestKubeletSourceUsage(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeKubelet{summaries: map[string]map[string]any{
+		"node-a": testSummary("node-a", t0, 10e9, 2<<30, "default/web", "kube-system/dns"),
+		"node-b": testSummary("node-b", t0, 10e9, 1<<30, "default/api"),
+	}}
+	s := newTestKubeletSource(t, fake)
+	q := UsageQuery{Nodes: []string{"node-a", "node-b"}, Namespaces: []string{"default"}, NodeUsage: true}
+
+	// The first collection has no previous counter and uses the estimate
+	usage, err := s.Usage(context.Background(), q)
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+	if usage.NodesSkipped || usage.PodsSkipped {
+		t.Fatalf("skipped = %v/%v, want usage", usage.NodesSkipped, usage.PodsSkipped)
+	}
+	want := Sample{CPU: 100, Memory: 2 << 30, Disk: 1 << 30}
+	if got := usage.Nodes["node-a"]; got != want {
+		t.Errorf("node-a = %+v, want %+v", got, want)
+	}
+	if _, ok := usage.Pods["kube-system/dns"]; ok {
+		t.Error("pod outside the namespace scope reported")
+	}
+	if got := usage.Pods["default/api"].Memory; got != 1<<30 {
+		t.Errorf("default/api memory = %d, want %d", got, 1<<30)
+	}
+
+	// The second computes the rate from the counters
+	fake.set("node-a", testSummary("node-a", t0.Add(10*time.Second), 30e9, 2<<30, "default/web"))
+	fake.set("node-b", nil)
+	usage, err = s.Usage(context.Background(), q)
+	if err == nil || !strings.Contains(err.Error(), "1/2 nodes") || !strings.Contains(err.Error(), "node-b") {
+		t.Errorf("Usage() error = %v, want the failed node reported", err)
+	}
+	if got := usage.Nodes["node-a"].CPU; got != 2000 {
+		t.Errorf("node-a CPU = %d, want 2000", got)
+	}
+	if got := usage.Pods["default/web"].CPU; got != 2000 {
+		t.Errorf("default/web CPU = %d, want 2000", got)
+	}
+	if got := usage.Containers["default/web"]["app"].CPU; got != 2000 {
+		t.Errorf("default/web app CPU = %d, want 2000", got)
+	}
+	if _, ok := usage.Nodes["node-b"]; ok {
+		t.Error("unreachable node reported")
+	}
+
+	// Counters of the unreachable node and its pods are forgotten
+	s.mu.Lock()
+	_, nodeKept := s.prev["node/node-b"]
+	_, podKept := s.prev["pod/default/api"]
+	s.mu.Unlock()
+	if nodeKept || podKept {
+		t.Error("counters of a missing node kept")
+	}
+
+	fake.set("node-a", nil)
+	usage, err = s.Usage(context.Background(), q)
+	if err == nil || strings.Contains(err.Error(), "nodes:") {
+		t.Errorf("Usage() error = %v, want all nodes failed", err)
+	}
+	if len(usage.Nodes) != 0 {
+		t.Errorf("nodes = %v, want none", usage.Nodes)
+	}
+}
+
+func TestKubeletSourceSkips(t *testing.T) {
+	s := newKubeletSource(nil)
+
+	usage, err := s.Usage(context.Background(), UsageQuery{})
+	if err != nil || !usage.NodesSkipped || !usage.PodsSkipped {
+		t.Errorf("without nodes: skipped = %v/%v, err = %v", usage.NodesSkipped, usage.PodsSkipped, err)
+	}
+
+	s.applyCapabilities(models.Capabilities{NodeProxy: false})
+	usage, err = s.Usage(context.Background(), UsageQuery{Nodes: []string{"node-a"}})
+	if err != nil || !usage.NodesSkipped || !usage.PodsSkipped {
+		t.Errorf("forbidden: skipped = %v/%v, err = %v", usage.NodesSkipped, usage.PodsSkipped, err)
+	}
+}
+
+// stubSource returns canned usage and counts its calls
+type stubSource struct {
+	name  string
+	usage *Usage
+	err   error
+	calls int
+}
+
+func (s *stubSource) Name() string {
+	return s.name
+}
+
+func (s *stubSource) Usage(ctx context.Context, q UsageQuery) (*Usage, error) {
+	s.calls++
+	return s.usage, s.err
+}
+
+func workingUsage() *Usage {
+	usage := newUsage()
+	usage.Nodes["node-a"] = Sample{CPU: 100}
+	return usage
+}
+
+func skippedUsage() *Usage {
+	usage := newUsage()
+	usage.NodesSkipped = true
+	usage.PodsSkipped = true
+	return usage
+}
+
+func TestAutoSource(t *testing.T) {
+	errMissing := errors.New("metrics-server missing")
+
+	t.Run("primary works", func(t *testing.T) {
+		primary := &stubSource{name: SourceMetricsServer, usage: workingUsage()}
+		fallback := &stubSource{name: SourceKubelet, usage: workingUsage()}
+		s := newAutoSource(primary, fallback)
+		if _, err := s.Usage(context.Background(), UsageQuery{}); err != nil {
+			t.Fatalf("Usage() error = %v", err)
+		}
+		if fallback.calls != 0 || s.Name() != SourceMetricsServer {
+			t.Errorf("fallback calls = %d, name = %s", fallback.calls, s.Name())
+		}
+	})
+
+	t.Run("falls back", func(t *testing.T) {
+		primary := &stubSource{name: SourceMetricsServer, usage: skippedUsage(), err: errMissing}
+		fallback := &stubSource{name: SourceKubelet, usage: workingUsage()}
+		s := newAutoSource(primary, fallback)
+		usage, err := s.Usage(context.Background(), UsageQuery{})
+		if err != nil || usage.Nodes["node-a"].CPU != 100 {
+			t.Fatalf("Usage() = %+v, %v, want the fallback's usage", usage, err)
+		}
+		if s.Name() != SourceKubelet {
+			t.Errorf("Name() = %s, want %s", s.Name(), SourceKubelet)
+		}
+
+		// The fallback stays in use, and its errors are reported
+		fallback.err = errors.New("node-b unreachable")
+		if _, err := s.Usage(context.Background(), UsageQuery{}); err != fallback.err {
+			t.Errorf("Usage() error = %v, want %v", err, fallback.err)
+		}
+		if primary.calls != 1 {
+			t.Errorf("primary calls = %d, want 1", primary.calls)
+		}
+	})
+
+	t.Run("partial fallback failure", func(t *testing.T) {
+		partial := errors.New("failed to fetch kubelet stats of 1/2 nodes")
+		primary := &stubSource{name: SourceMetricsServer, usage: skippedUsage(), err: errMissing}
+		fallback := &stubSource{name: SourceKubelet, usage: workingUsage(), err: partial}
+		s := newAutoSource(primary, fallback)
+		if _, err := s.Usage(context.Background(), UsageQuery{}); err != partial {
+			t.Errorf("Usage() error = %v, want %v", err, partial)
+		}
+		if s.Name() != SourceKubelet {
+			t.Errorf("Name() = %s, want %s", s.Name(), SourceKubelet)
+		}
+	})
+
+	t.Run("fallback fails", func(t *testing.T) {
+		primary := &stubSource{name: SourceMetricsServer, usage: skippedUsage(), err: errMissing}
+		fallback := &stubSource{name: SourceKubelet, usage: newUsage(), err: errors.New("forbidden")}
+		s := newAutoSource(primary, fallback)
+		if _, err := s.Usage(context.Background(), UsageQuery{}); err != errMissing {
+			t.Errorf("Usage() error = %v, want the primary's %v", err, errMissing)
+		}
+		if s.Name() != SourceMetricsServer {
+			t.Errorf("Name() = %s, want %s", s.Name(), SourceMetricsServer)
+		}
+
+		// The fallback is not tried again until fallbackRetry has passed
+		s.Usage(context.Background(), UsageQuery{})
+		if fallback.calls != 1 {
+			t.Errorf("fallback calls = %d, want 1", fallback.calls)
+		}
+		s.lastAttempt = time.Now().Add(-fallbackRetry)
+		s.Usage(context.Background(), UsageQuery{})
+		if fallback.calls != 2 {
+			t.Errorf("fallback calls = %d, want 2", fallback.calls)
+		}
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		primary := &stubSource{name: SourceMetricsServer, usage: workingUsage()}
+		fallback := &stubSource{name: SourceKubelet, usage: workingUsage()}
+		s := newAutoSource(primary, fallback)
+		s.applyCapabilities(models.Capabilities{NodeProxy: true})
+		if s.Name() != SourceKubelet {
+			t.Errorf("Name() = %s, want %s", s.Name(), SourceKubelet)
+		}
+		s.Usage(context.Background(), UsageQuery{})
+		if primary.calls != 0 {
+			t.Errorf("primary calls = %d, want 0", primary.calls)
+		}
+	})
+}
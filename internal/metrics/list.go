@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// listPageSize is the number of objects requested per list call. Large
+// clusters are listed in chunks rather than in one response holding every
+// object at once.
+const listPageSize = 500
+
+// listFunc lists one page of objects, returning its items and the token
+// continuing the list ("" after the last page)
+type listFunc[T any] func(ctx context.Context, opts metav1.ListOptions) ([]T, string, error)
+
+// listAll lists every object matching the selectors of opts page by
+// page. Each page is trimmed by strip before the next one is requested, so
+// only the fields ktop uses are kept. When the continue token expires
+// between pages, the list starts over in a single call.
+func listAll[T any](ctx context.Context, opts metav1.ListOptions, list listFunc[T], strip func(*T)) ([]T, error) {
+	var items []T
+	opts.Limit = listPageSize
+	for {
+		page, next, err := list(ctx, opts)
+		if err != nil && opts.Continue != "" && apierrors.IsResourceExpired(err) {
+			items, opts.Limit, opts.Continue = items[:0], 0, ""
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range page {
+			strip(&page[i])
+		}
+		items = append(items, page...)
+		if next == "" {
+			return items, nil
+		}
+		opts.Continue = next
+	}
+}
+
+// stripPod drops the fields of a pod that ktop does not use and that
+// make up much of its size: managed fields, annotations, volumes and
+// container environments
+func stripPod(p *corev1.Pod) {
+	p.ManagedFields = nil
+	p.Annotations = nil
+	p.Spec.Volumes = nil
+	for _, containers := range [][]corev1.Container{p.Spec.InitContainers, p.Spec.Containers} {
+		for i := range containers {
+			containers[i].Env = nil
+			containers[i].EnvFrom = nil
+			containers[i].Command = nil
+			containers[i].Args = nil
+		}
+	}
+}
+
+// stripNode drops the fields of a node that ktop does not use: managed
+// fields, annotations and the list of cached images
+func stripNode(n *corev1.Node) {
+	n.ManagedFields = nil
+	n.Annotations = nil
+	n.Status.Images = nil
+}
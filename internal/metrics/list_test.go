@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pagedList serves items in pages of opts.Limit, like the API server.
+// Continue tokens are the offset of the next page.
+type pagedList struct {
+	items  []int
+	calls  []metav1.ListOptions
+	expire bool // fail the first continued call with 410 Gone
+}
+
+func (l *pagedList) list(_ context.Context, opts metav1.ListOptions) ([]int, string, error) {
+	l.calls = append(l.calls, opts)
+	if opts.Continue != "" && l.expire {
+		l.expire = false
+		return nil, "", apierrors.NewResourceExpired("continue token expired")
+	}
+	start, _ := strconv.Atoi(opts.Continue)
+	if opts.Limit == 0 || start+int(opts.Limit) >= len(l.items) {
+		return append([]int(nil), l.items[start:]...), "", nil
+	}
+	end := start + int(opts.Limit)
+	return append([]int(nil), l.items[start:end]...), strconv.Itoa(end), nil
+}
+
+func TestListAll(t *testing.T) {
+	items := make([]int, 2*listPageSize+10)
+	for i := range items {
+		items[i] = i
+	}
+	double := func(v *int) { *v *= 2 }
+	check := func(t *testing.T, got []int) {
+		t.Helper()
+		if len(got) != len(items) {
+			t.Fatalf("got %d items, want %d", len(got), len(items))
+		}
+		for i, v := range got {
+			if v != 2*i {
+				t.Fatalf("item %d = %d, want %d stripped", i, v, 2*i)
+			}
+		}
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		l := &pagedList{items: items}
+		got, err := listAll(context.Background(), metav1.ListOptions{}, l.list, double)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got)
+		if len(l.calls) != 3 {
+			t.Fatalf("%d calls, want 3 pages", len(l.calls))
+		}
+		for _, opts := range l.calls {
+			if opts.Limit != listPageSize {
+				t.Errorf("limit = %d, want %d", opts.Limit, listPageSize)
+			}
+		}
+	})
+
+	t.Run("expired continue token", func(t *testing.T) {
+		l := &pagedList{items: items, expire: true}
+		got, err := listAll(context.Background(), metav1.ListOptions{}, l.list, double)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got)
+		if last := l.calls[len(l.calls)-1]; last.Limit != 0 || last.Continue != "" {
+			t.Errorf("after expiry listed with %+v, want a full list", last)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		want := errors.New("connection refused")
+		_, err := listAll(context.Background(), metav1.ListOptions{}, func(context.Context, metav1.ListOptions) ([]int, string, error) {
+			return nil, "", want
+		}, double)
+		if !errors.Is(err, want) {
+			t.Errorf("err = %v, want %v", err, want)
+		}
+	})
+}
+
+func TestStripPod(t *testing.T) {
+	p := testPod("shop", "web", "node-a", corev1.PodRunning, 1)
+	p.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}
+	p.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+	p.Spec.Volumes = []corev1.Volume{{Name: "data"}}
+	p.Spec.InitContainers = []corev1.Container{{Name: "init", Env: []corev1.EnvVar{{Name: "MODE", Value: "init"}}}}
+	p.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "DB_URL", Value: "postgres://db"}}
+	p.Spec.Containers[0].Command = []string{"/server"}
+
+	stripPod(p)
+	if p.Annotations != nil || p.ManagedFields != nil || p.Spec.Volumes != nil {
+		t.Errorf("metadata not stripped: %+v", p.ObjectMeta)
+	}
+	if p.Spec.InitContainers[0].Env != nil || p.Spec.Containers[0].Env != nil || p.Spec.Containers[0].Command != nil {
+		t.Errorf("containers not stripped: %+v", p.Spec)
+	}
+	// Fields ktop shows are kept
+	if p.Spec.NodeName != "node-a" || len(p.Spec.Containers) != 2 || p.Spec.Containers[0].Resources.Requests.Cpu().MilliValue() != 100 {
+		t.Errorf("used fields lost: %+v", p.Spec)
+	}
+	if p.Status.ContainerStatuses[0].RestartCount != 1 {
+		t.Errorf("status lost: %+v", p.Status)
+	}
+}
+
+func TestCollectStripsObjects(t *testing.T) {
+	n := testNode("node-a", 4000, 16*1024*mi, corev1.ConditionTrue)
+	n.Status.Images = []corev1.ContainerImage{{Names: []string{"nginx:1.27"}, SizeBytes: 70 * mi}}
+	p := testPod("shop", "web", "node-a", corev1.PodRunning)
+	p.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+
+	c := newTestCluster(n, p).collector()
+	collect(t, c)
+	if c.lastNodes[0].Status.Images != nil {
+		t.Errorf("cached node keeps images: %+v", c.lastNodes[0].Status.Images)
+	}
+	if c.lastPods[0].ManagedFields != nil {
+		t.Errorf("cached pod keeps managed fields: %+v", c.lastPods[0].ManagedFields)
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// metricsServerSource reads usage from the metrics.k8s.io API served by
+// metrics-server
+type metricsServerSource struct {
+	client *k8s.Client
+
+	// Set from the preflight checks; both allowed until then
+	nodesAllowed bool
+	podsAllowed  bool
+}
+
+// newMetricsServerSource creates a metrics-server source
+func newMetricsServerSource(client *k8s.Client) *metricsServerSource {
+	return &metricsServerSource{client: client, nodesAllowed: true, podsAllowed: true}
+}
+
+// Name returns the source name
+func (s *metricsServerSource) Name() string {
+	return SourceMetricsServer
+}
+
+// applyCapabilities skips the metrics RBAC forbids
+func (s *metricsServerSource) applyCapabilities(caps models.Capabilities) {
+	s.nodesAllowed = caps.NodeMetrics
+	s.podsAllowed = caps.PodMetrics
+}
+
+// Usage lists node and pod metrics
+func (s *metricsServerSource) Usage(ctx context.Context, q UsageQuery) (*Usage, error) {
+	usage := newUsage()
+	usage.NodesSkipped = !q.NodeUsage || !s.nodesAllowed
+	usage.PodsSkipped = !s.podsAllowed
+
+	var nodeErr error
+	if !usage.NodesSkipped {
+		nodeErr = s.nodeUsage(ctx, q.NodeSelector, usage)
+	}
+	if !usage.PodsSkipped {
+		if err := s.podUsage(ctx, q.Namespaces, q.PodSelector, usage); err != nil {
+			return usage, fmt.Errorf("failed to fetch pod metrics: %w", err)
+		}
+	}
+	if nodeErr != nil {
+		return usage, fmt.Errorf("failed to fetch node metrics: %w", nodeErr)
+	}
+	return usage, nil
+}
+
+// nodeUsage adds the usage of the nodes matching the label selector
+func (s *metricsServerSource) nodeUsage(ctx context.Context, selector string, usage *Usage) error {
+	opts := metav1.ListOptions{LabelSelector: selector}
+	metricsList, err := s.client.MetricsClient().MetricsV1beta1().NodeMetricses().List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, nm := range metricsList.Items {
+		usage.Nodes[nm.Name] = Sample{
+			CPU:    nm.Usage.Cpu().MilliValue(),
+			Memory: nm.Usage.Memory().Value(),
+		}
+	}
+	return nil
+}
+
+// podUsage adds the usage of the pods in the given namespaces, or in all
+// namespaces when none are given, that match the label selector
+func (s *metricsServerSource) podUsage(ctx context.Context, namespaces []string, selector string, usage *Usage) error {
+	opts := metav1.ListOptions{LabelSelector: selector}
+	for _, ns := range scopeOrAll(namespaces) {
+		podMetricsList, err := s.client.MetricsClient().MetricsV1beta1().PodMetricses(ns).List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, pm := range podMetricsList.Items {
+			var sample Sample
+			containers := make(map[string]Sample, len(pm.Containers))
+			for _, container := range pm.Containers {
+				c := Sample{
+					CPU:    container.Usage.Cpu().MilliValue(),
+					Memory: container.Usage.Memory().Value(),
+				}
+				containers[container.Name] = c
+				sample.CPU += c.CPU
+				sample.Memory += c.Memory
+			}
+			key := pm.Namespace + "/" + pm.Name
+			usage.Pods[key] = sample
+			usage.Containers[key] = containers
+		}
+	}
+	return nil
+}
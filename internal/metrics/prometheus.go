@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/prometheus"
+)
+
+// prometheusSource reads usage from a Prometheus server with the PromQL
+// queries of the config, so that clusters already scraping cAdvisor get
+// network and throttling data as well
+type prometheusSource struct {
+	client  *prometheus.Client
+	labels  config.PrometheusLabels
+	metrics []promMetric
+}
+
+// promMetric is one query and how its values are stored in a Sample
+type promMetric struct {
+	name    string
+	query   string
+	pod     bool // series are per pod rather than per node
+	history bool // loaded with range queries when backfilling
+	set     func(s *Sample, v float64)
+}
+
+// newPrometheusSource creates a Prometheus source from the config
+func newPrometheusSource(cfg *config.PrometheusConfig, timeout time.Duration) (*prometheusSource, error) {
+	headers, err := cfg.RequestHeaders()
+	if err != nil {
+		return nil, err
+	}
+	client, err := prometheus.NewClient(cfg.URL, headers, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	q := cfg.Queries
+	all := []promMetric{
+		{name: "nodeCPU", query: q.NodeCPU, history: true, set: setCPU},
+		{name: "nodeMemory", query: q.NodeMemory, history: true, set: setMemory},
+		{name: "nodeNetworkRx", query: q.NodeNetworkRx, set: setNetworkRx},
+		{name: "nodeNetworkTx", query: q.NodeNetworkTx, set: setNetworkTx},
+		{name: "podCPU", query: q.PodCPU, pod: true, history: true, set: setCPU},
+		{name: "podMemory", query: q.PodMemory, pod: true, history: true, set: setMemory},
+		{name: "podNetworkRx", query: q.PodNetworkRx, pod: true, set: setNetworkRx},
+		{name: "podNetworkTx", query: q.PodNetworkTx, pod: true, set: setNetworkTx},
+		{name: "podThrottling", query: q.PodThrottling, pod: true, set: setThrottled},
+	}
+
+	// An empty query disables the metric
+	src := &prometheusSource{client: client, labels: cfg.Labels}
+	for _, m := range all {
+		if m.query != "" {
+			src.metrics = append(src.metrics, m)
+		}
+	}
+	return src, nil
+}
+
+func setCPU(s *Sample, v float64)       { s.CPU = int64(math.Round(v * 1000)) }
+func setMemory(s *Sample, v float64)    { s.Memory = int64(v) }
+func setNetworkRx(s *Sample, v float64) { s.NetworkRx = int64(v) }
+func setNetworkTx(s *Sample, v float64) { s.NetworkTx = int64(v) }
+func setThrottled(s *Sample, v float64) { s.Throttled = v }
+
+// Name returns the source name
+func (s *prometheusSource) Name() string {
+	return SourcePrometheus
+}
+
+// Usage evaluates the queries concurrently. Failed queries are reported in
+// the error while the results of the others are still returned.
+func (s *prometheusSource) Usage(ctx context.Context, q UsageQuery) (*Usage, error) {
+	usage := newUsage()
+	usage.NodesSkipped = !q.NodeUsage
+
+	var queries []promMetric
+	for _, m := range s.metrics {
+		if m.pod || q.NodeUsage {
+			queries = append(queries, m)
+		}
+	}
+
+	now := time.Now()
+	results := make([][]prometheus.Sample, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, m := range queries {
+		wg.Add(1)
+		go func(i int, m promMetric) {
+			defer wg.Done()
+			results[i], errs[i] = s.client.Query(ctx, m.query, now)
+		}(i, m)
+	}
+	wg.Wait()
+
+	scope := namespaceSet(q.Namespaces)
+	var failed int
+	var firstErr error
+	for i, m := range queries {
+		if errs[i] != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", m.name, errs[i])
+			}
+			continue
+		}
+		target := usage.Nodes
+		if m.pod {
+			target = usage.Pods
+		}
+		for _, sample := range results[i] {
+			key, ok := s.key(sample.Labels, m.pod, scope)
+			if !ok || !finite(sample.Value) {
+				continue
+			}
+			value := target[key]
+			m.set(&value, sample.Value)
+			target[key] = value
+		}
+	}
+
+	if failed > 0 && failed == len(queries) {
+		return usage, fmt.Errorf("failed to query prometheus: %w", firstErr)
+	}
+	if failed > 0 {
+		return usage, fmt.Errorf("failed %d/%d prometheus queries: %w", failed, len(queries), firstErr)
+	}
+	return usage, nil
+}
+
+// UsageRange loads the CPU and memory history of nodes and pods with
+// range queries
+func (s *prometheusSource) UsageRange(ctx context.Context, q UsageQuery, start, end time.Time, step time.Duration) (*UsageHistory, error) {
+	scope := namespaceSet(q.Namespaces)
+
+	// Samples of each series by time, merged across queries
+	nodes := make(map[string]map[time.Time]*Sample)
+	pods := make(map[string]map[time.Time]*Sample)
+
+	for _, m := range s.metrics {
+		if !m.history || (!m.pod && !q.NodeUsage) {
+			continue
+		}
+		series, err := s.client.QueryRange(ctx, m.query, start, end, step)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.name, err)
+		}
+
+		target := nodes
+		if m.pod {
+			target = pods
+		}
+		for _, ser := range series {
+			key, ok := s.key(ser.Labels, m.pod, scope)
+			if !ok {
+				continue
+			}
+			samples := target[key]
+			if samples == nil {
+				samples = make(map[time.Time]*Sample)
+				target[key] = samples
+			}
+			for _, p := range ser.Points {
+				if !finite(p.Value) {
+					continue
+				}
+				sample := samples[p.Time]
+				if sample == nil {
+					sample = &Sample{}
+					samples[p.Time] = sample
+				}
+				m.set(sample, p.Value)
+			}
+		}
+	}
+
+	return &UsageHistory{Nodes: toPoints(nodes), Pods: toPoints(pods)}, nil
+}
+
+// toPoints turns samples by time into time-ordered points
+func toPoints(series map[string]map[time.Time]*Sample) map[string][]Point {
+	result := make(map[string][]Point, len(series))
+	for key, samples := range series {
+		points := make([]Point, 0, len(samples))
+		for t, sample := range samples {
+			points = append(points, Point{Time: t, Sample: *sample})
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+		result[key] = points
+	}
+	return result
+}
+
+// finite reports whether v is a usable value; ratios such as throttling
+// are NaN when the divisor is zero
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// key returns the node name or pod namespace/name a series belongs to,
+// and whether it is in scope
+func (s *prometheusSource) key(labels map[string]string, pod bool, scope map[string]bool) (string, bool) {
+	if !pod {
+		node := labels[s.labels.Node]
+		return node, node != ""
+	}
+	ns, name := labels[s.labels.Namespace], labels[s.labels.Pod]
+	if ns == "" || name == "" || (len(scope) > 0 && !scope[ns]) {
+		return "", false
+	}
+	return ns + "/" + name, true
+}
+
+// namespaceSet returns the namespaces as a set; empty means all
+func namespaceSet(namespaces []string) map[string]bool {
+	set := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		set[ns] = true
+	}
+	return set
+}
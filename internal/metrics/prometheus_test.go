@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+)
+
+// fakePrometheus serves canned results per PromQL query. Instant results
+// map labels to a value, range results map labels to [time, value] pairs.
+type fakePrometheus struct {
+	instant map[string][]fakeSeries
+	ranges  map[string][]fakeSeries
+	fail    map[string]bool
+}
+
+type fakeSeries struct {
+	labels map[string]string
+	value  string
+	points [][2]any
+}
+
+func (f *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("query")
+	if f.fail[query] {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"status": "error", "errorType": "bad_data", "error": "bad query"})
+		return
+	}
+
+	var resultType string
+	var result []map[string]any
+	switch r.URL.Path {
+	case "/api/v1/query":
+		resultType = "vector"
+		for _, s := range f.instant[query] {
+			result = append(result, map[string]any{"metric": s.labels, "value": [2]any{1700000000, s.value}})
+		}
+	case "/api/v1/query_range":
+		resultType = "matrix"
+		for _, s := range f.ranges[query] {
+			result = append(result, map[string]any{"metric": s.labels, "values": s.points})
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if result == nil {
+		result = []map[string]any{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "success",
+		"data":   map[string]any{"resultType": resultType, "result": result},
+	})
+}
+
+func pod(ns, name string) map[string]string {
+	return map[string]string{"namespace": ns, "pod": name}
+}
+
+func node(name string) map[string]string {
+	return map[string]string{"node": name}
+}
+
+// newTestPrometheusSource starts a fake server and a source querying it
+func newTestPrometheusSource(t *testing.T, fake *fakePrometheus, modify func(*config.PrometheusConfig)) *prometheusSource {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := config.DefaultPrometheusConfig()
+	cfg.URL = srv.URL
+	if modify != nil {
+		modify(&cfg)
+	}
+	src, err := newPrometheusSource(&cfg, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestPrometheusSourceUsage(t *testing.T) {
+	q := config.DefaultPrometheusConfig().Queries
+	fake := &fakePrometheus{instant: map[string][]fakeSeries{
+		q.NodeCPU:       {{labels: node("n1"), value: "1.5"}},
+		q.NodeMemory:    {{labels: node("n1"), value: "2048"}},
+		q.NodeNetworkRx: {{labels: node("n1"), value: "100"}},
+		q.PodCPU: {
+			{labels: pod("app", "web"), value: "0.25"},
+			{labels: pod("other", "db"), value: "0.5"},
+		},
+		q.PodMemory:     {{labels: pod("app", "web"), value: "1024"}},
+		q.PodNetworkTx:  {{labels: pod("app", "web"), value: "300"}},
+		q.PodThrottling: {{labels: pod("app", "web"), value: "0.2"}, {labels: pod("app", "idle"), value: "NaN"}},
+	}}
+	src := newTestPrometheusSource(t, fake, nil)
+
+	usage, err := src.Usage(context.Background(), UsageQuery{Namespaces: []string{"app"}, NodeUsage: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := usage.Nodes["n1"], (Sample{CPU: 1500, Memory: 2048, NetworkRx: 100}); got != want {
+		t.Errorf("node n1 = %+v, want %+v", got, want)
+	}
+	if got, want := usage.Pods["app/web"], (Sample{CPU: 250, Memory: 1024, NetworkTx: 300, Throttled: 0.2}); got != want {
+		t.Errorf("pod app/web = %+v, want %+v", got, want)
+	}
+	if _, ok := usage.Pods["other/db"]; ok {
+		t.Error("pod outside the namespace scope was included")
+	}
+	if _, ok := usage.Pods["app/idle"]; ok {
+		t.Error("NaN throttling ratio was recorded")
+	}
+}
+
+func TestPrometheusSourceSkipsNodes(t *testing.T) {
+	q := config.DefaultPrometheusConfig().Queries
+	fake := &fakePrometheus{
+		instant: map[string][]fakeSeries{q.PodCPU: {{labels: pod("app", "web"), value: "1"}}},
+		// Node queries must not be sent when node usage is not wanted
+		fail: map[string]bool{q.NodeCPU: true, q.NodeMemory: true},
+	}
+	src := newTestPrometheusSource(t, fake, nil)
+
+	usage, err := src.Usage(context.Background(), UsageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !usage.NodesSkipped || usage.Pods["app/web"].CPU != 1000 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestPrometheusSourcePartialFailure(t *testing.T) {
+	q := config.DefaultPrometheusConfig().Queries
+	fake := &fakePrometheus{
+		instant: map[string][]fakeSeries{q.PodCPU: {{labels: pod("app", "web"), value: "1"}}},
+		fail:    map[string]bool{q.PodMemory: true},
+	}
+	src := newTestPrometheusSource(t, fake, nil)
+
+	usage, err := src.Usage(context.Background(), UsageQuery{})
+	if err == nil || !strings.Contains(err.Error(), "podMemory") {
+		t.Errorf("err = %v, want a podMemory failure", err)
+	}
+	if usage.Pods["app/web"].CPU != 1000 {
+		t.Error("results of the successful queries were dropped")
+	}
+}
+
+func TestPrometheusSourceCustomQueries(t *testing.T) {
+	fake := &fakePrometheus{instant: map[string][]fakeSeries{
+		"my_cpu": {{labels: map[string]string{"kubernetes_namespace": "app", "pod_name": "web"}, value: "2"}},
+	}}
+	src := newTestPrometheusSource(t, fake, func(cfg *config.PrometheusConfig) {
+		cfg.Labels.Namespace = "kubernetes_namespace"
+		cfg.Labels.Pod = "pod_name"
+		cfg.Queries = config.PrometheusQueries{PodCPU: "my_cpu"}
+	})
+
+	usage, err := src.Usage(context.Background(), UsageQuery{NodeUsage: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Pods["app/web"].CPU != 2000 {
+		t.Errorf("pods = %+v", usage.Pods)
+	}
+}
+
+func TestPrometheusBackfill(t *testing.T) {
+	q := config.DefaultPrometheusConfig().Queries
+	now := time.Now().Truncate(time.Minute)
+	at := func(ago time.Duration) float64 { return float64(now.Add(-ago).Unix()) }
+	fake := &fakePrometheus{ranges: map[string][]fakeSeries{
+		q.PodCPU: {{labels: pod("app", "web"), points: [][2]any{
+			{at(20 * time.Minute), "0.1"}, {at(10 * time.Minute), "0.3"},
+		}}},
+		q.PodMemory: {{labels: pod("app", "web"), points: [][2]any{
+			{at(20 * time.Minute), "100"}, {at(10 * time.Minute), "200"},
+		}}},
+		q.NodeCPU: {{labels: node("n1"), points: [][2]any{
+			{at(2 * time.Hour), "4"}, {at(5 * time.Minute), "2"},
+		}}},
+	}}
+	src := newTestPrometheusSource(t, fake, nil)
+
+	past, err := src.UsageRange(context.Background(), UsageQuery{NodeUsage: true}, now.Add(-time.Hour), now, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHistory(time.Hour)
+	h.Record(now, &Usage{Pods: map[string]Sample{"app/web": {CPU: 500, Memory: 300}}})
+	h.Backfill(past)
+
+	points := h.Pod("app", "web")
+	if len(points) != 3 {
+		t.Fatalf("got %d points, want 3: %+v", len(points), points)
+	}
+	if points[0].CPU != 100 || points[0].Memory != 100 || points[1].CPU != 300 || points[2].CPU != 500 {
+		t.Errorf("points = %+v", points)
+	}
+
+	// Points older than the window are dropped
+	if nodePoints := h.Node("n1"); len(nodePoints) != 1 || nodePoints[0].CPU != 2000 {
+		t.Errorf("node points = %+v", nodePoints)
+	}
+}
+
+func TestCollectBackfill(t *testing.T) {
+	q := config.DefaultPrometheusConfig().Queries
+	at := float64(time.Now().Add(-10 * time.Minute).Unix())
+	fake := &fakePrometheus{ranges: map[string][]fakeSeries{
+		q.PodCPU:    {{labels: pod("app", "web"), points: [][2]any{{at, "0.3"}}}},
+		q.PodMemory: {{labels: pod("app", "web"), points: [][2]any{{at, "200"}}}},
+	}}
+	c := newTestCluster().collector()
+	c.source = newTestPrometheusSource(t, fake, nil)
+	c.config.Prometheus.Backfill.Duration = 30 * time.Minute
+
+	// The backfill continues after the context of the collection ends
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	c.WaitBackfill(waitCtx)
+
+	if points := c.History().Pod("app", "web"); len(points) == 0 || points[0].CPU != 300 {
+		t.Errorf("backfilled points = %+v", points)
+	}
+}
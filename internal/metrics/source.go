@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Metrics source names accepted by --metrics-source
+const (
+	SourceAuto          = "auto"
+	SourceMetricsServer = "metrics-server"
+	SourceKubelet       = "kubelet"
+	SourcePrometheus    = "prometheus"
+)
+
+// Sample is the resource usage of one node or pod
+type Sample struct {
+	CPU    int64 // millicores
+	Memory int64 // bytes (working set)
+	Disk   int64 // bytes; 0 when the source does not report it
+
+	// Reported by the Prometheus source only
+	NetworkRx int64   // bytes per second
+	NetworkTx int64   // bytes per second
+	Throttled float64 // fraction of CPU periods throttled, 0-1
+}
+
+// Usage holds the samples of one collection, keyed by node name and by
+// pod namespace/name
+type Usage struct {
+	Nodes map[string]Sample
+	Pods  map[string]Sample
+
+	// Containers holds the usage of each container by pod key and
+	// container name, for sources that report it
+	Containers map[string]map[string]Sample
+
+	// NodesSkipped and PodsSkipped are set when the source could not be
+	// asked for that part, e.g. because RBAC forbids it
+	NodesSkipped bool
+	PodsSkipped  bool
+}
+
+// newUsage returns an empty Usage
+func newUsage() *Usage {
+	return &Usage{
+		Nodes:      make(map[string]Sample),
+		Pods:       make(map[string]Sample),
+		Containers: make(map[string]map[string]Sample),
+	}
+}
+
+// UsageQuery describes what a Source should report
+type UsageQuery struct {
+	Nodes      []string // names of the cluster's nodes
+	Namespaces []string // pod scope; empty means all namespaces
+	NodeUsage  bool     // whether node usage is wanted
+
+	// Label selectors of the listed nodes and pods; sources that can
+	// select server-side skip the usage of other nodes and pods
+	NodeSelector string
+	PodSelector  string
+}
+
+// Source provides node and pod resource usage. Implementations may return
+// partial usage together with an error.
+type Source interface {
+	// Name identifies the source in the UI, e.g. "metrics-server"
+	Name() string
+
+	// Usage returns the current usage of nodes and pods
+	Usage(ctx context.Context, q UsageQuery) (*Usage, error)
+}
+
+// capabilityAware is implemented by sources that can skip calls the
+// preflight checks found unusable
+type capabilityAware interface {
+	applyCapabilities(caps models.Capabilities)
+}
+
+// historySource is implemented by sources that can report past usage,
+// used to backfill the history when ktop starts
+type historySource interface {
+	UsageRange(ctx context.Context, q UsageQuery, start, end time.Time, step time.Duration) (*UsageHistory, error)
+}
+
+// NewSource creates the metrics source selected by cfg.MetricsSource. In
+// auto mode Prometheus is used when a Prometheus URL is configured.
+func NewSource(cfg *config.Config, client *k8s.Client) (Source, error) {
+	name := cfg.MetricsSource
+	if (name == SourceAuto || name == "") && cfg.Prometheus.URL != "" {
+		name = SourcePrometheus
+	}
+
+	switch name {
+	case SourceMetricsServer:
+		return newMetricsServerSource(client), nil
+	case SourceKubelet:
+		return newKubeletSource(client), nil
+	case SourcePrometheus:
+		return newPrometheusSource(&cfg.Prometheus, cfg.Timeout)
+	case SourceAuto, "":
+		return newAutoSource(newMetricsServerSource(client), newKubeletSource(client)), nil
+	default:
+		return nil, fmt.Errorf("unknown metrics source %q", name)
+	}
+}
+
+// unavailableSource stands in for a source that could not be created, so
+// that the reason is shown in the UI instead of usage
+type unavailableSource struct {
+	name string
+	err  error
+}
+
+// Name returns the name of the source that could not be created
+func (s *unavailableSource) Name() string {
+	return s.name
+}
+
+// Usage reports why the source is unavailable
+func (s *unavailableSource) Usage(ctx context.Context, q UsageQuery) (*Usage, error) {
+	usage := newUsage()
+	usage.NodesSkipped = true
+	usage.PodsSkipped = true
+	return usage, s.err
+}
+
+// autoSource uses metrics-server and switches to the kubelet source when
+// metrics-server is missing or not permitted
+type autoSource struct {
+	primary  Source
+	fallback Source
+
+	mu          sync.Mutex
+	active      Source
+	lastAttempt time.Time // last time the fallback was tried
+}
+
+// fallbackRetry limits how often a failing fallback is tried again
+const fallbackRetry = time.Minute
+
+// newAutoSource creates a source preferring primary over fallback
+func newAutoSource(primary, fallback Source) *autoSource {
+	return &autoSource{primary: primary, fallback: fallback, active: primary}
+}
+
+// Name returns the name of the source in use
+func (s *autoSource) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active.Name()
+}
+
+// Usage queries the active source. When the primary source fails, the
+// fallback is tried and, if it works, used from then on.
+func (s *autoSource) Usage(ctx context.Context, q UsageQuery) (*Usage, error) {
+	s.mu.Lock()
+	active := s.active
+	s.mu.Unlock()
+
+	usage, err := active.Usage(ctx, q)
+	if (err == nil && !usage.PodsSkipped) || active != s.primary {
+		return usage, err
+	}
+
+	s.mu.Lock()
+	retry := time.Since(s.lastAttempt) >= fallbackRetry
+	if retry {
+		s.lastAttempt = time.Now()
+	}
+	s.mu.Unlock()
+	if !retry {
+		return usage, err
+	}
+
+	fallbackUsage, fallbackErr := s.fallback.Usage(ctx, q)
+	if fallbackUsage.PodsSkipped || (fallbackErr != nil && len(fallbackUsage.Nodes) == 0) {
+		// Report the primary source's problem; it is the expected one
+		return usage, err
+	}
+	s.mu.Lock()
+	s.active = s.fallback
+	s.mu.Unlock()
+	return fallbackUsage, fallbackErr
+}
+
+// applyCapabilities forwards the preflight results and starts with the
+// fallback when only it is permitted
+func (s *autoSource) applyCapabilities(caps models.Capabilities) {
+	for _, src := range []Source{s.primary, s.fallback} {
+		if aware, ok := src.(capabilityAware); ok {
+			aware.applyCapabilities(caps)
+		}
+	}
+	if !caps.NodeMetrics && !caps.PodMetrics && caps.NodeProxy {
+		s.mu.Lock()
+		s.active = s.fallback
+		s.mu.Unlock()
+	}
+}
@@ -38,15 +38,62 @@ type NodeConditions struct {
 
 // Node represents a Kubernetes node with its metrics
 type Node struct {
-	Name       string            `json:"name"`
-	Status     NodeStatus        `json:"status"`
-	CPU        ResourceUsage     `json:"cpu"`
-	Memory     ResourceUsage     `json:"memory"`
-	Disk       ResourceUsage     `json:"disk"`
-	GPU        *GPUInfo          `json:"gpu,omitempty"`
-	PodCount   int               `json:"podCount"`
-	Conditions NodeConditions    `json:"conditions"`
-	Labels     map[string]string `json:"labels,omitempty"`
+	Name        string            `json:"name"`
+	Status      NodeStatus        `json:"status"`
+	CPU         ResourceUsage     `json:"cpu"`
+	Memory      ResourceUsage     `json:"memory"`
+	Disk        ResourceUsage     `json:"disk"`
+	GPU         *GPUInfo          `json:"gpu,omitempty"`
+	PodCount    int               `json:"podCount"`
+	PodCapacity int               `json:"podCapacity"` // allocatable pods; 0 if unknown
+	Conditions  NodeConditions    `json:"conditions"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	InternalIP  string            `json:"internalIP,omitempty"`
+	Version     string            `json:"kubeletVersion,omitempty"`
+
+	// Allocatable resources and the requests of the pods scheduled on the
+	// node (millicores / bytes)
+	CPUAllocatable    int64 `json:"cpuAllocatable"`
+	MemoryAllocatable int64 `json:"memoryAllocatable"`
+	CPURequests       int64 `json:"cpuRequests"`
+	MemoryRequests    int64 `json:"memoryRequests"`
+
+	// Network rates in bytes per second; reported by Prometheus only
+	NetworkRx int64 `json:"networkRx,omitempty"`
+	NetworkTx int64 `json:"networkTx,omitempty"`
+
+	// Scheduling constraints: taints and whether the node is cordoned
+	Taints        []Taint `json:"taints,omitempty"`
+	Unschedulable bool    `json:"unschedulable,omitempty"`
+}
+
+// Taint keeps pods that do not tolerate it off a node
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"` // NoSchedule, PreferNoSchedule or NoExecute
+}
+
+// String formats a taint like kubectl, e.g. "dedicated=gpu:NoSchedule"
+func (t Taint) String() string {
+	s := t.Key
+	if t.Value != "" {
+		s += "=" + t.Value
+	}
+	return s + ":" + t.Effect
+}
+
+// RequestPercents returns the CPU and memory requests as percentages of
+// the allocatable resources, 0 when they are unknown
+func (n *Node) RequestPercents() (cpu, memory float64) {
+	if n.CPUAllocatable > 0 {
+		cpu = float64(n.CPURequests) / float64(n.CPUAllocatable) * 100
+	}
+	if n.MemoryAllocatable > 0 {
+		memory = float64(n.MemoryRequests) / float64(n.MemoryAllocatable) * 100
+	}
+	return cpu, memory
 }
 
 // PodStatus represents the status of a pod
@@ -70,6 +117,76 @@ type Pod struct {
 	Memory         int64     `json:"memory"`         // bytes
 	ContainerCount int       `json:"containerCount"`
 	RestartCount   int32     `json:"restartCount"`
+
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	IP        string            `json:"ip,omitempty"`
+	QOSClass  string            `json:"qosClass,omitempty"`
+
+	// Workload is the controller owning the pod as kind/name, e.g.
+	// Deployment/web; the pod itself, Pod/<name>, when it has none
+	Workload string `json:"workload,omitempty"`
+
+	// Requests and limits summed over containers (millicores / bytes)
+	CPURequest    int64 `json:"cpuRequest"`
+	CPULimit      int64 `json:"cpuLimit"`
+	MemoryRequest int64 `json:"memoryRequest"`
+	MemoryLimit   int64 `json:"memoryLimit"`
+	GPURequest    int64 `json:"gpuRequest,omitempty"` // NVIDIA GPUs
+
+	// Reported by Prometheus only: network rates in bytes per second and
+	// the percentage of CPU periods that were throttled
+	NetworkRx    int64   `json:"networkRx,omitempty"`
+	NetworkTx    int64   `json:"networkTx,omitempty"`
+	CPUThrottled float64 `json:"cpuThrottled,omitempty"`
+
+	// Containers in spec order; their usage is reported by metrics-server
+	// and the kubelet only
+	Containers []Container `json:"containers,omitempty"`
+}
+
+// containerErrors are the waiting and terminated reasons of containers
+// that cannot run: a pod is failing with any of them, whatever its phase
+var containerErrors = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+	"ContainerCannotRun":         true,
+	"StartError":                 true,
+	"OOMKilled":                  true,
+	"Error":                      true,
+}
+
+// Failing reports whether the pod failed or is not known to run, or has a
+// container that crashes or cannot start, e.g. in CrashLoopBackOff
+func (p *Pod) Failing() bool {
+	if p.Status == PodStatusFailed || p.Status == PodStatusUnknown {
+		return true
+	}
+	for _, c := range p.Containers {
+		if containerErrors[c.State] {
+			return true
+		}
+	}
+	return false
+}
+
+// Container is one container of a pod
+type Container struct {
+	Name          string `json:"name"`
+	State         string `json:"state"` // Running, or the reason it is waiting or terminated
+	CPU           int64  `json:"cpu"`   // millicores
+	Memory        int64  `json:"memory"`
+	CPURequest    int64  `json:"cpuRequest"`
+	CPULimit      int64  `json:"cpuLimit"`
+	MemoryRequest int64  `json:"memoryRequest"`
+	MemoryLimit   int64  `json:"memoryLimit"`
+	RestartCount  int32  `json:"restartCount"`
 }
 
 // ClusterInfo holds information about the connected cluster
@@ -80,13 +197,42 @@ type ClusterInfo struct {
 	Namespace string `json:"namespace,omitempty"` // current namespace if set
 }
 
+// Capabilities records which API features the current user can use, as
+// determined by the preflight checks. Optional features that are not
+// available are skipped instead of reported as errors.
+type Capabilities struct {
+	ListNodes   bool `json:"listNodes"`
+	NodeMetrics bool `json:"nodeMetrics"`
+	PodMetrics  bool `json:"podMetrics"`
+	Events      bool `json:"events"`
+	Logs        bool `json:"logs"`
+	Exec        bool `json:"exec"`
+	NodeProxy   bool `json:"nodeProxy"`
+}
+
 // ClusterMetrics holds all metrics data for a point in time
 type ClusterMetrics struct {
 	Timestamp   time.Time   `json:"timestamp"`
 	ClusterInfo ClusterInfo `json:"clusterInfo"`
 	Nodes       []Node      `json:"nodes"`
 	Pods        []Pod       `json:"pods"`
-	Error       error       `json:"-"`
+
+	// Sources reports how each data source fared in this collection
+	Sources []SourceStatus `json:"sources,omitempty"`
+
+	// Namespaces lists the namespaces pods were collected from; empty
+	// means cluster-wide
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NodesForbidden is set when RBAC does not allow listing nodes
+	NodesForbidden bool `json:"nodesForbidden,omitempty"`
+
+	// MetricsSource names the source usage was read from
+	MetricsSource string `json:"metricsSource,omitempty"`
+
+	// MetricsUnavailable is set when usage metrics were skipped because the
+	// metrics API is missing or not permitted
+	MetricsUnavailable bool `json:"metricsUnavailable,omitempty"`
 
 	// Aggregate stats
 	TotalCPUCapacity    int64 `json:"totalCPUCapacity"`    // millicores
@@ -102,6 +248,36 @@ type ClusterMetrics struct {
 	ReadyNodes          int   `json:"readyNodes"`
 }
 
+// Degraded returns the sources that are not ok
+func (m *ClusterMetrics) Degraded() []SourceStatus {
+	var degraded []SourceStatus
+	for _, s := range m.Sources {
+		if s.State != SourceOK {
+			degraded = append(degraded, s)
+		}
+	}
+	return degraded
+}
+
+// SourceState is the health of a data source in one collection
+type SourceState string
+
+const (
+	SourceOK     SourceState = "ok"
+	SourceStale  SourceState = "stale"  // failed; showing data of an earlier collection
+	SourceFailed SourceState = "failed" // failed; no earlier data is shown instead
+)
+
+// SourceStatus reports how one data source (node list, pod list or the
+// usage metrics source) fared in a collection
+type SourceStatus struct {
+	Name        string        `json:"name"`
+	State       SourceState   `json:"state"`
+	Latency     time.Duration `json:"latency"`
+	LastSuccess time.Time     `json:"lastSuccess"` // zero if never successful
+	Err         error         `json:"-"`
+}
+
 // SortField represents the field to sort by
 type SortField int
 
@@ -156,8 +332,64 @@ const (
 	ViewModeSplit ViewMode = iota
 	ViewModeNodes
 	ViewModePods
+	ViewModeTree      // nodes with their pods and containers
+	ViewModeHeatmap   // nodes as colored cells, grouped by a label
+	ViewModeRightsize // request recommendations per workload
+	ViewModeCost      // hourly and accumulated cost by node, namespace, ...
+)
+
+// HeatMetric is the measure that colors the cells of the heatmap
+type HeatMetric int
+
+const (
+	HeatCPU HeatMetric = iota
+	HeatMemory
+	HeatRequests // the higher of the CPU and memory requests
+	HeatPods     // pods against the node's pod limit
+)
+
+// String returns the display name for a heatmap metric
+func (h HeatMetric) String() string {
+	switch h {
+	case HeatCPU:
+		return "CPU"
+	case HeatMemory:
+		return "Memory"
+	case HeatRequests:
+		return "Requests"
+	case HeatPods:
+		return "Pods"
+	default:
+		return "Unknown"
+	}
+}
+
+// CostGroup is what the cost view sums costs up by
+type CostGroup int
+
+const (
+	CostByNamespace CostGroup = iota
+	CostByWorkload
+	CostByLabel // the configured pod label, e.g. team
+	CostByNode
 )
 
+// String returns the display name for a cost grouping
+func (g CostGroup) String() string {
+	switch g {
+	case CostByNamespace:
+		return "Namespace"
+	case CostByWorkload:
+		return "Workload"
+	case CostByLabel:
+		return "Label"
+	case CostByNode:
+		return "Node"
+	default:
+		return "Unknown"
+	}
+}
+
 // AppState holds the current application state
 type AppState struct {
 	ViewMode        ViewMode
@@ -166,11 +398,25 @@ type AppState struct {
 	PodSortField    SortField
 	PodSortAsc      bool
 	NamespaceFilter string // empty means all namespaces
+	NodeFilter      string // filter expression of the nodes table
+	PodFilter       string // filter expression of the pods table
+	PodNode         string // node the pods table is limited to
 	ShowSystem      bool   // show system namespaces
 	SelectedNode    int
 	SelectedPod     int
 	ShowHelp        bool
+	FleetView       bool // showing the multi-cluster fleet table
 	LastError       string
+
+	// The node label the nodes table and the heatmap are grouped by,
+	// empty for none, and the measure that colors the heatmap
+	NodeGroup  string
+	HeatMetric HeatMetric
+
+	// Cost view: what costs are summed up by, and what pods are charged
+	// for ("requests" or "usage")
+	CostGroup CostGroup
+	CostBasis string
 }
 
 // DefaultAppState returns the default application state
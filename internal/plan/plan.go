@@ -0,0 +1,374 @@
+// Package plan simulates placing replicas of a pod shape on the nodes of a
+// cluster, answering "will this workload fit?" from the allocatable
+// resources of each node minus the requests already committed on it.
+package plan
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Shape is the pod to place: its requests, the number of replicas, and
+// the nodes it may run on
+type Shape struct {
+	CPU      int64 // millicores per replica
+	Memory   int64 // bytes per replica
+	Replicas int
+
+	NodeSelector labels.Selector // nil selects every node
+	Tolerations  []corev1.Toleration
+}
+
+// ParseShape builds a shape from quantities such as "500m" and "4Gi", a
+// label selector and tolerations in kubectl taint syntax
+func ParseShape(cpu, memory string, replicas int, nodeSelector string, tolerations []string) (Shape, error) {
+	var s Shape
+	if replicas < 1 {
+		return s, fmt.Errorf("replicas must be at least 1")
+	}
+	s.Replicas = replicas
+	if cpu != "" {
+		q, err := resource.ParseQuantity(cpu)
+		if err != nil {
+			return s, fmt.Errorf("invalid cpu %q: %w", cpu, err)
+		}
+		s.CPU = q.MilliValue()
+	}
+	if memory != "" {
+		q, err := resource.ParseQuantity(memory)
+		if err != nil {
+			return s, fmt.Errorf("invalid memory %q: %w", memory, err)
+		}
+		s.Memory = q.Value()
+	}
+	if s.CPU < 0 || s.Memory < 0 {
+		return s, fmt.Errorf("requests must not be negative")
+	}
+	if s.CPU == 0 && s.Memory == 0 {
+		return s, fmt.Errorf("a cpu or memory request is required")
+	}
+	if nodeSelector != "" {
+		sel, err := labels.Parse(nodeSelector)
+		if err != nil {
+			return s, fmt.Errorf("invalid node selector: %w", err)
+		}
+		s.NodeSelector = sel
+	}
+	for _, t := range tolerations {
+		toleration, err := ParseToleration(t)
+		if err != nil {
+			return s, err
+		}
+		s.Tolerations = append(s.Tolerations, toleration)
+	}
+	return s, nil
+}
+
+// ParseToleration parses a toleration written like the taint it
+// tolerates: "key=value:Effect", "key:Effect", "key=value" or "key". A
+// missing value tolerates any value, a missing effect any effect, and "*"
+// tolerates every taint.
+func ParseToleration(s string) (corev1.Toleration, error) {
+	var t corev1.Toleration
+	if s == "*" {
+		t.Operator = corev1.TolerationOpExists
+		return t, nil
+	}
+	rest, effect, hasEffect := strings.Cut(s, ":")
+	if hasEffect {
+		switch e := corev1.TaintEffect(effect); e {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			t.Effect = e
+		default:
+			return t, fmt.Errorf("invalid toleration %q: unknown effect %q", s, effect)
+		}
+	}
+	key, value, hasValue := strings.Cut(rest, "=")
+	if key == "" {
+		return t, fmt.Errorf("invalid toleration %q: missing key", s)
+	}
+	t.Key = key
+	t.Operator = corev1.TolerationOpExists
+	if hasValue {
+		t.Operator, t.Value = corev1.TolerationOpEqual, value
+	}
+	return t, nil
+}
+
+// String describes the shape, e.g. "10 × (cpu 2.0, memory 4.0Gi)"
+func (s Shape) String() string {
+	var requests []string
+	if s.CPU > 0 {
+		requests = append(requests, "cpu "+metrics.FormatCPU(s.CPU))
+	}
+	if s.Memory > 0 {
+		requests = append(requests, "memory "+metrics.FormatMemory(s.Memory))
+	}
+	return fmt.Sprintf("%d × (%s)", s.Replicas, strings.Join(requests, ", "))
+}
+
+// Resource is what a node runs out of first
+type Resource string
+
+const (
+	ResourceCPU    Resource = "cpu"
+	ResourceMemory Resource = "memory"
+	ResourcePods   Resource = "pods"
+)
+
+// Strategy is a way of choosing the node of each replica
+type Strategy string
+
+const (
+	// FirstFit fills the nodes in order, packing replicas tightly
+	FirstFit Strategy = "first-fit"
+	// Spread places each replica on the node with the fewest replicas,
+	// like a topology spread constraint over nodes
+	Spread Strategy = "spread"
+)
+
+// Strategies lists the simulated strategies in report order
+var Strategies = []Strategy{FirstFit, Spread}
+
+// NodeFit is how a node fares for the shape
+type NodeFit struct {
+	Name string
+
+	// Excluded says why no replica can run on the node, e.g. "not ready"
+	// or a taint that is not tolerated; empty when the node is eligible
+	Excluded string
+
+	// Resources left for new pods: allocatable minus committed requests
+	FreeCPU    int64
+	FreeMemory int64
+	FreePods   int
+
+	Fits  int      // replicas the node can take
+	Limit Resource // what stops the node from taking one more
+
+	Placed map[Strategy]int // replicas placed on the node by each strategy
+}
+
+// Result is the outcome of a simulation
+type Result struct {
+	Shape Shape
+	Nodes []NodeFit // in order of name
+
+	// Fits is the number of replicas that can be placed, at most
+	// Shape.Replicas. Both strategies place the same number, on
+	// different nodes.
+	Fits int
+}
+
+// Simulate places the replicas of a shape on nodes with each strategy
+func Simulate(nodes []models.Node, shape Shape) *Result {
+	r := &Result{Shape: shape, Nodes: make([]NodeFit, 0, len(nodes))}
+	for i := range nodes {
+		r.Nodes = append(r.Nodes, fit(&nodes[i], shape))
+	}
+	sort.Slice(r.Nodes, func(i, j int) bool { return r.Nodes[i].Name < r.Nodes[j].Name })
+
+	for _, f := range r.Nodes {
+		r.Fits += f.Fits
+	}
+	r.Fits = min(r.Fits, shape.Replicas)
+
+	r.place(FirstFit, func(_, _ *NodeFit) bool { return false })
+	r.place(Spread, func(a, b *NodeFit) bool {
+		if a.Placed[Spread] != b.Placed[Spread] {
+			return a.Placed[Spread] < b.Placed[Spread]
+		}
+		return a.Fits-a.Placed[Spread] > b.Fits-b.Placed[Spread]
+	})
+	return r
+}
+
+// place assigns the replicas that fit one at a time, each to the first
+// node with room left that no later node is better than
+func (r *Result) place(strategy Strategy, better func(a, b *NodeFit) bool) {
+	for range r.Fits {
+		var best *NodeFit
+		for i := range r.Nodes {
+			f := &r.Nodes[i]
+			if f.Placed[strategy] >= f.Fits {
+				continue
+			}
+			if best == nil || better(f, best) {
+				best = f
+			}
+		}
+		best.Placed[strategy]++
+	}
+}
+
+// fit works out how many replicas of the shape a node can take
+func fit(n *models.Node, shape Shape) NodeFit {
+	f := NodeFit{
+		Name:       n.Name,
+		FreeCPU:    max(0, n.CPUAllocatable-n.CPURequests),
+		FreeMemory: max(0, n.MemoryAllocatable-n.MemoryRequests),
+		FreePods:   max(0, n.PodCapacity-n.PodCount),
+		Placed:     make(map[Strategy]int, len(Strategies)),
+	}
+	if f.Excluded = excluded(n, shape); f.Excluded != "" {
+		return f
+	}
+
+	f.Fits, f.Limit = f.FreePods, ResourcePods
+	if shape.CPU > 0 && int(f.FreeCPU/shape.CPU) < f.Fits {
+		f.Fits, f.Limit = int(f.FreeCPU/shape.CPU), ResourceCPU
+	}
+	if shape.Memory > 0 && int(f.FreeMemory/shape.Memory) < f.Fits {
+		f.Fits, f.Limit = int(f.FreeMemory/shape.Memory), ResourceMemory
+	}
+	return f
+}
+
+// excluded returns why no replica can be scheduled on a node, or ""
+func excluded(n *models.Node, shape Shape) string {
+	switch {
+	case n.Status != models.NodeStatusReady:
+		return "not ready"
+	case n.Unschedulable:
+		return "cordoned"
+	case shape.NodeSelector != nil && !shape.NodeSelector.Matches(labels.Set(n.Labels)):
+		return "node selector"
+	case n.CPUAllocatable == 0 && n.MemoryAllocatable == 0:
+		return "allocatable unknown"
+	}
+	for _, t := range n.Taints {
+		taint := corev1.Taint{Key: t.Key, Value: t.Value, Effect: corev1.TaintEffect(t.Effect)}
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule || tolerated(shape.Tolerations, &taint) {
+			continue
+		}
+		return "taint " + t.String()
+	}
+	return ""
+}
+
+// tolerated reports whether any of the tolerations tolerates a taint
+func tolerated(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unplaced returns the number of replicas that do not fit
+func (r *Result) Unplaced() int {
+	return r.Shape.Replicas - r.Fits
+}
+
+// Blocker is one reason replicas cannot be placed and the number of
+// nodes it applies to
+type Blocker struct {
+	Reason string // a Resource for full nodes, the exclusion otherwise
+	Nodes  int
+}
+
+// Blockers explains why the replicas that do not fit cannot be placed:
+// the resource each eligible node runs out of, and why the others are
+// excluded. Most common reasons come first.
+func (r *Result) Blockers() []Blocker {
+	if r.Unplaced() == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, f := range r.Nodes {
+		reason := f.Excluded
+		if reason == "" {
+			reason = string(f.Limit)
+		}
+		counts[reason]++
+	}
+	blockers := make([]Blocker, 0, len(counts))
+	for reason, n := range counts {
+		blockers = append(blockers, Blocker{Reason: reason, Nodes: n})
+	}
+	sort.Slice(blockers, func(i, j int) bool {
+		if blockers[i].Nodes != blockers[j].Nodes {
+			return blockers[i].Nodes > blockers[j].Nodes
+		}
+		return blockers[i].Reason < blockers[j].Reason
+	})
+	return blockers
+}
+
+// Write prints the result as a report: the verdict, a table of the nodes
+// with the replicas each strategy puts on them, and what blocks the rest
+func (r *Result) Write(w io.Writer) {
+	s := r.Shape
+	fmt.Fprintf(w, "Plan: %s", s)
+	if s.NodeSelector != nil {
+		fmt.Fprintf(w, " on nodes matching %s", s.NodeSelector)
+	}
+	if len(s.Tolerations) > 0 {
+		names := make([]string, 0, len(s.Tolerations))
+		for _, t := range s.Tolerations {
+			names = append(names, tolerationString(t))
+		}
+		fmt.Fprintf(w, ", tolerating %s", strings.Join(names, ", "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w)
+
+	if r.Unplaced() == 0 {
+		fmt.Fprintf(w, "All %d replicas fit.\n\n", s.Replicas)
+	} else {
+		fmt.Fprintf(w, "%d of %d replicas fit; %d cannot be placed.\n\n", r.Fits, s.Replicas, r.Unplaced())
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tFREE CPU\tFREE MEM\tFREE PODS\tFITS\tFIRST-FIT\tSPREAD\tLIMIT")
+	for _, f := range r.Nodes {
+		if f.Excluded != "" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t-\t-\t-\t%s\n", f.Name,
+				metrics.FormatCPU(f.FreeCPU), metrics.FormatMemory(f.FreeMemory), f.FreePods, f.Excluded)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", f.Name,
+			metrics.FormatCPU(f.FreeCPU), metrics.FormatMemory(f.FreeMemory), f.FreePods,
+			f.Fits, f.Placed[FirstFit], f.Placed[Spread], f.Limit)
+	}
+	tw.Flush()
+
+	if blockers := r.Blockers(); len(blockers) > 0 {
+		parts := make([]string, 0, len(blockers))
+		for _, b := range blockers {
+			nodes := "1 node"
+			if b.Nodes != 1 {
+				nodes = fmt.Sprintf("%d nodes", b.Nodes)
+			}
+			parts = append(parts, fmt.Sprintf("%s (%s)", b.Reason, nodes))
+		}
+		fmt.Fprintf(w, "\nBlocked by: %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// tolerationString formats a toleration in the syntax ParseToleration
+// reads
+func tolerationString(t corev1.Toleration) string {
+	if t.Key == "" {
+		return "*"
+	}
+	s := t.Key
+	if t.Operator == corev1.TolerationOpEqual {
+		s += "=" + t.Value
+	}
+	if t.Effect != "" {
+		s += ":" + string(t.Effect)
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nlaak/ktop/internal/models"
+)
+
+const gi = 1024 * 1024 * 1024
+
+// node returns a ready node with cpu cores and memory GiB allocatable and
+// nothing requested
+func node(name string, cpu, memory int64) models.Node {
+	return models.Node{
+		Name:              name,
+		Status:            models.NodeStatusReady,
+		CPUAllocatable:    cpu * 1000,
+		MemoryAllocatable: memory * gi,
+		PodCapacity:       110,
+		Labels:            map[string]string{"pool": "general"},
+	}
+}
+
+func mustShape(t *testing.T, cpu, memory string, replicas int, selector string, tolerations ...string) Shape {
+	t.Helper()
+	s, err := ParseShape(cpu, memory, replicas, selector, tolerations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseShape(t *testing.T) {
+	s := mustShape(t, "500m", "4Gi", 3, "pool=gpu", "dedicated=gpu:NoSchedule", "spot")
+	if s.CPU != 500 || s.Memory != 4*gi || s.Replicas != 3 {
+		t.Errorf("got cpu %d, memory %d, replicas %d", s.CPU, s.Memory, s.Replicas)
+	}
+	if s.NodeSelector.String() != "pool=gpu" {
+		t.Errorf("node selector %q", s.NodeSelector)
+	}
+	if len(s.Tolerations) != 2 {
+		t.Fatalf("got %d tolerations", len(s.Tolerations))
+	}
+	if got := tolerationString(s.Tolerations[0]); got != "dedicated=gpu:NoSchedule" {
+		t.Errorf("toleration %q", got)
+	}
+	if got := tolerationString(s.Tolerations[1]); got != "spot" {
+		t.Errorf("toleration %q", got)
+	}
+
+	for _, bad := range []struct {
+		cpu, memory string
+		replicas    int
+		toleration  string
+	}{
+		{"1", "", 0, ""},
+		{"", "", 1, ""},
+		{"lots", "", 1, ""},
+		{"1", "4Gb", 1, ""},
+		{"1", "", 1, "key:Sometimes"},
+		{"1", "", 1, "=value"},
+	} {
+		var tolerations []string
+		if bad.toleration != "" {
+			tolerations = []string{bad.toleration}
+		}
+		if _, err := ParseShape(bad.cpu, bad.memory, bad.replicas, "", tolerations); err == nil {
+			t.Errorf("ParseShape(%q, %q, %d, %q) succeeded", bad.cpu, bad.memory, bad.replicas, bad.toleration)
+		}
+	}
+}
+
+func TestSimulatePlacement(t *testing.T) {
+	busy := node("node-a", 4, 16)
+	busy.CPURequests = 2000 // room for one replica
+	nodes := []models.Node{node("node-c", 8, 8), busy, node("node-b", 8, 32)}
+
+	r := Simulate(nodes, mustShape(t, "2", "4Gi", 6, ""))
+	if r.Fits != 6 || r.Unplaced() != 0 || r.Blockers() != nil {
+		t.Fatalf("fits %d, unplaced %d, blockers %v", r.Fits, r.Unplaced(), r.Blockers())
+	}
+
+	want := []struct {
+		name             string
+		fits             int
+		limit            Resource
+		firstFit, spread int
+	}{
+		{"node-a", 1, ResourceCPU, 1, 1},
+		{"node-b", 4, ResourceCPU, 4, 3},
+		{"node-c", 2, ResourceMemory, 1, 2},
+	}
+	for i, w := range want {
+		f := r.Nodes[i]
+		if f.Name != w.name || f.Fits != w.fits || f.Limit != w.limit || f.Placed[FirstFit] != w.firstFit || f.Placed[Spread] != w.spread {
+			t.Errorf("node %d: got %s fits %d (%s), first-fit %d, spread %d; want %+v",
+				i, f.Name, f.Fits, f.Limit, f.Placed[FirstFit], f.Placed[Spread], w)
+		}
+	}
+}
+
+func TestSimulateExclusions(t *testing.T) {
+	notReady := node("node-a", 8, 32)
+	notReady.Status = models.NodeStatusNotReady
+	cordoned := node("node-b", 8, 32)
+	cordoned.Unschedulable = true
+	tainted := node("node-c", 8, 32)
+	tainted.Taints = []models.Taint{{Key: "dedicated", Value: "gpu", Effect: "NoSchedule"}}
+	preferred := node("node-d", 8, 32)
+	preferred.Taints = []models.Taint{{Key: "spot", Effect: "PreferNoSchedule"}}
+	other := node("node-e", 8, 32)
+	other.Labels = map[string]string{"pool": "batch"}
+	nodes := []models.Node{notReady, cordoned, tainted, preferred, other}
+
+	r := Simulate(nodes, mustShape(t, "4", "", 10, "pool=general"))
+	excluded := map[string]string{
+		"node-a": "not ready",
+		"node-b": "cordoned",
+		"node-c": "taint dedicated=gpu:NoSchedule",
+		"node-d": "",
+		"node-e": "node selector",
+	}
+	for _, f := range r.Nodes {
+		if f.Excluded != excluded[f.Name] {
+			t.Errorf("%s excluded by %q, want %q", f.Name, f.Excluded, excluded[f.Name])
+		}
+	}
+	if r.Fits != 2 || r.Unplaced() != 8 {
+		t.Errorf("fits %d, unplaced %d", r.Fits, r.Unplaced())
+	}
+
+	r = Simulate(nodes, mustShape(t, "4", "", 10, "", "dedicated=gpu:NoSchedule"))
+	if r.Fits != 6 {
+		t.Errorf("tolerating the taint fits %d, want 6", r.Fits)
+	}
+	blockers := r.Blockers()
+	if len(blockers) != 3 || blockers[0] != (Blocker{Reason: "cpu", Nodes: 3}) {
+		t.Errorf("blockers %v", blockers)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	full := node("node-b", 2, 4)
+	full.PodCount, full.PodCapacity = 10, 10
+	r := Simulate([]models.Node{node("node-a", 4, 16), full}, mustShape(t, "1", "1Gi", 5, "", "spot"))
+
+	var b strings.Builder
+	r.Write(&b)
+	out := b.String()
+	for _, want := range []string{
+		"Plan: 5 × (cpu 1.0, memory 1.0Gi), tolerating spot",
+		"4 of 5 replicas fit; 1 cannot be placed.",
+		"Blocked by: cpu (1 node), pods (1 node)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package prometheus is a minimal client for the Prometheus HTTP query API.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client queries a Prometheus server
+type Client struct {
+	baseURL string
+	headers map[string]string
+	http    *http.Client
+}
+
+// NewClient creates a client for the Prometheus server at baseURL.
+// headers are added to every request, e.g. for authorization.
+func NewClient(baseURL string, headers map[string]string, timeout time.Duration) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Prometheus URL %q", baseURL)
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		headers: headers,
+		http:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Sample is one value of a series in an instant query result
+type Sample struct {
+	Labels map[string]string
+	Time   time.Time
+	Value  float64
+}
+
+// Point is one value of a range query series
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is one series of a range query result
+type Series struct {
+	Labels map[string]string
+	Points []Point
+}
+
+// Query evaluates an instant query at time t
+func (c *Client) Query(ctx context.Context, query string, t time.Time) ([]Sample, error) {
+	params := url.Values{
+		"query": {query},
+		"time":  {formatTime(t)},
+	}
+	var results []struct {
+		Metric map[string]string `json:"metric"`
+		Value  [2]any            `json:"value"`
+	}
+	if err := c.get(ctx, "/api/v1/query", params, "vector", &results); err != nil {
+		return nil, err
+	}
+
+	samples := make([]Sample, 0, len(results))
+	for _, r := range results {
+		ts, v, err := parseValue(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, Sample{Labels: r.Metric, Time: ts, Value: v})
+	}
+	return samples, nil
+}
+
+// QueryRange evaluates a range query between start and end
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Series, error) {
+	params := url.Values{
+		"query": {query},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	var results []struct {
+		Metric map[string]string `json:"metric"`
+		Values [][2]any          `json:"values"`
+	}
+	if err := c.get(ctx, "/api/v1/query_range", params, "matrix", &results); err != nil {
+		return nil, err
+	}
+
+	series := make([]Series, 0, len(results))
+	for _, r := range results {
+		s := Series{Labels: r.Metric, Points: make([]Point, 0, len(r.Values))}
+		for _, value := range r.Values {
+			ts, v, err := parseValue(value)
+			if err != nil {
+				return nil, err
+			}
+			s.Points = append(s.Points, Point{Time: ts, Value: v})
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// apiResponse is the envelope of every Prometheus API response
+type apiResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// get calls an API endpoint and decodes a result of the expected type
+func (c *Client) get(ctx context.Context, path string, params url.Values, resultType string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("prometheus request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read prometheus response: %w", err)
+	}
+
+	var r apiResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return fmt.Errorf("prometheus returned %s: invalid response", resp.Status)
+	}
+	if r.Status != "success" {
+		return fmt.Errorf("prometheus query failed: %s: %s", r.ErrorType, r.Error)
+	}
+	if r.Data.ResultType != resultType {
+		return fmt.Errorf("prometheus returned a %s, expected a %s", r.Data.ResultType, resultType)
+	}
+	if err := json.Unmarshal(r.Data.Result, result); err != nil {
+		return fmt.Errorf("invalid %s result: %w", resultType, err)
+	}
+	return nil
+}
+
+// parseValue parses a [timestamp, "value"] pair
+func parseValue(pair [2]any) (time.Time, float64, error) {
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid sample timestamp %v", pair[0])
+	}
+	s, ok := pair[1].(string)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid sample value %v", pair[1])
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid sample value %q", s)
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)), v, nil
+}
+
+// formatTime formats a time as Unix seconds
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
@@ -0,0 +1,113 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	var gotQuery, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		gotQuery = r.URL.Query().Get("query")
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"node":"a"},"value":[1700000000.5,"0.25"]},
+			{"metric":{"node":"b"},"value":[1700000000.5,"NaN"]}]}}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL+"/", map[string]string{"Authorization": "Bearer t"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := c.Query(context.Background(), "up", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotQuery != "up" || gotAuth != "Bearer t" {
+		t.Errorf("request query=%q auth=%q", gotQuery, gotAuth)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if samples[0].Labels["node"] != "a" || samples[0].Value != 0.25 {
+		t.Errorf("sample = %+v", samples[0])
+	}
+	if want := time.Unix(1700000000, 500_000_000); !samples[0].Time.Equal(want) {
+		t.Errorf("time = %v, want %v", samples[0].Time, want)
+	}
+	if v := samples[1].Value; v == v {
+		t.Errorf("value = %v, want NaN", v)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v1/query_range" || q.Get("step") != "30" || q.Get("start") != "1000.000" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"pod":"p"},"values":[[1000,"1"],[1030,"2"]]}]}}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, err := c.QueryRange(context.Background(), "x", time.Unix(1000, 0), time.Unix(1060, 0), 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 2 {
+		t.Fatalf("series = %+v", series)
+	}
+	if p := series[0].Points[1]; p.Value != 2 || p.Time.Unix() != 1030 {
+		t.Errorf("point = %+v", p)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"api error", http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error"}`, "bad_data: parse error"},
+		{"wrong type", http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[]}}`, "expected a vector"},
+		{"not json", http.StatusBadGateway, `<html>`, "502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c, _ := NewClient(srv.URL, nil, time.Second)
+			_, err := c.Query(context.Background(), "up", time.Now())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientInvalidURL(t *testing.T) {
+	if _, err := NewClient("prometheus:9090", nil, time.Second); err == nil {
+		t.Error("expected an error for a URL without scheme")
+	}
+}
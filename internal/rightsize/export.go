@@ -0,0 +1,211 @@
+package rightsize
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nlaak/ktop/internal/metrics"
+)
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// csvHeader names the columns of WriteCSV; CPU is in millicores and
+// memory in bytes
+var csvHeader = []string{
+	"namespace", "kind", "workload", "container", "replicas", "samples", "verdict",
+	"cpu_request", "cpu_limit", "cpu_p95", "cpu_max", "cpu_request_recommended", "cpu_limit_recommended",
+	"memory_request", "memory_limit", "memory_p95", "memory_max", "memory_request_recommended", "memory_limit_recommended",
+}
+
+// WriteCSV writes one row per container
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	n := func(v int64) string { return strconv.FormatInt(v, 10) }
+	for _, wl := range r.Workloads {
+		for _, c := range wl.Containers {
+			cur, rec := c.Current, c.Recommended
+			err := cw.Write([]string{
+				wl.Namespace, wl.Kind, wl.Name, c.Name, strconv.Itoa(wl.Replicas), strconv.Itoa(c.Samples), string(c.Verdict),
+				n(cur.CPURequest), n(cur.CPULimit), n(c.CPUP95), n(c.CPUMax), n(rec.CPURequest), n(rec.CPULimit),
+				n(cur.MemoryRequest), n(cur.MemoryLimit), n(c.MemoryP95), n(c.MemoryMax), n(rec.MemoryRequest), n(rec.MemoryLimit),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// apiVersions lists the workload kinds a patch can be written for
+var apiVersions = map[string]string{
+	"Deployment":  "apps/v1",
+	"StatefulSet": "apps/v1",
+	"DaemonSet":   "apps/v1",
+	"ReplicaSet":  "apps/v1",
+}
+
+// Patchable reports whether a patch is written for the workload: it is
+// over- or under-provisioned and managed by a controller whose pod
+// template can be patched
+func (w *Workload) Patchable() bool {
+	_, ok := apiVersions[w.Kind]
+	return ok && (w.Verdict == Over || w.Verdict == Under)
+}
+
+// patch is a strategic merge patch of a workload's pod template
+type patch struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Containers []patchContainer `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+type patchContainer struct {
+	Name      string `json:"name"`
+	Resources struct {
+		Requests map[string]string `json:"requests"`
+		Limits   map[string]string `json:"limits,omitempty"`
+	} `json:"resources"`
+}
+
+// WritePatch writes a strategic merge patch per patchable workload, as a
+// multi-document YAML stream for the patches of a kustomization. Each
+// document is headed by the kubectl patch command applying it to the
+// running workload. Containers without a recommendation keep their
+// resources.
+func (r *Report) WritePatch(w io.Writer) error {
+	fmt.Fprintf(w, "# Right-sizing patches by ktop: CPU p95 and memory peak over %s plus %g%% headroom\n", r.Window, r.Headroom)
+	for _, wl := range r.Workloads {
+		if !wl.Patchable() {
+			continue
+		}
+		var p patch
+		p.APIVersion, p.Kind = apiVersions[wl.Kind], wl.Kind
+		p.Metadata.Name, p.Metadata.Namespace = wl.Name, wl.Namespace
+		for _, c := range wl.Containers {
+			if c.Verdict == Collecting {
+				continue
+			}
+			rec := c.Recommended
+			pc := patchContainer{Name: c.Name}
+			pc.Resources.Requests = map[string]string{
+				"cpu":    cpuQuantity(rec.CPURequest),
+				"memory": memoryQuantity(rec.MemoryRequest),
+			}
+			if rec.CPULimit > 0 || rec.MemoryLimit > 0 {
+				pc.Resources.Limits = make(map[string]string)
+			}
+			if rec.CPULimit > 0 {
+				pc.Resources.Limits["cpu"] = cpuQuantity(rec.CPULimit)
+			}
+			if rec.MemoryLimit > 0 {
+				pc.Resources.Limits["memory"] = memoryQuantity(rec.MemoryLimit)
+			}
+			p.Spec.Template.Spec.Containers = append(p.Spec.Template.Spec.Containers, pc)
+		}
+
+		data, err := yaml.Marshal(p)
+		if err != nil {
+			return err
+		}
+		spec, err := json.Marshal(map[string]any{"spec": p.Spec})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n# %s: %s\n# kubectl patch %s/%s -n %s --type=strategic -p '%s'\n%s",
+			wl.Key(), wl.Verdict, strings.ToLower(wl.Kind), wl.Name, wl.Namespace, spec, data)
+	}
+	return nil
+}
+
+// cpuQuantity formats millicores as a Kubernetes quantity, e.g. 250m
+func cpuQuantity(millicores int64) string {
+	return resource.NewMilliQuantity(millicores, resource.DecimalSI).String()
+}
+
+// memoryQuantity formats bytes as a Kubernetes quantity, e.g. 256Mi
+func memoryQuantity(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
+
+// WriteText prints the report as a table of the containers that have a
+// recommendation, with the totals
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Right-sizing: p95 of %s CPU peaks and memory peak over %s plus %g%% headroom\n\n", r.Resolution, r.Window, r.Headroom)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKLOAD\tCONTAINER\tPODS\tCPU REQ\tP95\tREC\tMEM REQ\tPEAK\tREC\tVERDICT")
+	for _, wl := range r.Workloads {
+		for _, c := range wl.Containers {
+			if c.Verdict == Collecting {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", wl.Key(), c.Name, wl.Replicas,
+				FormatRequest(c.Current.CPURequest, metrics.FormatCPU), metrics.FormatCPU(c.CPUP95), metrics.FormatCPU(c.Recommended.CPURequest),
+				FormatRequest(c.Current.MemoryRequest, metrics.FormatMemory), metrics.FormatMemory(c.MemoryMax), metrics.FormatMemory(c.Recommended.MemoryRequest),
+				c.Verdict)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d over-provisioned, %d under-provisioned workloads\n", r.Over, r.Under)
+	fmt.Fprintf(w, "Reclaimable: %s cores, %s; additional needed: %s cores, %s\n",
+		FormatCores(r.ReclaimableCPU), metrics.FormatMemory(r.ReclaimableMemory),
+		FormatCores(r.AdditionalCPU), metrics.FormatMemory(r.AdditionalMemory))
+	if collecting := r.CollectingContainers(); collecting > 0 {
+		fmt.Fprintf(w, "%d containers have too little usage history for a recommendation\n", collecting)
+	}
+}
+
+// CollectingContainers counts the containers without a recommendation
+func (r *Report) CollectingContainers() int {
+	n := 0
+	for _, wl := range r.Workloads {
+		for _, c := range wl.Containers {
+			if c.Verdict == Collecting {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// FormatRequest formats a request, or "-" when it is unset
+func FormatRequest(v int64, format func(int64) string) string {
+	if v == 0 {
+		return "-"
+	}
+	return format(v)
+}
+
+// FormatCores formats millicores as cores with two decimals
+func FormatCores(millicores int64) string {
+	return strconv.FormatFloat(float64(millicores)/1000, 'f', 2, 64)
+}
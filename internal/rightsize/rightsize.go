@@ -0,0 +1,310 @@
+// Package rightsize recommends container requests and limits from
+// observed usage: the 95th percentile of CPU and the peak of memory, plus
+// headroom, compared with what the containers request today. The history
+// keeps the peak of each of its buckets, so the CPU percentile is one of
+// per-bucket peaks rather than of every sample.
+package rightsize
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Verdict is how well a container's requests match its usage
+type Verdict string
+
+const (
+	// Under means usage exceeds the request, or nothing is requested
+	Under Verdict = "under-provisioned"
+	// Over means the request exceeds the recommendation by more than
+	// the tolerance
+	Over Verdict = "over-provisioned"
+	OK   Verdict = "ok"
+	// Collecting means there is not enough history yet
+	Collecting Verdict = "collecting"
+)
+
+// rank orders verdicts by urgency
+func (v Verdict) rank() int {
+	switch v {
+	case Under:
+		return 0
+	case Over:
+		return 1
+	case OK:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Smallest recommended requests, and the steps they are rounded up to
+const (
+	minCPU     = 10               // millicores
+	minMemory  = 16 * 1024 * 1024 // bytes
+	cpuStep    = 5
+	memoryStep = 1024 * 1024
+)
+
+// Resources are the requests and limits of a container (millicores /
+// bytes); 0 means unset
+type Resources struct {
+	CPURequest    int64 `json:"cpuRequest"`
+	CPULimit      int64 `json:"cpuLimit"`
+	MemoryRequest int64 `json:"memoryRequest"`
+	MemoryLimit   int64 `json:"memoryLimit"`
+}
+
+// Container is the recommendation for one container of a workload, from
+// the usage of that container across the workload's pods
+type Container struct {
+	Name    string `json:"name"`
+	Samples int    `json:"samples"`
+
+	// Observed usage (millicores / bytes); percentiles are of the peaks
+	// of each history bucket
+	CPUP95    int64 `json:"cpuP95"`
+	CPUMax    int64 `json:"cpuMax"`
+	MemoryP95 int64 `json:"memoryP95"`
+	MemoryMax int64 `json:"memoryMax"`
+
+	Current     Resources `json:"current"`
+	Recommended Resources `json:"recommended"` // zero while collecting
+	Verdict     Verdict   `json:"verdict"`
+}
+
+// Workload is the recommendation for a workload: the controller of a set
+// of pods, or a pod on its own
+type Workload struct {
+	Namespace  string      `json:"namespace"`
+	Kind       string      `json:"kind"`
+	Name       string      `json:"name"`
+	Replicas   int         `json:"replicas"`
+	Containers []Container `json:"containers"`
+	Verdict    Verdict     `json:"verdict"`
+
+	// Requests freed (reclaimable) or missing (additional) across all
+	// replicas if the recommendation is applied (millicores / bytes)
+	ReclaimableCPU    int64 `json:"reclaimableCPU"`
+	ReclaimableMemory int64 `json:"reclaimableMemory"`
+	AdditionalCPU     int64 `json:"additionalCPU"`
+	AdditionalMemory  int64 `json:"additionalMemory"`
+}
+
+// Key identifies a workload, e.g. shop/Deployment/web
+func (w *Workload) Key() string {
+	return w.Namespace + "/" + w.Kind + "/" + w.Name
+}
+
+// Report holds the recommendations of every workload, the most urgent
+// first, and their totals
+type Report struct {
+	Headroom   float64    `json:"headroomPercent"`
+	Window     string     `json:"window"`     // how long usage was observed
+	Resolution string     `json:"resolution"` // history bucket the peaks are of
+	Workloads  []Workload `json:"workloads"`
+
+	Over  int `json:"overProvisioned"`
+	Under int `json:"underProvisioned"`
+
+	ReclaimableCPU    int64 `json:"reclaimableCPU"`
+	ReclaimableMemory int64 `json:"reclaimableMemory"`
+	AdditionalCPU     int64 `json:"additionalCPU"`
+	AdditionalMemory  int64 `json:"additionalMemory"`
+}
+
+// Compute recommends requests for the containers of pods from their usage
+// history. Containers without usage of their own, because the source only
+// reports pods, use the pod's usage when they are the pod's only
+// container.
+func Compute(pods []models.Pod, history *metrics.History, cfg config.RightSizingConfig) *Report {
+	r := &Report{Headroom: cfg.Headroom, Resolution: history.Resolution().String()}
+	var first, last time.Time
+
+	type group struct {
+		pods   []*models.Pod
+		newest *models.Pod // holds the current requests and limits
+	}
+	groups := make(map[string]*group)
+	var keys []string
+	for i := range pods {
+		p := &pods[i]
+		if p.Status == models.PodStatusSucceeded || p.Status == models.PodStatusFailed {
+			continue
+		}
+		workload := p.Workload
+		if workload == "" {
+			workload = "Pod/" + p.Name
+		}
+		key := p.Namespace + "/" + workload
+		g := groups[key]
+		if g == nil {
+			g = &group{}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.pods = append(g.pods, p)
+		if g.newest == nil || p.CreatedAt.After(g.newest.CreatedAt) {
+			g.newest = p
+		}
+	}
+
+	for _, key := range keys {
+		g := groups[key]
+		namespace, workload, _ := strings.Cut(key, "/")
+		kind, name, _ := strings.Cut(workload, "/")
+		w := Workload{Namespace: namespace, Kind: kind, Name: name, Replicas: len(g.pods), Verdict: Collecting}
+		for _, ctr := range g.newest.Containers {
+			var points []metrics.Point
+			for _, p := range g.pods {
+				series := history.Container(p.Namespace, p.Name, ctr.Name)
+				if len(series) == 0 && len(p.Containers) == 1 {
+					series = history.Pod(p.Namespace, p.Name)
+				}
+				points = append(points, series...)
+				if len(series) > 0 {
+					if first.IsZero() || series[0].Time.Before(first) {
+						first = series[0].Time
+					}
+					last = later(last, series[len(series)-1].Time)
+				}
+			}
+			c := recommend(ctr, points, cfg)
+			if c.Verdict.rank() < w.Verdict.rank() {
+				w.Verdict = c.Verdict
+			}
+			w.Containers = append(w.Containers, c)
+		}
+		if w.Verdict == Over || w.Verdict == Under {
+			for i := range w.Containers {
+				w.add(&w.Containers[i])
+			}
+		}
+		r.Workloads = append(r.Workloads, w)
+	}
+	r.Window = last.Sub(first).Round(time.Second).String()
+
+	sort.SliceStable(r.Workloads, func(i, j int) bool {
+		a, b := &r.Workloads[i], &r.Workloads[j]
+		if a.Verdict != b.Verdict {
+			return a.Verdict.rank() < b.Verdict.rank()
+		}
+		return a.Key() < b.Key()
+	})
+	for _, w := range r.Workloads {
+		switch w.Verdict {
+		case Over:
+			r.Over++
+		case Under:
+			r.Under++
+		}
+		r.ReclaimableCPU += w.ReclaimableCPU
+		r.ReclaimableMemory += w.ReclaimableMemory
+		r.AdditionalCPU += w.AdditionalCPU
+		r.AdditionalMemory += w.AdditionalMemory
+	}
+	return r
+}
+
+// later returns the later of two times
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// add counts the change of a container's requests into the workload.
+// Changes are only counted for workloads that are over- or
+// under-provisioned, the ones a patch is written for.
+func (w *Workload) add(c *Container) {
+	if c.Verdict == Collecting {
+		return
+	}
+	replicas := int64(w.Replicas)
+	cpu := c.Current.CPURequest - c.Recommended.CPURequest
+	memory := c.Current.MemoryRequest - c.Recommended.MemoryRequest
+	w.ReclaimableCPU += max(0, cpu) * replicas
+	w.ReclaimableMemory += max(0, memory) * replicas
+	w.AdditionalCPU += max(0, -cpu) * replicas
+	w.AdditionalMemory += max(0, -memory) * replicas
+}
+
+// recommend sizes a container from its usage points. CPU is sized for its
+// 95th percentile, since short bursts are only throttled; memory for its
+// peak, since running out of it kills the container. Limits are only
+// recommended where the container has them today: for CPU the peak plus
+// headroom, for memory the recommended request.
+func recommend(ctr models.Container, points []metrics.Point, cfg config.RightSizingConfig) Container {
+	c := Container{
+		Name:    ctr.Name,
+		Samples: len(points),
+		Current: Resources{
+			CPURequest:    ctr.CPURequest,
+			CPULimit:      ctr.CPULimit,
+			MemoryRequest: ctr.MemoryRequest,
+			MemoryLimit:   ctr.MemoryLimit,
+		},
+		Verdict: Collecting,
+	}
+	if len(points) == 0 {
+		return c
+	}
+	cpu := make([]int64, len(points))
+	memory := make([]int64, len(points))
+	for i, p := range points {
+		cpu[i], memory[i] = p.CPU, p.Memory
+	}
+	c.CPUP95, c.CPUMax = percentile(cpu, 95), percentile(cpu, 100)
+	c.MemoryP95, c.MemoryMax = percentile(memory, 95), percentile(memory, 100)
+	if len(points) < cfg.MinSamples {
+		return c
+	}
+
+	factor := 1 + cfg.Headroom/100
+	rec := &c.Recommended
+	rec.CPURequest = roundUp(max(minCPU, scale(c.CPUP95, factor)), cpuStep)
+	rec.MemoryRequest = roundUp(max(minMemory, scale(c.MemoryMax, factor)), memoryStep)
+	if ctr.CPULimit > 0 {
+		rec.CPULimit = max(rec.CPURequest, roundUp(scale(c.CPUMax, factor), cpuStep))
+	}
+	if ctr.MemoryLimit > 0 {
+		rec.MemoryLimit = rec.MemoryRequest
+	}
+
+	tolerance := 1 + cfg.Tolerance/100
+	cur := c.Current
+	switch {
+	case cur.CPURequest == 0 || cur.MemoryRequest == 0 || cur.CPURequest < c.CPUP95 || cur.MemoryRequest < c.MemoryMax:
+		c.Verdict = Under
+	case float64(cur.CPURequest) > float64(rec.CPURequest)*tolerance || float64(cur.MemoryRequest) > float64(rec.MemoryRequest)*tolerance:
+		c.Verdict = Over
+	default:
+		c.Verdict = OK
+	}
+	return c
+}
+
+// percentile returns the p-th percentile of values by the nearest-rank
+// method; values is sorted in place
+func percentile(values []int64, p float64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	return values[max(0, rank-1)]
+}
+
+// scale multiplies v by factor, rounding up
+func scale(v int64, factor float64) int64 {
+	return int64(math.Ceil(float64(v) * factor))
+}
+
+// roundUp rounds v up to a multiple of step
+func roundUp(v, step int64) int64 {
+	return (v + step - 1) / step * step
+}
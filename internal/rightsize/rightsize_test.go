@@ -0,0 +1,139 @@
+package rightsize
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+const mi = 1024 * 1024
+
+func pod(namespace, name, workload string, containers ...models.Container) models.Pod {
+	return models.Pod{
+		Namespace:  namespace,
+		Name:       name,
+		Workload:   workload,
+		Status:     models.PodStatusRunning,
+		Containers: containers,
+	}
+}
+
+// testReport records samples minutes of usage: web reports its container,
+// at 100-190m CPU and 200Mi memory per replica; api only reports the pod,
+// at 300m and 100Mi; new-0 has three minutes
+func testReport(t *testing.T) *Report {
+	t.Helper()
+	pods := []models.Pod{
+		pod("shop", "web-1", "Deployment/web", models.Container{Name: "web", CPURequest: 1000, CPULimit: 2000, MemoryRequest: 1024 * mi}),
+		pod("shop", "web-2", "Deployment/web", models.Container{Name: "web", CPURequest: 1000, CPULimit: 2000, MemoryRequest: 1024 * mi}),
+		pod("shop", "api-0", "StatefulSet/api", models.Container{Name: "api", CPURequest: 100, MemoryRequest: 128 * mi, MemoryLimit: 256 * mi}),
+		pod("shop", "new-0", "Deployment/new", models.Container{Name: "new", CPURequest: 100, MemoryRequest: 64 * mi}),
+	}
+
+	history := metrics.NewHistory(time.Hour)
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Minute)
+	for i := range 20 {
+		usage := &metrics.Usage{
+			Pods: map[string]metrics.Sample{"shop/api-0": {CPU: 300, Memory: 100 * mi}},
+			Containers: map[string]map[string]metrics.Sample{
+				"shop/web-1": {"web": {CPU: 100 + int64(i%10)*10, Memory: 200 * mi}},
+				"shop/web-2": {"web": {CPU: 100, Memory: 180 * mi}},
+			},
+		}
+		if i < 3 {
+			usage.Containers["shop/new-0"] = map[string]metrics.Sample{"new": {CPU: 50, Memory: 32 * mi}}
+		}
+		history.Record(start.Add(time.Duration(i)*time.Minute), usage)
+	}
+	return Compute(pods, history, config.DefaultRightSizingConfig())
+}
+
+func TestCompute(t *testing.T) {
+	r := testReport(t)
+	if len(r.Workloads) != 3 {
+		t.Fatalf("got %d workloads", len(r.Workloads))
+	}
+
+	api, web, fresh := r.Workloads[0], r.Workloads[1], r.Workloads[2]
+	if api.Key() != "shop/StatefulSet/api" || api.Verdict != Under {
+		t.Errorf("first workload %s is %s, want the under-provisioned api", api.Key(), api.Verdict)
+	}
+	c := api.Containers[0]
+	// 300m + 15% = 345m; 100Mi + 15% rounded up to 115Mi, also the limit
+	if c.Samples != 20 || c.Recommended.CPURequest != 345 || c.Recommended.MemoryRequest != 115*mi || c.Recommended.MemoryLimit != 115*mi {
+		t.Errorf("api from pod usage: %+v", c)
+	}
+	if api.AdditionalCPU != 245 || api.ReclaimableMemory != 13*mi {
+		t.Errorf("api needs %dm more CPU and frees %d bytes", api.AdditionalCPU, api.ReclaimableMemory)
+	}
+
+	if web.Key() != "shop/Deployment/web" || web.Verdict != Over || web.Replicas != 2 {
+		t.Errorf("second workload %s is %s with %d replicas", web.Key(), web.Verdict, web.Replicas)
+	}
+	c = web.Containers[0]
+	// p95 of 40 points is 180m, the peak 190m
+	if c.CPUP95 != 180 || c.CPUMax != 190 || c.MemoryMax != 200*mi {
+		t.Errorf("web usage: %+v", c)
+	}
+	if c.Recommended.CPURequest != 210 || c.Recommended.CPULimit != 220 || c.Recommended.MemoryRequest != 230*mi || c.Recommended.MemoryLimit != 0 {
+		t.Errorf("web recommendation: %+v", c.Recommended)
+	}
+	if web.ReclaimableCPU != 2*790 || web.ReclaimableMemory != 2*794*mi {
+		t.Errorf("web frees %dm and %d bytes", web.ReclaimableCPU, web.ReclaimableMemory)
+	}
+
+	if fresh.Verdict != Collecting || fresh.Containers[0].Samples != 3 || fresh.ReclaimableCPU != 0 {
+		t.Errorf("new workload: %+v", fresh)
+	}
+	if r.Over != 1 || r.Under != 1 || r.ReclaimableCPU != 1580 || r.Window != "19m0s" {
+		t.Errorf("totals: %d over, %d under, %dm reclaimable over %s", r.Over, r.Under, r.ReclaimableCPU, r.Window)
+	}
+}
+
+func TestExport(t *testing.T) {
+	r := testReport(t)
+
+	var b strings.Builder
+	if err := r.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "shop,Deployment,web,web,2,40,over-provisioned,1000,2000,180,190,210,220,") {
+		t.Errorf("csv:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := r.WritePatch(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+# shop/Deployment/web: over-provisioned
+# kubectl patch deployment/web -n shop --type=strategic -p '{"spec":{"template":{"spec":{"containers":[{"name":"web","resources":{"requests":{"cpu":"210m","memory":"230Mi"},"limits":{"cpu":"220m"}}}]}}}}'
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        resources:
+          limits:
+            cpu: 220m
+          requests:
+            cpu: 210m
+            memory: 230Mi
+`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("patch lacks the web deployment:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "kind: Deployment\nmetadata:\n  name: new") {
+		t.Errorf("patch includes a workload without a recommendation:\n%s", b.String())
+	}
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,59 +11,144 @@ import (
 	"github.com/rivo/tview"
 
 	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/cost"
 	"github.com/nlaak/ktop/internal/metrics"
 	"github.com/nlaak/ktop/internal/models"
+	"github.com/nlaak/ktop/internal/rightsize"
 )
 
 // App represents the main TUI application
 type App struct {
-	app       *tview.Application
-	collector *metrics.Collector
-	config    *config.Config
-	colors    Colors
+	app    *tview.Application
+	config *config.Config
+	colors Colors
+	keys   *keyMap
+
+	// Table columns
+	nodeCols []tableColumn[models.Node]
+	podCols  []tableColumn[models.Pod]
 
 	// UI components
+	pages      *tview.Pages
 	mainFlex   *tview.Flex
 	header     *tview.TextView
 	summary    *tview.TextView
 	nodesTable *tview.Table
 	podsTable  *tview.Table
+	nodes      *tableContent[models.Node]
+	nodeGroups map[string]*nodeGroup // group header rows of the nodes table by name
+	collapsed  map[string]bool       // keys of the collapsed node groups
+	pods       *tableContent[models.Pod]
+	treeTable  *tview.Table
+	tree       *tableContent[treeRow]
+	expanded   map[string]bool // keys of the expanded tree rows
+	heatFlex   *tview.Flex
+	heat       *heatmap
+	heatInfo   *tview.TextView
+	sizeFlex   *tview.Flex
+	sizeTable  *tview.Table
+	sizing     *tableContent[sizingRow]
+	sizeInfo   *tview.TextView
+	report     *rightsize.Report // shown in the right-sizing view
+	exported   string            // files the report was last exported to
+	costFlex   *tview.Flex
+	costTable  *tview.Table
+	costRows   *tableContent[costRow]
+	costInfo   *tview.TextView
+	costReport *cost.Report // shown in the cost view
 	footer     *tview.TextView
-	helpModal  *tview.Modal
+	help       *helpView
+	picker     *columnPicker
+	contexts   *contextPicker
+	prompt     *filterPrompt
+	planner    *planner
+	fleetFlex  *tview.Flex
+	fleetTable *tview.Table
+
+	// Monitored clusters; active is the one shown in the cluster view
+	clusters []*cluster
+	active   *cluster
 
 	// State
-	state     models.AppState
-	stateMu   sync.RWMutex
-	metrics   *models.ClusterMetrics
-	metricsMu sync.RWMutex
+	state   models.AppState
+	stateMu sync.RWMutex
 
 	// Control
-	ctx        context.Context
-	cancel     context.CancelFunc
-	refreshNow chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewApp creates a new TUI application for a single cluster
+func NewApp(collector *metrics.Collector, cfg *config.Config) (*App, error) {
+	return newApp([]Cluster{{Collector: collector}}, cfg)
 }
 
-// NewApp creates a new TUI application
-func NewApp(collector *metrics.Collector, cfg *config.Config) *App {
+// newApp creates the application for one or more clusters
+func newApp(clusters []Cluster, cfg *config.Config) (*App, error) {
+	colors, err := LoadTheme(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeCols, err := nodeColumns.resolve(cfg.Columns.Nodes)
+	if err != nil {
+		return nil, fmt.Errorf("nodes columns: %w", err)
+	}
+	podCols, err := podColumns.resolve(cfg.Columns.Pods)
+	if err != nil {
+		return nil, fmt.Errorf("pods columns: %w", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	a := &App{
-		app:        tview.NewApplication(),
-		collector:  collector,
-		config:     cfg,
-		colors:     DefaultColors(),
-		state:      models.DefaultAppState(),
-		ctx:        ctx,
-		cancel:     cancel,
-		refreshNow: make(chan struct{}, 1),
+		app:      tview.NewApplication(),
+		config:   cfg,
+		colors:   colors,
+		keys:     keys,
+		nodeCols: nodeCols,
+		podCols:  podCols,
+		state:    models.DefaultAppState(),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 
+	for _, c := range clusters {
+		a.clusters = append(a.clusters, newCluster(c, cfg.Pricing))
+	}
+	a.active = a.clusters[0]
 	a.state.ShowSystem = cfg.AllNamespaces
+	a.state.NodeGroup = cfg.GroupBy
+	a.state.CostBasis = cfg.Pricing.Basis
 
 	a.setupUI()
+	a.applyTheme()
 	a.setupKeybindings()
 
-	return a
+	return a, nil
+}
+
+// ValidateConfig checks the UI settings (theme, keys, columns) so that
+// mistakes are reported before connecting to the cluster
+func ValidateConfig(cfg *config.Config) error {
+	if _, err := LoadTheme(cfg); err != nil {
+		return err
+	}
+	if _, err := newKeyMap(cfg.Keys); err != nil {
+		return err
+	}
+	if _, err := nodeColumns.resolve(cfg.Columns.Nodes); err != nil {
+		return fmt.Errorf("nodes columns: %w", err)
+	}
+	if _, err := podColumns.resolve(cfg.Columns.Pods); err != nil {
+		return fmt.Errorf("pods columns: %w", err)
+	}
+	return nil
 }
 
 // setupUI initializes all UI components
@@ -86,8 +172,8 @@ func (a *App) setupUI() {
 		SetFixed(1, 0)
 	a.nodesTable.SetBorder(true).
 		SetTitle(" NODES ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorderColor(tcell.ColorWhite)
+		SetTitleAlign(tview.AlignLeft)
+	a.nodes = newTableContent(a, a.nodesTable, a.nodeCols, nodeKey)
 
 	// Pods table
 	a.podsTable = tview.NewTable().
@@ -96,8 +182,120 @@ func (a *App) setupUI() {
 		SetFixed(1, 0)
 	a.podsTable.SetBorder(true).
 		SetTitle(" PODS ").
+		SetTitleAlign(tview.AlignLeft)
+	a.pods = newTableContent(a, a.podsTable, a.podCols, podKey)
+
+	// Enter on a node limits the pods table to the node's pods; on a
+	// group header it toggles the group, as do Right and Left
+	a.collapsed = make(map[string]bool)
+	a.nodesTable.SetSelectedFunc(func(row, _ int) {
+		if i := row - 1; i >= 0 && i < len(a.nodes.items) {
+			if g := a.nodeGroups[a.nodes.items[i].Name]; g != nil {
+				a.expandNodeGroup(!g.expanded)
+			} else {
+				a.drillDown(a.nodes.items[i].Name)
+			}
+			a.updateUI()
+		}
+	})
+	a.nodesTable.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if a.nodeGroups == nil {
+			return event
+		}
+		switch event.Key() {
+		case tcell.KeyRight:
+			a.expandNodeGroup(true)
+		case tcell.KeyLeft:
+			a.expandNodeGroup(false)
+		default:
+			return event
+		}
+		a.updateUI()
+		return nil
+	})
+
+	// Tree view of nodes, pods and containers; Enter toggles a branch,
+	// Right and Left expand and collapse it
+	a.treeTable = tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	a.treeTable.SetBorder(true).
+		SetTitle(" TREE ").
+		SetTitleAlign(tview.AlignLeft)
+	a.tree = newTableContent(a, a.treeTable, treeColumns, treeKey)
+	a.expanded = make(map[string]bool)
+	a.treeTable.SetSelectedFunc(func(row, _ int) {
+		if i := row - 1; i >= 0 && i < len(a.tree.items) {
+			a.expandTreeRow(!a.tree.items[i].expanded)
+			a.updateUI()
+		}
+	})
+	a.treeTable.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyRight:
+			a.expandTreeRow(true)
+		case tcell.KeyLeft:
+			a.expandTreeRow(false)
+		default:
+			return event
+		}
+		a.updateUI()
+		return nil
+	})
+
+	// Heatmap of the nodes with the details of the selected one; Enter
+	// or a double click shows the node's pods
+	a.heat = newHeatmap(a)
+	a.heat.SetBorder(true).
+		SetTitle(" HEATMAP ").
+		SetTitleAlign(tview.AlignLeft)
+	a.heatInfo = tview.NewTextView().
+		SetDynamicColors(true)
+	a.heatInfo.SetBorder(true).
+		SetTitle(" NODE ").
 		SetTitleAlign(tview.AlignLeft).
-		SetBorderColor(tcell.ColorWhite)
+		SetBorderPadding(0, 0, 1, 1)
+	a.heat.changed = a.updateHeatDetails
+	a.heat.done = func(node string) {
+		a.drillDown(node)
+		a.updateUI()
+	}
+	a.heatFlex = tview.NewFlex().
+		AddItem(a.heat, 0, 1, true).
+		AddItem(a.heatInfo, 44, 0, false)
+
+	// Right-sizing recommendations with their totals below
+	a.sizeTable = tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	a.sizeTable.SetBorder(true).
+		SetTitle(" RIGHT-SIZING ").
+		SetTitleAlign(tview.AlignLeft)
+	a.sizing = newTableContent(a, a.sizeTable, sizingColumns, sizingKey)
+	a.sizeInfo = tview.NewTextView().
+		SetDynamicColors(true)
+	a.sizeInfo.SetBorderPadding(0, 0, 1, 1)
+	a.sizeFlex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(a.sizeTable, 0, 1, true).
+		AddItem(a.sizeInfo, 2, 0, false)
+
+	// Costs by the chosen grouping with the cluster's totals below
+	a.costTable = tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	a.costTable.SetBorder(true).
+		SetTitle(" COST ").
+		SetTitleAlign(tview.AlignLeft)
+	a.costRows = newTableContent(a, a.costTable, costColumns, costKey)
+	a.costInfo = tview.NewTextView().
+		SetDynamicColors(true)
+	a.costInfo.SetBorderPadding(0, 0, 1, 1)
+	a.costFlex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(a.costTable, 0, 1, true).
+		AddItem(a.costInfo, 2, 0, false)
 
 	// Footer
 	a.footer = tview.NewTextView().
@@ -105,16 +303,8 @@ func (a *App) setupUI() {
 		SetTextAlign(tview.AlignCenter)
 	a.footer.SetBorder(false)
 
-	// Help modal
-	a.helpModal = tview.NewModal().
-		SetText(helpText()).
-		AddButtons([]string{"Close"}).
-		SetDoneFunc(func(_ int, _ string) {
-			a.stateMu.Lock()
-			a.state.ShowHelp = false
-			a.stateMu.Unlock()
-			a.app.SetRoot(a.mainFlex, true)
-		})
+	// Help screen
+	a.help = newHelpView(a.helpText())
 
 	// Main layout
 	a.mainFlex = tview.NewFlex().SetDirection(tview.FlexRow).
@@ -123,6 +313,50 @@ func (a *App) setupUI() {
 		AddItem(a.nodesTable, 0, 1, true).
 		AddItem(a.podsTable, 0, 2, false).
 		AddItem(a.footer, 1, 0, false)
+
+	// Filter prompt, shown instead of the footer
+	a.prompt = newFilterPrompt(a)
+
+	// Capacity planner, an overlay page once opened
+	a.planner = newPlanner(a)
+
+	a.setupFleetUI()
+
+	// Pages stack overlays such as the column picker on the main layout
+	a.pages = tview.NewPages().
+		AddPage("fleet", a.fleetFlex, true, false).
+		AddPage("main", a.mainFlex, true, true)
+}
+
+// applyTheme applies the color palette to the UI components
+func (a *App) applyTheme() {
+	tview.Styles.PrimitiveBackgroundColor = a.colors.Background
+	tview.Styles.ContrastBackgroundColor = a.colors.Selected
+	tview.Styles.BorderColor = a.colors.Border
+	tview.Styles.TitleColor = a.colors.Text
+	tview.Styles.PrimaryTextColor = a.colors.Text
+	tview.Styles.SecondaryTextColor = a.colors.Header
+
+	selected := tcell.StyleDefault.Reverse(true)
+	if a.colors.Selected != tcell.ColorDefault {
+		selected = tcell.StyleDefault.Background(a.colors.Selected).Foreground(a.colors.Text)
+	}
+
+	for _, table := range []*tview.Table{a.nodesTable, a.podsTable, a.treeTable, a.sizeTable, a.costTable, a.fleetTable} {
+		table.SetBorderColor(a.colors.Border).
+			SetTitleColor(a.colors.Text).
+			SetBackgroundColor(a.colors.Background)
+		table.SetSelectedStyle(selected)
+	}
+	for _, tv := range []*tview.TextView{a.header, a.summary, a.footer, a.heatInfo, a.sizeInfo, a.costInfo, a.help.TextView} {
+		tv.SetTextColor(a.colors.Text).
+			SetBackgroundColor(a.colors.Background)
+	}
+	for _, box := range []*tview.Box{a.heat.Box, a.heatInfo.Box, a.help.Box} {
+		box.SetBorderColor(a.colors.Border).
+			SetTitleColor(a.colors.Text).
+			SetBackgroundColor(a.colors.Background)
+	}
 }
 
 // setupKeybindings configures keyboard input handling
@@ -131,87 +365,46 @@ func (a *App) setupKeybindings() {
 		a.stateMu.Lock()
 		defer a.stateMu.Unlock()
 
+		// Overlay pickers and the filter prompt handle their own keys
+		if a.picker != nil || a.contexts != nil || a.prompt.open || a.planner.open {
+			return event
+		}
+
 		// Handle help modal first
 		if a.state.ShowHelp {
-			if event.Key() == tcell.KeyEscape || event.Rune() == '?' || event.Rune() == 'q' {
+			act := a.keys.lookup(event)
+			if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || (act != nil && (act.Name == "help" || act.Name == "quit")) {
 				a.state.ShowHelp = false
-				a.app.SetRoot(a.mainFlex, true)
+				a.app.SetRoot(a.pages, true)
 				return nil
 			}
 			return event
 		}
 
-		switch event.Key() {
-		case tcell.KeyEscape:
-			if a.state.NamespaceFilter != "" {
-				a.state.NamespaceFilter = ""
-				return nil
-			}
-		case tcell.KeyTab:
-			// Switch focus between nodes and pods tables
-			if a.nodesTable.HasFocus() {
-				a.app.SetFocus(a.podsTable)
-			} else {
-				a.app.SetFocus(a.nodesTable)
-			}
-			return nil
+		act := a.keys.lookup(event)
+		if act == nil || (a.state.FleetView && !act.Fleet) {
+			return event
 		}
-
-		switch event.Rune() {
-		case 'q', 'Q':
-			a.cancel()
-			a.app.Stop()
-			return nil
-
-		case 'r', 'R':
-			// Force refresh
-			select {
-			case a.refreshNow <- struct{}{}:
-			default:
-			}
-			return nil
-
-		case 's', 'S':
-			// Cycle node sort
-			a.cycleNodeSort()
-			return nil
-
-		case 'p', 'P':
-			// Cycle pod sort
-			a.cyclePodSort()
-			return nil
-
-		case 'f', 'F':
-			// Filter namespaces - cycle through available namespaces
-			a.cycleNamespaceFilter()
-			return nil
-
-		case 'n', 'N':
-			// Next namespace filter
-			a.cycleNamespaceFilter()
-			return nil
-
-		case 't', 'T':
-			// Toggle view mode
-			a.cycleViewMode()
-			return nil
-
-		case 'a', 'A':
-			// Toggle system namespaces
-			a.state.ShowSystem = !a.state.ShowSystem
-			return nil
-
-		case '?':
-			// Show help
-			a.state.ShowHelp = true
-			a.app.SetRoot(a.helpModal, true)
+		// The message of an earlier action or failure is replaced by
+		// the next action, which sets its own on failure
+		lastError := a.state.LastError
+		a.state.LastError = ""
+		if act.handler(a) {
 			return nil
 		}
-
+		a.state.LastError = lastError
 		return event
 	})
 }
 
+// setError records an error to show in the header until the next key
+// action or cluster switch
+func (a *App) setError(msg string) {
+	a.stateMu.Lock()
+	a.state.LastError = msg
+	a.stateMu.Unlock()
+}
+
 // cycleNodeSort cycles through node sort options
 func (a *App) cycleNodeSort() {
 	switch a.state.NodeSortField {
@@ -248,7 +441,7 @@ func (a *App) cyclePodSort() {
 
 // cycleNamespaceFilter cycles through namespace filters
 func (a *App) cycleNamespaceFilter() {
-	namespaces := a.collector.GetNamespaces()
+	namespaces := a.active.namespaces()
 	if len(namespaces) == 0 {
 		return
 	}
@@ -282,9 +475,46 @@ func (a *App) cycleViewMode() {
 	case models.ViewModeNodes:
 		a.state.ViewMode = models.ViewModePods
 	case models.ViewModePods:
+		a.state.ViewMode = models.ViewModeTree
+	case models.ViewModeTree:
+		a.state.ViewMode = models.ViewModeHeatmap
+	case models.ViewModeHeatmap:
+		a.state.ViewMode = models.ViewModeRightsize
+	case models.ViewModeRightsize:
+		a.state.ViewMode = models.ViewModeCost
+	case models.ViewModeCost:
 		a.state.ViewMode = models.ViewModeSplit
 	}
 	a.updateLayout()
+
+	// Keys go to the table the new layout starts with
+	switch a.state.ViewMode {
+	case models.ViewModePods:
+		a.app.SetFocus(a.podsTable)
+	case models.ViewModeTree:
+		a.app.SetFocus(a.treeTable)
+	case models.ViewModeHeatmap:
+		a.app.SetFocus(a.heat)
+	case models.ViewModeRightsize:
+		a.app.SetFocus(a.sizeTable)
+	case models.ViewModeCost:
+		a.app.SetFocus(a.costTable)
+	default:
+		a.app.SetFocus(a.nodesTable)
+	}
+}
+
+// drillDown limits the pods table to the pods of a node and moves the
+// focus there, showing the pods table if it is hidden
+func (a *App) drillDown(node string) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	a.state.PodNode = node
+	if a.state.ViewMode == models.ViewModeNodes || a.state.ViewMode == models.ViewModeHeatmap {
+		a.state.ViewMode = models.ViewModeSplit
+		a.updateLayout()
+	}
+	a.app.SetFocus(a.podsTable)
 }
 
 // updateLayout updates the layout based on view mode
@@ -301,6 +531,14 @@ func (a *App) updateLayout() {
 		a.mainFlex.AddItem(a.nodesTable, 0, 1, true)
 	case models.ViewModePods:
 		a.mainFlex.AddItem(a.podsTable, 0, 1, true)
+	case models.ViewModeTree:
+		a.mainFlex.AddItem(a.treeTable, 0, 1, true)
+	case models.ViewModeHeatmap:
+		a.mainFlex.AddItem(a.heatFlex, 0, 1, true)
+	case models.ViewModeRightsize:
+		a.mainFlex.AddItem(a.sizeFlex, 0, 1, true)
+	case models.ViewModeCost:
+		a.mainFlex.AddItem(a.costFlex, 0, 1, true)
 	}
 
 	a.mainFlex.AddItem(a.footer, 1, 0, false)
@@ -308,51 +546,28 @@ func (a *App) updateLayout() {
 
 // Run starts the application
 func (a *App) Run() error {
-	// Start metrics collection goroutine
-	go a.metricsLoop()
-
-	// Start UI refresh goroutine
-	go a.refreshLoop()
-
-	// Run the application
-	return a.app.SetRoot(a.mainFlex, true).EnableMouse(true).Run()
-}
-
-// metricsLoop periodically collects metrics
-func (a *App) metricsLoop() {
-	ticker := time.NewTicker(a.config.RefreshInterval)
-	defer ticker.Stop()
-
-	// Initial fetch
-	a.fetchMetrics()
-
-	for {
-		select {
-		case <-a.ctx.Done():
-			return
-		case <-a.refreshNow:
-			a.fetchMetrics()
-		case <-ticker.C:
-			a.fetchMetrics()
-		}
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("failed to create screen: %w", err)
 	}
-}
+	a.app.SetScreen(screen) // initializes the screen
 
-// fetchMetrics fetches and stores new metrics
-func (a *App) fetchMetrics() {
-	m, err := a.collector.Collect(a.ctx)
-	if err != nil && m == nil {
-		return
+	// Fit the theme to what the terminal can display
+	a.colors = a.colors.Fit(screen.Colors())
+	a.applyTheme()
+
+	// Start one metrics collection goroutine per cluster
+	for _, c := range a.clusters {
+		go c.run(a.ctx, a.config.RefreshInterval, func() {
+			a.app.QueueUpdateDraw(a.updateUI)
+		})
 	}
 
-	a.metricsMu.Lock()
-	a.metrics = m
-	a.metricsMu.Unlock()
+	// Start UI refresh goroutine
+	go a.refreshLoop()
 
-	// Queue UI update
-	a.app.QueueUpdateDraw(func() {
-		a.updateUI()
-	})
+	// Run the application
+	return a.app.SetRoot(a.pages, true).EnableMouse(true).Run()
 }
 
 // refreshLoop periodically updates the UI
@@ -374,45 +589,104 @@ func (a *App) refreshLoop() {
 
 // updateUI updates all UI components
 func (a *App) updateUI() {
-	a.metricsMu.RLock()
-	m := a.metrics
-	a.metricsMu.RUnlock()
-
 	a.stateMu.RLock()
 	state := a.state
+	active := a.active
 	a.stateMu.RUnlock()
 
+	if state.FleetView {
+		a.updateFleetHeader(state)
+		a.updateFleetTable()
+		a.updateFooter(nil, state)
+		return
+	}
+
+	m := active.latest()
 	a.updateHeader(m, state)
 	a.updateSummary(m)
 	a.updateNodesTable(m, state)
 	a.updatePodsTable(m, state)
+	a.updateTreeTable(m, state)
+	a.updateHeatmap(m, state)
+	a.updateSizingTable(m, state)
+	a.updateCostTable(m, state)
 	a.updateFooter(m, state)
+	a.planner.update(m)
 }
 
 // updateHeader updates the header text
 func (a *App) updateHeader(m *models.ClusterMetrics, state models.AppState) {
 	if m == nil {
-		a.header.SetText("[yellow]ktop[-] - Kubernetes Cluster Monitor   [red]Connecting...[-]")
+		connecting := "Connecting..."
+		if name := a.active.name(); name != "" {
+			connecting = "Connecting to " + name + "..."
+		}
+		a.header.SetText(fmt.Sprintf("%sktop[-] - Kubernetes Cluster Monitor   %s%s[-]",
+			ColorTag(a.colors.Header), ColorTag(a.colors.Critical), connecting))
 		return
 	}
 
 	elapsed := time.Since(m.Timestamp)
 	refreshStr := formatDuration(elapsed)
 
-	header := fmt.Sprintf("[yellow]ktop[-] - [white]%s[-] [gray](%s)[-]   Nodes: [white]%d/%d[-]   [gray]Updated: %s ago[-]",
-		m.ClusterInfo.Name, m.ClusterInfo.Context, m.ReadyNodes, m.TotalNodes, refreshStr)
+	text, dim := ColorTag(a.colors.Text), ColorTag(a.colors.TextDim)
+	nodes := fmt.Sprintf("%d/%d", m.ReadyNodes, m.TotalNodes)
+	if m.NodesForbidden {
+		nodes = "-"
+	}
+	header := fmt.Sprintf("%sktop[-] - %s%s[-] %s(%s)[-]   Nodes: %s%s[-]   ",
+		ColorTag(a.colors.Header), text, m.ClusterInfo.Name, dim, m.ClusterInfo.Context,
+		text, nodes)
+	if len(m.Namespaces) > 0 {
+		header += fmt.Sprintf("Namespace: %s%s[-]   ", text, strings.Join(m.Namespaces, ","))
+	}
+	header += fmt.Sprintf("%sUpdated: %s ago[-]", dim, refreshStr)
 
-	if m.Error != nil {
-		header += fmt.Sprintf("  [red]⚠ %s[-]", m.Error.Error())
+	if m.MetricsSource != "" && m.MetricsSource != "metrics-server" {
+		header += "  " + ColoredText("via "+m.MetricsSource, a.colors.TextDim)
+	}
+	if m.MetricsUnavailable {
+		header += "  " + ColoredText("(usage metrics unavailable)", a.colors.TextDim)
+	}
+	if degraded := m.Degraded(); len(degraded) > 0 {
+		header += "  " + a.sourceWarning(degraded)
+	}
+	if state.LastError != "" {
+		header += "  " + ColoredText("⚠ "+state.LastError, a.colors.Warning)
 	}
 
 	a.header.SetText(header)
 }
 
+// sourceWarning describes the degraded data sources for the header, e.g.
+// "⚠ pods stale 2m, metrics-server failed". The error is shown when a
+// single source is affected.
+func (a *App) sourceWarning(degraded []models.SourceStatus) string {
+	color := a.colors.Warning
+	parts := make([]string, 0, len(degraded))
+	for _, s := range degraded {
+		if s.State == models.SourceStale {
+			parts = append(parts, fmt.Sprintf("%s stale %s", s.Name, formatDuration(time.Since(s.LastSuccess))))
+			continue
+		}
+		parts = append(parts, s.Name+" "+string(s.State))
+		color = a.colors.Critical
+	}
+	text := "⚠ " + strings.Join(parts, ", ")
+	if len(degraded) == 1 && degraded[0].Err != nil {
+		text += ": " + degraded[0].Err.Error()
+	}
+	return ColoredText(text, color)
+}
+
 // updateSummary updates the cluster resource summary bar
 func (a *App) updateSummary(m *models.ClusterMetrics) {
 	if m == nil {
-		a.summary.SetText("[gray]Loading cluster resources...[-]")
+		a.summary.SetText(ColoredText("Loading cluster resources...", a.colors.TextDim))
+		return
+	}
+	if m.NodesForbidden {
+		a.updateScopedSummary(m)
 		return
 	}
 
@@ -429,25 +703,27 @@ func (a *App) updateSummary(m *models.ClusterMetrics) {
 	}
 
 	// Get colors based on usage
-	cpuColor := a.colors.GetResourceColor(cpuPercent)
-	memColor := a.colors.GetResourceColor(memPercent)
-	diskColor := a.colors.GetResourceColor(diskPercent)
+	th := a.config.Thresholds
+	cpuColor := a.colors.GetResourceColor(cpuPercent, th.CPU)
+	memColor := a.colors.GetResourceColor(memPercent, th.Memory)
+	diskColor := a.colors.GetResourceColor(diskPercent, th.Disk)
 
 	// Build summary line 1: CPU and Memory
-	line1 := fmt.Sprintf("[white]CPU:[white] [gray]%d cores[-]  %s / %s  %s   ",
-		m.TotalCPUCores,
+	text := ColorTag(a.colors.Text)
+	line1 := fmt.Sprintf("%sCPU:[-] %s  %s / %s  %s   ",
+		text, ColoredText(fmt.Sprintf("%d cores", m.TotalCPUCores), a.colors.TextDim),
 		ColoredText(metrics.FormatCPU(m.TotalCPUUsed), cpuColor),
 		metrics.FormatCPU(m.TotalCPUCapacity),
 		ColoredText(fmt.Sprintf("%.1f%%", cpuPercent), cpuColor))
 
-	line1 += fmt.Sprintf("[white]RAM:[-]  %s / %s  %s   ",
+	line1 += fmt.Sprintf("%sRAM:[-]  %s / %s  %s   ", text,
 		ColoredText(metrics.FormatMemory(m.TotalMemoryUsed), memColor),
 		metrics.FormatMemory(m.TotalMemoryCapacity),
 		ColoredText(fmt.Sprintf("%.1f%%", memPercent), memColor))
 
 	// Add disk if available
 	if m.TotalDiskCapacity > 0 {
-		line1 += fmt.Sprintf("[white]DISK:[-]  %s / %s  %s   ",
+		line1 += fmt.Sprintf("%sDISK:[-]  %s / %s  %s   ", text,
 			ColoredText(metrics.FormatMemory(m.TotalDiskUsed), diskColor),
 			metrics.FormatMemory(m.TotalDiskCapacity),
 			ColoredText(fmt.Sprintf("%.1f%%", diskPercent), diskColor))
@@ -455,121 +731,130 @@ func (a *App) updateSummary(m *models.ClusterMetrics) {
 
 	// Add GPU count
 	if m.TotalGPUs > 0 {
-		line1 += fmt.Sprintf("[white]GPUs:[-] [green]%d[-]", m.TotalGPUs)
+		line1 += fmt.Sprintf("%sGPUs:[-] %s", text, ColoredText(fmt.Sprintf("%d", m.TotalGPUs), a.colors.Healthy))
 	}
 
 	// Build summary line 2: Pods
-	line2 := fmt.Sprintf("[white]Pods:[-] [cyan]%d[-] running", m.TotalPods)
+	line2 := fmt.Sprintf("%sPods:[-] %s running", text, ColoredText(fmt.Sprintf("%d", m.TotalPods), a.colors.Highlight))
+
+	a.summary.SetText(line1 + "\n" + line2)
+}
+
+// updateScopedSummary shows the usage of the watched namespaces when
+// cluster capacity is unknown because nodes cannot be listed
+func (a *App) updateScopedSummary(m *models.ClusterMetrics) {
+	var cpu, mem int64
+	for _, pod := range m.Pods {
+		cpu += pod.CPU
+		mem += pod.Memory
+	}
+
+	text := ColorTag(a.colors.Text)
+	line1 := fmt.Sprintf("%sCPU:[-] %s   %sRAM:[-] %s   %s", text,
+		ColoredText(metrics.FormatCPU(cpu), a.colors.Highlight), text,
+		ColoredText(metrics.FormatMemory(mem), a.colors.Highlight),
+		ColoredText("(used by watched namespaces; cluster capacity unavailable)", a.colors.TextDim))
+	line2 := fmt.Sprintf("%sPods:[-] %s running", text, ColoredText(fmt.Sprintf("%d", m.TotalPods), a.colors.Highlight))
 
 	a.summary.SetText(line1 + "\n" + line2)
 }
 
-// updateNodesTable updates the nodes table
+// updateNodesTable updates the nodes table when the metrics or the state
+// changed since it was last updated
 func (a *App) updateNodesTable(m *models.ClusterMetrics, state models.AppState) {
-	a.nodesTable.Clear()
-
-	// Set headers
-	headers := []string{"NODE", "STATUS", "CPU", "CPU%", "MEMORY", "MEM%", "PODS", "GPU"}
-	for i, h := range headers {
-		cell := tview.NewTableCell(h).
-			SetTextColor(tcell.ColorYellow).
-			SetSelectable(false).
-			SetAlign(tview.AlignLeft)
-		if i > 1 {
-			cell.SetAlign(tview.AlignRight)
+	if !a.nodes.changed(m, state) {
+		return
+	}
+	a.nodeGroups = nil
+
+	if m != nil && m.NodesForbidden {
+		a.nodesTable.SetTitle(" NODES (unavailable) ")
+		scope := "Showing pods in all namespaces."
+		switch len(m.Namespaces) {
+		case 0:
+		case 1:
+			scope = fmt.Sprintf("Showing pods in namespace %s only; use -n to watch other namespaces.", m.Namespaces[0])
+		default:
+			scope = fmt.Sprintf("Showing pods in namespaces %s only; use -n to watch other namespaces.", strings.Join(m.Namespaces, ", "))
 		}
-		a.nodesTable.SetCell(0, i, cell)
+		a.nodes.setNotice(false,
+			"Your account is not allowed to list nodes, so node status and cluster capacity are hidden.",
+			scope)
+		return
 	}
 
 	if m == nil || len(m.Nodes) == 0 {
-		a.nodesTable.SetCell(1, 0, tview.NewTableCell("No nodes found").SetTextColor(tcell.ColorGray))
+		a.nodes.setNotice(true, "No nodes found")
 		return
 	}
 
-	// Sort nodes
-	nodes := make([]models.Node, len(m.Nodes))
-	copy(nodes, m.Nodes)
-	metrics.SortNodes(nodes, state.NodeSortField, state.NodeSortAsc)
-
 	// Update title with sort indicator
 	sortIndicator := "↓"
 	if state.NodeSortAsc {
 		sortIndicator = "↑"
 	}
-	a.nodesTable.SetTitle(fmt.Sprintf(" NODES (sort: %s %s) ", state.NodeSortField.String(), sortIndicator))
-
-	// Populate rows
-	for i, node := range nodes {
-		row := i + 1
-
-		// Node name
-		a.nodesTable.SetCell(row, 0, tview.NewTableCell(node.Name).
-			SetTextColor(tcell.ColorWhite))
-
-		// Status
-		statusColor := a.colors.GetNodeStatusColor(node.Status)
-		a.nodesTable.SetCell(row, 1, tview.NewTableCell(string(node.Status)).
-			SetTextColor(statusColor))
-
-		// CPU usage
-		cpuColor := a.colors.GetResourceColor(node.CPU.Percent)
-		a.nodesTable.SetCell(row, 2, tview.NewTableCell(metrics.FormatCPU(node.CPU.Current)).
-			SetTextColor(cpuColor).SetAlign(tview.AlignRight))
-
-		// CPU percent with bar
-		a.nodesTable.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.1f%%", node.CPU.Percent)).
-			SetTextColor(cpuColor).SetAlign(tview.AlignRight))
-
-		// Memory usage
-		memColor := a.colors.GetResourceColor(node.Memory.Percent)
-		a.nodesTable.SetCell(row, 4, tview.NewTableCell(metrics.FormatMemory(node.Memory.Current)).
-			SetTextColor(memColor).SetAlign(tview.AlignRight))
-
-		// Memory percent
-		a.nodesTable.SetCell(row, 5, tview.NewTableCell(fmt.Sprintf("%.1f%%", node.Memory.Percent)).
-			SetTextColor(memColor).SetAlign(tview.AlignRight))
+	grouping := ""
+	if state.NodeGroup != "" {
+		grouping = ", by " + state.NodeGroup
+	}
+	a.nodesTable.SetTitle(fmt.Sprintf(" NODES (sort: %s %s%s) %s", state.NodeSortField.String(), sortIndicator,
+		grouping, filterTitle(state.NodeFilter)))
 
-		// Pod count
-		a.nodesTable.SetCell(row, 6, tview.NewTableCell(fmt.Sprintf("%d", node.PodCount)).
-			SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	// Filter and sort nodes; the prompt only stores valid expressions
+	filter, _ := metrics.ParseFilter(state.NodeFilter, metrics.FilterKindNodes)
+	nodes := make([]models.Node, len(m.Nodes))
+	copy(nodes, m.Nodes)
+	nodes = filter.Nodes(nodes)
+	if len(nodes) == 0 {
+		a.nodes.setNotice(true, "No nodes match the filter")
+		return
+	}
+	metrics.SortNodes(nodes, state.NodeSortField, state.NodeSortAsc)
 
-		// GPU
-		gpuStr := "-"
-		if node.GPU != nil {
-			gpuStr = fmt.Sprintf("%d", node.GPU.Count)
-		}
-		a.nodesTable.SetCell(row, 7, tview.NewTableCell(gpuStr).
-			SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	// Group header rows use the thresholds of their label value
+	if state.NodeGroup != "" {
+		nodes, a.nodeGroups = groupNodes(nodes, state.NodeGroup, state.NodeSortField, state.NodeSortAsc, a.collapsed)
 	}
+	a.nodes.setItems(nodes, func(n *models.Node) rowContext {
+		return rowContext{
+			th:         a.config.Thresholds.ForLabels(n.Labels),
+			nodeLabels: n.Labels,
+			group:      a.nodeGroups[n.Name],
+			grouped:    a.nodeGroups != nil,
+		}
+	})
 }
 
-// updatePodsTable updates the pods table
+// updatePodsTable updates the pods table when the metrics or the state
+// changed since it was last updated
 func (a *App) updatePodsTable(m *models.ClusterMetrics, state models.AppState) {
-	a.podsTable.Clear()
-
-	// Set headers
-	headers := []string{"NAMESPACE", "POD", "STATUS", "CPU", "MEMORY", "RESTARTS", "NODE"}
-	for i, h := range headers {
-		cell := tview.NewTableCell(h).
-			SetTextColor(tcell.ColorYellow).
-			SetSelectable(false).
-			SetAlign(tview.AlignLeft)
-		if i >= 3 && i <= 5 {
-			cell.SetAlign(tview.AlignRight)
-		}
-		a.podsTable.SetCell(0, i, cell)
+	if !a.pods.changed(m, state) {
+		return
 	}
 
 	if m == nil || len(m.Pods) == 0 {
-		a.podsTable.SetCell(1, 0, tview.NewTableCell("No pods found").SetTextColor(tcell.ColorGray))
+		a.pods.setNotice(true, "No pods found")
 		return
 	}
 
 	// Filter and sort pods
-	pods := metrics.FilterPods(m.Pods, state.NamespaceFilter, state.ShowSystem)
+	// Explicitly watched namespaces are shown even if they are system ones
+	showSystem := state.ShowSystem || len(m.Namespaces) > 0
+	pods := metrics.FilterPods(m.Pods, state.NamespaceFilter, showSystem)
+	filter, _ := metrics.ParseFilter(state.PodFilter, metrics.FilterKindPods)
+	pods = filter.Pods(pods)
+	if state.PodNode != "" {
+		pods = podsOnNode(pods, state.PodNode)
+	}
 	metrics.SortPods(pods, state.PodSortField, state.PodSortAsc)
 	pods = metrics.LimitPods(pods, a.config.TopPods)
 
+	// Node labels select per-pool threshold overrides for each pod
+	nodeLabels := make(map[string]map[string]string, len(m.Nodes))
+	for _, node := range m.Nodes {
+		nodeLabels[node.Name] = node.Labels
+	}
+
 	// Update title
 	sortIndicator := "↓"
 	if state.PodSortAsc {
@@ -579,75 +864,69 @@ func (a *App) updatePodsTable(m *models.ClusterMetrics, state models.AppState) {
 	if state.NamespaceFilter != "" {
 		filterStr = state.NamespaceFilter
 	}
-	a.podsTable.SetTitle(fmt.Sprintf(" PODS (top %d by %s %s) [filter: %s] ",
-		len(pods), state.PodSortField.String(), sortIndicator, filterStr))
-
-	// Populate rows
-	for i, pod := range pods {
-		row := i + 1
-
-		// Namespace
-		nsColor := a.colors.GetNamespaceColor(pod.Namespace)
-		a.podsTable.SetCell(row, 0, tview.NewTableCell(truncate(pod.Namespace, 20)).
-			SetTextColor(nsColor))
-
-		// Pod name
-		a.podsTable.SetCell(row, 1, tview.NewTableCell(truncate(pod.Name, 40)).
-			SetTextColor(tcell.ColorWhite))
-
-		// Status
-		statusColor := a.colors.GetPodStatusColor(pod.Status)
-		a.podsTable.SetCell(row, 2, tview.NewTableCell(string(pod.Status)).
-			SetTextColor(statusColor))
-
-		// CPU
-		a.podsTable.SetCell(row, 3, tview.NewTableCell(metrics.FormatCPU(pod.CPU)).
-			SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
-
-		// Memory
-		a.podsTable.SetCell(row, 4, tview.NewTableCell(metrics.FormatMemory(pod.Memory)).
-			SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	a.podsTable.SetTitle(fmt.Sprintf(" PODS (top %d by %s %s) [filter: %s] %s%s",
+		len(pods), state.PodSortField.String(), sortIndicator, filterStr, a.nodeTitle(state.PodNode),
+		filterTitle(state.PodFilter)))
+	if len(pods) == 0 {
+		a.pods.setNotice(true, "No pods match the filter")
+		return
+	}
 
-		// Restarts
-		restartColor := tcell.ColorWhite
-		if pod.RestartCount > 0 {
-			restartColor = tcell.ColorYellow
+	a.pods.setItems(pods, func(p *models.Pod) rowContext {
+		labels := nodeLabels[p.NodeName]
+		return rowContext{
+			th:         a.config.Thresholds.ForLabels(labels),
+			nodeLabels: labels,
 		}
-		if pod.RestartCount > 5 {
-			restartColor = tcell.ColorRed
+	})
+}
+
+// podsOnNode returns the pods running on a node
+func podsOnNode(pods []models.Pod, node string) []models.Pod {
+	result := make([]models.Pod, 0, len(pods))
+	for _, p := range pods {
+		if p.NodeName == node {
+			result = append(result, p)
 		}
-		a.podsTable.SetCell(row, 5, tview.NewTableCell(fmt.Sprintf("%d", pod.RestartCount)).
-			SetTextColor(restartColor).SetAlign(tview.AlignRight))
+	}
+	return result
+}
+
+// nodeTitle shows the node the pods table is limited to in its title
+func (a *App) nodeTitle(node string) string {
+	if node == "" {
+		return ""
+	}
+	return ColoredText(tview.Escape("[node: "+node+"]"), a.colors.Highlight) + " "
+}
 
-		// Node
-		a.podsTable.SetCell(row, 6, tview.NewTableCell(truncate(pod.NodeName, 20)).
-			SetTextColor(tcell.ColorGray))
+// filterTitle shows a table's filter expression in its title
+func filterTitle(expr string) string {
+	if expr == "" {
+		return ""
 	}
+	return tview.Escape("[/"+expr+"]") + " "
 }
 
 // updateFooter updates the footer text
 func (a *App) updateFooter(m *models.ClusterMetrics, state models.AppState) {
-	footer := "[yellow]q[-]uit  [yellow]r[-]efresh  [yellow]s[-]ort nodes  [yellow]p[-]od sort  "
-	footer += "[yellow]f/n[-]amespace  [yellow]t[-]oggle view  [yellow]a[-]ll ns  [yellow]?[-]help"
-	a.footer.SetText(footer)
+	if state.FleetView {
+		footer := ColoredText("Enter", a.colors.Header) + " open cluster  "
+		footer += a.keys.footerText(a.colors.Header, func(act *action) bool { return act.Fleet })
+		a.footer.SetText(footer)
+		return
+	}
+	multi := len(a.clusters) > 1
+	a.footer.SetText(a.keys.footerText(a.colors.Header, func(act *action) bool {
+		return act.Name != "fleet" || multi
+	}))
 }
 
-// helpText returns the help modal text
-func helpText() string {
-	return `ktop - Kubernetes Cluster Monitor
-
-Keyboard Controls:
-  q     Quit
-  r     Force refresh
-  s     Sort nodes (cycle)
-  p     Sort pods (cycle)
-  f/n   Filter by namespace
-  t     Toggle view mode
-  a     Toggle system namespaces
-  Tab   Switch focus
-  ?     Show this help
-
-Press any key to close`
+// helpText returns the text of the help screen
+func (a *App) helpText() string {
+	return "ktop - Kubernetes Cluster Monitor\n\nKeyboard Controls:\n" +
+		strings.Join(a.keys.helpLines(), "\n") +
+		"\n\nPress Esc to close"
 }
 
 // truncate truncates a string to max length with ellipsis
@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/cost"
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Cluster is one kubeconfig context to monitor. Err records why no
+// collector could be created for it.
+type Cluster struct {
+	Context   string
+	Collector *metrics.Collector
+	Err       error
+}
+
+// cluster tracks the collection state of one monitored cluster. Each
+// cluster is collected by its own goroutine so a slow or unreachable
+// cluster never delays the others.
+type cluster struct {
+	refreshNow chan struct{}
+
+	mu          sync.RWMutex
+	context     string
+	collector   *metrics.Collector
+	metrics     *models.ClusterMetrics
+	lastErr     error
+	lastSuccess time.Time
+	latency     time.Duration
+
+	// costs accumulates the cost of the cluster since it was connected
+	costs *cost.Tracker
+}
+
+// newCluster creates the runtime state for a cluster, priced by pricing
+func newCluster(c Cluster, pricing config.PricingConfig) *cluster {
+	name := c.Context
+	if name == "" && c.Collector != nil {
+		name = c.Collector.Client().ClusterInfo().Context
+	}
+	return &cluster{
+		context:    name,
+		collector:  c.Collector,
+		refreshNow: make(chan struct{}, 1),
+		lastErr:    c.Err,
+		costs:      cost.NewTracker(pricing),
+	}
+}
+
+// name returns the kubeconfig context of the cluster
+func (c *cluster) name() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.context
+}
+
+// client returns the Kubernetes client of the cluster, if connected
+func (c *cluster) client() *k8s.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.collector == nil {
+		return nil
+	}
+	return c.collector.Client()
+}
+
+// namespaces returns the namespaces seen by the last collection
+func (c *cluster) namespaces() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.collector == nil {
+		return nil
+	}
+	return c.collector.GetNamespaces()
+}
+
+// history returns the usage history of the cluster, if connected
+func (c *cluster) history() *metrics.History {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.collector == nil {
+		return nil
+	}
+	return c.collector.History()
+}
+
+// reconnect replaces the collector, dropping the metrics of the previous
+// context, and requests an immediate collection
+func (c *cluster) reconnect(name string, collector *metrics.Collector) {
+	c.mu.Lock()
+	c.context = name
+	c.collector = collector
+	c.metrics = nil
+	c.lastErr = nil
+	c.lastSuccess = time.Time{}
+	c.latency = 0
+	c.costs.Reset()
+	c.mu.Unlock()
+
+	c.refresh()
+}
+
+// snapshot returns the latest metrics and collection status
+func (c *cluster) snapshot() (m *models.ClusterMetrics, lastErr error, lastSuccess time.Time, latency time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.metrics, c.lastErr, c.lastSuccess, c.latency
+}
+
+// latest returns the latest metrics
+func (c *cluster) latest() *models.ClusterMetrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.metrics
+}
+
+// refresh requests an immediate collection
+func (c *cluster) refresh() {
+	select {
+	case c.refreshNow <- struct{}{}:
+	default:
+	}
+}
+
+// run collects metrics every interval until ctx is done, calling
+// updated after each collection
+func (c *cluster) run(ctx context.Context, interval time.Duration, updated func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Initial fetch
+	c.collect(ctx)
+	updated()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.refreshNow:
+		case <-ticker.C:
+		}
+		c.collect(ctx)
+		updated()
+	}
+}
+
+// collect fetches and stores new metrics. Results of a collector replaced
+// by reconnect while collecting are discarded.
+func (c *cluster) collect(ctx context.Context) {
+	c.mu.RLock()
+	collector := c.collector
+	c.mu.RUnlock()
+	if collector == nil {
+		return
+	}
+
+	start := time.Now()
+	m, err := collector.Collect(ctx)
+	latency := time.Since(start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.collector != collector {
+		return
+	}
+
+	c.latency = latency
+	c.lastErr = err
+	if m != nil && err == nil {
+		c.lastSuccess = time.Now()
+	}
+	if m != nil {
+		c.costs.Observe(m)
+		c.metrics = m
+	}
+}
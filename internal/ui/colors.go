@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/nlaak/ktop/internal/config"
@@ -66,21 +67,30 @@ func DefaultColors() Colors {
 	}
 }
 
-// Thresholds for color coding
-var thresholds = config.DefaultThresholds()
-
 // GetResourceColor returns the appropriate color for a resource usage percentage
-func (c Colors) GetResourceColor(percent float64) tcell.Color {
+func (c Colors) GetResourceColor(percent float64, threshold config.ThresholdConfig) tcell.Color {
 	switch {
-	case percent >= thresholds.CriticalPercent:
+	case percent >= threshold.Critical:
 		return c.Critical
-	case percent >= thresholds.WarningPercent:
+	case percent >= threshold.Warning:
 		return c.Warning
 	default:
 		return c.Healthy
 	}
 }
 
+// GetRestartColor returns the color for a pod restart count
+func (c Colors) GetRestartColor(restarts int32, threshold config.ThresholdConfig) tcell.Color {
+	switch {
+	case float64(restarts) >= threshold.Critical:
+		return c.Critical
+	case float64(restarts) >= threshold.Warning:
+		return c.Warning
+	default:
+		return c.Text
+	}
+}
+
 // GetNodeStatusColor returns the color for a node status
 func (c Colors) GetNodeStatusColor(status models.NodeStatus) tcell.Color {
 	if status == models.NodeStatusReady {
@@ -113,28 +123,13 @@ func (c Colors) GetNamespaceColor(namespace string) tcell.Color {
 	return c.Text
 }
 
-// ColorTag returns a tview color tag string for a color
+// ColorTag returns a tview color tag string for a color. Named colors use
+// their W3C name, anything else (including 24-bit colors) a #rrggbb value.
 func ColorTag(color tcell.Color) string {
-	switch color {
-	case tcell.ColorGreen:
-		return "[green]"
-	case tcell.ColorYellow:
-		return "[yellow]"
-	case tcell.ColorRed:
-		return "[red]"
-	case tcell.ColorBlue:
-		return "[blue]"
-	case tcell.ColorTeal:
-		return "[teal]"
-	case tcell.ColorAqua:
-		return "[aqua]"
-	case tcell.ColorGray:
-		return "[gray]"
-	case tcell.ColorWhite:
-		return "[white]"
-	default:
-		return "[white]"
+	if color == tcell.ColorDefault {
+		return "[default]"
 	}
+	return "[" + strings.ToLower(color.String()) + "]"
 }
 
 // ColorTagClose returns the closing color tag
@@ -148,7 +143,7 @@ func ColoredText(text string, color tcell.Color) string {
 }
 
 // ProgressBar generates a simple text-based progress bar
-func ProgressBar(percent float64, width int, colors Colors) string {
+func ProgressBar(percent float64, width int, colors Colors, threshold config.ThresholdConfig) string {
 	if width < 3 {
 		width = 3
 	}
@@ -161,7 +156,7 @@ func ProgressBar(percent float64, width int, colors Colors) string {
 		filled = 0
 	}
 
-	color := colors.GetResourceColor(percent)
+	color := colors.GetResourceColor(percent, threshold)
 	
 	bar := ColorTag(color)
 	for i := 0; i < filled; i++ {
@@ -177,14 +172,14 @@ func ProgressBar(percent float64, width int, colors Colors) string {
 }
 
 // ProgressBarCompact generates a compact progress bar with percentage
-func ProgressBarCompact(percent float64, width int, colors Colors) string {
+func ProgressBarCompact(percent float64, width int, colors Colors, threshold config.ThresholdConfig) string {
 	barWidth := width - 6 // Reserve space for percentage display
 	if barWidth < 3 {
 		barWidth = 3
 	}
 
-	bar := ProgressBar(percent, barWidth, colors)
-	color := colors.GetResourceColor(percent)
+	bar := ProgressBar(percent, barWidth, colors, threshold)
+	color := colors.GetResourceColor(percent, threshold)
 	
 	return bar + " " + ColoredText(FormatPercentCompact(percent), color)
 }
@@ -0,0 +1,319 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/config"
+)
+
+// columnPicker is a modal for choosing, ordering and sizing table columns
+type columnPicker struct {
+	a      *App
+	table  *tview.Table
+	input  *tview.InputField
+	layout *tview.Flex
+
+	returnFocus tview.Primitive // focused when the picker closes
+
+	name      string                // table edited, "nodes" or "pods"
+	specs     []config.ColumnConfig // visible columns, in order
+	initial   []config.ColumnConfig // layout when the picker opened
+	file      []config.ColumnConfig // layout of the config file
+	available []string              // every static column name
+	lookup    func(name string) (header string, width int, ok bool)
+	apply     func(specs []config.ColumnConfig) error
+}
+
+// newColumnPicker creates a picker editing the layout of the table name,
+// starting from specs; file is the layout of the config file. apply is
+// called with the new layout after every change.
+func newColumnPicker[T any](a *App, name string, set columnSet[T], specs, file []config.ColumnConfig, apply func([]config.ColumnConfig) error) *columnPicker {
+	p := &columnPicker{
+		a:         a,
+		name:      name,
+		specs:     slices.Clone(set.specs(specs)),
+		initial:   slices.Clone(set.specs(specs)),
+		file:      slices.Clone(set.specs(file)),
+		available: set.names(),
+		lookup: func(name string) (string, int, bool) {
+			col, ok := set.lookup(name)
+			return col.Header, col.Width, ok
+		},
+		apply: apply,
+	}
+
+	p.table = tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	p.table.SetBorder(true).
+		SetTitle(fmt.Sprintf(" %s COLUMNS ", strings.ToUpper(name))).
+		SetTitleColor(a.colors.Text).
+		SetBorderColor(a.colors.Border).
+		SetBackgroundColor(a.colors.Background)
+	p.table.SetInputCapture(p.handleKey)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText(fmt.Sprintf("%s toggle  %s move  %s width  %s reset width  %s add label column  %s config file layout  %s close",
+			ColoredText("Space", a.colors.Header), ColoredText("K/J", a.colors.Header),
+			ColoredText("+/-", a.colors.Header), ColoredText("0", a.colors.Header),
+			ColoredText("l", a.colors.Header), ColoredText("r", a.colors.Header),
+			ColoredText("Esc", a.colors.Header)))
+	help.SetBackgroundColor(a.colors.Background)
+
+	p.input = tview.NewInputField().
+		SetLabel("Label key (prefix node-label: for pods' node labels): ").
+		SetFieldWidth(40)
+	p.input.SetDoneFunc(p.handleInputDone)
+
+	p.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(p.table, 0, 1, true).
+		AddItem(help, 2, 0, false)
+
+	p.render()
+	p.table.Select(1, 0)
+	return p
+}
+
+// rowSpec returns the layout entry and visibility for a table row
+func (p *columnPicker) rowSpec(row int) (config.ColumnConfig, bool) {
+	i := row - 1
+	if i < len(p.specs) {
+		return p.specs[i], true
+	}
+	hidden := p.hidden()
+	if i-len(p.specs) < len(hidden) {
+		return config.ColumnConfig{Name: hidden[i-len(p.specs)]}, false
+	}
+	return config.ColumnConfig{}, false
+}
+
+// hidden returns the static columns not currently shown
+func (p *columnPicker) hidden() []string {
+	shown := make(map[string]bool, len(p.specs))
+	for _, spec := range p.specs {
+		shown[spec.Name] = true
+	}
+	var hidden []string
+	for _, name := range p.available {
+		if !shown[name] {
+			hidden = append(hidden, name)
+		}
+	}
+	return hidden
+}
+
+// render redraws the column list
+func (p *columnPicker) render() {
+	colors := p.a.colors
+	p.table.Clear()
+	for i, h := range []string{"", "COLUMN", "HEADER", "WIDTH"} {
+		p.table.SetCell(0, i, tview.NewTableCell(h).
+			SetTextColor(colors.Header).
+			SetSelectable(false))
+	}
+
+	rows := len(p.specs) + len(p.hidden())
+	for row := 1; row <= rows; row++ {
+		spec, visible := p.rowSpec(row)
+		header, width, _ := p.lookup(spec.Name)
+		if spec.Header != "" {
+			header = spec.Header
+		}
+		if spec.Width > 0 {
+			width = spec.Width
+		}
+
+		check, color := "[ ]", colors.TextDim
+		if visible {
+			check, color = "[x]", colors.Text
+		}
+		widthStr := "auto"
+		if width > 0 {
+			widthStr = fmt.Sprintf("%d", width)
+		}
+
+		p.table.SetCell(row, 0, tview.NewTableCell(check).SetTextColor(color))
+		p.table.SetCell(row, 1, tview.NewTableCell(spec.Name).SetTextColor(color))
+		p.table.SetCell(row, 2, tview.NewTableCell(header).SetTextColor(color))
+		p.table.SetCell(row, 3, tview.NewTableCell(widthStr).SetTextColor(color).SetAlign(tview.AlignRight))
+	}
+}
+
+// changed applies the current layout and redraws the list
+func (p *columnPicker) changed(selectRow int) {
+	if err := p.apply(p.specs); err != nil {
+		p.a.setError(err.Error())
+	}
+	p.render()
+	p.table.Select(selectRow, 0)
+}
+
+// handleKey processes key presses inside the picker
+func (p *columnPicker) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	row, _ := p.table.GetSelection()
+	i := row - 1
+	visible := i >= 0 && i < len(p.specs)
+
+	switch {
+	case event.Key() == tcell.KeyEscape || event.Rune() == 'q':
+		p.a.closeColumnPicker()
+		return nil
+
+	case event.Rune() == ' ' || event.Key() == tcell.KeyEnter:
+		if visible {
+			if len(p.specs) == 1 {
+				return nil // keep at least one column
+			}
+			p.specs = append(p.specs[:i], p.specs[i+1:]...)
+			p.changed(row)
+		} else if spec, _ := p.rowSpec(row); spec.Name != "" {
+			p.specs = append(p.specs, spec)
+			p.changed(len(p.specs))
+		}
+		return nil
+
+	case event.Rune() == 'K' || (event.Key() == tcell.KeyUp && event.Modifiers()&tcell.ModShift != 0):
+		if visible && i > 0 {
+			p.specs[i-1], p.specs[i] = p.specs[i], p.specs[i-1]
+			p.changed(row - 1)
+		}
+		return nil
+
+	case event.Rune() == 'J' || (event.Key() == tcell.KeyDown && event.Modifiers()&tcell.ModShift != 0):
+		if visible && i < len(p.specs)-1 {
+			p.specs[i+1], p.specs[i] = p.specs[i], p.specs[i+1]
+			p.changed(row + 1)
+		}
+		return nil
+
+	case event.Rune() == '+' || event.Rune() == '-':
+		if !visible {
+			return nil
+		}
+		_, width, _ := p.lookup(p.specs[i].Name)
+		if p.specs[i].Width > 0 {
+			width = p.specs[i].Width
+		}
+		switch {
+		case event.Rune() == '+' && width > 0:
+			width += 2
+		case event.Rune() == '-' && width == 0:
+			width = 30
+		case event.Rune() == '-' && width > 5:
+			width -= 2
+		}
+		p.specs[i].Width = width
+		p.changed(row)
+		return nil
+
+	case event.Rune() == '0':
+		if visible {
+			p.specs[i].Width = 0
+			p.changed(row)
+		}
+		return nil
+
+	case event.Rune() == 'r':
+		p.specs = slices.Clone(p.file)
+		p.changed(1)
+		return nil
+
+	case event.Rune() == 'l':
+		p.input.SetText("")
+		p.layout.AddItem(p.input, 1, 0, true)
+		p.a.app.SetFocus(p.input)
+		return nil
+	}
+	return event
+}
+
+// handleInputDone adds the label column typed into the input field
+func (p *columnPicker) handleInputDone(key tcell.Key) {
+	text := strings.TrimSpace(p.input.GetText())
+	p.layout.RemoveItem(p.input)
+	p.a.app.SetFocus(p.table)
+
+	if key != tcell.KeyEnter || text == "" {
+		return
+	}
+	name := text
+	if !strings.HasPrefix(name, "label:") && !strings.HasPrefix(name, "node-label:") {
+		name = "label:" + name
+	}
+	if _, _, ok := p.lookup(name); !ok {
+		p.a.setError(fmt.Sprintf("unknown column %q", name))
+		return
+	}
+	p.specs = append(p.specs, config.ColumnConfig{Name: name})
+	p.changed(len(p.specs))
+}
+
+// openColumnPicker shows the column picker for the focused table
+func (a *App) openColumnPicker() {
+	if a.podsTable.HasFocus() {
+		a.picker = newColumnPicker(a, "pods", podColumns, a.config.Columns.Pods, a.config.FileColumns().Pods, func(specs []config.ColumnConfig) error {
+			cols, err := podColumns.resolve(specs)
+			if err != nil {
+				return err
+			}
+			a.config.Columns.Pods = append([]config.ColumnConfig(nil), specs...)
+			a.podCols = cols
+			a.pods.setColumns(cols)
+			return nil
+		})
+	} else {
+		a.picker = newColumnPicker(a, "nodes", nodeColumns, a.config.Columns.Nodes, a.config.FileColumns().Nodes, func(specs []config.ColumnConfig) error {
+			cols, err := nodeColumns.resolve(specs)
+			if err != nil {
+				return err
+			}
+			a.config.Columns.Nodes = append([]config.ColumnConfig(nil), specs...)
+			a.nodeCols = cols
+			a.nodes.setColumns(cols)
+			return nil
+		})
+	}
+	a.picker.returnFocus = a.app.GetFocus()
+	a.pages.AddPage("columns", centered(a.picker.layout, 70, 24), true, true)
+	a.app.SetFocus(a.picker.table)
+}
+
+// closeColumnPicker hides the picker and, when the layout changed,
+// saves it to the state file. The config file layout is not saved, so
+// that later edits of the config file apply to the table again.
+func (a *App) closeColumnPicker() {
+	a.stateMu.Lock()
+	p := a.picker
+	a.picker = nil
+	a.stateMu.Unlock()
+
+	a.pages.RemovePage("columns")
+	a.app.SetFocus(p.returnFocus)
+	if slices.Equal(p.specs, p.initial) {
+		return
+	}
+	specs := p.specs
+	if slices.Equal(specs, p.file) {
+		specs = nil
+	}
+	if err := a.config.SaveColumns(p.name, specs); err != nil {
+		a.setError(err.Error())
+	}
+}
+
+// centered wraps a primitive so it is drawn centered with a fixed size
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
@@ -0,0 +1,310 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// rowContext carries per-row data shared by all cells of a row
+type rowContext struct {
+	th         config.Thresholds // thresholds for the row's node pool
+	nodeLabels map[string]string // labels of the node the row belongs to
+	group      *nodeGroup        // group a header row sums up; nil for other rows
+	grouped    bool              // the row is listed under a group header
+}
+
+// tableColumn describes one column of a table listing items of type T
+type tableColumn[T any] struct {
+	Name   string
+	Header string
+	Align  int
+	Width  int // maximum width, 0 for unlimited
+
+	value func(a *App, ctx rowContext, item *T) (string, tcell.Color)
+}
+
+// columnSet is the catalog of columns a table can show
+type columnSet[T any] struct {
+	columns  []tableColumn[T]
+	dynamic  map[string]func(key string) tableColumn[T] // prefix -> column for key
+	defaults []string
+}
+
+// lookup returns the column with the given name, including dynamic
+// columns such as "label:team"
+func (s columnSet[T]) lookup(name string) (tableColumn[T], bool) {
+	for _, col := range s.columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	if prefix, key, ok := strings.Cut(name, ":"); ok && key != "" {
+		if build, ok := s.dynamic[prefix]; ok {
+			col := build(key)
+			col.Name = name
+			return col, true
+		}
+	}
+	return tableColumn[T]{}, false
+}
+
+// names returns the names of all static columns
+func (s columnSet[T]) names() []string {
+	names := make([]string, 0, len(s.columns))
+	for _, col := range s.columns {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+// specs returns the configured layout, or the defaults when none is set
+func (s columnSet[T]) specs(configured []config.ColumnConfig) []config.ColumnConfig {
+	if len(configured) > 0 {
+		return configured
+	}
+	specs := make([]config.ColumnConfig, 0, len(s.defaults))
+	for _, name := range s.defaults {
+		specs = append(specs, config.ColumnConfig{Name: name})
+	}
+	return specs
+}
+
+// resolve turns a column layout into columns ready to render
+func (s columnSet[T]) resolve(configured []config.ColumnConfig) ([]tableColumn[T], error) {
+	specs := s.specs(configured)
+	result := make([]tableColumn[T], 0, len(specs))
+	for _, spec := range specs {
+		col, ok := s.lookup(spec.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s, label:<key>)", spec.Name, strings.Join(s.names(), ", "))
+		}
+		if spec.Header != "" {
+			col.Header = spec.Header
+		}
+		if spec.Width > 0 {
+			col.Width = spec.Width
+		}
+		result = append(result, col)
+	}
+	return result, nil
+}
+
+// labelHeader derives a header from a label key,
+// e.g. "topology.kubernetes.io/zone" -> "ZONE"
+func labelHeader(key string) string {
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		key = key[i+1:]
+	}
+	return strings.ToUpper(key)
+}
+
+// labelValue formats a label value, using "-" when it is missing
+func labelValue(labels map[string]string, key string) string {
+	if v, ok := labels[key]; ok {
+		return v
+	}
+	return "-"
+}
+
+// nodeColumns is the catalog of nodes table columns
+var nodeColumns = columnSet[models.Node]{
+	columns: []tableColumn[models.Node]{
+		{Name: "node", Header: "NODE", value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			if g := ctx.group; g != nil {
+				marker := "▾ "
+				if !g.expanded {
+					marker = "▸ "
+				}
+				return marker + g.value + " (" + plural(g.nodes, "node") + ")", a.colors.Header
+			}
+			if ctx.grouped {
+				return "  " + n.Name, a.colors.Text
+			}
+			return n.Name, a.colors.Text
+		}},
+		{Name: "status", Header: "STATUS", value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			if g := ctx.group; g != nil {
+				return fmt.Sprintf("%d/%d Ready", g.ready, g.nodes), a.colors.GetNodeStatusColor(n.Status)
+			}
+			return string(n.Status), a.colors.GetNodeStatusColor(n.Status)
+		}},
+		{Name: "cpu", Header: "CPU", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			text := metrics.FormatCPU(n.CPU.Current)
+			if ctx.group != nil {
+				text += "/" + metrics.FormatCPU(n.CPU.Capacity) + " (" + metrics.FormatCPU(n.CPURequests) + " req)"
+			}
+			return text, a.colors.GetResourceColor(n.CPU.Percent, ctx.th.CPU)
+		}},
+		{Name: "cpu%", Header: "CPU%", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			return fmt.Sprintf("%.1f%%", n.CPU.Percent), a.colors.GetResourceColor(n.CPU.Percent, ctx.th.CPU)
+		}},
+		{Name: "memory", Header: "MEMORY", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			text := metrics.FormatMemory(n.Memory.Current)
+			if ctx.group != nil {
+				text += "/" + metrics.FormatMemory(n.Memory.Capacity) + " (" + metrics.FormatMemory(n.MemoryRequests) + " req)"
+			}
+			return text, a.colors.GetResourceColor(n.Memory.Percent, ctx.th.Memory)
+		}},
+		{Name: "mem%", Header: "MEM%", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			return fmt.Sprintf("%.1f%%", n.Memory.Percent), a.colors.GetResourceColor(n.Memory.Percent, ctx.th.Memory)
+		}},
+		{Name: "cpu-req%", Header: "CPU REQ%", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			if n.CPUAllocatable == 0 {
+				return "-", a.colors.TextDim
+			}
+			percent, _ := n.RequestPercents()
+			return fmt.Sprintf("%.1f%%", percent), a.colors.GetResourceColor(percent, ctx.th.CPU)
+		}},
+		{Name: "mem-req%", Header: "MEM REQ%", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			if n.MemoryAllocatable == 0 {
+				return "-", a.colors.TextDim
+			}
+			_, percent := n.RequestPercents()
+			return fmt.Sprintf("%.1f%%", percent), a.colors.GetResourceColor(percent, ctx.th.Memory)
+		}},
+		{Name: "pods", Header: "PODS", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			if n.PodCapacity == 0 {
+				return fmt.Sprintf("%d", n.PodCount), a.colors.Text
+			}
+			percent := float64(n.PodCount) / float64(n.PodCapacity) * 100
+			return fmt.Sprintf("%d/%d", n.PodCount, n.PodCapacity), a.colors.GetResourceColor(percent, ctx.th.Pods)
+		}},
+		{Name: "gpu", Header: "GPU", Align: tview.AlignRight, value: func(a *App, ctx rowContext, n *models.Node) (string, tcell.Color) {
+			if n.GPU == nil {
+				return "-", a.colors.Text
+			}
+			color := a.colors.Text
+			if n.GPU.Utilization > 0 {
+				color = a.colors.GetResourceColor(n.GPU.Utilization, ctx.th.GPU)
+			}
+			return fmt.Sprintf("%d", n.GPU.Count), color
+		}},
+		{Name: "age", Header: "AGE", Align: tview.AlignRight, value: func(a *App, _ rowContext, n *models.Node) (string, tcell.Color) {
+			return formatAge(n.CreatedAt), a.colors.TextDim
+		}},
+		{Name: "ip", Header: "IP", value: func(a *App, _ rowContext, n *models.Node) (string, tcell.Color) {
+			return n.InternalIP, a.colors.TextDim
+		}},
+		{Name: "version", Header: "VERSION", value: func(a *App, _ rowContext, n *models.Node) (string, tcell.Color) {
+			return n.Version, a.colors.TextDim
+		}},
+		{Name: "net-rx", Header: "NET RX", Align: tview.AlignRight, value: func(a *App, _ rowContext, n *models.Node) (string, tcell.Color) {
+			return formatOptional(n.NetworkRx, metrics.FormatRate), a.colors.Text
+		}},
+		{Name: "net-tx", Header: "NET TX", Align: tview.AlignRight, value: func(a *App, _ rowContext, n *models.Node) (string, tcell.Color) {
+			return formatOptional(n.NetworkTx, metrics.FormatRate), a.colors.Text
+		}},
+	},
+	dynamic: map[string]func(key string) tableColumn[models.Node]{
+		"label": func(key string) tableColumn[models.Node] {
+			return tableColumn[models.Node]{Header: labelHeader(key), value: func(a *App, _ rowContext, n *models.Node) (string, tcell.Color) {
+				return labelValue(n.Labels, key), a.colors.Text
+			}}
+		},
+	},
+	defaults: []string{"node", "status", "cpu", "cpu%", "memory", "mem%", "pods", "gpu"},
+}
+
+// podColumns is the catalog of pods table columns
+var podColumns = columnSet[models.Pod]{
+	columns: []tableColumn[models.Pod]{
+		{Name: "namespace", Header: "NAMESPACE", Width: 20, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return p.Namespace, a.colors.GetNamespaceColor(p.Namespace)
+		}},
+		{Name: "pod", Header: "POD", Width: 40, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return p.Name, a.colors.Text
+		}},
+		{Name: "status", Header: "STATUS", value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return string(p.Status), a.colors.GetPodStatusColor(p.Status)
+		}},
+		{Name: "cpu", Header: "CPU", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return metrics.FormatCPU(p.CPU), a.colors.Text
+		}},
+		{Name: "memory", Header: "MEMORY", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return metrics.FormatMemory(p.Memory), a.colors.Text
+		}},
+		{Name: "restarts", Header: "RESTARTS", Align: tview.AlignRight, value: func(a *App, ctx rowContext, p *models.Pod) (string, tcell.Color) {
+			return fmt.Sprintf("%d", p.RestartCount), a.colors.GetRestartColor(p.RestartCount, ctx.th.Restarts)
+		}},
+		{Name: "node", Header: "NODE", Width: 20, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return p.NodeName, a.colors.TextDim
+		}},
+		{Name: "age", Header: "AGE", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatAge(p.CreatedAt), a.colors.TextDim
+		}},
+		{Name: "ip", Header: "IP", value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return p.IP, a.colors.TextDim
+		}},
+		{Name: "qos", Header: "QOS", value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return p.QOSClass, a.colors.TextDim
+		}},
+		{Name: "containers", Header: "CONTAINERS", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return fmt.Sprintf("%d", p.ContainerCount), a.colors.Text
+		}},
+		{Name: "cpu-req", Header: "CPU REQ", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatOptional(p.CPURequest, metrics.FormatCPU), a.colors.Text
+		}},
+		{Name: "cpu-lim", Header: "CPU LIM", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatOptional(p.CPULimit, metrics.FormatCPU), a.colors.Text
+		}},
+		{Name: "mem-req", Header: "MEM REQ", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatOptional(p.MemoryRequest, metrics.FormatMemory), a.colors.Text
+		}},
+		{Name: "mem-lim", Header: "MEM LIM", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatOptional(p.MemoryLimit, metrics.FormatMemory), a.colors.Text
+		}},
+		{Name: "net-rx", Header: "NET RX", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatOptional(p.NetworkRx, metrics.FormatRate), a.colors.Text
+		}},
+		{Name: "net-tx", Header: "NET TX", Align: tview.AlignRight, value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+			return formatOptional(p.NetworkTx, metrics.FormatRate), a.colors.Text
+		}},
+		{Name: "throttled", Header: "THROTTLED", Align: tview.AlignRight, value: func(a *App, ctx rowContext, p *models.Pod) (string, tcell.Color) {
+			if p.CPUThrottled == 0 {
+				return "-", a.colors.TextDim
+			}
+			return fmt.Sprintf("%.1f%%", p.CPUThrottled), a.colors.GetResourceColor(p.CPUThrottled, ctx.th.CPU)
+		}},
+	},
+	dynamic: map[string]func(key string) tableColumn[models.Pod]{
+		"label": func(key string) tableColumn[models.Pod] {
+			return tableColumn[models.Pod]{Header: labelHeader(key), value: func(a *App, _ rowContext, p *models.Pod) (string, tcell.Color) {
+				return labelValue(p.Labels, key), a.colors.Text
+			}}
+		},
+		"node-label": func(key string) tableColumn[models.Pod] {
+			return tableColumn[models.Pod]{Header: labelHeader(key), value: func(a *App, ctx rowContext, _ *models.Pod) (string, tcell.Color) {
+				return labelValue(ctx.nodeLabels, key), a.colors.TextDim
+			}}
+		},
+	},
+	defaults: []string{"namespace", "pod", "status", "cpu", "memory", "restarts", "node"},
+}
+
+// formatOptional formats a resource value, showing "-" when unset
+func formatOptional(v int64, format func(int64) string) string {
+	if v == 0 {
+		return "-"
+	}
+	return format(v)
+}
+
+// formatAge formats the time since t like kubectl does (e.g. 5m, 3h, 12d)
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t)
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return formatDuration(d)
+}
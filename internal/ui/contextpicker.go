@@ -0,0 +1,284 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/metrics"
+)
+
+// contextPicker is a modal for switching the active cluster to another
+// kubeconfig context, with fuzzy search over the context list
+type contextPicker struct {
+	a      *App
+	input  *tview.InputField
+	table  *tview.Table
+	layout *tview.Flex
+
+	returnFocus tview.Primitive // focused when the picker closes
+
+	current  string            // context of the active cluster
+	contexts []k8s.ContextInfo // every context in the kubeconfig
+	matches  []k8s.ContextInfo // contexts matching the query, best first
+}
+
+// newContextPicker creates a picker listing the given contexts
+func newContextPicker(a *App, contexts []k8s.ContextInfo, current string) *contextPicker {
+	p := &contextPicker{
+		a:        a,
+		current:  current,
+		contexts: contexts,
+	}
+
+	p.input = tview.NewInputField().
+		SetLabel("Context: ").
+		SetFieldBackgroundColor(a.colors.Background).
+		SetFieldTextColor(a.colors.Text).
+		SetLabelColor(a.colors.Header)
+	p.input.SetBackgroundColor(a.colors.Background)
+	p.input.SetChangedFunc(func(string) { p.filter() })
+	p.input.SetInputCapture(p.handleKey)
+
+	p.table = tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	p.table.SetBorder(true).
+		SetTitle(" SWITCH CONTEXT ").
+		SetTitleColor(a.colors.Text).
+		SetBorderColor(a.colors.Border).
+		SetBackgroundColor(a.colors.Background)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText(fmt.Sprintf("type to search  %s select  %s switch  %s close",
+			ColoredText("↑/↓", a.colors.Header), ColoredText("Enter", a.colors.Header),
+			ColoredText("Esc", a.colors.Header)))
+	help.SetBackgroundColor(a.colors.Background)
+
+	p.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(p.input, 1, 0, true).
+		AddItem(p.table, 0, 1, false).
+		AddItem(help, 1, 0, false)
+
+	p.filter()
+	return p
+}
+
+// filter narrows the list to the contexts matching the query
+func (p *contextPicker) filter() {
+	query := p.input.GetText()
+
+	type scored struct {
+		info  k8s.ContextInfo
+		score int
+	}
+	var found []scored
+	for _, info := range p.contexts {
+		if score, ok := fuzzyMatch(query, info.Name); ok {
+			found = append(found, scored{info, score})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].score > found[j].score
+	})
+
+	p.matches = p.matches[:0]
+	for _, f := range found {
+		p.matches = append(p.matches, f.info)
+	}
+	p.render()
+}
+
+// render redraws the context list, selecting the best match
+func (p *contextPicker) render() {
+	colors := p.a.colors
+	p.table.Clear()
+	for i, h := range []string{"", "CONTEXT", "CLUSTER", "USER", "NAMESPACE"} {
+		p.table.SetCell(0, i, tview.NewTableCell(h).
+			SetTextColor(colors.Header).
+			SetSelectable(false))
+	}
+
+	if len(p.matches) == 0 {
+		p.table.SetCell(1, 1, tview.NewTableCell("No matching contexts").
+			SetTextColor(colors.TextDim).
+			SetSelectable(false))
+		return
+	}
+
+	for i, info := range p.matches {
+		row := i + 1
+		marker, color := "", colors.Text
+		if info.Name == p.current {
+			marker, color = "*", colors.Highlight
+		}
+		namespace := info.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		p.table.SetCell(row, 0, tview.NewTableCell(marker).SetTextColor(color))
+		p.table.SetCell(row, 1, tview.NewTableCell(truncate(info.Name, 40)).SetTextColor(color))
+		p.table.SetCell(row, 2, tview.NewTableCell(truncate(info.Cluster, 30)).SetTextColor(colors.TextDim))
+		p.table.SetCell(row, 3, tview.NewTableCell(truncate(info.User, 20)).SetTextColor(colors.TextDim))
+		p.table.SetCell(row, 4, tview.NewTableCell(namespace).SetTextColor(colors.TextDim))
+	}
+	p.table.Select(1, 0)
+}
+
+// handleKey moves the selection and acts on Enter/Esc; other keys edit
+// the query
+func (p *contextPicker) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	row, _ := p.table.GetSelection()
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		p.a.closeContextPicker()
+		return nil
+
+	case tcell.KeyEnter:
+		if row >= 1 && row <= len(p.matches) {
+			name := p.matches[row-1].Name
+			p.a.closeContextPicker()
+			if name != p.current {
+				p.a.switchContext(name)
+			}
+		}
+		return nil
+
+	case tcell.KeyUp:
+		if row > 1 {
+			p.table.Select(row-1, 0)
+		}
+		return nil
+
+	case tcell.KeyDown:
+		if row < len(p.matches) {
+			p.table.Select(row+1, 0)
+		}
+		return nil
+	}
+	return event
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in s in
+// order, ignoring case. Consecutive matches and matches at the start of a
+// word score higher, so "prd" ranks "prod-eu" above "pre-release-dev".
+func fuzzyMatch(pattern, s string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	pat := []rune(strings.ToLower(pattern))
+	text := []rune(strings.ToLower(s))
+
+	score, pi, prev := 0, 0, -2
+	for i, r := range text {
+		if pi == len(pat) {
+			break
+		}
+		if r != pat[pi] {
+			continue
+		}
+		switch {
+		case i == prev+1:
+			score += 3
+		case i == 0 || !unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]):
+			score += 2
+		default:
+			score++
+		}
+		prev = i
+		pi++
+	}
+	if pi < len(pat) {
+		return 0, false
+	}
+	// Prefer shorter names when scores tie
+	return score*100 - len(text), true
+}
+
+// openContextPicker shows the context picker for the active cluster
+func (a *App) openContextPicker() {
+	if a.config.Demo {
+		a.state.LastError = "context switching is not available in demo mode"
+		return
+	}
+
+	var contexts []k8s.ContextInfo
+	if client := a.active.client(); client != nil {
+		contexts = client.GetContextDetails()
+	}
+	if len(contexts) == 0 {
+		// In-cluster or failed clients have no kubeconfig loaded
+		var err error
+		contexts, err = k8s.ListContextDetails(a.config.KubeconfigPath)
+		if err != nil {
+			a.state.LastError = err.Error()
+			return
+		}
+	}
+	if len(contexts) == 0 {
+		a.state.LastError = "no kubeconfig contexts found"
+		return
+	}
+
+	a.contexts = newContextPicker(a, contexts, a.active.name())
+	a.contexts.returnFocus = a.app.GetFocus()
+	a.pages.AddPage("contexts", centered(a.contexts.layout, 100, 20), true, true)
+	a.app.SetFocus(a.contexts.input)
+}
+
+// closeContextPicker hides the context picker
+func (a *App) closeContextPicker() {
+	a.stateMu.Lock()
+	focus := a.contexts.returnFocus
+	a.contexts = nil
+	a.stateMu.Unlock()
+
+	a.pages.RemovePage("contexts")
+	a.app.SetFocus(focus)
+}
+
+// switchContext connects the active cluster to another kubeconfig context.
+// The client is built in the background so a slow credential plugin does
+// not freeze the UI; the previous connection stays in use if it fails.
+func (a *App) switchContext(name string) {
+	a.setError("connecting to " + name + "...")
+	active := a.active
+
+	go func() {
+		client, err := k8s.NewClientForContext(a.config, name)
+		a.app.QueueUpdateDraw(func() {
+			if err != nil {
+				a.setError(fmt.Sprintf("switch to %s: %v", name, err))
+				return
+			}
+			active.reconnect(name, metrics.NewCollector(client, a.config))
+
+			a.stateMu.Lock()
+			a.resetClusterState()
+			a.stateMu.Unlock()
+		})
+	}()
+}
+
+// resetClusterState clears the state that refers to the namespaces and
+// nodes of the previous cluster: the namespace filter, the node the pods
+// table is limited to and table filters with ns: or node: terms. Called
+// with stateMu held when another cluster is shown.
+func (a *App) resetClusterState() {
+	a.state.NamespaceFilter = ""
+	a.state.PodNode = ""
+	if f, _ := metrics.ParseFilter(a.state.NodeFilter, metrics.FilterKindNodes); f.ClusterScoped() {
+		a.state.NodeFilter = ""
+	}
+	if f, _ := metrics.ParseFilter(a.state.PodFilter, metrics.FilterKindPods); f.ClusterScoped() {
+		a.state.PodFilter = ""
+	}
+	a.state.LastError = ""
+}
@@ -0,0 +1,160 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/cost"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// costRow is one row of the cost view: a node, namespace, workload or
+// label value
+type costRow struct {
+	line  cost.Line
+	share float64 // percent of the cluster's hourly cost, -1 if unknown
+	idle  float64 // hourly cost of a node's idle capacity, -1 for others
+}
+
+// costKey identifies a cost row across refreshes
+func costKey(r *costRow) string {
+	return r.line.Name
+}
+
+// costColumns are the columns of the cost view
+var costColumns = []tableColumn[costRow]{
+	{Name: "name", Header: "NAME", Width: 56, value: func(a *App, _ rowContext, r *costRow) (string, tcell.Color) {
+		return r.line.Name, a.colors.Text
+	}},
+	{Name: "hourly", Header: "PER HOUR", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *costRow) (string, tcell.Color) {
+		return cost.Format(a.config.Pricing.Currency, r.line.Hourly), a.colors.Text
+	}},
+	{Name: "monthly", Header: "PER MONTH", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *costRow) (string, tcell.Color) {
+		return cost.Format(a.config.Pricing.Currency, r.line.Hourly*cost.HoursPerMonth), a.colors.TextDim
+	}},
+	{Name: "session", Header: "SESSION", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *costRow) (string, tcell.Color) {
+		return cost.Format(a.config.Pricing.Currency, r.line.Session), a.colors.Text
+	}},
+	{Name: "share", Header: "SHARE", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *costRow) (string, tcell.Color) {
+		return formatShare(r.share), a.colors.Text
+	}},
+	{Name: "idle", Header: "IDLE/HOUR", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *costRow) (string, tcell.Color) {
+		if r.idle < 0 {
+			return "", a.colors.TextDim
+		}
+		return cost.Format(a.config.Pricing.Currency, r.idle), a.colors.Warning
+	}},
+}
+
+// nextCostGroup returns the grouping of the cost view after g, skipping
+// the label when none is configured
+func (a *App) nextCostGroup(g models.CostGroup) models.CostGroup {
+	g = (g + 1) % (models.CostByNode + 1)
+	if g == models.CostByLabel && a.config.Pricing.GroupLabel == "" {
+		g++
+	}
+	return g
+}
+
+// costGroupName names a cost grouping in titles, the label for
+// CostByLabel
+func (a *App) costGroupName(g models.CostGroup) string {
+	if g == models.CostByLabel {
+		return a.config.Pricing.GroupLabel
+	}
+	return g.String()
+}
+
+// updateCostTable shows the costs of the latest collection, summed up by
+// the chosen grouping, when the metrics or the state changed since it was
+// last updated. Costs cover every pod, regardless of the pod filters.
+func (a *App) updateCostTable(m *models.ClusterMetrics, state models.AppState) {
+	if state.ViewMode != models.ViewModeCost {
+		return
+	}
+	defer a.updateCostInfo(state)
+	if !a.costRows.changed(m, state) {
+		return
+	}
+
+	a.costTable.SetTitle(fmt.Sprintf(" COST BY %s (pods charged for %s) ",
+		strings.ToUpper(a.costGroupName(state.CostGroup)), state.CostBasis))
+	a.costReport = a.active.costs.Report(state.CostBasis)
+	r := a.costReport
+	if m == nil || r == nil {
+		a.costRows.setNotice(true, "Waiting for metrics...")
+		return
+	}
+
+	share := func(hourly float64) float64 {
+		if r.Cluster.Hourly == 0 {
+			return -1
+		}
+		return hourly / r.Cluster.Hourly * 100
+	}
+	var rows []costRow
+	add := func(lines []cost.Line) {
+		for _, l := range lines {
+			rows = append(rows, costRow{line: l, share: share(l.Hourly), idle: -1})
+		}
+	}
+	switch state.CostGroup {
+	case models.CostByNamespace:
+		add(r.Namespaces)
+	case models.CostByWorkload:
+		add(r.Workloads)
+	case models.CostByLabel:
+		add(r.Groups)
+	case models.CostByNode:
+		for _, n := range r.Nodes {
+			row := costRow{line: n.Line, share: share(n.Hourly), idle: n.Idle()}
+			if n.InstanceType != "" {
+				row.line.Name += " (" + n.InstanceType + ")"
+			}
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		a.costRows.setNotice(true, "Nothing to charge")
+		return
+	}
+	a.costRows.setItems(rows, func(*costRow) rowContext {
+		return rowContext{th: a.config.Thresholds}
+	})
+}
+
+// updateCostInfo shows the cluster's totals and how to change the view
+func (a *App) updateCostInfo(state models.AppState) {
+	r := a.costReport
+	if r == nil {
+		a.costInfo.SetText("")
+		return
+	}
+
+	currency := a.config.Pricing.Currency
+	text, dim := ColorTag(a.colors.Text), ColorTag(a.colors.TextDim)
+	percent := func(hourly float64) string {
+		if r.Cluster.Hourly == 0 {
+			return ""
+		}
+		return fmt.Sprintf(" (%.0f%%)", hourly/r.Cluster.Hourly*100)
+	}
+	info := fmt.Sprintf("%sCluster:[-] %s%s/h, %s/month[-]   %sAllocated:[-] %s%s/h%s[-]   %sIdle:[-] %s%s/h%s[-]   %sSession %s:[-] %s%s[-]\n",
+		dim, text, cost.Format(currency, r.Cluster.Hourly), cost.Format(currency, r.Cluster.Hourly*cost.HoursPerMonth),
+		dim, text, cost.Format(currency, r.Allocated.Hourly), percent(r.Allocated.Hourly),
+		dim, ColorTag(a.colors.Warning), cost.Format(currency, r.Idle.Hourly), percent(r.Idle.Hourly),
+		dim, r.Session, text, cost.Format(currency, r.Cluster.Session))
+
+	other := "usage"
+	if state.CostBasis == "usage" {
+		other = "requests"
+	}
+	header := ColorTag(a.colors.Header)
+	info += fmt.Sprintf("%s%s[-] charge pods for %s   %s%s[-] sum up by %s",
+		header, a.keys.label("cost-basis"), other,
+		header, a.keys.label("group"), strings.ToLower(a.costGroupName(a.nextCostGroup(state.CostGroup))))
+	a.costInfo.SetText(info)
+}
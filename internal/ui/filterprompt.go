@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/metrics"
+)
+
+// filterPrompt replaces the footer while a filter expression for the
+// focused table is typed. The table follows the expression as it is
+// typed, as long as it parses; otherwise the error is shown next to it.
+type filterPrompt struct {
+	a      *App
+	input  *tview.InputField
+	errors *tview.TextView
+	layout *tview.Flex
+
+	open        bool               // shown instead of the footer
+	kind        metrics.FilterKind // table the expression applies to
+	returnFocus tview.Primitive    // focused when the prompt closes
+}
+
+// newFilterPrompt creates the prompt, hidden until opened
+func newFilterPrompt(a *App) *filterPrompt {
+	p := &filterPrompt{a: a}
+
+	p.input = tview.NewInputField().SetLabel("/")
+	p.input.SetChangedFunc(p.changed)
+	p.input.SetDoneFunc(p.done)
+	p.errors = tview.NewTextView()
+
+	p.layout = tview.NewFlex().
+		AddItem(p.input, 0, 1, true).
+		AddItem(p.errors, 0, 1, false)
+	return p
+}
+
+// openFilterPrompt shows the filter prompt for the focused table. It runs
+// with stateMu held.
+func (a *App) openFilterPrompt() {
+	p := a.prompt
+	p.kind, p.returnFocus = metrics.FilterKindNodes, a.app.GetFocus()
+	expr := a.state.NodeFilter
+	if a.podsTable.HasFocus() {
+		p.kind, expr = metrics.FilterKindPods, a.state.PodFilter
+	}
+
+	p.input.SetText(expr).
+		SetFieldBackgroundColor(a.colors.Background).
+		SetFieldTextColor(a.colors.Text).
+		SetLabelColor(a.colors.Header).
+		SetBackgroundColor(a.colors.Background)
+	p.errors.SetText("").
+		SetTextColor(a.colors.Critical).
+		SetBackgroundColor(a.colors.Background)
+	p.open = true
+
+	a.mainFlex.RemoveItem(a.footer)
+	a.mainFlex.AddItem(p.layout, 1, 0, true)
+	a.app.SetFocus(p.input)
+}
+
+// changed applies the expression to the table when it parses
+func (p *filterPrompt) changed(expr string) {
+	if !p.open {
+		return
+	}
+	if _, err := metrics.ParseFilter(expr, p.kind); err != nil {
+		p.errors.SetText(err.Error())
+		p.input.SetFieldTextColor(p.a.colors.Critical)
+		return
+	}
+	p.errors.SetText("")
+	p.input.SetFieldTextColor(p.a.colors.Text)
+	p.set(expr)
+	p.a.updateUI()
+}
+
+// done closes the prompt; Enter keeps the last valid filter, Esc clears it
+func (p *filterPrompt) done(key tcell.Key) {
+	if key == tcell.KeyEscape {
+		p.set("")
+	}
+
+	a := p.a
+	a.stateMu.Lock()
+	p.open = false
+	a.stateMu.Unlock()
+	a.mainFlex.RemoveItem(p.layout)
+	a.mainFlex.AddItem(a.footer, 1, 0, false)
+	a.app.SetFocus(p.returnFocus)
+	a.updateUI()
+}
+
+// set stores the filter expression of the prompt's table
+func (p *filterPrompt) set(expr string) {
+	p.a.stateMu.Lock()
+	defer p.a.stateMu.Unlock()
+	if p.kind == metrics.FilterKindPods {
+		p.a.state.PodFilter = expr
+	} else {
+		p.a.state.NodeFilter = expr
+	}
+}
@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// NewFleetApp creates a TUI application monitoring several clusters at
+// once, starting in the fleet view
+func NewFleetApp(clusters []Cluster, cfg *config.Config) (*App, error) {
+	a, err := newApp(clusters, cfg)
+	if err != nil {
+		return nil, err
+	}
+	a.state.FleetView = true
+	a.pages.SwitchToPage("fleet")
+	return a, nil
+}
+
+// setupFleetUI creates the fleet view, which shares the header and footer
+// with the cluster view
+func (a *App) setupFleetUI() {
+	a.fleetTable = tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	a.fleetTable.SetBorder(true).
+		SetTitle(" CLUSTERS ").
+		SetTitleAlign(tview.AlignLeft)
+	a.fleetTable.SetSelectedFunc(func(row, _ int) {
+		if row >= 1 && row <= len(a.clusters) {
+			a.openCluster(a.clusters[row-1])
+		}
+	})
+
+	a.fleetFlex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(a.header, 1, 0, false).
+		AddItem(a.fleetTable, 0, 1, true).
+		AddItem(a.footer, 1, 0, false)
+}
+
+// openCluster switches from the fleet view to the cluster view of c
+func (a *App) openCluster(c *cluster) {
+	a.stateMu.Lock()
+	a.active = c
+	a.state.FleetView = false
+	a.resetClusterState()
+	a.stateMu.Unlock()
+
+	a.pages.SwitchToPage("main")
+	a.app.SetFocus(a.nodesTable)
+	a.updateUI()
+}
+
+// showFleet switches back to the fleet view. Called with stateMu held.
+func (a *App) showFleet() {
+	a.state.FleetView = true
+	a.pages.SwitchToPage("fleet")
+	a.app.SetFocus(a.fleetTable)
+}
+
+// updateFleetHeader updates the header for the fleet view
+func (a *App) updateFleetHeader(state models.AppState) {
+	healthy := 0
+	for _, c := range a.clusters {
+		if m, err, _, _ := c.snapshot(); m != nil && err == nil {
+			healthy++
+		}
+	}
+
+	text := ColorTag(a.colors.Text)
+	header := fmt.Sprintf("%sktop[-] - %sfleet[-]   Clusters: %s%d[-]   Healthy: %s",
+		ColorTag(a.colors.Header), text, text, len(a.clusters),
+		ColoredText(fmt.Sprintf("%d/%d", healthy, len(a.clusters)), a.fleetHealthColor(healthy)))
+	if state.LastError != "" {
+		header += "  " + ColoredText("⚠ "+state.LastError, a.colors.Warning)
+	}
+	a.header.SetText(header)
+}
+
+// fleetHealthColor colors the healthy cluster count
+func (a *App) fleetHealthColor(healthy int) tcell.Color {
+	switch {
+	case healthy == len(a.clusters):
+		return a.colors.StatusOK
+	case healthy == 0:
+		return a.colors.StatusBad
+	default:
+		return a.colors.Warning
+	}
+}
+
+// updateFleetTable updates the per-cluster summary table
+func (a *App) updateFleetTable() {
+	a.fleetTable.Clear()
+
+	headers := []string{"CONTEXT", "CLUSTER", "NODES", "CPU%", "MEM%", "PODS", "FAILING", "PENDING", "LATENCY", "UPDATED", "HEALTH"}
+	for i, h := range headers {
+		cell := tview.NewTableCell(h).
+			SetTextColor(a.colors.Header).
+			SetSelectable(false)
+		if i >= 2 && i <= 9 {
+			cell.SetAlign(tview.AlignRight)
+		}
+		a.fleetTable.SetCell(0, i, cell)
+	}
+
+	th := a.config.Thresholds
+	for i, c := range a.clusters {
+		row := i + 1
+		m, lastErr, lastSuccess, latency := c.snapshot()
+
+		a.fleetTable.SetCell(row, 0, tview.NewTableCell(c.name()).SetTextColor(a.colors.Text))
+
+		if m == nil {
+			status, color := "connecting...", a.colors.TextDim
+			if lastErr != nil {
+				status, color = lastErr.Error(), a.colors.StatusBad
+			}
+			for col := 1; col < len(headers)-1; col++ {
+				a.fleetTable.SetCell(row, col, tview.NewTableCell("-").
+					SetTextColor(a.colors.TextDim).SetAlign(tview.AlignRight))
+			}
+			a.fleetTable.SetCell(row, len(headers)-1, tview.NewTableCell(status).SetTextColor(color))
+			continue
+		}
+
+		cpuPercent := safePercent(m.TotalCPUUsed, m.TotalCPUCapacity)
+		memPercent := safePercent(m.TotalMemoryUsed, m.TotalMemoryCapacity)
+		failing, pending := 0, 0
+		for i := range m.Pods {
+			switch {
+			case m.Pods[i].Failing():
+				failing++
+			case m.Pods[i].Status == models.PodStatusPending:
+				pending++
+			}
+		}
+
+		nodes, nodesColor := fmt.Sprintf("%d/%d", m.ReadyNodes, m.TotalNodes), a.colors.StatusOK
+		if m.NodesForbidden {
+			nodes, nodesColor = "-", a.colors.TextDim
+		} else if m.ReadyNodes < m.TotalNodes {
+			nodesColor = a.colors.StatusBad
+		}
+		failingColor := a.colors.Text
+		if failing > 0 {
+			failingColor = a.colors.Critical
+		}
+		pendingColor := a.colors.Text
+		if pending > 0 {
+			pendingColor = a.colors.Warning
+		}
+
+		health, healthColor := "ok", a.colors.StatusOK
+		if lastErr != nil {
+			health, healthColor = lastErr.Error(), a.colors.StatusBad
+		} else if degraded := m.Degraded(); len(degraded) > 0 {
+			health, healthColor = fmt.Sprintf("%s %s", degraded[0].Name, degraded[0].State), a.colors.Warning
+			if degraded[0].Err != nil {
+				health += ": " + degraded[0].Err.Error()
+			}
+		}
+		updated := "-"
+		if !lastSuccess.IsZero() {
+			updated = formatDuration(time.Since(lastSuccess)) + " ago"
+		}
+
+		cells := []struct {
+			text  string
+			color tcell.Color
+		}{
+			{m.ClusterInfo.Name, a.colors.TextDim},
+			{nodes, nodesColor},
+			{fmt.Sprintf("%.1f%%", cpuPercent), a.colors.GetResourceColor(cpuPercent, th.CPU)},
+			{fmt.Sprintf("%.1f%%", memPercent), a.colors.GetResourceColor(memPercent, th.Memory)},
+			{fmt.Sprintf("%d", m.TotalPods), a.colors.Text},
+			{fmt.Sprintf("%d", failing), failingColor},
+			{fmt.Sprintf("%d", pending), pendingColor},
+			{latency.Round(time.Millisecond).String(), a.colors.TextDim},
+			{updated, a.colors.TextDim},
+			{health, healthColor},
+		}
+		for j, cell := range cells {
+			col := j + 1
+			tc := tview.NewTableCell(truncate(cell.text, 40)).SetTextColor(cell.color)
+			if col >= 2 && col <= 9 {
+				tc.SetAlign(tview.AlignRight)
+			}
+			a.fleetTable.SetCell(row, col, tc)
+		}
+	}
+}
+
+// safePercent returns used/capacity as a percentage, 0 without capacity
+func safePercent(used, capacity int64) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(used) / float64(capacity) * 100
+}
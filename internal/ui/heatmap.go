@@ -0,0 +1,501 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// heatCellWidth is the width of a cell: two block characters between
+// the brackets that mark the selected node
+const heatCellWidth = 4
+
+// noGroup names the group of the nodes without the grouping label
+const noGroup = "(none)"
+
+// heatCell is one node of the heatmap
+type heatCell struct {
+	node    *models.Node
+	percent float64 // value of the metric; -1 when it is unknown
+	color   tcell.Color
+	glyph   string
+
+	x, y int // position in the content, set by layout
+}
+
+// heatGroup is the nodes sharing a value of the grouping label
+type heatGroup struct {
+	name  string
+	cells []heatCell
+
+	y int // line of the group header, set by layout
+}
+
+// heatmap draws each node as a colored cell, one block of cells per
+// group. The selected node is bracketed; the arrow keys, clicks and the
+// mouse pointer move the selection.
+type heatmap struct {
+	*tview.Box
+	a *App
+
+	groups   []heatGroup
+	notice   string // shown instead of the cells when there are none
+	selected string // name of the selected node
+	offset   int    // first content line shown
+
+	changed func()            // called when the selection moves
+	done    func(node string) // called for Enter on a cell
+}
+
+// newHeatmap creates an empty heatmap
+func newHeatmap(a *App) *heatmap {
+	return &heatmap{Box: tview.NewBox(), a: a}
+}
+
+// setGroups replaces the cells, keeping the selected node if it is still
+// shown
+func (h *heatmap) setGroups(groups []heatGroup, notice string) {
+	h.groups, h.notice = groups, notice
+	if h.cell(h.selected) == nil {
+		h.selected = ""
+		if len(groups) > 0 {
+			h.selected = groups[0].cells[0].node.Name
+		}
+	}
+}
+
+// cell returns the cell of a node, or nil
+func (h *heatmap) cell(name string) *heatCell {
+	for i := range h.groups {
+		for j := range h.groups[i].cells {
+			if c := &h.groups[i].cells[j]; c.node.Name == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// selectedNode returns the selected node, or nil
+func (h *heatmap) selectedNode() *models.Node {
+	if c := h.cell(h.selected); c != nil {
+		return c.node
+	}
+	return nil
+}
+
+// selectCell selects a cell and reports the change
+func (h *heatmap) selectCell(c *heatCell) {
+	if c == nil || c.node.Name == h.selected {
+		return
+	}
+	h.selected = c.node.Name
+	if h.changed != nil {
+		h.changed()
+	}
+}
+
+// layout places the group headers and cells for a width and returns the
+// number of content lines. Groups are separated by a blank line.
+func (h *heatmap) layout(width int) int {
+	perLine := max(1, width/heatCellWidth)
+	y := 0
+	for i := range h.groups {
+		g := &h.groups[i]
+		if i > 0 {
+			y++
+		}
+		g.y = y
+		for j := range g.cells {
+			g.cells[j].x = j % perLine * heatCellWidth
+			g.cells[j].y = y + 1 + j/perLine
+		}
+		y += 2 + (len(g.cells)-1)/perLine
+	}
+	return y
+}
+
+// scrollTo adjusts the offset so the selected cell is shown, along with
+// its group header when the cell is on the group's first line
+func (h *heatmap) scrollTo(lines, height int) {
+	for _, g := range h.groups {
+		for _, c := range g.cells {
+			if c.node.Name != h.selected {
+				continue
+			}
+			top := c.y
+			if c.y == g.y+1 {
+				top = g.y
+			}
+			if top < h.offset {
+				h.offset = top
+			}
+			if c.y >= h.offset+height {
+				h.offset = c.y - height + 1
+			}
+		}
+	}
+	h.offset = max(0, min(h.offset, lines-height))
+}
+
+// Draw draws the group headers and the cells that fit in the box
+func (h *heatmap) Draw(screen tcell.Screen) {
+	h.Box.DrawForSubclass(screen, h)
+	x, y, width, height := h.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+	colors := h.a.colors
+	if len(h.groups) == 0 {
+		tview.Print(screen, tview.Escape(h.notice), x, y, width, tview.AlignLeft, colors.TextDim)
+		return
+	}
+
+	h.scrollTo(h.layout(width), height)
+	visible := func(line int) bool {
+		return line >= h.offset && line < h.offset+height
+	}
+	for _, g := range h.groups {
+		if visible(g.y) {
+			tview.Print(screen, tview.Escape(h.groupHeader(&g)), x, y+g.y-h.offset, width, tview.AlignLeft, colors.Header)
+		}
+		for _, c := range g.cells {
+			if !visible(c.y) {
+				continue
+			}
+			cx, cy := x+c.x, y+c.y-h.offset
+			if c.node.Name == h.selected {
+				tview.Print(screen, "[", cx, cy, 1, tview.AlignLeft, colors.Text)
+				tview.Print(screen, "]", cx+3, cy, 1, tview.AlignLeft, colors.Text)
+			}
+			tview.Print(screen, c.glyph, cx+1, cy, 2, tview.AlignLeft, c.color)
+		}
+	}
+}
+
+// groupHeader describes a group: its name, size and average of the metric
+func (h *heatmap) groupHeader(g *heatGroup) string {
+	var sum float64
+	known := 0
+	for _, c := range g.cells {
+		if c.percent >= 0 {
+			sum += c.percent
+			known++
+		}
+	}
+	header := g.name + "  " + plural(len(g.cells), "node")
+	if known > 0 {
+		header += fmt.Sprintf("  avg %.1f%%", sum/float64(known))
+	}
+	return header
+}
+
+// move selects the nearest cell in a direction: the previous or next cell
+// for dx, or the closest cell on the line above or below for dy
+func (h *heatmap) move(dx, dy int) {
+	var cells []*heatCell
+	for i := range h.groups {
+		for j := range h.groups[i].cells {
+			cells = append(cells, &h.groups[i].cells[j])
+		}
+	}
+	current := slices.IndexFunc(cells, func(c *heatCell) bool { return c.node.Name == h.selected })
+	if current < 0 {
+		return
+	}
+	if dx != 0 {
+		if next := current + dx; next >= 0 && next < len(cells) {
+			h.selectCell(cells[next])
+		}
+		return
+	}
+
+	from := cells[current]
+	var best *heatCell
+	for _, c := range cells {
+		if (c.y-from.y)*dy <= 0 {
+			continue
+		}
+		if best == nil || abs(c.y-from.y) < abs(best.y-from.y) ||
+			(c.y == best.y && abs(c.x-from.x) < abs(best.x-from.x)) {
+			best = c
+		}
+	}
+	h.selectCell(best)
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// InputHandler moves the selection with the arrow keys; Enter reports
+// the selected node
+func (h *heatmap) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+	return h.WrapInputHandler(func(event *tcell.EventKey, _ func(p tview.Primitive)) {
+		_, _, width, _ := h.GetInnerRect()
+		h.layout(width)
+		switch event.Key() {
+		case tcell.KeyLeft:
+			h.move(-1, 0)
+		case tcell.KeyRight:
+			h.move(1, 0)
+		case tcell.KeyUp:
+			h.move(0, -1)
+		case tcell.KeyDown:
+			h.move(0, 1)
+		case tcell.KeyEnter:
+			if h.selected != "" && h.done != nil {
+				h.done(h.selected)
+			}
+		}
+	})
+}
+
+// MouseHandler selects the cell under the pointer when it moves or
+// clicks, and scrolls with the wheel
+func (h *heatmap) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+	return h.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		mx, my := event.Position()
+		if !h.InRect(mx, my) {
+			return false, nil
+		}
+		x, y, width, _ := h.GetInnerRect()
+		h.layout(width)
+		at := func() *heatCell {
+			for i := range h.groups {
+				for j := range h.groups[i].cells {
+					c := &h.groups[i].cells[j]
+					if my == y+c.y-h.offset && mx >= x+c.x && mx < x+c.x+heatCellWidth {
+						return c
+					}
+				}
+			}
+			return nil
+		}
+
+		switch action {
+		case tview.MouseMove:
+			h.selectCell(at())
+		case tview.MouseLeftClick:
+			setFocus(h)
+			h.selectCell(at())
+		case tview.MouseLeftDoubleClick:
+			if c := at(); c != nil && h.done != nil {
+				h.done(c.node.Name)
+			}
+		case tview.MouseScrollUp:
+			h.offset = max(0, h.offset-1)
+		case tview.MouseScrollDown:
+			h.offset++
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// heatValue returns the metric of a node as a percentage along with the
+// threshold that colors it. The percentage is -1 when it is unknown.
+// Requests use the higher of the CPU and memory requests.
+func heatValue(n *models.Node, metric models.HeatMetric, th config.Thresholds, usage bool) (float64, config.ThresholdConfig) {
+	switch metric {
+	case models.HeatMemory:
+		if !usage || n.Memory.Capacity == 0 {
+			return -1, th.Memory
+		}
+		return n.Memory.Percent, th.Memory
+	case models.HeatRequests:
+		if n.CPUAllocatable == 0 && n.MemoryAllocatable == 0 {
+			return -1, th.CPU
+		}
+		cpu, memory := n.RequestPercents()
+		if memory > cpu {
+			return memory, th.Memory
+		}
+		return cpu, th.CPU
+	case models.HeatPods:
+		if n.PodCapacity == 0 {
+			return -1, th.Pods
+		}
+		return float64(n.PodCount) / float64(n.PodCapacity) * 100, th.Pods
+	}
+	if !usage || n.CPU.Capacity == 0 {
+		return -1, th.CPU
+	}
+	return n.CPU.Percent, th.CPU
+}
+
+// heatGroups groups the nodes by the value of a label, in order of the
+// value with the nodes without it last. Within a group the nodes are
+// ordered by the metric, highest first. Cells are colored by the node's
+// thresholds; nodes that are not ready are crossed out.
+func (a *App) heatGroups(nodes []models.Node, label string, metric models.HeatMetric, usage bool) []heatGroup {
+	byName := make(map[string]*heatGroup)
+	var groups []*heatGroup
+	for i := range nodes {
+		n := &nodes[i]
+		name := "all nodes"
+		if label != "" {
+			name = noGroup
+			if v, ok := n.Labels[label]; ok {
+				name = v
+			}
+		}
+		g := byName[name]
+		if g == nil {
+			g = &heatGroup{name: name}
+			byName[name] = g
+			groups = append(groups, g)
+		}
+
+		percent, tc := heatValue(n, metric, a.config.Thresholds.ForLabels(n.Labels), usage)
+		cell := heatCell{node: n, percent: percent, glyph: "██", color: a.colors.GetResourceColor(percent, tc)}
+		switch {
+		case n.Status != models.NodeStatusReady:
+			cell.glyph, cell.color = "××", a.colors.StatusBad
+		case percent < 0:
+			cell.glyph, cell.color = "░░", a.colors.TextDim
+		}
+		g.cells = append(g.cells, cell)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if (groups[i].name == noGroup) != (groups[j].name == noGroup) {
+			return groups[j].name == noGroup
+		}
+		return groups[i].name < groups[j].name
+	})
+	result := make([]heatGroup, len(groups))
+	for i, g := range groups {
+		sort.SliceStable(g.cells, func(i, j int) bool {
+			if g.cells[i].percent != g.cells[j].percent {
+				return g.cells[i].percent > g.cells[j].percent
+			}
+			return g.cells[i].node.Name < g.cells[j].node.Name
+		})
+		result[i] = *g
+	}
+	return result
+}
+
+// nodeGroupLabels returns the candidate labels that are set on some node
+func nodeGroupLabels(m *models.ClusterMetrics, candidates []string) []string {
+	if m == nil {
+		return nil
+	}
+	var result []string
+	for _, label := range candidates {
+		for _, n := range m.Nodes {
+			if _, ok := n.Labels[label]; ok {
+				result = append(result, label)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// cycleNodeGroup groups the nodes table and the heatmap by the next label
+// that is set on some node, then by none
+func (a *App) cycleNodeGroup() {
+	labels := nodeGroupLabels(a.active.latest(), a.config.GroupLabels)
+	next := slices.Index(labels, a.state.NodeGroup) + 1
+	if next < len(labels) {
+		a.state.NodeGroup = labels[next]
+	} else {
+		a.state.NodeGroup = ""
+	}
+}
+
+// updateHeatmap redraws the heatmap from the latest metrics. Nodes are
+// filtered like in the nodes table.
+func (a *App) updateHeatmap(m *models.ClusterMetrics, state models.AppState) {
+	if state.ViewMode != models.ViewModeHeatmap {
+		return
+	}
+
+	title := " HEATMAP (" + state.HeatMetric.String()
+	if state.NodeGroup != "" {
+		title += " by " + state.NodeGroup
+	}
+	a.heat.SetTitle(title + ") " + filterTitle(state.NodeFilter))
+
+	switch {
+	case m == nil || len(m.Nodes) == 0 && !m.NodesForbidden:
+		a.heat.setGroups(nil, "No nodes found")
+	case m.NodesForbidden:
+		a.heat.setGroups(nil, "Your account is not allowed to list nodes.")
+	default:
+		filter, _ := metrics.ParseFilter(state.NodeFilter, metrics.FilterKindNodes)
+		nodes := make([]models.Node, len(m.Nodes))
+		copy(nodes, m.Nodes)
+		nodes = filter.Nodes(nodes)
+		a.heat.setGroups(a.heatGroups(nodes, state.NodeGroup, state.HeatMetric, !m.MetricsUnavailable),
+			"No nodes match the filter")
+	}
+	a.updateHeatDetails()
+}
+
+// updateHeatDetails shows the selected node of the heatmap next to it
+func (a *App) updateHeatDetails() {
+	n := a.heat.selectedNode()
+	if n == nil {
+		a.heatInfo.SetText("")
+		return
+	}
+	th := a.config.Thresholds.ForLabels(n.Labels)
+	text, dim := a.colors.Text, a.colors.TextDim
+	field := func(name, value string) string {
+		return ColoredText(fmt.Sprintf("%-10s", name), dim) + value + "\n"
+	}
+	usage := func(used, capacity int64, percent float64, tc config.ThresholdConfig, format func(int64) string) string {
+		if capacity == 0 {
+			return ColoredText("-", dim)
+		}
+		return fmt.Sprintf("%s / %s  %s", format(used), format(capacity),
+			ColoredText(metrics.FormatPercent(percent), a.colors.GetResourceColor(percent, tc)))
+	}
+
+	var b strings.Builder
+	b.WriteString(ColoredText(tview.Escape(n.Name), a.colors.Highlight) + "\n\n")
+	b.WriteString(field("Status", ColoredText(string(n.Status), a.colors.GetNodeStatusColor(n.Status))))
+	b.WriteString(field("CPU", usage(n.CPU.Current, n.CPU.Capacity, n.CPU.Percent, th.CPU, metrics.FormatCPU)))
+	b.WriteString(field("Memory", usage(n.Memory.Current, n.Memory.Capacity, n.Memory.Percent, th.Memory, metrics.FormatMemory)))
+	cpuReq, memReq := n.RequestPercents()
+	b.WriteString(field("CPU req", usage(n.CPURequests, n.CPUAllocatable, cpuReq, th.CPU, metrics.FormatCPU)))
+	b.WriteString(field("Mem req", usage(n.MemoryRequests, n.MemoryAllocatable, memReq, th.Memory, metrics.FormatMemory)))
+	pods := fmt.Sprintf("%d", n.PodCount)
+	if n.PodCapacity > 0 {
+		percent := float64(n.PodCount) / float64(n.PodCapacity) * 100
+		pods = ColoredText(fmt.Sprintf("%d / %d", n.PodCount, n.PodCapacity), a.colors.GetResourceColor(percent, th.Pods))
+	}
+	b.WriteString(field("Pods", pods))
+	if n.GPU != nil && n.GPU.Count > 0 {
+		b.WriteString(field("GPUs", fmt.Sprintf("%d", n.GPU.Count)))
+	}
+
+	// The labels the heatmap can group by
+	b.WriteString("\n")
+	for _, label := range a.config.GroupLabels {
+		if v, ok := n.Labels[label]; ok {
+			b.WriteString(ColoredText(strings.ToLower(labelHeader(label))+":", dim) + " " + ColoredText(tview.Escape(v), text) + "\n")
+		}
+	}
+
+	b.WriteString("\n" + ColoredText("██", a.colors.Healthy) + " ok  " + ColoredText("██", a.colors.Warning) + " warning  " +
+		ColoredText("██", a.colors.Critical) + " critical\n" +
+		ColoredText("××", a.colors.StatusBad) + " not ready  " + ColoredText("░░", dim) + " no data\n")
+	a.heatInfo.SetText(b.String())
+}
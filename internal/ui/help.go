@@ -0,0 +1,41 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// helpView is the help screen: a bordered text sized to fit its lines,
+// centered on the screen and scrollable when the screen is too small
+type helpView struct {
+	*tview.TextView
+	width, height int
+}
+
+// newHelpView creates the help screen for a text
+func newHelpView(text string) *helpView {
+	h := &helpView{TextView: tview.NewTextView().SetDynamicColors(true)}
+	h.SetText(text)
+	h.SetBorder(true).
+		SetTitle(" HELP ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderPadding(0, 0, 1, 1)
+
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		h.width = max(h.width, tview.TaggedStringWidth(line))
+	}
+	h.width += 4 // border and padding
+	h.height = len(lines) + 2
+	return h
+}
+
+// Draw centers the help screen, shrinking it to fit small screens
+func (h *helpView) Draw(screen tcell.Screen) {
+	screenWidth, screenHeight := screen.Size()
+	width, height := min(h.width, screenWidth), min(h.height, screenHeight)
+	h.SetRect((screenWidth-width)/2, (screenHeight-height)/2, width, height)
+	h.TextView.Draw(screen)
+}
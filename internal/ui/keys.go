@@ -0,0 +1,395 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// action is a named command that can be bound to one or more keys
+type action struct {
+	Name        string   // identifier used in the config file
+	Description string   // shown in the help screen
+	Footer      string   // short label for the footer, empty to omit
+	Keys        []string // default key bindings
+	Fleet       bool     // also available in the fleet view
+
+	// handler runs with stateMu held and reports whether the key was consumed
+	handler func(a *App) bool
+}
+
+// actions is the registry of every remappable command, in help order
+var actions = []*action{
+	{
+		Name: "quit", Description: "Quit", Footer: "quit",
+		Keys: []string{"q", "Q"}, Fleet: true,
+		handler: func(a *App) bool {
+			a.cancel()
+			a.app.Stop()
+			return true
+		},
+	},
+	{
+		Name: "refresh", Description: "Force refresh", Footer: "refresh",
+		Keys: []string{"r", "R"}, Fleet: true,
+		handler: func(a *App) bool {
+			if a.state.FleetView {
+				for _, c := range a.clusters {
+					c.refresh()
+				}
+				return true
+			}
+			a.active.refresh()
+			return true
+		},
+	},
+	{
+		Name: "sort-nodes", Description: "Sort nodes (cycle: name → CPU → memory → status → pods)", Footer: "sort nodes",
+		Keys: []string{"s", "S"},
+		handler: func(a *App) bool {
+			a.cycleNodeSort()
+			return true
+		},
+	},
+	{
+		Name: "sort-pods", Description: "Sort pods (cycle: namespace → name → CPU → memory)", Footer: "pod sort",
+		Keys: []string{"p", "P"},
+		handler: func(a *App) bool {
+			a.cyclePodSort()
+			return true
+		},
+	},
+	{
+		Name: "namespace-filter", Description: "Cycle namespace filter", Footer: "namespace",
+		Keys: []string{"f", "F", "n", "N"},
+		handler: func(a *App) bool {
+			a.cycleNamespaceFilter()
+			return true
+		},
+	},
+	{
+		Name: "filter", Description: "Filter the focused table (e.g. web ns:shop cpu>500m NOT status:Running)", Footer: "filter",
+		Keys: []string{"/"},
+		handler: func(a *App) bool {
+			a.openFilterPrompt()
+			return true
+		},
+	},
+	{
+		Name: "clear-filter", Description: "Release node, then clear filters",
+		Keys: []string{"Esc"},
+		handler: func(a *App) bool {
+			if a.state.PodNode != "" {
+				a.state.PodNode = ""
+				return true
+			}
+			if a.state.NamespaceFilter == "" && a.state.NodeFilter == "" && a.state.PodFilter == "" {
+				return false
+			}
+			a.state.NamespaceFilter, a.state.NodeFilter, a.state.PodFilter = "", "", ""
+			return true
+		},
+	},
+	{
+		Name: "toggle-view", Description: "Toggle view mode (split / nodes / pods / tree / heatmap / right-sizing / cost)", Footer: "toggle view",
+		Keys: []string{"t", "T"},
+		handler: func(a *App) bool {
+			a.cycleViewMode()
+			return true
+		},
+	},
+	{
+		Name: "group", Description: "Group nodes by the next label (pool / zone / instance type), or costs by the next grouping",
+		Keys: []string{"g", "G"},
+		handler: func(a *App) bool {
+			if a.state.ViewMode == models.ViewModeCost {
+				a.state.CostGroup = a.nextCostGroup(a.state.CostGroup)
+				return true
+			}
+			a.cycleNodeGroup()
+			return true
+		},
+	},
+	{
+		Name: "heatmap-metric", Description: "Color the heatmap by CPU / memory / requests / pods",
+		Keys: []string{"m", "M"},
+		handler: func(a *App) bool {
+			a.state.HeatMetric = (a.state.HeatMetric + 1) % (models.HeatPods + 1)
+			return true
+		},
+	},
+	{
+		Name: "toggle-system", Description: "Toggle system namespaces", Footer: "all ns",
+		Keys: []string{"a", "A"},
+		handler: func(a *App) bool {
+			a.state.ShowSystem = !a.state.ShowSystem
+			return true
+		},
+	},
+	{
+		Name: "columns", Description: "Choose columns of the focused table", Footer: "columns",
+		Keys: []string{"c", "C"},
+		handler: func(a *App) bool {
+			a.openColumnPicker()
+			return true
+		},
+	},
+	{
+		Name: "context", Description: "Switch kubeconfig context", Footer: "context",
+		Keys: []string{"x", "X"},
+		handler: func(a *App) bool {
+			a.openContextPicker()
+			return true
+		},
+	},
+	{
+		Name: "plan", Description: "Plan capacity: how many replicas of a pod shape fit, and where",
+		Keys: []string{"w", "W"},
+		handler: func(a *App) bool {
+			a.openPlanner()
+			return true
+		},
+	},
+	{
+		Name: "export", Description: "Export the right-sizing recommendations as JSON, CSV and a YAML patch",
+		Keys: []string{"e", "E"},
+		handler: func(a *App) bool {
+			return a.exportSizing()
+		},
+	},
+	{
+		Name: "cost-basis", Description: "Charge pods for their requests or their usage in the cost view",
+		Keys: []string{"u", "U"},
+		handler: func(a *App) bool {
+			if a.state.ViewMode != models.ViewModeCost {
+				return false
+			}
+			if a.state.CostBasis == "usage" {
+				a.state.CostBasis = "requests"
+			} else {
+				a.state.CostBasis = "usage"
+			}
+			return true
+		},
+	},
+	{
+		Name: "fleet", Description: "Back to the fleet view (multi-cluster mode)", Footer: "fleet",
+		Keys: []string{"b", "B"},
+		handler: func(a *App) bool {
+			if len(a.clusters) < 2 {
+				return false
+			}
+			a.showFleet()
+			return true
+		},
+	},
+	{
+		Name: "switch-focus", Description: "Switch focus between nodes and pods",
+		Keys: []string{"Tab"},
+		handler: func(a *App) bool {
+			// Other views show a single table, which keeps the focus
+			if a.state.ViewMode != models.ViewModeSplit {
+				return false
+			}
+			if a.nodesTable.HasFocus() {
+				a.app.SetFocus(a.podsTable)
+			} else {
+				a.app.SetFocus(a.nodesTable)
+			}
+			return true
+		},
+	},
+	{
+		Name: "help", Description: "Show help", Footer: "help",
+		Keys: []string{"?"}, Fleet: true,
+		handler: func(a *App) bool {
+			a.state.ShowHelp = true
+			a.app.SetRoot(a.help, true)
+			return true
+		},
+	},
+}
+
+// keyID identifies a key press independent of modifiers tcell folds in
+type keyID struct {
+	key tcell.Key
+	ch  rune
+}
+
+// keyIDFromEvent returns the keyID for a key event
+func keyIDFromEvent(event *tcell.EventKey) keyID {
+	if event.Key() == tcell.KeyRune {
+		return keyID{key: tcell.KeyRune, ch: event.Rune()}
+	}
+	return keyID{key: event.Key()}
+}
+
+// keyAliases are accepted spellings that tcell does not use itself
+var keyAliases = map[string]tcell.Key{
+	"escape": tcell.KeyEscape,
+	"return": tcell.KeyEnter,
+}
+
+// parseKey parses a key name such as "q", "Tab", "Esc", "F5" or "Ctrl+R"
+func parseKey(name string) (keyID, error) {
+	if utf8.RuneCountInString(name) == 1 {
+		r, _ := utf8.DecodeRuneInString(name)
+		return keyID{key: tcell.KeyRune, ch: r}, nil
+	}
+
+	normalized := strings.ToLower(strings.ReplaceAll(name, "+", "-"))
+	if normalized == "space" {
+		return keyID{key: tcell.KeyRune, ch: ' '}, nil
+	}
+	if key, ok := keyAliases[normalized]; ok {
+		return keyID{key: key}, nil
+	}
+	for key, keyName := range tcell.KeyNames {
+		if strings.ToLower(keyName) == normalized {
+			return keyID{key: key}, nil
+		}
+	}
+	return keyID{}, fmt.Errorf("unknown key %q", name)
+}
+
+// keyMap resolves key presses to actions
+type keyMap struct {
+	bindings map[keyID]*action
+	keys     map[string][]string // action name -> effective key names
+}
+
+// newKeyMap builds the key map from the defaults and the user's overrides,
+// rejecting unknown actions, unknown keys and keys bound to two actions
+func newKeyMap(overrides map[string][]string) (*keyMap, error) {
+	byName := make(map[string]*action, len(actions))
+	for _, act := range actions {
+		byName[act.Name] = act
+	}
+	for name := range overrides {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("keys: unknown action %q (actions: %s)", name, strings.Join(ActionNames(), ", "))
+		}
+	}
+
+	km := &keyMap{
+		bindings: make(map[keyID]*action),
+		keys:     make(map[string][]string, len(actions)),
+	}
+	for _, act := range actions {
+		keys := act.Keys
+		if custom, ok := overrides[act.Name]; ok {
+			keys = custom
+		}
+		for _, name := range keys {
+			id, err := parseKey(name)
+			if err != nil {
+				return nil, fmt.Errorf("keys: %s: %w", act.Name, err)
+			}
+			if other, ok := km.bindings[id]; ok && other != act {
+				return nil, fmt.Errorf("keys: %q is bound to both %s and %s", name, other.Name, act.Name)
+			}
+			km.bindings[id] = act
+		}
+		km.keys[act.Name] = keys
+	}
+	return km, nil
+}
+
+// lookup returns the action bound to a key event, if any
+func (km *keyMap) lookup(event *tcell.EventKey) *action {
+	return km.bindings[keyIDFromEvent(event)]
+}
+
+// label returns the display form of an action's keys, e.g. "f/n"
+func (km *keyMap) label(name string) string {
+	seen := make(map[string]bool)
+	labels := make([]string, 0, len(km.keys[name]))
+	for _, key := range km.keys[name] {
+		// Upper-case duplicates of letter keys add noise to the help
+		lower := strings.ToLower(key)
+		if utf8.RuneCountInString(key) == 1 && seen[lower] {
+			continue
+		}
+		seen[lower] = true
+		labels = append(labels, key)
+	}
+	return strings.Join(labels, "/")
+}
+
+// navigationHelp describes the fixed navigation keys, listed after the
+// actions
+var navigationHelp = [][2]string{
+	{"↑/↓", "Navigate selection"},
+	{"Enter", "Pods of the node / toggle group or branch"},
+	{"←/→", "Collapse / expand group or tree branch, move in the heatmap"},
+}
+
+// helpLines returns one "keys  description" line per bound action
+func (km *keyMap) helpLines() []string {
+	width := 0
+	for _, act := range actions {
+		if l := utf8.RuneCountInString(km.label(act.Name)); l > width {
+			width = l
+		}
+	}
+	for _, nav := range navigationHelp {
+		width = max(width, utf8.RuneCountInString(nav[0]))
+	}
+
+	lines := make([]string, 0, len(actions)+len(navigationHelp))
+	for _, act := range actions {
+		label := km.label(act.Name)
+		if label == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width, label, act.Description))
+	}
+	for _, nav := range navigationHelp {
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width, nav[0], nav[1]))
+	}
+	return lines
+}
+
+// footerText returns the footer line with each key highlighted, listing
+// only the actions for which show returns true
+func (km *keyMap) footerText(keyColor tcell.Color, show func(act *action) bool) string {
+	parts := make([]string, 0, len(actions))
+	for _, act := range actions {
+		label := km.label(act.Name)
+		if act.Footer == "" || label == "" || !show(act) {
+			continue
+		}
+		parts = append(parts, ColoredText(label, keyColor)+" "+act.Footer)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// ActionNames returns the names of all remappable actions
+func ActionNames() []string {
+	names := make([]string, 0, len(actions))
+	for _, act := range actions {
+		names = append(names, act.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeyboardHelp renders the keyboard section of the command-line usage
+// message from the active key map
+func KeyboardHelp(cfg *config.Config) string {
+	km, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		km, _ = newKeyMap(nil)
+	}
+	var b strings.Builder
+	for _, line := range km.helpLines() {
+		b.WriteString("  " + line + "\n")
+	}
+	return b.String()
+}
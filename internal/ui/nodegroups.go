@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// nodeGroup describes the nodes sharing a value of the grouping label
+type nodeGroup struct {
+	key      string // label=value, the key of the group in App.collapsed
+	value    string
+	nodes    int
+	ready    int
+	expanded bool // whether the nodes are listed below the header
+}
+
+// groupKeyPrefix starts the names of group header rows; node names
+// cannot contain a slash, so the keys never clash
+const groupKeyPrefix = "group/"
+
+// groupNodes lists a header row per value of label, each followed by its
+// nodes unless the group is collapsed. A header row is a node holding the
+// totals of its group, so the columns show the group's usage, capacity,
+// requests, pods and GPUs. Groups are sorted like the nodes, by their
+// totals; nodes keep their order within a group.
+func groupNodes(nodes []models.Node, label string, field models.SortField, ascending bool, collapsed map[string]bool) ([]models.Node, map[string]*nodeGroup) {
+	groups := make(map[string]*nodeGroup)
+	members := make(map[string][]models.Node)
+	var headers []models.Node
+	index := make(map[string]int)
+	for _, n := range nodes {
+		value := noGroup
+		if v, ok := n.Labels[label]; ok {
+			value = v
+		}
+		name := groupKeyPrefix + value
+		i, ok := index[name]
+		if !ok {
+			i = len(headers)
+			index[name] = i
+			headers = append(headers, models.Node{Name: name, Status: models.NodeStatusReady, Labels: map[string]string{label: value}})
+			key := label + "=" + value
+			groups[name] = &nodeGroup{key: key, value: value, expanded: !collapsed[key]}
+		}
+		addToGroup(&headers[i], &n)
+		g := groups[name]
+		g.nodes++
+		if n.Status == models.NodeStatusReady {
+			g.ready++
+		}
+		members[name] = append(members[name], n)
+	}
+
+	for i := range headers {
+		h := &headers[i]
+		if h.CPU.Capacity > 0 {
+			h.CPU.Percent = float64(h.CPU.Current) / float64(h.CPU.Capacity) * 100
+		}
+		if h.Memory.Capacity > 0 {
+			h.Memory.Percent = float64(h.Memory.Current) / float64(h.Memory.Capacity) * 100
+		}
+		if h.Disk.Capacity > 0 {
+			h.Disk.Percent = float64(h.Disk.Current) / float64(h.Disk.Capacity) * 100
+		}
+	}
+	metrics.SortNodes(headers, field, ascending)
+
+	rows := make([]models.Node, 0, len(headers)+len(nodes))
+	for _, h := range headers {
+		rows = append(rows, h)
+		if groups[h.Name].expanded {
+			rows = append(rows, members[h.Name]...)
+		}
+	}
+	return rows, groups
+}
+
+// addToGroup adds a node to the totals of its group's header row. The
+// group is not ready when any of its nodes is not.
+func addToGroup(h, n *models.Node) {
+	h.CPU.Current += n.CPU.Current
+	h.CPU.Capacity += n.CPU.Capacity
+	h.Memory.Current += n.Memory.Current
+	h.Memory.Capacity += n.Memory.Capacity
+	h.Disk.Current += n.Disk.Current
+	h.Disk.Capacity += n.Disk.Capacity
+	h.CPUAllocatable += n.CPUAllocatable
+	h.MemoryAllocatable += n.MemoryAllocatable
+	h.CPURequests += n.CPURequests
+	h.MemoryRequests += n.MemoryRequests
+	h.PodCount += n.PodCount
+	h.PodCapacity += n.PodCapacity
+	h.NetworkRx += n.NetworkRx
+	h.NetworkTx += n.NetworkTx
+	if n.GPU != nil {
+		if h.GPU == nil {
+			h.GPU = &models.GPUInfo{}
+		}
+		h.GPU.Count += n.GPU.Count
+	}
+	if n.Status != models.NodeStatusReady {
+		h.Status = models.NodeStatusNotReady
+	}
+}
+
+// expandNodeGroup expands or collapses the group of the selected row of
+// the nodes table. Collapsing a node row selects its group header.
+func (a *App) expandNodeGroup(expand bool) {
+	row, _ := a.nodesTable.GetSelection()
+	items := a.nodes.items
+	i := row - 1
+	if i < 0 || i >= len(items) || a.nodeGroups == nil {
+		return
+	}
+	g := a.nodeGroups[items[i].Name]
+	if g == nil {
+		if expand {
+			return
+		}
+		for j := i - 1; j >= 0; j-- {
+			if a.nodeGroups[items[j].Name] != nil {
+				a.nodesTable.Select(j+1, 0)
+				return
+			}
+		}
+		return
+	}
+	if g.expanded == expand {
+		return
+	}
+	if expand {
+		delete(a.collapsed, g.key)
+	} else {
+		a.collapsed[g.key] = true
+	}
+	a.nodes.invalidate()
+}
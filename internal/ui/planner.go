@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/models"
+	"github.com/nlaak/ktop/internal/plan"
+)
+
+// planner is a modal for capacity planning: a pod shape is entered and
+// the placement of its replicas on the current nodes is simulated as it
+// is typed, refreshed with every metrics update. The shape is kept when
+// the planner closes.
+type planner struct {
+	a      *App
+	form   *tview.Form
+	result *tview.TextView
+	help   *tview.TextView
+	layout *tview.Flex
+
+	cpu, memory, replicas, selector, tolerations *tview.InputField
+
+	open        bool
+	returnFocus tview.Primitive // focused when the planner closes
+}
+
+// newPlanner creates the planner, hidden until opened
+func newPlanner(a *App) *planner {
+	p := &planner{a: a}
+	changed := func(string) {
+		a.stateMu.RLock()
+		active := a.active
+		a.stateMu.RUnlock()
+		p.update(active.latest())
+	}
+	field := func(label, value string, width int) *tview.InputField {
+		f := tview.NewInputField().
+			SetLabel(label).
+			SetText(value).
+			SetFieldWidth(width).
+			SetChangedFunc(changed)
+		p.form.AddFormItem(f)
+		return f
+	}
+
+	p.form = tview.NewForm().SetItemPadding(0)
+	p.cpu = field("CPU request", "500m", 12)
+	p.memory = field("Memory request", "512Mi", 12)
+	p.replicas = field("Replicas", "3", 6)
+	p.selector = field("Node selector", "", 60)
+	p.tolerations = field("Tolerations", "", 60)
+	p.form.SetCancelFunc(p.close)
+	p.form.SetInputCapture(p.handleKey)
+	p.form.SetBorderPadding(0, 1, 1, 1)
+
+	// The flex does not clear its padding, so the items are padded
+	p.result = tview.NewTextView().SetDynamicColors(true)
+	p.result.SetBorderPadding(0, 0, 1, 1)
+	p.help = tview.NewTextView().SetDynamicColors(true)
+	p.help.SetBorderPadding(0, 0, 1, 1)
+
+	p.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(p.form, 6, 0, true).
+		AddItem(p.result, 0, 1, false).
+		AddItem(p.help, 1, 0, false)
+	p.layout.SetBorder(true).
+		SetTitle(" CAPACITY PLAN ").
+		SetTitleAlign(tview.AlignLeft)
+	return p
+}
+
+// openPlanner shows the planner. It runs with stateMu held.
+func (a *App) openPlanner() {
+	p := a.planner
+	colors := a.colors
+	p.form.SetFieldBackgroundColor(colors.Background).
+		SetFieldTextColor(colors.Text).
+		SetLabelColor(colors.Header).
+		SetBackgroundColor(colors.Background)
+	p.layout.SetBorderColor(colors.Border).
+		SetTitleColor(colors.Text).
+		SetBackgroundColor(colors.Background)
+	p.result.SetTextColor(colors.Text).
+		SetBackgroundColor(colors.Background)
+	p.help.SetText(fmt.Sprintf("%s next field  %s scroll  %s close   tolerations: key=value:Effect, comma-separated",
+		ColoredText("Tab", colors.Header), ColoredText("PgUp/PgDn", colors.Header),
+		ColoredText("Esc", colors.Header))).
+		SetBackgroundColor(colors.Background)
+
+	p.open = true
+	p.returnFocus = a.app.GetFocus()
+	p.update(a.active.latest())
+	a.pages.AddPage("plan", centered(p.layout, 100, 32), true, true)
+	a.app.SetFocus(p.form)
+}
+
+// close hides the planner
+func (p *planner) close() {
+	a := p.a
+	a.stateMu.Lock()
+	p.open = false
+	a.stateMu.Unlock()
+
+	a.pages.RemovePage("plan")
+	a.app.SetFocus(p.returnFocus)
+}
+
+// handleKey scrolls the result while a field has focus
+func (p *planner) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	row, _ := p.result.GetScrollOffset()
+	switch event.Key() {
+	case tcell.KeyPgUp:
+		p.result.ScrollTo(max(0, row-10), 0)
+	case tcell.KeyPgDn:
+		p.result.ScrollTo(row+10, 0)
+	default:
+		return event
+	}
+	return nil
+}
+
+// shape parses the fields of the form
+func (p *planner) shape() (plan.Shape, error) {
+	replicas, err := strconv.Atoi(strings.TrimSpace(p.replicas.GetText()))
+	if err != nil {
+		return plan.Shape{}, fmt.Errorf("replicas must be a number")
+	}
+	var tolerations []string
+	for _, t := range strings.Split(p.tolerations.GetText(), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tolerations = append(tolerations, t)
+		}
+	}
+	return plan.ParseShape(strings.TrimSpace(p.cpu.GetText()), strings.TrimSpace(p.memory.GetText()),
+		replicas, strings.TrimSpace(p.selector.GetText()), tolerations)
+}
+
+// update simulates the shape of the form on the nodes of m
+func (p *planner) update(m *models.ClusterMetrics) {
+	if !p.open {
+		return
+	}
+	colors := p.a.colors
+	shape, err := p.shape()
+	switch {
+	case err != nil:
+		p.result.SetText(ColoredText(tview.Escape(err.Error()), colors.Critical))
+		return
+	case m == nil:
+		p.result.SetText(ColoredText("Waiting for metrics...", colors.TextDim))
+		return
+	case m.NodesForbidden:
+		p.result.SetText(ColoredText("Planning needs permission to list nodes.", colors.Critical))
+		return
+	}
+
+	var b strings.Builder
+	if len(m.Namespaces) > 0 || p.a.config.Selector != "" || p.a.config.FieldSelector != "" {
+		// Requests of the pods outside the scope are not counted
+		fmt.Fprintf(&b, "%s\n\n", ColoredText("Pods are scoped by namespace or selector: free capacity is overestimated.", colors.Warning))
+	}
+	result := plan.Simulate(m.Nodes, shape)
+	verdict := colors.Healthy
+	if result.Unplaced() > 0 {
+		verdict = colors.Critical
+	}
+	var report strings.Builder
+	result.Write(&report)
+	for i, line := range strings.Split(strings.TrimRight(report.String(), "\n"), "\n") {
+		line = tview.Escape(line)
+		if i == 2 {
+			line = ColoredText(line, verdict)
+		}
+		b.WriteString(line + "\n")
+	}
+	p.result.SetText(b.String())
+}
@@ -0,0 +1,658 @@
+package ui
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/k8s"
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// Run "go test ./internal/ui -update" after an intended change of the
+// rendering to rewrite the golden files, and review the diff.
+var update = flag.Bool("update", false, "rewrite golden files")
+
+const (
+	screenWidth  = 120
+	screenHeight = 36
+	mi           = 1024 * 1024
+	gi           = 1024 * mi
+)
+
+// renderHarness drives an App on a simulation screen without running the
+// event loop: metrics and state are set directly, keys are dispatched the
+// way tview does, and each render is what a refresh tick would draw.
+type renderHarness struct {
+	t      *testing.T
+	app    *App
+	screen tcell.SimulationScreen
+}
+
+// newRenderHarness creates an app for cfg, or the default configuration
+// when cfg is nil, showing m
+func newRenderHarness(t *testing.T, cfg *config.Config, m *models.ClusterMetrics) *renderHarness {
+	t.Helper()
+	t.Setenv("NO_COLOR", "")
+	if cfg == nil {
+		cfg = config.NewConfig()
+	}
+
+	a, err := newApp([]Cluster{{Context: "test"}}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen := tcell.NewSimulationScreen("UTF-8")
+	a.app.SetScreen(screen) // initializes the screen
+	screen.SetSize(screenWidth, screenHeight)
+	a.colors = a.colors.Fit(screen.Colors())
+	a.applyTheme()
+	a.app.SetRoot(a.pages, true)
+
+	a.active.metrics = m
+	return &renderHarness{t: t, app: a, screen: screen}
+}
+
+// setState changes the app state before the next render
+func (h *renderHarness) setState(modify func(*models.AppState)) {
+	h.app.stateMu.Lock()
+	modify(&h.app.state)
+	h.app.stateMu.Unlock()
+}
+
+// press sends keys, named as in the keys config, e.g. "s", "Tab", "Esc"
+func (h *renderHarness) press(keys ...string) {
+	h.t.Helper()
+	for _, name := range keys {
+		id, err := parseKey(name)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		event := tcell.NewEventKey(id.key, id.ch, tcell.ModNone)
+
+		// As tview's event loop: the input capture first, then the root
+		if capture := h.app.app.GetInputCapture(); capture != nil {
+			event = capture(event)
+		}
+		if event == nil {
+			continue
+		}
+		if handler := h.app.pages.InputHandler(); handler != nil {
+			handler(event, func(p tview.Primitive) { h.app.app.SetFocus(p) })
+		}
+	}
+}
+
+// render updates the UI and returns the screen as text, a grid of style
+// letters and the legend of the styles
+func (h *renderHarness) render() string {
+	// Keep "Updated: <1s ago" in the header
+	if m := h.app.active.latest(); m != nil {
+		m.Timestamp = time.Now()
+	}
+	h.app.updateUI()
+	h.app.app.ForceDraw()
+
+	cells, width, height := h.screen.GetContents()
+	styles := make(map[tcell.Style]byte)
+	var legend []string
+	var text, grid strings.Builder
+	for y := 0; y < height; y++ {
+		var line, styleLine strings.Builder
+		for x := 0; x < width; x++ {
+			cell := cells[y*width+x]
+			letter, ok := styles[cell.Style]
+			if !ok {
+				letter = styleLetter(len(styles))
+				styles[cell.Style] = letter
+				legend = append(legend, fmt.Sprintf("%c %s", letter, describeStyle(cell.Style)))
+			}
+			styleLine.WriteByte(letter)
+
+			// The cell after a wide rune is covered by it
+			if len(cell.Runes) == 0 {
+				line.WriteByte(' ')
+				continue
+			}
+			line.WriteString(string(cell.Runes))
+			if runewidth.StringWidth(string(cell.Runes)) == 2 {
+				x++
+				styleLine.WriteByte(letter)
+			}
+		}
+		text.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+		grid.WriteString(styleLine.String() + "\n")
+	}
+	return text.String() + "-- styles --\n" + grid.String() + "-- legend --\n" + strings.Join(legend, "\n") + "\n"
+}
+
+// styleLetter names the n-th distinct style of a screen
+func styleLetter(n int) byte {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	if n >= len(letters) {
+		return '?'
+	}
+	return letters[n]
+}
+
+// describeStyle formats the colors and attributes of a style
+func describeStyle(style tcell.Style) string {
+	fg, bg, attrs := style.Decompose()
+	desc := fmt.Sprintf("fg=%s bg=%s", colorName(fg), colorName(bg))
+	for _, attr := range []struct {
+		mask tcell.AttrMask
+		name string
+	}{
+		{tcell.AttrBold, "bold"}, {tcell.AttrDim, "dim"}, {tcell.AttrItalic, "italic"},
+		{tcell.AttrUnderline, "underline"}, {tcell.AttrReverse, "reverse"}, {tcell.AttrBlink, "blink"},
+	} {
+		if attrs&attr.mask != 0 {
+			desc += " " + attr.name
+		}
+	}
+	return desc
+}
+
+// colorName formats a color as hex; names are ambiguous, e.g. gray/grey
+func colorName(c tcell.Color) string {
+	if c == tcell.ColorDefault {
+		return "default"
+	}
+	return fmt.Sprintf("#%06x", c.Hex())
+}
+
+// assertGolden compares got with testdata/<name>.golden
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test ./internal/ui -update to create it)", err)
+	}
+	if got == string(want) {
+		return
+	}
+	gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("%s differs at line %d:\n got: %q\nwant: %q\n\nfull output:\n%s", path, i+1, g, w, got)
+		}
+	}
+}
+
+// testMetrics returns a small cluster with a busy node, a node that is
+// not ready, a GPU node at its pod limit, and pods in several states
+func testMetrics() *models.ClusterMetrics {
+	m := &models.ClusterMetrics{
+		ClusterInfo: models.ClusterInfo{Name: "prod", Context: "prod-admin"},
+		Nodes: []models.Node{
+			testNode("node-a", models.NodeStatusReady, 3400, 4000, 14*gi, 16*gi, 3),
+			testNode("node-b", models.NodeStatusReady, 800, 4000, 4*gi, 16*gi, 2),
+			testNode("gpu-1", models.NodeStatusReady, 16000, 32000, 100*gi, 244*gi, 1),
+			testNode("node-c", models.NodeStatusNotReady, 0, 4000, 0, 16*gi, 0),
+		},
+		Pods: []models.Pod{
+			testPod("shop", "web-1", models.PodStatusRunning, 250, 300*mi, 0, "node-a"),
+			testPod("shop", "web-2", models.PodStatusRunning, 250, 310*mi, 0, "node-b"),
+			testPod("shop", "worker-7d9f", models.PodStatusRunning, 5, 12*mi, 14, "node-a"),
+			testPod("data", "postgres-0", models.PodStatusRunning, 1200, 4*gi, 1, "node-a"),
+			testPod("kube-system", "coredns-5d78c", models.PodStatusRunning, 20, 50*mi, 0, "node-b"),
+			testPod("ml", "inference-0", models.PodStatusRunning, 12000, 80*gi, 0, "gpu-1"),
+			testPod("ml", "trainer-xl", models.PodStatusPending, 0, 0, 0, ""),
+		},
+		MetricsSource: "metrics-server",
+	}
+	m.Pods[3].Containers = []models.Container{
+		{Name: "postgres", State: "Running", CPU: 1150, Memory: 4*gi - 64*mi, RestartCount: 1},
+		{Name: "exporter", State: "CrashLoopBackOff", CPU: 50, Memory: 64 * mi},
+	}
+	m.Nodes[2].GPU = &models.GPUInfo{Count: 4}
+	m.Nodes[2].PodCapacity = 1
+	for i, zone := range []string{"us-east-1a", "us-east-1b", "us-east-1a", "us-east-1b"} {
+		n := &m.Nodes[i]
+		pool := "general"
+		if n.GPU != nil {
+			pool = "gpu"
+		}
+		n.Labels = map[string]string{"node-pool": pool, "topology.kubernetes.io/zone": zone}
+		n.CPUAllocatable, n.MemoryAllocatable = n.CPU.Capacity, n.Memory.Capacity
+	}
+	m.Nodes[0].CPURequests, m.Nodes[0].MemoryRequests = 2000, 15*gi
+	m.Nodes[1].CPURequests, m.Nodes[1].MemoryRequests = 1500, 2*gi
+	m.Nodes[2].CPURequests, m.Nodes[2].MemoryRequests = 16000, 96*gi
+
+	m.TotalNodes, m.TotalPods = len(m.Nodes), len(m.Pods)
+	for _, n := range m.Nodes {
+		m.TotalCPUCapacity += n.CPU.Capacity
+		m.TotalCPUUsed += n.CPU.Current
+		m.TotalCPUCores += int(n.CPU.Capacity / 1000)
+		m.TotalMemoryCapacity += n.Memory.Capacity
+		m.TotalMemoryUsed += n.Memory.Current
+		if n.GPU != nil {
+			m.TotalGPUs += n.GPU.Count
+		}
+		if n.Status == models.NodeStatusReady {
+			m.ReadyNodes++
+		}
+	}
+	return m
+}
+
+func testNode(name string, status models.NodeStatus, cpu, cpuCap, mem, memCap int64, pods int) models.Node {
+	n := models.Node{Name: name, Status: status, PodCount: pods, PodCapacity: 110}
+	n.CPU = models.ResourceUsage{Current: cpu, Capacity: cpuCap, Percent: float64(cpu) / float64(cpuCap) * 100}
+	n.Memory = models.ResourceUsage{Current: mem, Capacity: memCap, Percent: float64(mem) / float64(memCap) * 100}
+	return n
+}
+
+func testPod(ns, name string, status models.PodStatus, cpu, mem int64, restarts int32, node string) models.Pod {
+	return models.Pod{Namespace: ns, Name: name, Status: status, CPU: cpu, Memory: mem, RestartCount: restarts, NodeName: node}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics func() *models.ClusterMetrics
+		state   func(*models.AppState)
+	}{
+		{name: "split", metrics: testMetrics},
+		{name: "connecting", metrics: func() *models.ClusterMetrics { return nil }},
+		{name: "errors", metrics: func() *models.ClusterMetrics {
+			m := testMetrics()
+			m.MetricsUnavailable = true
+			return m
+		}, state: func(s *models.AppState) {
+			s.LastError = "context switching is not available in demo mode"
+		}},
+		{name: "degraded", metrics: func() *models.ClusterMetrics {
+			m := testMetrics()
+			m.Sources = []models.SourceStatus{
+				{Name: "nodes", State: models.SourceOK},
+				{Name: "pods", State: models.SourceStale, LastSuccess: time.Now().Add(-2*time.Minute - 5*time.Second),
+					Err: fmt.Errorf("context deadline exceeded")},
+				{Name: "metrics-server", State: models.SourceFailed, Err: fmt.Errorf("service unavailable")},
+			}
+			return m
+		}},
+		{name: "nodes-forbidden", metrics: func() *models.ClusterMetrics {
+			m := testMetrics()
+			m.Nodes, m.NodesForbidden = nil, true
+			m.Namespaces = []string{"shop"}
+			m.Pods = m.Pods[:3]
+			m.TotalPods = 3
+			return m
+		}},
+		{name: "nodes-forbidden-all-namespaces", metrics: func() *models.ClusterMetrics {
+			m := testMetrics()
+			m.Nodes, m.NodesForbidden = nil, true
+			return m
+		}},
+		{name: "empty", metrics: func() *models.ClusterMetrics {
+			return &models.ClusterMetrics{ClusterInfo: models.ClusterInfo{Name: "kind", Context: "kind-kind"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newRenderHarness(t, nil, tt.metrics())
+			if tt.state != nil {
+				h.setState(tt.state)
+			}
+			assertGolden(t, tt.name, h.render())
+		})
+	}
+}
+
+func TestRenderKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		// Node sort cycles CPU → memory → status → pods → name, then
+		// flips the direction
+		{"sort-nodes-memory", []string{"s"}},
+		{"sort-nodes-name-ascending", []string{"s", "s", "s", "s"}},
+		// Pod sort cycles CPU → memory → namespace (flipping direction)
+		{"sort-pods-namespace", []string{"p", "p"}},
+		{"show-system", []string{"a"}},
+		{"view-nodes", []string{"t"}},
+		{"view-pods", []string{"t", "t"}},
+		{"help", []string{"?"}},
+		{"help-closed", []string{"?", "Esc"}},
+		// The filter applies to the focused table while it is typed
+		{"filter-nodes-live", []string{"/", "c", "p", "u", "%", ">", "5", "0"}},
+		{"filter-pods", []string{"Tab", "/", "n", "s", ":", "s", "h", "o", "p", " ", "!", "w", "e", "b", "Enter"}},
+		{"filter-invalid", []string{"/", "c", "p", "u", ">", "x"}},
+		{"filter-cleared", []string{"/", "g", "p", "u", "Enter", "Esc"}},
+		// Enter on a node limits the pods table to it until Esc
+		{"drill-down", []string{"Down", "Enter"}},
+		{"drill-down-released", []string{"Down", "Enter", "Esc"}},
+		{"drill-down-from-nodes-view", []string{"t", "Enter"}},
+		// The tree view opens a node, then a pod; Left on a container
+		// selects its pod and collapses it next
+		{"view-tree", []string{"t", "t", "t"}},
+		{"tree-expanded", []string{"t", "t", "t", "Down", "Enter", "Down", "Right"}},
+		{"tree-collapsed", []string{"t", "t", "t", "Down", "Enter", "Down", "Right", "Down", "Left", "Left"}},
+		// Grouped nodes get a header row with the group's totals; Left
+		// selects the group of a node and then collapses it, Enter on a node
+		// still drills down
+		{"nodes-grouped", []string{"g", "g"}},
+		{"nodes-group-collapsed", []string{"g", "Left", "Left"}},
+		{"nodes-group-drill-down", []string{"g", "Down", "Enter"}},
+		// The heatmap groups by the labels set on some node, colors by
+		// the chosen metric, and moves its selection with the arrows
+		{"view-heatmap", []string{"t", "t", "t", "t"}},
+		{"heatmap-grouped", []string{"t", "t", "t", "t", "g", "g"}},
+		{"heatmap-requests", []string{"t", "t", "t", "t", "g", "m", "m"}},
+		{"heatmap-moved", []string{"t", "t", "t", "t", "g", "Down", "Right"}},
+		{"heatmap-drill-down", []string{"t", "t", "t", "t", "Right", "Enter"}},
+		// The planner simulates the shape as it is typed and keeps it
+		// when closed
+		{"plan", []string{"w"}},
+		{"plan-blocked", []string{"w", "Backspace", "Backspace", "Backspace", "Backspace", "4", "Tab", "Tab", "Backspace", "8"}},
+		{"plan-invalid", []string{"w", "Tab", "x"}},
+		{"plan-closed", []string{"w", "Esc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newRenderHarness(t, nil, testMetrics())
+			// Refresh ticks draw the tables between key presses
+			for _, key := range tt.keys {
+				h.render()
+				h.press(key)
+			}
+			assertGolden(t, "keys-"+tt.name, h.render())
+		})
+	}
+}
+
+// Tab only switches between the tables of the split view; in views
+// showing a single table or the heatmap the keys after it still navigate
+func TestTabOutsideSplitView(t *testing.T) {
+	tests := []struct {
+		name string
+		view []string
+		keys []string
+	}{
+		{"nodes", []string{"t"}, []string{"Down", "Enter"}},
+		{"tree", []string{"t", "t", "t"}, []string{"Down", "Enter", "Down", "Right"}},
+		{"heatmap", []string{"t", "t", "t", "t"}, []string{"Right", "Enter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			render := func(keys ...string) string {
+				h := newRenderHarness(t, nil, testMetrics())
+				for _, key := range keys {
+					h.render()
+					h.press(key)
+				}
+				return h.render()
+			}
+			want := render(append(slices.Clone(tt.view), tt.keys...)...)
+			got := render(append(append(slices.Clone(tt.view), "Tab"), tt.keys...)...)
+			if got != want {
+				t.Errorf("after Tab:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// Pods whose containers crash or cannot start count as failing in the
+// fleet view, whatever their phase
+func TestFleetFailingPods(t *testing.T) {
+	m := testMetrics()
+	pull := testPod("shop", "web-3", models.PodStatusPending, 0, 0, 0, "node-b")
+	pull.Containers = []models.Container{{Name: "web", State: "ImagePullBackOff"}}
+	m.Pods = append(m.Pods, pull)
+	h := newRenderHarness(t, nil, m)
+	h.app.clusters = append(h.app.clusters, newCluster(Cluster{Context: "staging"}, h.app.config.Pricing))
+	h.app.showFleet()
+	h.render()
+
+	// postgres-0 is running with a container in CrashLoopBackOff; of the
+	// pending pods, web-3 cannot pull its image
+	if got := h.app.fleetTable.GetCell(1, 6).Text; got != "2" {
+		t.Errorf("failing = %s, want 2", got)
+	}
+	if got := h.app.fleetTable.GetCell(1, 7).Text; got != "1" {
+		t.Errorf("pending = %s, want 1", got)
+	}
+}
+
+func TestOpenClusterResetsState(t *testing.T) {
+	h := newRenderHarness(t, nil, testMetrics())
+	h.app.state.NamespaceFilter = "shop"
+	h.app.state.PodNode = "node-a"
+	h.app.state.NodeFilter = "cpu%>50"
+	h.app.state.PodFilter = "web ns:shop"
+	h.app.state.LastError = "context switching is not available in demo mode"
+
+	// Filters without namespaces or nodes apply to any cluster
+	h.app.openCluster(h.app.active)
+	got := h.app.state
+	if got.NamespaceFilter != "" || got.PodNode != "" || got.PodFilter != "" || got.LastError != "" {
+		t.Errorf("state of the previous cluster kept: %+v", got)
+	}
+	if got.NodeFilter != "cpu%>50" {
+		t.Errorf("node filter = %q, want it kept", got.NodeFilter)
+	}
+}
+
+func TestRenderCustomColumns(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Columns.Nodes = []config.ColumnConfig{{Name: "node"}, {Name: "cpu%", Header: "LOAD"}, {Name: "gpu"}}
+	cfg.Columns.Pods = []config.ColumnConfig{{Name: "pod", Width: 8}, {Name: "restarts"}}
+	h := newRenderHarness(t, cfg, testMetrics())
+	assertGolden(t, "custom-columns", h.render())
+}
+
+func TestColumnPickerState(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.ConfigPath = filepath.Join(t.TempDir(), "config.yaml")
+	cfg.Columns.Nodes = []config.ColumnConfig{{Name: "node"}, {Name: "cpu%"}, {Name: "gpu"}}
+	if err := cfg.LoadState(); err != nil {
+		t.Fatal(err)
+	}
+	h := newRenderHarness(t, cfg, testMetrics())
+	state := func() string {
+		data, err := os.ReadFile(cfg.StatePath())
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// Looking at the layout does not save it
+	h.press("c", "Esc")
+	if got := state(); got != "" {
+		t.Errorf("state saved without changes:\n%s", got)
+	}
+
+	// Hiding a column saves the layout of that table only
+	h.press("c", "Space", "Esc")
+	if got := state(); !strings.Contains(got, "name: cpu%") || strings.Contains(got, "name: node\n") || strings.Contains(got, "pods:") {
+		t.Errorf("state after hiding the node column:\n%s", got)
+	}
+
+	// r restores the config file layout, which is not saved
+	h.press("c", "r", "Esc")
+	if got := state(); strings.Contains(got, "nodes:") {
+		t.Errorf("state after resetting:\n%s", got)
+	}
+	if len(cfg.Columns.Nodes) != 3 || cfg.Columns.Nodes[0].Name != "node" {
+		t.Errorf("columns after resetting: %+v", cfg.Columns.Nodes)
+	}
+}
+
+func TestErrorClearedByNextAction(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.Demo = true
+	h := newRenderHarness(t, cfg, testMetrics())
+	h.press("x")
+	if !strings.Contains(h.render(), "not available in demo mode") {
+		t.Fatal("the error is not shown")
+	}
+	h.press("s")
+	if strings.Contains(h.render(), "not available in demo mode") {
+		t.Error("the error is still shown after the next action")
+	}
+}
+
+// sizingMetrics returns testMetrics with the requests of the pods'
+// containers, and records twelve minutes of their usage in the history of
+// a collector for h
+func sizingMetrics(h *renderHarness) {
+	m := h.app.active.metrics
+	for i := range m.Pods {
+		p := &m.Pods[i]
+		switch p.Name {
+		case "web-1", "web-2":
+			p.Workload = "Deployment/web"
+			p.Containers = []models.Container{{Name: "web", CPURequest: 1000, CPULimit: 2000, MemoryRequest: gi}}
+		case "worker-7d9f":
+			p.Workload = "Deployment/worker"
+			p.Containers = []models.Container{{Name: "worker"}}
+		case "postgres-0":
+			p.Workload = "StatefulSet/postgres"
+			p.Containers[0].CPURequest, p.Containers[0].MemoryRequest = 1000, 4*gi
+			p.Containers[1].CPURequest, p.Containers[1].MemoryRequest = 100, 64*mi
+		case "inference-0":
+			p.Containers = []models.Container{{Name: "model", CPURequest: 12000, MemoryRequest: 96 * gi}}
+		case "trainer-xl":
+			p.Workload = "Job/trainer-xl"
+			p.Containers = []models.Container{{Name: "trainer", CPURequest: 8000, MemoryRequest: 32 * gi}}
+		}
+	}
+
+	client := k8s.NewClientFromClientsets(fake.NewSimpleClientset(), nil, m.ClusterInfo)
+	collector := metrics.NewCollector(client, h.app.config)
+	start := time.Now().Add(-12 * time.Minute).Truncate(time.Minute)
+	for i := range 12 {
+		usage := &metrics.Usage{
+			Pods:       make(map[string]metrics.Sample),
+			Containers: make(map[string]map[string]metrics.Sample),
+		}
+		for _, p := range m.Pods {
+			if p.Status == models.PodStatusRunning {
+				usage.Pods[p.Namespace+"/"+p.Name] = metrics.Sample{CPU: p.CPU, Memory: p.Memory}
+			}
+		}
+		postgres := make(map[string]metrics.Sample)
+		for _, c := range m.Pods[3].Containers {
+			postgres[c.Name] = metrics.Sample{CPU: c.CPU, Memory: c.Memory}
+		}
+		usage.Containers["data/postgres-0"] = postgres
+		collector.History().Record(start.Add(time.Duration(i)*time.Minute), usage)
+	}
+	h.app.active.collector = collector
+}
+
+func TestRenderRightsizing(t *testing.T) {
+	h := newRenderHarness(t, nil, testMetrics())
+	sizingMetrics(h)
+	h.press("t", "t", "t", "t", "t")
+	assertGolden(t, "rightsizing", h.render())
+
+	// Export writes the report to the current directory, named after
+	// the time of the metrics. An export into a removed directory fails;
+	// the next one clears its error.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, dir := filepath.Join(t.TempDir(), "removed"), t.TempDir()
+	if err := os.Mkdir(removed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	h.press("e")
+	if !strings.Contains(h.render(), "export failed") {
+		t.Error("the failed export is not reported")
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	h.press("e")
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{".json", ".csv", ".yaml"} {
+		if files, _ := filepath.Glob(filepath.Join(dir, "ktop-rightsizing-*"+ext)); len(files) != 1 {
+			t.Errorf("exported %s files: %v", ext, files)
+		}
+	}
+	if out := h.render(); !strings.Contains(out, "Exported ktop-rightsizing-") || strings.Contains(out, "export failed") {
+		t.Errorf("the export is not reported, or its earlier failure still is:\n%s", out)
+	}
+}
+
+func TestRenderCost(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"cost", nil},
+		// g sums up by workload, then by the team label and by node; u
+		// charges pods for their usage
+		{"cost-by-team", []string{"g", "g"}},
+		{"cost-by-node-usage", []string{"g", "g", "g", "u"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NewConfig()
+			cfg.Pricing.GroupLabel = "team"
+			m := testMetrics()
+			m.Timestamp = time.Now()
+			for i := range m.Pods {
+				p := &m.Pods[i]
+				p.CPURequest, p.MemoryRequest = p.CPU*2, p.Memory*2
+				p.Labels = map[string]string{"team": map[string]string{"shop": "checkout", "ml": "research"}[p.Namespace]}
+			}
+			m.Pods[5].GPURequest = 2
+			m.Nodes[0].Labels["node.kubernetes.io/instance-type"] = "m6i.xlarge"
+			h := newRenderHarness(t, cfg, m)
+			h.app.active.costs.Observe(m)
+
+			h.press("t", "t", "t", "t", "t", "t")
+			for _, key := range tt.keys {
+				h.render()
+				h.press(key)
+			}
+			assertGolden(t, tt.name, h.render())
+		})
+	}
+}
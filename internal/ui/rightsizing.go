@@ -0,0 +1,254 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+	"github.com/nlaak/ktop/internal/rightsize"
+)
+
+// sizingRow is one row of the right-sizing view: a workload, followed by
+// one row per container with its recommendation
+type sizingRow struct {
+	key       string
+	workload  *rightsize.Workload
+	container *rightsize.Container // nil on the workload row
+}
+
+// sizingKey identifies a right-sizing row across refreshes
+func sizingKey(r *sizingRow) string {
+	return r.key
+}
+
+// verdictColor returns the color of a right-sizing verdict
+func (a *App) verdictColor(v rightsize.Verdict) tcell.Color {
+	switch v {
+	case rightsize.Under:
+		return a.colors.Critical
+	case rightsize.Over:
+		return a.colors.Warning
+	case rightsize.OK:
+		return a.colors.Healthy
+	}
+	return a.colors.TextDim
+}
+
+// formatChange formats the change of a workload's requests as reclaimed
+// (negative) or additional (positive) amounts, or "-" when there is none
+func formatChange(reclaimable, additional int64, format func(int64) string) string {
+	switch {
+	case additional > 0:
+		return "+" + format(additional)
+	case reclaimable > 0:
+		return "-" + format(reclaimable)
+	}
+	return "-"
+}
+
+// containerValue returns a column value of container rows, blank on
+// workload rows and dimmed while usage is collected. Usage values are "-"
+// until there is a sample.
+func containerValue(usage bool, value func(c *rightsize.Container) string) func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+	return func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		switch {
+		case r.container == nil:
+			return "", a.colors.Text
+		case usage && r.container.Samples == 0:
+			return "-", a.colors.TextDim
+		case r.container.Verdict == rightsize.Collecting:
+			return value(r.container), a.colors.TextDim
+		}
+		return value(r.container), a.colors.Text
+	}
+}
+
+// recommendedValue returns a recommendation column, "-" while collecting
+func recommendedValue(value func(c *rightsize.Container) string) func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+	return func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		switch {
+		case r.container == nil:
+			return "", a.colors.Text
+		case r.container.Verdict == rightsize.Collecting:
+			return "-", a.colors.TextDim
+		}
+		return value(r.container), a.colors.Header
+	}
+}
+
+// sizingColumns are the columns of the right-sizing view. Usage and
+// recommendations are per replica; the changes of the workload rows sum
+// up all replicas.
+var sizingColumns = []tableColumn[sizingRow]{
+	{Name: "name", Header: "WORKLOAD / CONTAINER", Width: 44, value: func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		if r.container != nil {
+			return "  " + r.container.Name, a.colors.TextDim
+		}
+		return r.workload.Key(), a.colors.Text
+	}},
+	{Name: "pods", Header: "PODS", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		if r.container != nil {
+			return "", a.colors.Text
+		}
+		return fmt.Sprintf("%d", r.workload.Replicas), a.colors.Text
+	}},
+	{Name: "cpu-request", Header: "CPU REQ", Align: tview.AlignRight, value: containerValue(false, func(c *rightsize.Container) string {
+		return rightsize.FormatRequest(c.Current.CPURequest, metrics.FormatCPU)
+	})},
+	{Name: "cpu-p95", Header: "P95", Align: tview.AlignRight, value: containerValue(true, func(c *rightsize.Container) string {
+		return metrics.FormatCPU(c.CPUP95)
+	})},
+	{Name: "cpu-recommended", Header: "REC", Align: tview.AlignRight, value: recommendedValue(func(c *rightsize.Container) string {
+		return metrics.FormatCPU(c.Recommended.CPURequest)
+	})},
+	{Name: "memory-request", Header: "MEM REQ", Align: tview.AlignRight, value: containerValue(false, func(c *rightsize.Container) string {
+		return rightsize.FormatRequest(c.Current.MemoryRequest, metrics.FormatMemory)
+	})},
+	{Name: "memory-peak", Header: "PEAK", Align: tview.AlignRight, value: containerValue(true, func(c *rightsize.Container) string {
+		return metrics.FormatMemory(c.MemoryMax)
+	})},
+	{Name: "memory-recommended", Header: "REC", Align: tview.AlignRight, value: recommendedValue(func(c *rightsize.Container) string {
+		return metrics.FormatMemory(c.Recommended.MemoryRequest)
+	})},
+	{Name: "cpu-change", Header: "CPU Δ", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		if r.container != nil {
+			return "", a.colors.Text
+		}
+		w := r.workload
+		return formatChange(w.ReclaimableCPU, w.AdditionalCPU, metrics.FormatCPU), a.colors.Text
+	}},
+	{Name: "memory-change", Header: "MEM Δ", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		if r.container != nil {
+			return "", a.colors.Text
+		}
+		w := r.workload
+		return formatChange(w.ReclaimableMemory, w.AdditionalMemory, metrics.FormatMemory), a.colors.Text
+	}},
+	{Name: "verdict", Header: "VERDICT", value: func(a *App, _ rowContext, r *sizingRow) (string, tcell.Color) {
+		if r.container != nil {
+			return string(r.container.Verdict), a.verdictColor(r.container.Verdict)
+		}
+		return string(r.workload.Verdict), a.verdictColor(r.workload.Verdict)
+	}},
+}
+
+// updateSizingTable recomputes the right-sizing view when the metrics or
+// the state changed since it was last updated. Pods are filtered by
+// namespace like in the pods table.
+func (a *App) updateSizingTable(m *models.ClusterMetrics, state models.AppState) {
+	if state.ViewMode != models.ViewModeRightsize {
+		return
+	}
+	defer a.updateSizingInfo()
+	if !a.sizing.changed(m, state) {
+		return
+	}
+
+	a.report = nil
+	history := a.active.history()
+	switch {
+	case m == nil || history == nil:
+		a.sizeTable.SetTitle(" RIGHT-SIZING ")
+		a.sizing.setNotice(true, "Waiting for metrics...")
+		return
+	case m.MetricsUnavailable:
+		a.sizeTable.SetTitle(" RIGHT-SIZING ")
+		a.sizing.setNotice(true, "Right-sizing needs usage metrics")
+		return
+	}
+
+	showSystem := state.ShowSystem || len(m.Namespaces) > 0
+	pods := metrics.FilterPods(m.Pods, state.NamespaceFilter, showSystem)
+	a.report = rightsize.Compute(pods, history, a.config.RightSizing)
+	a.sizeTable.SetTitle(fmt.Sprintf(" RIGHT-SIZING (p95 of %s CPU peaks, memory peak over %s + %g%% headroom) ",
+		a.report.Resolution, a.report.Window, a.report.Headroom))
+	if len(a.report.Workloads) == 0 {
+		a.sizing.setNotice(true, "No pods found")
+		return
+	}
+
+	var rows []sizingRow
+	for i := range a.report.Workloads {
+		w := &a.report.Workloads[i]
+		rows = append(rows, sizingRow{key: w.Key(), workload: w})
+		for j := range w.Containers {
+			rows = append(rows, sizingRow{key: w.Key() + "/" + w.Containers[j].Name, workload: w, container: &w.Containers[j]})
+		}
+	}
+	a.sizing.setItems(rows, func(*sizingRow) rowContext {
+		return rowContext{th: a.config.Thresholds}
+	})
+}
+
+// updateSizingInfo shows the totals of the right-sizing report and how
+// to export it
+func (a *App) updateSizingInfo() {
+	r := a.report
+	if r == nil {
+		a.sizeInfo.SetText("")
+		return
+	}
+
+	text, dim := ColorTag(a.colors.Text), ColorTag(a.colors.TextDim)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%d over-provisioned[-]   %s%d under-provisioned[-]   %sReclaimable:[-] %s%s cores, %s[-]   %sAdditional needed:[-] %s%s cores, %s[-]\n",
+		ColorTag(a.colors.Warning), r.Over, ColorTag(a.colors.Critical), r.Under,
+		dim, text, rightsize.FormatCores(r.ReclaimableCPU), metrics.FormatMemory(r.ReclaimableMemory),
+		dim, text, rightsize.FormatCores(r.AdditionalCPU), metrics.FormatMemory(r.AdditionalMemory))
+	if collecting := r.CollectingContainers(); collecting > 0 {
+		fmt.Fprintf(&b, "%s%s without enough usage history yet[-]   ", dim, plural(collecting, "container"))
+	}
+	if a.exported != "" {
+		b.WriteString(ColoredText("Exported "+tview.Escape(a.exported), a.colors.Healthy))
+	} else {
+		fmt.Fprintf(&b, "%s%s[-] export as JSON, CSV and a YAML patch", ColorTag(a.colors.Header), a.keys.label("export"))
+	}
+	a.sizeInfo.SetText(b.String())
+}
+
+// exportSizing writes the right-sizing report to the current directory as
+// JSON, CSV and a YAML patch, named after the time of the metrics it was
+// computed from. A successful export clears the error of a failed one. It
+// runs with stateMu held and reports false outside the right-sizing view.
+func (a *App) exportSizing() bool {
+	if a.state.ViewMode != models.ViewModeRightsize {
+		return false
+	}
+	r, m := a.report, a.sizing.metrics
+	if r == nil || m == nil {
+		a.state.LastError = "no recommendations to export yet"
+		return true
+	}
+
+	base := "ktop-rightsizing-" + m.Timestamp.Format("20060102-150405")
+	writers := []struct {
+		ext   string
+		write func(f *os.File) error
+	}{
+		{".json", func(f *os.File) error { return r.WriteJSON(f) }},
+		{".csv", func(f *os.File) error { return r.WriteCSV(f) }},
+		{".yaml", func(f *os.File) error { return r.WritePatch(f) }},
+	}
+	for _, w := range writers {
+		f, err := os.Create(base + w.ext)
+		if err == nil {
+			err = w.write(f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			a.state.LastError = fmt.Sprintf("export failed: %v", err)
+			a.exported = ""
+			return true
+		}
+	}
+	a.state.LastError = ""
+	a.exported = base + ".{json,csv,yaml}"
+	return true
+}
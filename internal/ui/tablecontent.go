@@ -0,0 +1,196 @@
+package ui
+
+import (
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// tableContent is the virtual content of the nodes or pods table. It holds
+// the sorted items and renders a row only when tview draws it, so a large
+// table costs no more than its visible rows. Rendered cells are kept per
+// item key and updated only where their text changed, and the selection
+// follows the selected item when the order changes.
+type tableContent[T any] struct {
+	tview.TableContentReadOnly
+
+	app   *App
+	table *tview.Table
+	cols  []tableColumn[T]
+	key   func(*T) string
+
+	items  []T
+	rowCtx func(*T) rowContext
+	notice []*tview.TableCell // shown instead of items when set
+	header bool               // whether the header row is shown
+
+	headerCells []*tview.TableCell
+
+	// Rows rendered since the items were last set, and the ones rendered
+	// before that, by item key
+	rows, prevRows map[string][]*tview.TableCell
+
+	// Metrics and state the items were built from
+	metrics *models.ClusterMetrics
+	state   models.AppState
+}
+
+// newTableContent backs a table with virtual content listing items of
+// type T, identified by key
+func newTableContent[T any](a *App, table *tview.Table, cols []tableColumn[T], key func(*T) string) *tableContent[T] {
+	c := &tableContent[T]{app: a, table: table, key: key}
+	c.setColumns(cols)
+	table.SetContent(c)
+	return c
+}
+
+// nodeKey identifies a node across refreshes
+func nodeKey(n *models.Node) string {
+	return n.Name
+}
+
+// podKey identifies a pod across refreshes
+func podKey(p *models.Pod) string {
+	return p.Namespace + "/" + p.Name
+}
+
+// setColumns changes the columns and drops the rendered rows
+func (c *tableContent[T]) setColumns(cols []tableColumn[T]) {
+	c.cols = cols
+	c.rows, c.prevRows = make(map[string][]*tview.TableCell), nil
+	c.headerCells = make([]*tview.TableCell, len(cols))
+	for i, col := range cols {
+		c.headerCells[i] = tview.NewTableCell(col.Header).
+			SetSelectable(false).
+			SetAlign(col.Align)
+	}
+	c.metrics = nil
+}
+
+// changed records the metrics and state the table is about to show and
+// reports whether they differ from the ones shown. Refreshes in between
+// collections then leave the table alone.
+func (c *tableContent[T]) changed(m *models.ClusterMetrics, state models.AppState) bool {
+	if m != nil && m == c.metrics && state == c.state {
+		return false
+	}
+	c.metrics, c.state = m, state
+	return true
+}
+
+// invalidate makes the next update rebuild the items, for changes that
+// are not part of the metrics or the state
+func (c *tableContent[T]) invalidate() {
+	c.metrics = nil
+}
+
+// setItems shows items below the header row. If the selected item is
+// still listed, the selection moves with it and keeps its place on screen.
+func (c *tableContent[T]) setItems(items []T, rowCtx func(*T) rowContext) {
+	row, _ := c.table.GetSelection()
+	offset, _ := c.table.GetOffset()
+	selected := ""
+	if i := row - 1; c.notice == nil && i >= 0 && i < len(c.items) {
+		selected = c.key(&c.items[i])
+	}
+
+	c.items, c.rowCtx, c.notice, c.header = items, rowCtx, nil, true
+	c.prevRows, c.rows = c.rows, make(map[string][]*tview.TableCell, len(c.rows))
+
+	if selected == "" {
+		return
+	}
+	for i := range items {
+		if c.key(&items[i]) == selected {
+			c.table.SetOffset(max(0, offset+i+1-row), 0)
+			c.table.Select(i+1, 0)
+			return
+		}
+	}
+}
+
+// setNotice shows dimmed lines instead of items, below the header row if
+// header is set
+func (c *tableContent[T]) setNotice(header bool, lines ...string) {
+	c.items, c.header = nil, header
+	c.notice = make([]*tview.TableCell, len(lines))
+	for i, line := range lines {
+		c.notice[i] = tview.NewTableCell(line).
+			SetTextColor(c.app.colors.TextDim).
+			SetSelectable(false)
+	}
+}
+
+// GetRowCount implements tview.TableContent
+func (c *tableContent[T]) GetRowCount() int {
+	rows := len(c.items)
+	if c.notice != nil {
+		rows = len(c.notice)
+	}
+	if c.header {
+		rows++
+	}
+	return rows
+}
+
+// GetColumnCount implements tview.TableContent
+func (c *tableContent[T]) GetColumnCount() int {
+	if !c.header {
+		return 1
+	}
+	return max(len(c.cols), 1)
+}
+
+// GetCell implements tview.TableContent
+func (c *tableContent[T]) GetCell(row, column int) *tview.TableCell {
+	if c.header {
+		if row == 0 {
+			if column >= len(c.headerCells) {
+				return nil
+			}
+			return c.headerCells[column].SetTextColor(c.app.colors.Header)
+		}
+		row--
+	}
+	if c.notice != nil {
+		if column > 0 || row >= len(c.notice) {
+			return nil
+		}
+		return c.notice[row]
+	}
+	if row < 0 || row >= len(c.items) || column >= len(c.cols) {
+		return nil
+	}
+	return c.renderRow(row)[column]
+}
+
+// renderRow returns the cells of an item, rendering them once per
+// setItems and reusing the cells the item had before
+func (c *tableContent[T]) renderRow(i int) []*tview.TableCell {
+	item := &c.items[i]
+	key := c.key(item)
+	if cells, ok := c.rows[key]; ok {
+		return cells
+	}
+
+	cells := c.prevRows[key]
+	if len(cells) != len(c.cols) {
+		cells = make([]*tview.TableCell, len(c.cols))
+	}
+	ctx := c.rowCtx(item)
+	for j, col := range c.cols {
+		text, color := col.value(c.app, ctx, item)
+		if col.Width > 0 {
+			text = truncate(text, col.Width)
+		}
+		switch {
+		case cells[j] == nil:
+			cells[j] = tview.NewTableCell(text).SetAlign(col.Align)
+		case cells[j].Text != text:
+			cells[j].SetText(text)
+		}
+		cells[j].SetTextColor(color)
+	}
+	c.rows[key] = cells
+	return cells
+}
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlaak/ktop/internal/config"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// selectedPod returns the key of the pod selected in the pods table
+func selectedPod(t *testing.T, a *App) string {
+	t.Helper()
+	row, _ := a.podsTable.GetSelection()
+	if row < 1 || row > len(a.pods.items) {
+		t.Fatalf("selected row %d of %d pods", row, len(a.pods.items))
+	}
+	return podKey(&a.pods.items[row-1])
+}
+
+func TestTableSelectionFollowsItem(t *testing.T) {
+	h := newRenderHarness(t, nil, testMetrics())
+	h.press("Tab")
+	h.render()
+	h.press("Down")
+	h.render()
+	if got := selectedPod(t, h.app); got != "data/postgres-0" {
+		t.Fatalf("selected %s, want the second busiest pod", got)
+	}
+
+	// The next collection makes the selected pod the busiest one
+	m := testMetrics()
+	for i := range m.Pods {
+		if m.Pods[i].Name == "postgres-0" {
+			m.Pods[i].CPU = 20000
+		}
+	}
+	h.app.active.metrics = m
+	h.render()
+	if got := selectedPod(t, h.app); got != "data/postgres-0" {
+		t.Errorf("selection moved to %s, want it to follow data/postgres-0", got)
+	}
+	if row, _ := h.app.podsTable.GetSelection(); row != 1 {
+		t.Errorf("selected row %d, want 1", row)
+	}
+
+	// When the selected pod is gone, the selection stays on its row
+	m = testMetrics()
+	pods := m.Pods[:0]
+	for _, p := range m.Pods {
+		if p.Name != "postgres-0" {
+			pods = append(pods, p)
+		}
+	}
+	m.Pods = pods
+	h.app.active.metrics = m
+	h.render()
+	if row, _ := h.app.podsTable.GetSelection(); row != 1 {
+		t.Errorf("selected row %d after the pod left, want 1", row)
+	}
+}
+
+func TestTableRendersVisibleRows(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.TopPods = 5000
+	m := testMetrics()
+	for i := range 5000 {
+		m.Pods = append(m.Pods, testPod("load", fmt.Sprintf("pod-%d", i), models.PodStatusRunning, int64(i), mi, 0, "node-a"))
+	}
+	h := newRenderHarness(t, cfg, m)
+	h.render()
+
+	if rendered := len(h.app.pods.rows); rendered == 0 || rendered > screenHeight {
+		t.Errorf("rendered %d of %d rows, want only the visible ones", rendered, len(h.app.pods.items))
+	}
+
+	// Refreshes without a new collection keep the rendered cells
+	cell := h.app.pods.GetCell(1, 1)
+	h.render()
+	if h.app.pods.GetCell(1, 1) != cell {
+		t.Error("refresh without new metrics rendered the rows again")
+	}
+
+	// A new collection reuses the cells of rows that are still shown
+	next := *m
+	h.app.active.metrics = &next
+	h.render()
+	if h.app.pods.GetCell(1, 1) != cell {
+		t.Error("unchanged row got new cells")
+	}
+}
@@ -0,0 +1,243 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/nlaak/ktop/internal/config"
+)
+
+// builtinThemes maps theme names to their palettes
+var builtinThemes = map[string]func() Colors{
+	"dark":         DefaultColors,
+	"light":        lightColors,
+	"solarized":    solarizedColors,
+	"deuteranopia": deuteranopiaColors,
+	"monochrome":   monochromeColors,
+}
+
+// ThemeNames returns the names of the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme resolves the configured theme into a color palette. Custom
+// themes from the config file start from a built-in base and override
+// individual colors. NO_COLOR forces the monochrome theme.
+func LoadTheme(cfg *config.Config) (Colors, error) {
+	if os.Getenv("NO_COLOR") != "" {
+		return monochromeColors(), nil
+	}
+
+	name := cfg.Theme
+	if name == "" {
+		name = "dark"
+	}
+
+	custom, ok := cfg.Themes[name]
+	if !ok {
+		if base, ok := builtinThemes[name]; ok {
+			return base(), nil
+		}
+		return Colors{}, fmt.Errorf("unknown theme %q (built-in: %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+
+	baseName := custom.Base
+	if baseName == "" {
+		baseName = "dark"
+	}
+	base, ok := builtinThemes[baseName]
+	if !ok {
+		return Colors{}, fmt.Errorf("theme %q: unknown base theme %q", name, baseName)
+	}
+
+	colors := base()
+	fields := colors.fields()
+	for key, value := range custom.Colors {
+		field, ok := fields[key]
+		if !ok {
+			return Colors{}, fmt.Errorf("theme %q: unknown color %q", name, key)
+		}
+		color, err := parseColor(value)
+		if err != nil {
+			return Colors{}, fmt.Errorf("theme %q: color %q: %w", name, key, err)
+		}
+		*field = color
+	}
+	return colors, nil
+}
+
+// parseColor parses a "#rrggbb" hex value, a W3C color name or "default"
+func parseColor(value string) (tcell.Color, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "default" || value == "" {
+		return tcell.ColorDefault, nil
+	}
+	color := tcell.GetColor(value)
+	if color == tcell.ColorDefault {
+		return color, fmt.Errorf("invalid color %q (use #rrggbb or a color name)", value)
+	}
+	return color, nil
+}
+
+// fields maps config file color keys to the palette entries they set
+func (c *Colors) fields() map[string]*tcell.Color {
+	return map[string]*tcell.Color{
+		"healthy":      &c.Healthy,
+		"warning":      &c.Warning,
+		"critical":     &c.Critical,
+		"statusOK":     &c.StatusOK,
+		"statusBad":    &c.StatusBad,
+		"header":       &c.Header,
+		"border":       &c.Border,
+		"background":   &c.Background,
+		"text":         &c.Text,
+		"textDim":      &c.TextDim,
+		"system":       &c.System,
+		"selected":     &c.Selected,
+		"highlight":    &c.Highlight,
+		"podRunning":   &c.PodRunning,
+		"podPending":   &c.PodPending,
+		"podSucceeded": &c.PodSucceeded,
+		"podFailed":    &c.PodFailed,
+	}
+}
+
+// Fit maps every color onto the terminal's palette when it supports fewer
+// than 256 colors, and drops color entirely on monochrome terminals.
+func (c Colors) Fit(depth int) Colors {
+	if depth >= 256 {
+		return c
+	}
+	if depth < 8 {
+		return monochromeColors()
+	}
+
+	palette := make([]tcell.Color, depth)
+	for i := range palette {
+		palette[i] = tcell.PaletteColor(i)
+	}
+	for _, field := range c.fields() {
+		if field.IsRGB() {
+			*field = tcell.FindColor(*field, palette)
+		}
+	}
+	return c
+}
+
+// lightColors is tuned for terminals with a light background
+func lightColors() Colors {
+	return Colors{
+		Healthy:  tcell.NewHexColor(0x007f00),
+		Warning:  tcell.NewHexColor(0xaf5f00),
+		Critical: tcell.NewHexColor(0xd70000),
+
+		StatusOK:  tcell.NewHexColor(0x007f00),
+		StatusBad: tcell.NewHexColor(0xd70000),
+
+		Header:     tcell.NewHexColor(0x00008b),
+		Border:     tcell.NewHexColor(0x444444),
+		Background: tcell.ColorDefault,
+		Text:       tcell.NewHexColor(0x1c1c1c),
+		TextDim:    tcell.NewHexColor(0x6c6c6c),
+		System:     tcell.NewHexColor(0x005f87),
+		Selected:   tcell.NewHexColor(0xbcd4ff),
+		Highlight:  tcell.NewHexColor(0x8700af),
+
+		PodRunning:   tcell.NewHexColor(0x007f00),
+		PodPending:   tcell.NewHexColor(0xaf5f00),
+		PodSucceeded: tcell.NewHexColor(0x005fd7),
+		PodFailed:    tcell.NewHexColor(0xd70000),
+	}
+}
+
+// solarizedColors uses the Solarized dark palette
+func solarizedColors() Colors {
+	const (
+		base01  = 0x586e75
+		base0   = 0x839496
+		base1   = 0x93a1a1
+		yellow  = 0xb58900
+		orange  = 0xcb4b16
+		red     = 0xdc322f
+		magenta = 0xd33682
+		blue    = 0x268bd2
+		cyan    = 0x2aa198
+		green   = 0x859900
+		base02  = 0x073642
+	)
+	return Colors{
+		Healthy:  tcell.NewHexColor(green),
+		Warning:  tcell.NewHexColor(yellow),
+		Critical: tcell.NewHexColor(red),
+
+		StatusOK:  tcell.NewHexColor(green),
+		StatusBad: tcell.NewHexColor(red),
+
+		Header:     tcell.NewHexColor(yellow),
+		Border:     tcell.NewHexColor(base01),
+		Background: tcell.ColorDefault,
+		Text:       tcell.NewHexColor(base1),
+		TextDim:    tcell.NewHexColor(base0),
+		System:     tcell.NewHexColor(cyan),
+		Selected:   tcell.NewHexColor(base02),
+		Highlight:  tcell.NewHexColor(magenta),
+
+		PodRunning:   tcell.NewHexColor(green),
+		PodPending:   tcell.NewHexColor(orange),
+		PodSucceeded: tcell.NewHexColor(blue),
+		PodFailed:    tcell.NewHexColor(red),
+	}
+}
+
+// deuteranopiaColors avoids red/green pairs, using the Okabe-Ito palette
+func deuteranopiaColors() Colors {
+	const (
+		blue      = 0x0072b2
+		skyBlue   = 0x56b4e9
+		orange    = 0xe69f00
+		vermilion = 0xd55e00
+		yellow    = 0xf0e442
+		purple    = 0xcc79a7
+	)
+	return Colors{
+		Healthy:  tcell.NewHexColor(skyBlue),
+		Warning:  tcell.NewHexColor(orange),
+		Critical: tcell.NewHexColor(vermilion),
+
+		StatusOK:  tcell.NewHexColor(skyBlue),
+		StatusBad: tcell.NewHexColor(vermilion),
+
+		Header:     tcell.NewHexColor(yellow),
+		Border:     tcell.ColorWhite,
+		Background: tcell.ColorDefault,
+		Text:       tcell.ColorWhite,
+		TextDim:    tcell.ColorGray,
+		System:     tcell.NewHexColor(purple),
+		Selected:   tcell.NewHexColor(blue),
+		Highlight:  tcell.NewHexColor(yellow),
+
+		PodRunning:   tcell.NewHexColor(skyBlue),
+		PodPending:   tcell.NewHexColor(orange),
+		PodSucceeded: tcell.NewHexColor(blue),
+		PodFailed:    tcell.NewHexColor(vermilion),
+	}
+}
+
+// monochromeColors uses the terminal's default colors throughout
+func monochromeColors() Colors {
+	c := Colors{}
+	for _, field := range c.fields() {
+		*field = tcell.ColorDefault
+	}
+	return c
+}
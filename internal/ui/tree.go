@@ -0,0 +1,288 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/nlaak/ktop/internal/metrics"
+	"github.com/nlaak/ktop/internal/models"
+)
+
+// treeDepth is the level of a tree row
+type treeDepth int
+
+const (
+	treeNode treeDepth = iota
+	treePod
+	treeContainer
+)
+
+// treeRow is one row of the tree view: a node, a pod on it, or one of
+// the pod's containers. Node and pod rows roll up the usage of their
+// children, so a branch shows what it costs even when collapsed.
+type treeRow struct {
+	key      string
+	depth    treeDepth
+	name     string
+	status   string
+	children int  // pods of a node, containers of a pod
+	expanded bool // whether the children are listed below the row
+
+	cpu      int64 // millicores
+	memory   int64 // bytes
+	restarts int32
+
+	node *models.Node // node the row is on; nil when it is unknown
+}
+
+// unscheduledNode names the branch of pods that are not on a node yet
+const unscheduledNode = "(unscheduled)"
+
+// treeKey identifies a tree row across refreshes
+func treeKey(r *treeRow) string {
+	return r.key
+}
+
+// percentOfNode returns v as a percentage of the node's capacity, or -1
+// when the capacity is unknown
+func percentOfNode(v, capacity int64) float64 {
+	if capacity == 0 {
+		return -1
+	}
+	return float64(v) / float64(capacity) * 100
+}
+
+// formatShare formats a percentage of a node's capacity
+func formatShare(percent float64) string {
+	if percent < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", percent)
+}
+
+// treeColumns are the columns of the tree view. Percentages are shares
+// of the capacity of the node a row is on.
+var treeColumns = []tableColumn[treeRow]{
+	{Name: "name", Header: "NAME", Width: 60, value: func(a *App, _ rowContext, r *treeRow) (string, tcell.Color) {
+		marker := "  "
+		if r.children > 0 {
+			marker = "▸ "
+			if r.expanded {
+				marker = "▾ "
+			}
+		}
+		color := a.colors.Text
+		if r.depth == treeContainer {
+			color = a.colors.TextDim
+		}
+		return strings.Repeat("  ", int(r.depth)) + marker + r.name, color
+	}},
+	{Name: "status", Header: "STATUS", value: func(a *App, _ rowContext, r *treeRow) (string, tcell.Color) {
+		switch r.depth {
+		case treeNode:
+			if r.node == nil {
+				return r.status, a.colors.TextDim
+			}
+			return r.status, a.colors.GetNodeStatusColor(models.NodeStatus(r.status))
+		case treePod:
+			return r.status, a.colors.GetPodStatusColor(models.PodStatus(r.status))
+		}
+		if r.status == "Running" || r.status == "Completed" {
+			return r.status, a.colors.Healthy
+		}
+		return r.status, a.colors.Warning
+	}},
+	{Name: "cpu", Header: "CPU", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *treeRow) (string, tcell.Color) {
+		return metrics.FormatCPU(r.cpu), a.colors.Text
+	}},
+	{Name: "cpu%", Header: "CPU%", Align: tview.AlignRight, value: func(a *App, ctx rowContext, r *treeRow) (string, tcell.Color) {
+		if r.node == nil {
+			return "-", a.colors.TextDim
+		}
+		percent := percentOfNode(r.cpu, r.node.CPU.Capacity)
+		return formatShare(percent), a.colors.GetResourceColor(percent, ctx.th.CPU)
+	}},
+	{Name: "memory", Header: "MEMORY", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *treeRow) (string, tcell.Color) {
+		return metrics.FormatMemory(r.memory), a.colors.Text
+	}},
+	{Name: "mem%", Header: "MEM%", Align: tview.AlignRight, value: func(a *App, ctx rowContext, r *treeRow) (string, tcell.Color) {
+		if r.node == nil {
+			return "-", a.colors.TextDim
+		}
+		percent := percentOfNode(r.memory, r.node.Memory.Capacity)
+		return formatShare(percent), a.colors.GetResourceColor(percent, ctx.th.Memory)
+	}},
+	{Name: "contents", Header: "CONTENTS", Align: tview.AlignRight, value: func(a *App, _ rowContext, r *treeRow) (string, tcell.Color) {
+		switch r.depth {
+		case treeNode:
+			return plural(r.children, "pod"), a.colors.TextDim
+		case treePod:
+			return plural(r.children, "container"), a.colors.TextDim
+		}
+		return "", a.colors.TextDim
+	}},
+	{Name: "restarts", Header: "RESTARTS", Align: tview.AlignRight, value: func(a *App, ctx rowContext, r *treeRow) (string, tcell.Color) {
+		return fmt.Sprintf("%d", r.restarts), a.colors.GetRestartColor(r.restarts, ctx.th.Restarts)
+	}},
+}
+
+// plural formats a count of things, e.g. "1 pod" or "3 pods"
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
+
+// buildTree lists the nodes in order, each followed by its pods when it
+// is expanded, and each expanded pod by its containers. Pods on nodes that
+// are not listed, e.g. because nodes cannot be listed, get a branch of
+// their own unless extra is false.
+func buildTree(nodes []models.Node, pods []models.Pod, known map[string]bool, extra bool, expanded map[string]bool) []treeRow {
+	byNode := make(map[string][]*models.Pod)
+	var others []string
+	for i := range pods {
+		name := pods[i].NodeName
+		if name == "" {
+			name = unscheduledNode
+		}
+		if _, seen := byNode[name]; !seen && !known[name] {
+			others = append(others, name)
+		}
+		byNode[name] = append(byNode[name], &pods[i])
+	}
+
+	var rows []treeRow
+	addNode := func(name, status string, node *models.Node) {
+		nodePods := byNode[name]
+		key := "node/" + name
+		row := treeRow{key: key, name: name, status: status, children: len(nodePods), expanded: expanded[key], node: node}
+		for _, p := range nodePods {
+			row.cpu += p.CPU
+			row.memory += p.Memory
+			row.restarts += p.RestartCount
+		}
+		rows = append(rows, row)
+		if !row.expanded {
+			return
+		}
+		for _, p := range nodePods {
+			key := "pod/" + p.Namespace + "/" + p.Name
+			row := treeRow{
+				key: key, depth: treePod, name: p.Namespace + "/" + p.Name, status: string(p.Status),
+				children: len(p.Containers), expanded: expanded[key],
+				cpu: p.CPU, memory: p.Memory, restarts: p.RestartCount, node: node,
+			}
+			rows = append(rows, row)
+			if !row.expanded {
+				continue
+			}
+			for _, c := range p.Containers {
+				rows = append(rows, treeRow{
+					key: key + "/" + c.Name, depth: treeContainer, name: c.Name, status: c.State,
+					cpu: c.CPU, memory: c.Memory, restarts: c.RestartCount, node: node,
+				})
+			}
+		}
+	}
+
+	for i := range nodes {
+		addNode(nodes[i].Name, string(nodes[i].Status), &nodes[i])
+	}
+	if extra {
+		for _, name := range others {
+			addNode(name, "-", nil)
+		}
+	}
+	return rows
+}
+
+// updateTreeTable updates the tree view when the metrics or the state
+// changed since it was last updated. Nodes and pods are filtered and
+// sorted like in their own tables, without the top pods limit.
+func (a *App) updateTreeTable(m *models.ClusterMetrics, state models.AppState) {
+	if state.ViewMode != models.ViewModeTree || !a.tree.changed(m, state) {
+		return
+	}
+
+	nodeSort, podSort := "↓", "↓"
+	if state.NodeSortAsc {
+		nodeSort = "↑"
+	}
+	if state.PodSortAsc {
+		podSort = "↑"
+	}
+	a.treeTable.SetTitle(fmt.Sprintf(" TREE (nodes by %s %s, pods by %s %s) %s%s",
+		state.NodeSortField.String(), nodeSort, state.PodSortField.String(), podSort,
+		filterTitle(state.NodeFilter), filterTitle(state.PodFilter)))
+
+	if m == nil || (len(m.Nodes) == 0 && len(m.Pods) == 0) {
+		a.tree.setNotice(true, "No nodes found")
+		return
+	}
+
+	nodeFilter, _ := metrics.ParseFilter(state.NodeFilter, metrics.FilterKindNodes)
+	nodes := make([]models.Node, len(m.Nodes))
+	copy(nodes, m.Nodes)
+	nodes = nodeFilter.Nodes(nodes)
+	metrics.SortNodes(nodes, state.NodeSortField, state.NodeSortAsc)
+
+	showSystem := state.ShowSystem || len(m.Namespaces) > 0
+	pods := metrics.FilterPods(m.Pods, state.NamespaceFilter, showSystem)
+	podFilter, _ := metrics.ParseFilter(state.PodFilter, metrics.FilterKindPods)
+	pods = podFilter.Pods(pods)
+	metrics.SortPods(pods, state.PodSortField, state.PodSortAsc)
+
+	known := make(map[string]bool, len(m.Nodes))
+	for _, n := range m.Nodes {
+		known[n.Name] = true
+	}
+	rows := buildTree(nodes, pods, known, nodeFilter == nil, a.expanded)
+	if len(rows) == 0 {
+		a.tree.setNotice(true, "No nodes match the filter")
+		return
+	}
+
+	a.tree.setItems(rows, func(r *treeRow) rowContext {
+		if r.node == nil {
+			return rowContext{th: a.config.Thresholds}
+		}
+		return rowContext{
+			th:         a.config.Thresholds.ForLabels(r.node.Labels),
+			nodeLabels: r.node.Labels,
+		}
+	})
+}
+
+// expandTreeRow expands or collapses the selected branch of the tree.
+// Collapsing a row without an open branch selects its parent instead.
+func (a *App) expandTreeRow(expand bool) {
+	row, _ := a.treeTable.GetSelection()
+	items := a.tree.items
+	i := row - 1
+	if i < 0 || i >= len(items) {
+		return
+	}
+	r := items[i]
+	if !expand && !r.expanded {
+		for j := i - 1; j >= 0; j-- {
+			if items[j].depth < r.depth {
+				a.treeTable.Select(j+1, 0)
+				return
+			}
+		}
+		return
+	}
+	if r.children == 0 || r.expanded == expand {
+		return
+	}
+	if expand {
+		a.expanded[r.key] = true
+	} else {
+		delete(a.expanded, r.key)
+	}
+	a.tree.invalidate()
+}